@@ -5,9 +5,13 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -15,14 +19,25 @@ import (
 	urlpkg "net/url"
 	"os"
 	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/quic-go/quic-go"
 	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http/httpguts"
 	"golang.org/x/net/publicsuffix"
 
 	"github.com/imroc/req/v3/http2"
+	"github.com/imroc/req/v3/http3"
+	"github.com/imroc/req/v3/internal/compress"
 	"github.com/imroc/req/v3/internal/header"
+	h2internal "github.com/imroc/req/v3/internal/http2"
+	h3internal "github.com/imroc/req/v3/internal/http3"
+	"github.com/imroc/req/v3/internal/transport"
 	"github.com/imroc/req/v3/internal/util"
 
 	"github.com/google/go-querystring/query"
@@ -61,7 +76,9 @@ type Client struct {
 	jsonUnmarshal           func(data []byte, v any) error
 	xmlMarshal              func(v any) ([]byte, error)
 	xmlUnmarshal            func(data []byte, v any) error
-	multipartBoundaryFunc   func() string
+	multipartBoundaryFunc   func() (string, error)
+	multipartBoundaryGen    func(r io.Reader) (string, error)
+	multipartBoundaryRand   io.Reader
 	outputDirectory         string
 	scheme                  string
 	log                     Logger
@@ -75,6 +92,40 @@ type Client struct {
 	responseBodyTransformer func(rawBody []byte, req *Request, resp *Response) (transformedBody []byte, err error)
 	resultStateCheckFunc    func(resp *Response) ResultState
 	onError                 ErrorHook
+
+	impersonateChromeVersion  int
+	impersonateFirefoxVersion int
+	profileHeaderKeys         []string      // the common headers set by the applied profile
+	profilePingInterval       time.Duration // the http2 ping interval set by the applied profile
+	impersonatePlatform       string
+	impersonateLanguages      []string
+	impersonateClientHints    *ClientHints
+	impersonateFetchMode      string
+	disableImpersonateTE      bool
+	fetchModeRestore          *fetchModeRestore
+	clientHintHeaders         map[string]string
+	clientHintsAuto           bool
+	acceptCH                  *sync.Map // origin -> client hints requested by Accept-CH
+	originHeaderOrders        *sync.Map // origin -> header order
+	impersonateRotation       []string
+	impersonateLogger         func(ImpersonateLogEntry)
+	proxySelector             func(r *Request) *urlpkg.URL
+	tlsSeedRand               *seededRand
+	tlsSessionCache           utls.ClientSessionCache
+	alpn                      []string
+	echConfigList             []byte
+	greaseECH                 *bool
+	greaseSeed                *int64
+	clientHelloObserver       func(raw []byte)
+	tlsHandshakeObserver      func(state utls.ConnectionState)
+	responseHeaderOrder       bool
+	tlsFingerprintID          utls.ClientHelloID
+	tlsFingerprintSpec        func() (*utls.ClientHelloSpec, error)
+	impersonateClients        *sync.Map
+	headerOrderFunc           func(r *Request) []string
+	// headerOrder is the order set by SetCommonHeaderOrder, it's nil if the
+	// order is computed by the function set by SetCommonHeaderOrderFunc.
+	headerOrder []string
 }
 
 type ErrorHook func(client *Client, req *Request, resp *Response, err error)
@@ -249,10 +300,35 @@ func (c *Client) SetCommonFormData(data map[string]string) *Client {
 // Boundary delimiter may only contain certain ASCII characters, and must be
 // non-empty and at most 70 bytes long (see RFC 2046, Section 5.1.1).
 func (c *Client) SetMultipartBoundaryFunc(fn func() string) *Client {
+	if fn == nil {
+		c.multipartBoundaryFunc = nil
+		return c
+	}
+	c.multipartBoundaryFunc = func() (string, error) {
+		return fn(), nil
+	}
+	return c
+}
+
+// SetMultipartBoundaryFuncE is similar to SetMultipartBoundaryFunc, but the
+// function can return an error, which will be returned to the caller when
+// sending the "multipart/form-data" request.
+func (c *Client) SetMultipartBoundaryFuncE(fn func() (string, error)) *Client {
 	c.multipartBoundaryFunc = fn
 	return c
 }
 
+// SetMultipartBoundaryRand set the source of randomness used to generate the
+// boundary delimiters for "multipart/form-data" requests, which is useful to
+// get reproducible boundaries in tests by injecting a seeded reader, the default
+// is crypto/rand. It takes no effect if a customized boundary function is set
+// by SetMultipartBoundaryFunc, and the error of reading from r will be returned
+// to the caller when sending the "multipart/form-data" request.
+func (c *Client) SetMultipartBoundaryRand(r io.Reader) *Client {
+	c.multipartBoundaryRand = r
+	return c
+}
+
 // SetBaseURL set the default base URL, will be used if request URL is
 // a relative URL.
 func (c *Client) SetBaseURL(u string) *Client {
@@ -274,6 +350,7 @@ func (c *Client) SetCertFromFile(certFile, keyFile string) *Client {
 		c.log.Errorf("failed to load client cert: %v", err)
 		return c
 	}
+	c.resetImpersonateClients()
 	config := c.GetTLSClientConfig()
 	config.Certificates = append(config.Certificates, cert)
 	return c
@@ -281,6 +358,7 @@ func (c *Client) SetCertFromFile(certFile, keyFile string) *Client {
 
 // SetCerts set client certificates.
 func (c *Client) SetCerts(certs ...tls.Certificate) *Client {
+	c.resetImpersonateClients()
 	config := c.GetTLSClientConfig()
 	config.Certificates = append(config.Certificates, certs...)
 	return c
@@ -296,12 +374,14 @@ func (c *Client) appendRootCertData(data []byte) {
 
 // SetRootCertFromString set root certificates from string.
 func (c *Client) SetRootCertFromString(pemContent string) *Client {
+	c.resetImpersonateClients()
 	c.appendRootCertData([]byte(pemContent))
 	return c
 }
 
 // SetRootCertsFromFile set root certificates from files.
 func (c *Client) SetRootCertsFromFile(pemFiles ...string) *Client {
+	c.resetImpersonateClients()
 	for _, pemFile := range pemFiles {
 		rootPemData, err := os.ReadFile(pemFile)
 		if err != nil {
@@ -355,12 +435,14 @@ func (c *Client) SetRedirectPolicy(policies ...RedirectPolicy) *Client {
 //
 // This is unrelated to the similarly named TCP keep-alives.
 func (c *Client) DisableKeepAlives() *Client {
+	c.resetImpersonateClients()
 	c.Transport.DisableKeepAlives = true
 	return c
 }
 
 // EnableKeepAlives enables HTTP keep-alives (enabled by default).
 func (c *Client) EnableKeepAlives() *Client {
+	c.resetImpersonateClients()
 	c.Transport.DisableKeepAlives = false
 	return c
 }
@@ -396,6 +478,38 @@ func (c *Client) DisableAutoDecompress() *Client {
 	return c
 }
 
+// SetAcceptEncoding set the accept-encoding header advertised by the requests
+// fired from the client, e.g. SetAcceptEncoding("gzip", "deflate", "br", "zstd")
+// like Chrome and Firefox, and enables the automatic decompression, so the
+// responses of all the advertised encodings are transparently decoded. The
+// encodings whose decoder is not compiled in (br and zstd are excluded with the
+// req_nobrotli and req_nozstd build tags) are not advertised. The header is
+// removed if no encoding is advertised, in which case the transport requests
+// and decodes gzip only, unless DisableCompression is called.
+func (c *Client) SetAcceptEncoding(encodings ...string) *Client {
+	var advertised []string
+	for _, encoding := range encodings {
+		encoding = strings.TrimSpace(encoding)
+		name, _, _ := strings.Cut(encoding, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch {
+		case name == "identity" || compress.IsSupported(name):
+			advertised = append(advertised, encoding)
+		case !compress.IsKnown(name):
+			c.log.Errorf("unsupported content coding %q", name)
+		}
+	}
+	if len(advertised) == 0 {
+		if c.Headers != nil {
+			c.Headers.Del("Accept-Encoding")
+		}
+		return c
+	}
+	c.SetCommonHeader("Accept-Encoding", strings.Join(advertised, ", "))
+	c.Transport.AutoDecompression = true
+	return c
+}
+
 // SetTLSClientConfig set the TLS client config. Be careful! Usually
 // you don't need this, you can directly set the tls configuration with
 // methods like EnableInsecureSkipVerify, SetCerts etc. Or you can call
@@ -403,6 +517,7 @@ func (c *Client) DisableAutoDecompress() *Client {
 // overwriting some important configurations, such as not setting NextProtos
 // will not use http2 by default.
 func (c *Client) SetTLSClientConfig(conf *tls.Config) *Client {
+	c.resetImpersonateClients()
 	c.TLSClientConfig = conf
 	return c
 }
@@ -410,6 +525,7 @@ func (c *Client) SetTLSClientConfig(conf *tls.Config) *Client {
 // EnableInsecureSkipVerify enable send https without verifying
 // the server's certificates (disabled by default).
 func (c *Client) EnableInsecureSkipVerify() *Client {
+	c.resetImpersonateClients()
 	c.GetTLSClientConfig().InsecureSkipVerify = true
 	return c
 }
@@ -417,6 +533,7 @@ func (c *Client) EnableInsecureSkipVerify() *Client {
 // DisableInsecureSkipVerify disable send https without verifying
 // the server's certificates (disabled by default).
 func (c *Client) DisableInsecureSkipVerify() *Client {
+	c.resetImpersonateClients()
 	c.GetTLSClientConfig().InsecureSkipVerify = false
 	return c
 }
@@ -702,6 +819,29 @@ func (c *Client) EnableDumpAllWithoutBody() *Client {
 	return c
 }
 
+// EnableDumpTLS enable dump for requests fired from the client, including the
+// TLS ClientHello of the new connections, which is dumped with the server name,
+// the alpn protocols, the JA3 and JA4 fingerprints and the hex dump of the TLS
+// records, so it can be compared with the packets captured from the browser.
+func (c *Client) EnableDumpTLS() *Client {
+	o := c.getDumpOptions()
+	o.TLS = true
+	c.EnableDumpAll()
+	return c
+}
+
+// EnableDumpHTTP2Frames enable dump for requests fired from the client,
+// including the http2 frames sent (prefixed with "> ") and received (prefixed
+// with "< ") on the connections, e.g. the SETTINGS, WINDOW_UPDATE and PRIORITY
+// frames sent after the connection preface, with the frame type, the flags and
+// the decoded settings and priorities.
+func (c *Client) EnableDumpHTTP2Frames() *Client {
+	o := c.getDumpOptions()
+	o.HTTP2Frames = true
+	c.EnableDumpAll()
+	return c
+}
+
 // EnableDumpEachRequest enable dump at the request-level for each request, and only
 // temporarily stores the dump content in memory, call Response.Dump() to get the
 // dump content when needed.
@@ -888,8 +1028,38 @@ func (c *Client) SetCommonHeaders(hdrs map[string]string) *Client {
 	return c
 }
 
+// SetPriorityHeader set the RFC 9218 priority header for requests fired from
+// the client, e.g. "u=0, i" for SetPriorityHeader(0, true), which is sent by
+// modern browsers instead of the http2 PRIORITY frames. The urgency must be
+// between 0 (highest) and 7 (lowest), the header is not changed otherwise.
+// Note the header is sent at the position of "priority" in the header order,
+// which is the last one in the order of the built-in browser profiles.
+func (c *Client) SetPriorityHeader(urgency int, incremental bool) *Client {
+	if urgency < 0 || urgency > 7 {
+		c.log.Errorf("invalid priority urgency %d, must be between 0 and 7", urgency)
+		return c
+	}
+	return c.SetCommonHeader("priority", formatPriorityHeader(urgency, incremental))
+}
+
+// formatPriorityHeader formats the value of the RFC 9218 priority header.
+func formatPriorityHeader(urgency int, incremental bool) string {
+	v := "u=" + strconv.Itoa(urgency)
+	if incremental {
+		v += ", i"
+	}
+	return v
+}
+
+// GetCommonHeaders returns a copy of the headers for requests fired from the
+// client, which is useful to inspect the headers set by ImpersonateXXX.
+func (c *Client) GetCommonHeaders() http.Header {
+	return c.Headers.Clone()
+}
+
 // SetCommonHeader set a header for requests fired from the client.
 func (c *Client) SetCommonHeader(key, value string) *Client {
+	c.resetImpersonateClients()
 	if c.Headers == nil {
 		c.Headers = make(http.Header)
 	}
@@ -901,6 +1071,7 @@ func (c *Client) SetCommonHeader(key, value string) *Client {
 // the client which key is a non-canonical key (keep case unchanged),
 // only valid for HTTP/1.1.
 func (c *Client) SetCommonHeaderNonCanonical(key, value string) *Client {
+	c.resetImpersonateClients()
 	if c.Headers == nil {
 		c.Headers = make(http.Header)
 	}
@@ -919,7 +1090,13 @@ func (c *Client) SetCommonHeadersNonCanonical(hdrs map[string]string) *Client {
 }
 
 // SetCommonHeaderOrder set the order of the http header requests fired from the
-// client (case-insensitive).
+// client (case-insensitive), the order set by Request.SetHeaderOrder takes precedence.
+// The header names are normalized to lowercase, and the duplicated ones are
+// removed with a warning, use SetCommonHeaderOrderStrict to get an error instead.
+// The headers added automatically (host, connection, content-length, cookie,
+// user-agent and accept-encoding) are ordered as well, the headers which are not
+// in the order are sent after the ordered ones in alphabetical order, except
+// the http1 host header which is sent first if it's not in the order.
 // For example:
 //
 //	client.R().SetCommonHeaderOrder(
@@ -929,20 +1106,167 @@ func (c *Client) SetCommonHeadersNonCanonical(hdrs map[string]string) *Client {
 //	    "accept-encoding",
 //	).Get(url
 func (c *Client) SetCommonHeaderOrder(keys ...string) *Client {
-	c.Transport.WrapRoundTripFunc(func(rt http.RoundTripper) HttpRoundTripFunc {
-		return func(req *http.Request) (resp *http.Response, err error) {
-			if req.Header == nil {
-				req.Header = make(http.Header)
-			}
-			req.Header[HeaderOderKey] = keys
-			return rt.RoundTrip(req)
+	keys, duplicates := normalizeHeaderOrder(keys)
+	if len(duplicates) > 0 {
+		c.log.Warnf("ignore duplicated headers %v in SetCommonHeaderOrder", duplicates)
+	}
+	return c.setCommonHeaderOrder(keys)
+}
+
+// SetCommonHeaderOrderStrict is similar to SetCommonHeaderOrder, but returns an
+// error and leaves the order unchanged if any header name is invalid or duplicated.
+func (c *Client) SetCommonHeaderOrderStrict(keys ...string) error {
+	for _, key := range keys {
+		if !httpguts.ValidHeaderFieldName(key) {
+			return fmt.Errorf("invalid header name %q in header order", key)
 		}
+	}
+	keys, duplicates := normalizeHeaderOrder(keys)
+	if len(duplicates) > 0 {
+		return fmt.Errorf("duplicated headers %v in header order", duplicates)
+	}
+	c.setCommonHeaderOrder(keys)
+	return nil
+}
+
+func (c *Client) setCommonHeaderOrder(keys []string) *Client {
+	if len(keys) == 0 {
+		return c.SetCommonHeaderOrderFunc(nil)
+	}
+	c.SetCommonHeaderOrderFunc(func(r *Request) []string {
+		return keys
 	})
+	c.headerOrder = keys
 	return c
 }
 
+// normalizeHeaderOrder returns the lowercase header names without duplicates,
+// and the duplicated ones.
+func normalizeHeaderOrder(keys []string) (normalized, duplicates []string) {
+	seen := make(map[string]bool, len(keys))
+	normalized = make([]string, 0, len(keys))
+	for _, key := range keys {
+		key = strings.ToLower(key)
+		if seen[key] {
+			duplicates = append(duplicates, key)
+			continue
+		}
+		seen[key] = true
+		normalized = append(normalized, key)
+	}
+	return
+}
+
+// SetCommonHeaderOrderFunc set the function which computes the order of the http
+// header (case-insensitive) for each request fired from the client at send time,
+// e.g. vary the order between requests, or compute the order by the request method.
+// The order set by Request.SetHeaderOrder takes precedence, and the pseudo header
+// order is not affected, see SetCommonPseudoHeaderOder.
+func (c *Client) SetCommonHeaderOrderFunc(fn func(r *Request) []string) *Client {
+	c.headerOrderFunc = fn
+	c.headerOrder = nil
+	return c
+}
+
+// SetCommonHeaderCasing set the case of the header names sent over HTTP/1.1
+// for requests fired from the client, replacing the previous one, see
+// Request.SetHeaderCasing for details. Pass nil to remove it.
+func (c *Client) SetCommonHeaderCasing(casing map[string]string) *Client {
+	c.resetImpersonateClients()
+	names, err := headerCasingNames(casing)
+	if err != nil {
+		c.log.Errorf("failed to set common header casing: %v", err)
+		return c
+	}
+	if len(names) == 0 {
+		delete(c.Headers, HeaderCasingKey)
+		return c
+	}
+	if c.Headers == nil {
+		c.Headers = make(http.Header)
+	}
+	c.Headers[HeaderCasingKey] = names
+	return c
+}
+
+// EnableResponseHeaderOrder enable recording the order of the response
+// headers, which is returned by Response.HeaderOrder, e.g. to relay the
+// responses faithfully.
+func (c *Client) EnableResponseHeaderOrder() *Client {
+	c.responseHeaderOrder = true
+	return c
+}
+
+// DisableResponseHeaderOrder disable recording the order of the response
+// headers (disabled by default).
+func (c *Client) DisableResponseHeaderOrder() *Client {
+	c.responseHeaderOrder = false
+	return c
+}
+
+// SetHeaderOrderForOrigin set the order of the http header (case-insensitive)
+// for the requests to the origin, e.g. "https://example.com", which overrides
+// the order set by SetCommonHeaderOrder and SetCommonHeaderOrderFunc, e.g. to
+// send the header order of the fetch requests of the site's own javascript
+// rather than the one of the navigation requests. The requests to the other
+// origins still use the common order, pass an empty order to remove the
+// override. The overrides are kept when impersonating other browsers, and the
+// order set by Request.SetHeaderOrder takes precedence. It's safe to call it
+// while the client is sending requests.
+func (c *Client) SetHeaderOrderForOrigin(origin string, order []string) *Client {
+	u, err := urlpkg.Parse(origin)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		c.log.Errorf("invalid origin %q, should be like https://example.com", origin)
+		return c
+	}
+	if len(order) == 0 {
+		c.originHeaderOrders.Delete(urlOrigin(u))
+		return c
+	}
+	keys, duplicates := normalizeHeaderOrder(order)
+	if len(duplicates) > 0 {
+		c.log.Warnf("ignore duplicated headers %v in SetHeaderOrderForOrigin", duplicates)
+	}
+	c.originHeaderOrders.Store(urlOrigin(u), keys)
+	return c
+}
+
+// requestHeaderOrder returns the header order of the request, which is the
+// order of the request origin set by SetHeaderOrderForOrigin, or the common
+// order if not set.
+func (c *Client) requestHeaderOrder(r *Request) []string {
+	if r.URL != nil {
+		if order, ok := c.originHeaderOrders.Load(urlOrigin(r.URL)); ok {
+			return order.([]string)
+		}
+	}
+	headerOrderFunc := c.headerOrderFunc
+	if r.impersonateClient != nil {
+		headerOrderFunc = r.impersonateClient.headerOrderFunc
+	}
+	if headerOrderFunc == nil {
+		return nil
+	}
+	return headerOrderFunc(r)
+}
+
+// urlOrigin returns the lowercase origin of the url without the default port,
+// e.g. "https://example.com".
+func urlOrigin(u *urlpkg.URL) string {
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Host)
+	if port := u.Port(); (scheme == "https" && port == "443") || (scheme == "http" && port == "80") {
+		host = strings.ToLower(u.Hostname())
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+	}
+	return scheme + "://" + host
+}
+
 // SetCommonPseudoHeaderOder set the order of the pseudo http header requests fired
-// from the client (case-insensitive).
+// from the client (case-insensitive), the order set by Request.SetPseudoHeaderOrder
+// takes precedence.
 // Note this is only valid for http2 and http3.
 // For example:
 //
@@ -952,44 +1276,392 @@ func (c *Client) SetCommonHeaderOrder(keys ...string) *Client {
 //	    ":path",
 //	    ":method",
 //	)
+//
+// The order should be a permutation of :method, :scheme, :path and :authority,
+// otherwise the error is logged and the order is unchanged, pass no keys to
+// remove the order.
 func (c *Client) SetCommonPseudoHeaderOder(keys ...string) *Client {
-	c.Transport.WrapRoundTripFunc(func(rt http.RoundTripper) HttpRoundTripFunc {
-		return func(req *http.Request) (resp *http.Response, err error) {
-			if req.Header == nil {
-				req.Header = make(http.Header)
-			}
-			req.Header[PseudoHeaderOderKey] = keys
-			return rt.RoundTrip(req)
-		}
-	})
+	keys, err := validatePseudoHeaderOrder(keys)
+	if err != nil {
+		c.log.Errorf("%v", err)
+		return c
+	}
+	c.Transport.SetPseudoHeaderOrder(keys...)
 	return c
 }
 
+// SetCommonPseudoHeaderOrderStrict is similar to SetCommonPseudoHeaderOder, but
+// returns the error if any pseudo header is unknown, duplicated or missing.
+func (c *Client) SetCommonPseudoHeaderOrderStrict(keys ...string) error {
+	keys, err := validatePseudoHeaderOrder(keys)
+	if err != nil {
+		return err
+	}
+	c.Transport.SetPseudoHeaderOrder(keys...)
+	return nil
+}
+
+// pseudoHeaders is the pseudo headers of the http2 and http3 requests.
+var pseudoHeaders = []string{":method", ":scheme", ":path", ":authority"}
+
+// validatePseudoHeaderOrder returns the lowercase pseudo header order, or an
+// error if the order is not a permutation of the pseudo headers, the empty
+// order is valid.
+func validatePseudoHeaderOrder(keys []string) ([]string, error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	keys, duplicates := normalizeHeaderOrder(keys)
+	if len(duplicates) > 0 {
+		return nil, fmt.Errorf("duplicated pseudo headers %v in pseudo header order", duplicates)
+	}
+	for _, key := range keys {
+		if !slices.Contains(pseudoHeaders, key) {
+			return nil, fmt.Errorf("unknown pseudo header %q in pseudo header order", key)
+		}
+	}
+	for _, key := range pseudoHeaders {
+		if !slices.Contains(keys, key) {
+			return nil, fmt.Errorf("missing pseudo header %q in pseudo header order", key)
+		}
+	}
+	return keys, nil
+}
+
 // SetHTTP2SettingsFrame set the ordered http2 settings frame.
 func (c *Client) SetHTTP2SettingsFrame(settings ...http2.Setting) *Client {
 	c.Transport.SetHTTP2SettingsFrame(settings...)
 	return c
 }
 
-// SetHTTP2ConnectionFlow set the default http2 connection flow, which is the increment
-// value of initial WINDOW_UPDATE frame.
+// GetHTTP2Settings returns a copy of the http2 settings set by
+// SetHTTP2SettingsFrame or ImpersonateXXX, returns nil if the default
+// settings are used.
+func (c *Client) GetHTTP2Settings() []http2.Setting {
+	return cloneSlice(c.t2.Settings)
+}
+
+// SetHTTP2SettingsOrder reorders the http2 settings already set by
+// SetHTTP2SettingsFrame or an impersonation without changing their values.
+// Every configured setting must appear in order exactly once, the order is
+// ignored if any ID in it has no configured value.
+func (c *Client) SetHTTP2SettingsOrder(order ...http2.SettingID) *Client {
+	if len(order) != len(c.t2.Settings) {
+		c.log.Errorf("http2 settings order has %d settings, but %d settings are configured", len(order), len(c.t2.Settings))
+		return c
+	}
+	settings := make([]http2.Setting, 0, len(order))
+	seen := make(map[http2.SettingID]bool, len(order))
+	for _, id := range order {
+		if seen[id] {
+			c.log.Errorf("duplicated http2 setting %v in settings order", id)
+			return c
+		}
+		seen[id] = true
+		i := slices.IndexFunc(c.t2.Settings, func(s http2.Setting) bool { return s.ID == id })
+		if i < 0 {
+			c.log.Errorf("http2 setting %v in settings order has no value", id)
+			return c
+		}
+		settings = append(settings, c.t2.Settings[i])
+	}
+	c.Transport.SetHTTP2SettingsFrame(settings...)
+	return c
+}
+
+// SetHTTP3Settings set the http3 settings frame, the default settings
+// are sent if settings is nil. It takes effect once http3 is enabled.
+func (c *Client) SetHTTP3Settings(settings *http3.Settings) *Client {
+	c.Transport.SetHTTP3Settings(settings)
+	return c
+}
+
+// SetHTTP3SettingsFrame set the ordered http3 settings frame, which is
+// useful to send GREASE or QPACK related settings. The value of
+// SETTINGS_ENABLE_CONNECT_PROTOCOL (0x8) and SETTINGS_H3_DATAGRAM (0x33)
+// must be 0 or 1, the reserved http2 settings (0x2 to 0x5) and duplicated
+// settings are not allowed, the settings are ignored if any of them is invalid.
+func (c *Client) SetHTTP3SettingsFrame(settings ...http3.Setting) *Client {
+	s := c.http3Settings.Clone()
+	if s == nil {
+		s = &http3.Settings{}
+	}
+	seen := make(map[http3.SettingID]bool, len(settings))
+	for _, setting := range settings {
+		if seen[setting.ID] {
+			c.log.Errorf("duplicated http3 setting %v", setting.ID)
+			return c
+		}
+		seen[setting.ID] = true
+		switch setting.ID {
+		case http3.SettingEnableConnectProtocol, http3.SettingH3Datagram:
+			if setting.Val > 1 {
+				c.log.Errorf("invalid value %d of http3 setting %v", setting.Val, setting.ID)
+				return c
+			}
+			if setting.ID == http3.SettingEnableConnectProtocol {
+				s.ExtendedConnect = setting.Val == 1
+			} else {
+				s.Datagram = setting.Val == 1
+			}
+		case 0x2, 0x3, 0x4, 0x5:
+			c.log.Errorf("reserved http2 setting 0x%x is not allowed in http3 settings", uint64(setting.ID))
+			return c
+		}
+	}
+	s.Other = cloneSlice(settings)
+	c.Transport.SetHTTP3Settings(s)
+	return c
+}
+
+// SetHTTP3GREASE set whether to send a GREASE setting and a GREASE frame
+// with random reserved identifiers in http3, as Chrome does.
+func (c *Client) SetHTTP3GREASE(enable bool) *Client {
+	s := c.http3Settings.Clone()
+	if s == nil {
+		s = &http3.Settings{}
+	}
+	s.GREASE = enable
+	c.Transport.SetHTTP3Settings(s)
+	return c
+}
+
+// SetHTTP3QPACKMaxTableCapacity set the SETTINGS_QPACK_MAX_TABLE_CAPACITY
+// (0x1) of the http3 settings, which is the maximum capacity of the QPACK
+// dynamic table the server is allowed to use when encoding the response
+// headers, e.g. 65536 like Chrome and Firefox. The setting is replaced in
+// place if it's already set, otherwise it's sent after the other settings.
+//
+// Attention: the QPACK decoder does not support the dynamic table, so the
+// responses fail to decode if the server does use it, which is why the
+// setting is not sent by ImpersonateXXX, use it at your own risk.
+func (c *Client) SetHTTP3QPACKMaxTableCapacity(capacity uint64) *Client {
+	if capacity > 0 {
+		c.log.Warnf("the qpack dynamic table is not supported, the http3 responses fail to decode if the server uses it")
+	}
+	c.setHTTP3Setting(http3.SettingQpackMaxTableCapacity, capacity)
+	return c
+}
+
+// SetHTTP3QPACKBlockedStreams set the SETTINGS_QPACK_BLOCKED_STREAMS (0x7)
+// of the http3 settings, which is the maximum number of streams that can be
+// blocked on the QPACK dynamic table, e.g. 100 like Chrome or 20 like
+// Firefox. The setting is replaced in place if it's already set, otherwise
+// it's sent after the other settings.
+func (c *Client) SetHTTP3QPACKBlockedStreams(streams uint64) *Client {
+	c.setHTTP3Setting(http3.SettingQpackBlockedStreams, streams)
+	return c
+}
+
+func (c *Client) setHTTP3Setting(id http3.SettingID, val uint64) {
+	s := c.http3Settings.Clone()
+	if s == nil {
+		s = &http3.Settings{}
+	}
+	if i := slices.IndexFunc(s.Other, func(setting http3.Setting) bool { return setting.ID == id }); i >= 0 {
+		s.Other[i].Val = val
+	} else {
+		s.Other = append(s.Other, http3.Setting{ID: id, Val: val})
+	}
+	c.Transport.SetHTTP3Settings(s)
+}
+
+// SetMaxHTTP3FrameSize set the maximum payload size of the received http3
+// DATA, HEADERS and unknown frames, the connection is closed with an error
+// if a larger frame is received, which protects against peers announcing
+// huge frames. Zero means to use the default limit (16 MB).
+func (c *Client) SetMaxHTTP3FrameSize(size uint64) *Client {
+	c.Transport.SetMaxHTTP3FrameSize(size)
+	return c
+}
+
+// SetMaxDecompressedSize set the maximum size of the decompressed response
+// body, which guards against the decompression bombs sent by hostile servers
+// when gzip, deflate, br or zstd is advertised. Reading the body returns a
+// *DecompressedSizeError once more bytes are decoded. Zero means no limit,
+// which is the default.
+func (c *Client) SetMaxDecompressedSize(size int64) *Client {
+	c.Transport.SetMaxDecompressedSize(size)
+	return c
+}
+
+// SetHTTP3UnknownFrameHandler set the handler which is called with the type
+// and the payload of the received http3 frames of unknown types, which is
+// useful to inspect or handle extension frames. The payload is skipped after
+// fn returns unless it returns processed, in which case fn must consume the
+// whole payload.
+func (c *Client) SetHTTP3UnknownFrameHandler(fn func(frameType http3.FrameType, payload io.Reader) (processed bool, err error)) *Client {
+	c.Transport.SetHTTP3UnknownFrameHandler(fn)
+	return c
+}
+
+// SetHTTP2GoAwayHandler set the handler which is called with the remote
+// address of the connection and the GOAWAY frame received from the http2
+// server, which means the server is shutting down the connection, e.g. it
+// has reached its limit of the requests per connection. The handler is
+// called in a new goroutine so it never blocks the connection.
+func (c *Client) SetHTTP2GoAwayHandler(fn func(addr string, goAway http2.GoAway)) *Client {
+	c.Transport.HTTP2GoAwayHandler = fn
+	return c
+}
+
+// SetHTTP3GoAwayHandler set the handler which is called with the remote
+// address of the connection and the GOAWAY frame received from the http3
+// server, see SetHTTP2GoAwayHandler.
+func (c *Client) SetHTTP3GoAwayHandler(fn func(addr string, goAway http3.GoAway)) *Client {
+	c.Transport.HTTP3GoAwayHandler = fn
+	return c
+}
+
+// SetHTTP3DatagramHandler set the handler which is called with the received
+// http3 datagrams (RFC 9297) and the ID of the stream they are associated
+// with, datagrams must be enabled with SetHTTP3Settings.
+func (c *Client) SetHTTP3DatagramHandler(fn func(stream quic.StreamID, payload []byte)) *Client {
+	c.Transport.SetHTTP3DatagramHandler(fn)
+	return c
+}
+
+// SendHTTP3Datagram sends a http3 datagram (RFC 9297) associated with the
+// active request stream, which is useful for MASQUE-style protocols. Both
+// the client and the server must advertise datagram support in their
+// settings, it returns http3.ErrDatagramNotEnabled if datagrams are not
+// enabled with SetHTTP3Settings, or http3.ErrDatagramNotSupported if the
+// server did not advertise it.
+func (c *Client) SendHTTP3Datagram(stream quic.StreamID, payload []byte) error {
+	return c.Transport.SendHTTP3Datagram(stream, payload)
+}
+
+const (
+	// minHTTP2ConnectionFlow is the minimum http2 connection flow, which
+	// doubles the initial connection-level flow control window at least.
+	minHTTP2ConnectionFlow = 65535
+	// maxHTTP2ConnectionFlow is the maximum http2 connection flow, which keeps
+	// the connection-level flow control window within 2^31-1 (RFC 9113, Section 6.9.1).
+	maxHTTP2ConnectionFlow = 1<<31 - 1 - 65535
+)
+
+func validateHTTP2ConnectionFlow(flow uint32) error {
+	if flow < minHTTP2ConnectionFlow || flow > maxHTTP2ConnectionFlow {
+		return fmt.Errorf("invalid http2 connection flow %d, must be between %d and %d", flow, minHTTP2ConnectionFlow, maxHTTP2ConnectionFlow)
+	}
+	return nil
+}
+
+// SetHTTP2ConnectionFlow set the default http2 connection flow, which is the delta
+// of the initial connection-level WINDOW_UPDATE frame sent by the browsers right
+// after the SETTINGS frame (e.g. 15663105 for Chrome). The flow must be between
+// 65535 and 2^31-1-65535, it's ignored if it's out of range, and 0 resets it to
+// the default flow.
 func (c *Client) SetHTTP2ConnectionFlow(flow uint32) *Client {
+	if flow != 0 {
+		if err := validateHTTP2ConnectionFlow(flow); err != nil {
+			c.log.Errorf("failed to set http2 connection flow: %v", err)
+			return c
+		}
+	}
 	c.Transport.SetHTTP2ConnectionFlow(flow)
 	return c
 }
 
+// GetHTTP2ConnectionFlow returns the http2 connection flow set by
+// SetHTTP2ConnectionFlow, returns 0 if the default flow is used.
+func (c *Client) GetHTTP2ConnectionFlow() uint32 {
+	return c.t2.ConnectionFlow
+}
+
+// SetHTTP2SettingsJitter set whether to perturb the values of the http2
+// settings (such as HeaderTableSize or MaxConcurrentStreams) within
+// browser-plausible ranges, the IDs and the order of the settings are kept.
+func (c *Client) SetHTTP2SettingsJitter(enable bool) *Client {
+	c.Transport.SetHTTP2SettingsJitter(enable)
+	return c
+}
+
+// SetHTTP2SettingsJitterSeed set the seed of the http2 settings jitter and
+// enable it, which makes the jittered values deterministic.
+func (c *Client) SetHTTP2SettingsJitterSeed(seed int64) *Client {
+	c.Transport.SetHTTP2SettingsJitterSeed(seed)
+	return c
+}
+
 // SetHTTP2HeaderPriority set the header priority param.
 func (c *Client) SetHTTP2HeaderPriority(priority http2.PriorityParam) *Client {
 	c.Transport.SetHTTP2HeaderPriority(priority)
 	return c
 }
 
-// SetHTTP2PriorityFrames set the ordered http2 priority frames.
+// GetHTTP2HeaderPriority returns the header priority param set by
+// SetHTTP2HeaderPriority or ImpersonateXXX.
+func (c *Client) GetHTTP2HeaderPriority() http2.PriorityParam {
+	return c.t2.HeaderPriority
+}
+
+// SetHTTP2PriorityFrames set the ordered http2 priority frames, the priority
+// frames are cleared if no frame is passed.
 func (c *Client) SetHTTP2PriorityFrames(frames ...http2.PriorityFrame) *Client {
 	c.Transport.SetHTTP2PriorityFrames(frames...)
 	return c
 }
 
+const (
+	// minHTTP2FrameSize and maxHTTP2FrameSize are the range of the frame
+	// size (RFC 9113, Section 6.5.2).
+	minHTTP2FrameSize = 1 << 14
+	maxHTTP2FrameSize = 1<<24 - 1
+)
+
+// SetHTTP2MaxHeaderFrameSize set the maximum payload size of the http2 HEADERS
+// and CONTINUATION frames, the header blocks which are larger are split into a
+// HEADERS frame and CONTINUATION frames. The browsers split the header blocks
+// at the default frame size 16384 even if the server allows larger frames
+// with SETTINGS_MAX_FRAME_SIZE, while the frames are only capped by the server
+// setting by default. The size must be between 16384 and 2^24-1, it's ignored
+// if it's out of range, and 0 resets it to the default.
+func (c *Client) SetHTTP2MaxHeaderFrameSize(size uint32) *Client {
+	if size != 0 && (size < minHTTP2FrameSize || size > maxHTTP2FrameSize) {
+		c.log.Errorf("invalid http2 max header frame size %d, must be between %d and %d", size, minHTTP2FrameSize, maxHTTP2FrameSize)
+		return c
+	}
+	c.Transport.SetHTTP2MaxHeaderFrameSize(size)
+	return c
+}
+
+// SetHTTP2SplitCookie set whether the Cookie header, including the cookies
+// added from the cookie jar, is split into separate http2 header fields of
+// each cookie-pair (enabled by default) like Firefox, or sent as a single
+// header field like Chrome and Safari. The header is sent at the position of
+// "cookie" in the header order either way.
+func (c *Client) SetHTTP2SplitCookie(split bool) *Client {
+	c.Transport.SetHTTP2SplitCookie(split)
+	return c
+}
+
+// SetHTTP2PriorityUpdate set the RFC 9218 PRIORITY_UPDATE frame sent before
+// the HEADERS frame of each request, which is the replacement of the legacy
+// PRIORITY frames (see SetHTTP2PriorityFrames). The urgency must be between
+// 0 and 7, the frame is not changed otherwise.
+func (c *Client) SetHTTP2PriorityUpdate(urgency int, incremental bool) *Client {
+	if urgency < 0 || urgency > 7 {
+		c.log.Errorf("invalid priority urgency %d, must be between 0 and 7", urgency)
+		return c
+	}
+	c.Transport.SetHTTP2PriorityUpdate(formatPriorityHeader(urgency, incremental))
+	return c
+}
+
+// DisableHTTP2PriorityUpdate disables the PRIORITY_UPDATE frame set by
+// SetHTTP2PriorityUpdate.
+func (c *Client) DisableHTTP2PriorityUpdate() *Client {
+	c.Transport.SetHTTP2PriorityUpdate("")
+	return c
+}
+
+// GetHTTP2PriorityFrames returns a copy of the http2 priority frames set by
+// SetHTTP2PriorityFrames or ImpersonateXXX.
+func (c *Client) GetHTTP2PriorityFrames() []http2.PriorityFrame {
+	return cloneSlice(c.t2.PriorityFrames)
+}
+
 // SetCommonContentType set the `Content-Type` header for requests fired
 // from the client.
 func (c *Client) SetCommonContentType(ct string) *Client {
@@ -1025,6 +1697,7 @@ func (c *Client) SetCommonDumpOptions(opt *DumpOptions) *Client {
 
 // SetProxy set the proxy function.
 func (c *Client) SetProxy(proxy func(*http.Request) (*urlpkg.URL, error)) *Client {
+	c.resetImpersonateClients()
 	c.Transport.SetProxy(proxy)
 	return c
 }
@@ -1048,7 +1721,10 @@ func (c *Client) OnAfterResponse(m ResponseMiddleware) *Client {
 	return c
 }
 
-// SetProxyURL set proxy from the proxy URL.
+// SetProxyURL set proxy from the proxy URL, the "http", "https", "socks5" and
+// "socks5h" schemes are supported. The TLS handshake with the destination is
+// done through the tunnel of the proxy with the tls fingerprint of the client,
+// so the destination sees the same ClientHello as without the proxy.
 func (c *Client) SetProxyURL(proxyUrl string) *Client {
 	if proxyUrl == "" {
 		c.log.Warnf("ignore empty proxy url in SetProxyURL")
@@ -1064,6 +1740,43 @@ func (c *Client) SetProxyURL(proxyUrl string) *Client {
 	return c
 }
 
+// SetProxySelector set the function to select the proxy of each request, e.g.
+// to pin each identity (tls fingerprint, user agent, cookies, etc.) to its own
+// proxy, so the requests of the same identity always exit from the same IP.
+// It's called before each attempt of the request, including the retries, so
+// the proxy can follow the profile switched by RetryWithProfileRotation, see
+// Request.GetImpersonateProfile. The proxy set by SetProxy or SetProxyURL is
+// used if fn returns nil. The connections are pooled per proxy and tls
+// fingerprint, so they are never shared between the proxies. Pass nil to
+// remove it.
+func (c *Client) SetProxySelector(fn func(r *Request) *urlpkg.URL) *Client {
+	c.proxySelector = fn
+	return c
+}
+
+// SetProxyConnectHeader set the headers sent to the proxy in the CONNECT
+// requests of the "https" destinations, e.g. the User-Agent and
+// Proxy-Connection headers sent by the browsers. The header names are sent as
+// is, in the order of the values of HeaderOderKey if present. No User-Agent is
+// sent unless it's set here. The request fails with a *ProxyConnectError if the
+// proxy refuses to connect, which matches ErrProxyAuthRequired with errors.Is
+// if the proxy requires the authentication.
+func (c *Client) SetProxyConnectHeader(hdr http.Header) *Client {
+	c.resetImpersonateClients()
+	c.Transport.SetProxyConnectHeader(hdr)
+	return c
+}
+
+// SetProxyConnectHeaderFunc is similar to SetProxyConnectHeader, but returns
+// the headers of each CONNECT request to the target (host:port) with fn, which
+// overrides the headers set by SetProxyConnectHeader, the request fails with
+// the error returned by fn. Pass nil to remove it.
+func (c *Client) SetProxyConnectHeaderFunc(fn func(ctx context.Context, proxyURL *urlpkg.URL, target string) (http.Header, error)) *Client {
+	c.resetImpersonateClients()
+	c.Transport.SetGetProxyConnectHeader(fn)
+	return c
+}
+
 // DisableTraceAll disable trace for requests fired from the client.
 func (c *Client) DisableTraceAll() *Client {
 	c.trace = false
@@ -1142,12 +1855,14 @@ func (c *Client) SetXmlUnmarshal(fn func(data []byte, v any) error) *Client {
 // Make sure the returned `conn` implements pkg/tls.Conn if you want your
 // customized `conn` supports HTTP2.
 func (c *Client) SetDialTLS(fn func(ctx context.Context, network, addr string) (net.Conn, error)) *Client {
+	c.resetImpersonateClients()
 	c.Transport.SetDialTLS(fn)
 	return c
 }
 
 // SetDial set the customized `DialContext` function to Transport.
 func (c *Client) SetDial(fn func(ctx context.Context, network, addr string) (net.Conn, error)) *Client {
+	c.resetImpersonateClients()
 	c.Transport.SetDial(fn)
 	return c
 }
@@ -1217,6 +1932,7 @@ func (conn *uTLSConn) ConnectionState() tls.ConnectionState {
 		SignedCertificateTimestamps: cs.SignedCertificateTimestamps,
 		OCSPResponse:                cs.OCSPResponse,
 		TLSUnique:                   cs.TLSUnique,
+		ECHAccepted:                 cs.ECHAccepted,
 	}
 }
 
@@ -1225,6 +1941,331 @@ func (conn *uTLSConn) ConnectionState() tls.ConnectionState {
 // which uses the specified clientHelloID to simulate the tls fingerprint.
 // Note this is valid for HTTP1 and HTTP2, not HTTP3.
 func (c *Client) SetTLSFingerprint(clientHelloID utls.ClientHelloID) *Client {
+	return c.setUTLSHandshake(clientHelloID, nil)
+}
+
+// SetTLSSessionResumption set whether to resume the TLS sessions with the
+// session tickets (TLS 1.2) or the pre-shared keys (TLS 1.3) received from the
+// server like browsers do, so the repeated connections to the same host skip
+// the full handshake (disabled by default). The pre_shared_key extension is
+// added to the ClientHello of the tls fingerprint if it's missing, and it's
+// only sent when there is a session to resume, so the initial ClientHello is
+// not changed. Note the clients created by Clone share the session cache.
+func (c *Client) SetTLSSessionResumption(enable bool) *Client {
+	conf := c.GetTLSClientConfig()
+	if !enable {
+		c.tlsSessionCache = nil
+		conf.ClientSessionCache = nil
+		return c
+	}
+	c.tlsSessionCache = utls.NewLRUClientSessionCache(0)
+	conf.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	return c
+}
+
+// modifySpec returns the spec func which modifies the spec of the tls
+// fingerprint with fn, the spec of clientHelloID is used if specFunc is nil.
+// It returns nil if the spec of clientHelloID is generated by utls at the
+// handshake, e.g. the randomized fingerprint, which can not be modified.
+func modifySpec(clientHelloID utls.ClientHelloID, specFunc func() (*utls.ClientHelloSpec, error), fn func(spec *utls.ClientHelloSpec) error) func() (*utls.ClientHelloSpec, error) {
+	if specFunc == nil {
+		if _, err := utls.UTLSIdToSpec(clientHelloID); err != nil {
+			return nil
+		}
+		specFunc = func() (*utls.ClientHelloSpec, error) {
+			spec, err := utls.UTLSIdToSpec(clientHelloID)
+			return &spec, err
+		}
+	}
+	return func() (*utls.ClientHelloSpec, error) {
+		spec, err := specFunc()
+		if err != nil {
+			return nil, err
+		}
+		if err = fn(spec); err != nil {
+			return nil, err
+		}
+		return spec, nil
+	}
+}
+
+// addPreSharedKey adds the pre_shared_key extension, which is required to
+// resume TLS 1.3 sessions, to the spec if it's missing.
+func addPreSharedKey(spec *utls.ClientHelloSpec) error {
+	for _, ext := range spec.Extensions {
+		if _, ok := ext.(utls.PreSharedKeyExtension); ok {
+			return nil
+		}
+	}
+	// the pre_shared_key extension must be the last one.
+	spec.Extensions = append(spec.Extensions, &utls.UtlsPreSharedKeyExtension{})
+	return nil
+}
+
+// SetALPN set the protocols of the ALPN extension in the ClientHello in order,
+// the allowed protocols are "h2" and "http/1.1", e.g. SetALPN("h2", "http/1.1")
+// like Chrome. It overrides the ALPN extension of the tls fingerprint set by
+// ImpersonateXXX, SetTLSFingerprint or SetCustomTLSFingerprint, and the
+// NextProtos of the tls config otherwise. Call it without protocols to use the
+// ones of the tls fingerprint. It only takes effect on the new connections,
+// and the handshake fails if the protocols conflict with the http version
+// forced by EnableForceHTTP1 or EnableForceHTTP2.
+func (c *Client) SetALPN(protocols ...string) *Client {
+	for _, proto := range protocols {
+		if proto != "h2" && proto != "http/1.1" {
+			c.log.Errorf("unsupported alpn protocol %q, should be h2 or http/1.1", proto)
+			return c
+		}
+	}
+	if err := c.checkALPN(protocols); err != nil {
+		c.log.Errorf("%v", err)
+		return c
+	}
+	conf := c.GetTLSClientConfig()
+	if len(protocols) == 0 {
+		if c.alpn != nil {
+			c.alpn = nil
+			conf.NextProtos = []string{"h2", "http/1.1"}
+		}
+		return c
+	}
+	c.alpn = cloneSlice(protocols)
+	conf.NextProtos = cloneSlice(protocols)
+	return c
+}
+
+// checkALPN returns an error if the alpn protocols conflict with the forced
+// http version.
+func (c *Client) checkALPN(protocols []string) error {
+	if len(protocols) == 0 {
+		return nil
+	}
+	switch c.Transport.forceHttpVersion {
+	case h1:
+		if !slices.Contains(protocols, "http/1.1") {
+			return fmt.Errorf("alpn protocols %q conflict with EnableForceHTTP1, http/1.1 is missing", protocols)
+		}
+	case h2:
+		if !slices.Contains(protocols, "h2") {
+			return fmt.Errorf("alpn protocols %q conflict with EnableForceHTTP2, h2 is missing", protocols)
+		}
+	}
+	return nil
+}
+
+// setALPN replaces the protocols of the ALPN extension in the spec.
+func setALPN(spec *utls.ClientHelloSpec, protocols []string) error {
+	for _, ext := range spec.Extensions {
+		if alpn, ok := ext.(*utls.ALPNExtension); ok {
+			alpn.AlpnProtocols = cloneSlice(protocols)
+			return nil
+		}
+	}
+	return errors.New("the tls fingerprint has no alpn extension")
+}
+
+// SetTLSClientHelloSpec set the tls fingerprint from the utls ClientHelloSpec,
+// which is more flexible than SetCustomTLSFingerprint as the individual
+// extensions can be modified, e.g. reorder the signature algorithms of the spec
+// returned by utls.UTLSIdToSpec. The extensions are stateful, so the spec is
+// marshaled into a ClientHello once and a fresh spec is parsed from it for
+// each handshake, and it should not be reused after calling this method.
+// Note this is valid for HTTP1 and HTTP2, not HTTP3.
+func (c *Client) SetTLSClientHelloSpec(spec *utls.ClientHelloSpec) *Client {
+	if spec == nil {
+		c.log.Errorf("client hello spec is nil")
+		return c
+	}
+	raw, err := marshalClientHelloSpec(spec)
+	if err != nil {
+		c.log.Errorf("failed to marshal client hello spec: %v", err)
+		return c
+	}
+	return c.SetCustomTLSFingerprint(raw)
+}
+
+// marshalClientHelloSpec returns the raw ClientHello built from the spec.
+func marshalClientHelloSpec(spec *utls.ClientHelloSpec) ([]byte, error) {
+	uconn := utls.UClient(nil, &utls.Config{ServerName: "example.com", OmitEmptyPsk: true}, utls.HelloCustom)
+	if err := uconn.ApplyPreset(spec); err != nil {
+		return nil, err
+	}
+	if err := uconn.BuildHandshakeState(); err != nil {
+		return nil, err
+	}
+	return uconn.HandshakeState.Hello.Raw, nil
+}
+
+// SetECH set the ECHConfigList, which is usually published in the HTTPS DNS
+// record of the server, to encrypt the ClientHello with the Encrypted Client
+// Hello (ECH) extension, so only the public name in the config is visible to
+// the network. The handshake fails with a *tls.ECHRejectionError (or the
+// utls.ECHRejectionError if the tls fingerprint is set) if the server does
+// not accept ECH, pass nil to disable it. Note ECH requires TLS 1.3.
+func (c *Client) SetECH(configList []byte) *Client {
+	if configList != nil && (len(configList) < 2 || int(binary.BigEndian.Uint16(configList)) != len(configList)-2) {
+		c.log.Errorf("malformed ECHConfigList")
+		return c
+	}
+	c.echConfigList = bytes.Clone(configList)
+	c.GetTLSClientConfig().EncryptedClientHelloConfigList = c.echConfigList
+	return c
+}
+
+// SetGREASEECH set whether to send a GREASE (fake) ECH extension in the
+// ClientHello of the tls fingerprint, which is sent by Chrome and Firefox if
+// the server has no ECH config. The extension of the tls fingerprint is kept
+// if it's not called, e.g. the fingerprints of Chrome since 117 and Firefox
+// 120 already have it. It's not valid without the tls fingerprint, and the
+// extension is always sent if SetECH is called.
+func (c *Client) SetGREASEECH(enable bool) *Client {
+	c.greaseECH = &enable
+	return c
+}
+
+// setGREASEECH adds the GREASE ECH extension to the spec if it's missing, or
+// removes the ECH extension from the spec if enable is false.
+func setGREASEECH(spec *utls.ClientHelloSpec, enable bool) error {
+	i := slices.IndexFunc(spec.Extensions, func(ext utls.TLSExtension) bool {
+		_, ok := ext.(utls.EncryptedClientHelloExtension)
+		return ok
+	})
+	switch {
+	case enable && i < 0:
+		// insert before the trailing GREASE, padding and pre_shared_key
+		// extensions like Chrome.
+		i = len(spec.Extensions)
+		for i > 0 {
+			switch spec.Extensions[i-1].(type) {
+			case *utls.UtlsGREASEExtension, *utls.UtlsPaddingExtension, utls.PreSharedKeyExtension:
+				i--
+				continue
+			}
+			break
+		}
+		spec.Extensions = slices.Insert(spec.Extensions, i, utls.TLSExtension(utls.BoringGREASEECH()))
+	case !enable && i >= 0:
+		spec.Extensions = slices.Delete(spec.Extensions, i, i+1)
+	}
+	return nil
+}
+
+// SetGREASEDeterministic set the seed to derive the GREASE values (RFC 8701)
+// of the ClientHello of the tls fingerprint, which are chosen randomly for
+// each handshake by default. With the same seed, the GREASE cipher suite,
+// extensions, supported group, key share and supported version are the same
+// in every handshake, so the ClientHello can be compared byte-for-byte with a
+// capture (except the client random, session id and key shares, see
+// SetImpersonateSeed). It's not valid without the tls fingerprint or with a
+// randomized one.
+func (c *Client) SetGREASEDeterministic(seed int64) *Client {
+	c.greaseSeed = &seed
+	return c
+}
+
+// setGREASEValues replaces the GREASE values of the ClientHello applied to
+// the uconn with the ones derived from the seed, the two GREASE extensions
+// have different values like BoringSSL.
+func setGREASEValues(uconn *utls.UConn, seed int64) {
+	r := newSeededRand(seed)
+	value := func() uint16 {
+		v := uint16(r.Int63()&0xf0) | 0x0a
+		return v<<8 | v
+	}
+	cipher, group, version, ext1, ext2 := value(), value(), value(), value(), value()
+	if ext1 == ext2 {
+		ext2 ^= 0x1010
+	}
+	hello := uconn.HandshakeState.Hello
+	for i, cs := range hello.CipherSuites {
+		if isGREASE(cs) {
+			hello.CipherSuites[i] = cipher
+		}
+	}
+	greaseExts := 0
+	for _, e := range uconn.Extensions {
+		switch ext := e.(type) {
+		case *utls.UtlsGREASEExtension:
+			if greaseExts == 0 {
+				ext.Value = ext1
+			} else {
+				ext.Value = ext2
+			}
+			greaseExts++
+		case *utls.SupportedCurvesExtension:
+			for i, curve := range ext.Curves {
+				if isGREASE(uint16(curve)) {
+					ext.Curves[i] = utls.CurveID(group)
+				}
+			}
+		case *utls.KeyShareExtension:
+			for i, ks := range ext.KeyShares {
+				if isGREASE(uint16(ks.Group)) {
+					ext.KeyShares[i].Group = utls.CurveID(group)
+				}
+			}
+		case *utls.SupportedVersionsExtension:
+			for i, v := range ext.Versions {
+				if isGREASE(v) {
+					ext.Versions[i] = version
+				}
+			}
+		}
+	}
+}
+
+// SetCustomTLSFingerprint set the tls fingerprint for tls handshake from the
+// raw bytes of a ClientHello captured from a real client (e.g. with Wireshark),
+// the cipher suites, extensions and their order are parsed from it and will be
+// used to perform the tls handshake with utls.
+// Note this is valid for HTTP1 and HTTP2, not HTTP3.
+func (c *Client) SetCustomTLSFingerprint(rawClientHello []byte) *Client {
+	if err := c.setCustomTLSFingerprint(rawClientHello); err != nil {
+		c.log.Errorf("%v", err)
+	}
+	return c
+}
+
+// SetCustomTLSFingerprintBase64 is like SetCustomTLSFingerprint, but the raw
+// ClientHello is encoded with the standard base64 encoding (the padding is
+// optional), which is handy to store the captured ClientHello in config files.
+// It returns an error if it can not be decoded, or it's not a valid
+// ClientHello, in which case the tls fingerprint is not changed.
+func (c *Client) SetCustomTLSFingerprintBase64(s string) error {
+	s = strings.Join(strings.Fields(s), "")
+	raw, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return fmt.Errorf("failed to decode base64 client hello: %w", err)
+	}
+	return c.setCustomTLSFingerprint(raw)
+}
+
+// SetCustomTLSFingerprintHex is like SetCustomTLSFingerprint, but the raw
+// ClientHello is hex encoded, e.g. copied from Wireshark as a hex stream, the
+// white spaces are ignored. It returns an error if it can not be decoded, or
+// it's not a valid ClientHello, in which case the tls fingerprint is not
+// changed.
+func (c *Client) SetCustomTLSFingerprintHex(s string) error {
+	raw, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		return fmt.Errorf("failed to decode hex client hello: %w", err)
+	}
+	return c.setCustomTLSFingerprint(raw)
+}
+
+func (c *Client) setCustomTLSFingerprint(rawClientHello []byte) error {
+	if _, err := ParseClientHello(rawClientHello); err != nil {
+		return fmt.Errorf("failed to parse client hello: %w", err)
+	}
+	raw := bytes.Clone(rawClientHello)
+	c.setUTLSHandshake(utls.HelloCustom, func() (*utls.ClientHelloSpec, error) {
+		// extensions are stateful, so a fresh spec is required for each handshake.
+		return ParseClientHello(raw)
+	})
+	return nil
+}
+
+func (c *Client) setUTLSHandshake(clientHelloID utls.ClientHelloID, specFunc func() (*utls.ClientHelloSpec, error)) *Client {
 	fn := func(ctx context.Context, addr string, plainConn net.Conn) (conn net.Conn, tlsState *tls.ConnectionState, err error) {
 		colonPos := strings.LastIndex(addr, ":")
 		if colonPos == -1 {
@@ -1246,13 +2287,91 @@ func (c *Client) SetTLSFingerprint(clientHelloID utls.ClientHelloID) *Client {
 			MaxVersion:                  tlsConfig.MaxVersion,
 			DynamicRecordSizingDisabled: tlsConfig.DynamicRecordSizingDisabled,
 			KeyLogWriter:                tlsConfig.KeyLogWriter,
+			// omit the psk extension like browsers if there is no session to resume.
+			OmitEmptyPsk: true,
+		}
+		specFunc := specFunc
+		if c.tlsSeedRand != nil {
+			// derive the randomness of each handshake from the seed.
+			utlsConfig.Rand = newSeededRand(c.tlsSeedRand.Int63())
+			shuffleSeed := c.tlsSeedRand.Int63()
+			if specFunc == nil && shufflesTLSExtensions(clientHelloID) {
+				specFunc = func() (*utls.ClientHelloSpec, error) {
+					return seededShuffleSpec(clientHelloID, shuffleSeed)
+				}
+			}
+		}
+		if c.alpn != nil {
+			if err = c.checkALPN(c.alpn); err != nil {
+				return
+			}
+			alpn := c.alpn
+			specFunc = modifySpec(clientHelloID, specFunc, func(spec *utls.ClientHelloSpec) error {
+				return setALPN(spec, alpn)
+			})
+		}
+		if transport.IsHTTP1Only(ctx) {
+			specFunc = modifySpec(clientHelloID, specFunc, func(spec *utls.ClientHelloSpec) error {
+				// the fingerprint without the alpn extension offers
+				// http/1.1 only anyway.
+				setALPN(spec, []string{"http/1.1"})
+				return nil
+			})
+		}
+		if c.greaseECH != nil || c.echConfigList != nil {
+			// the ECH extension is required to send the real ECH.
+			enable := c.echConfigList != nil || *c.greaseECH
+			specFunc = modifySpec(clientHelloID, specFunc, func(spec *utls.ClientHelloSpec) error {
+				return setGREASEECH(spec, enable)
+			})
+		}
+		if c.echConfigList != nil {
+			utlsConfig.EncryptedClientHelloConfigList = c.echConfigList
+			utlsConfig.MinVersion = utls.VersionTLS13
+		}
+		if c.tlsSessionCache != nil {
+			utlsConfig.ClientSessionCache = c.tlsSessionCache
+			specFunc = modifySpec(clientHelloID, specFunc, addPreSharedKey)
+		}
+		if c.greaseSeed != nil && specFunc == nil {
+			// the spec is applied before the handshake to replace the GREASE values.
+			specFunc = modifySpec(clientHelloID, nil, func(*utls.ClientHelloSpec) error { return nil })
+		}
+		helloID := clientHelloID
+		if specFunc != nil {
+			// utls replaces the applied spec with the one of the ID unless
+			// the ID is HelloCustom.
+			helloID = utls.HelloCustom
+		}
+		uconn := &uTLSConn{utls.UClient(plainConn, utlsConfig, helloID)}
+		if specFunc != nil {
+			var spec *utls.ClientHelloSpec
+			spec, err = specFunc()
+			if err != nil {
+				return
+			}
+			if err = uconn.ApplyPreset(spec); err != nil {
+				return
+			}
+			if c.greaseSeed != nil {
+				setGREASEValues(uconn.UConn, *c.greaseSeed)
+			}
+		}
+		if observer := c.clientHelloObserver; observer != nil {
+			if err = uconn.BuildHandshakeState(); err != nil {
+				return
+			}
+			raw := bytes.Clone(uconn.HandshakeState.Hello.Raw)
+			go observer(raw)
 		}
-		uconn := &uTLSConn{utls.UClient(plainConn, utlsConfig, clientHelloID)}
 		err = uconn.HandshakeContext(ctx)
 		if err != nil {
 			return
 		}
 		cs := uconn.Conn.ConnectionState()
+		if observer := c.tlsHandshakeObserver; observer != nil {
+			go observer(cs)
+		}
 		conn = uconn
 		tlsState = &tls.ConnectionState{
 			Version:                     cs.Version,
@@ -1267,10 +2386,38 @@ func (c *Client) SetTLSFingerprint(clientHelloID utls.ClientHelloID) *Client {
 			SignedCertificateTimestamps: cs.SignedCertificateTimestamps,
 			OCSPResponse:                cs.OCSPResponse,
 			TLSUnique:                   cs.TLSUnique,
+			ECHAccepted:                 cs.ECHAccepted,
 		}
 		return
 	}
+	c.tlsFingerprintID = clientHelloID
+	c.tlsFingerprintSpec = specFunc
 	c.Transport.SetTLSHandshake(fn)
+	c.Transport.TLSFingerprintKey = tlsFingerprintKey(clientHelloID, specFunc)
+	c.t2.ResetFingerprintKey()
+	return c
+}
+
+// SetClientHelloObserver set the observer which is called with the raw bytes
+// of each ClientHello right before it's sent, which is the handshake message
+// without the record header, including the GREASE values, and can be fed back
+// with SetCustomTLSFingerprint to replay it. The observer is called in a new
+// goroutine so it never blocks the handshake. It's only called when the tls
+// fingerprint is customized, e.g. with ImpersonateXXX, SetTLSFingerprint or
+// SetCustomTLSFingerprint, and not for HTTP3. Set fn to nil to remove it.
+func (c *Client) SetClientHelloObserver(fn func(raw []byte)) *Client {
+	c.clientHelloObserver = fn
+	return c
+}
+
+// SetTLSHandshakeObserver set the observer which is called with the state of
+// each new tls connection right after the handshake completes, e.g. to verify
+// the negotiated version, cipher suite and ALPN are the ones expected by the
+// impersonated browser. The reused connections do not call it again. Like
+// SetClientHelloObserver, it's called in a new goroutine, and only when the tls
+// fingerprint is customized, and not for HTTP3. Set fn to nil to remove it.
+func (c *Client) SetTLSHandshakeObserver(fn func(state utls.ConnectionState)) *Client {
+	c.tlsHandshakeObserver = fn
 	return c
 }
 
@@ -1278,12 +2425,24 @@ func (c *Client) SetTLSFingerprint(clientHelloID utls.ClientHelloID) *Client {
 // it specifies an optional dial function for tls handshake, it works even if a proxy is set, can be
 // used to customize the tls fingerprint.
 func (c *Client) SetTLSHandshake(fn func(ctx context.Context, addr string, plainConn net.Conn) (conn net.Conn, tlsState *tls.ConnectionState, err error)) *Client {
+	c.tlsFingerprintID = utls.ClientHelloID{}
+	c.tlsFingerprintSpec = nil
 	c.Transport.SetTLSHandshake(fn)
+	c.Transport.TLSFingerprintKey = ""
+	if fn != nil {
+		c.Transport.TLSFingerprintKey = fmt.Sprintf("custom-%d", customTLSHandshakeSeq.Add(1))
+	}
+	c.t2.ResetFingerprintKey()
 	return c
 }
 
+// customTLSHandshakeSeq numbers the custom tls handshake functions, the number
+// is the key of their tls fingerprint as it can not be computed.
+var customTLSHandshakeSeq atomic.Uint64
+
 // SetTLSHandshakeTimeout set the TLS handshake timeout.
 func (c *Client) SetTLSHandshakeTimeout(timeout time.Duration) *Client {
+	c.resetImpersonateClients()
 	c.Transport.SetTLSHandshakeTimeout(timeout)
 	return c
 }
@@ -1493,6 +2652,27 @@ func (c *Client) SetHTTP2ReadIdleTimeout(timeout time.Duration) *Client {
 	return c
 }
 
+// SetHTTP2PingInterval set the interval of the http2 PING frames sent on the
+// idle connections, the browsers ping the connection which has received nothing
+// for a while to keep it alive and measure the RTT, e.g. Firefox pings after 58
+// seconds. The connection is closed if the ack is not received within the ping
+// timeout (see SetHTTP2PingTimeout). It's the same as SetHTTP2ReadIdleTimeout,
+// and 0 disables the pings.
+func (c *Client) SetHTTP2PingInterval(interval time.Duration) *Client {
+	c.Transport.SetHTTP2ReadIdleTimeout(interval)
+	return c
+}
+
+// SetHTTP2PingPayload set the function which returns the opaque data of the
+// seq-th (from 0) http2 PING frame sent on each connection, the data is random
+// if fn is nil, which is the default. The data of the PING frames sent by the
+// impersonated browser is used after ImpersonateXXX, e.g. the odd sequence
+// numbers 1, 3, 5... of Chrome, and the zeros of Firefox.
+func (c *Client) SetHTTP2PingPayload(fn func(seq uint64) [8]byte) *Client {
+	c.Transport.SetHTTP2PingPayload(fn)
+	return c
+}
+
 // SetHTTP2PingTimeout set the http2 PingTimeout, which is the timeout
 // after which the connection will be closed if a response to Ping is
 // not received.
@@ -1554,6 +2734,13 @@ func (c *Client) Clone() *Client {
 	cc.afterResponse = cloneSlice(c.afterResponse)
 	cc.dumpOptions = c.dumpOptions.Clone()
 	cc.retryOption = c.retryOption.Clone()
+	cc.impersonateClients = new(sync.Map)
+	cc.acceptCH = new(sync.Map)
+	cc.originHeaderOrders = new(sync.Map)
+	c.originHeaderOrders.Range(func(origin, order any) bool {
+		cc.originHeaderOrders.Store(origin, order)
+		return true
+	})
 	return &cc
 }
 
@@ -1574,9 +2761,12 @@ func C() *Client {
 		parseRequestHeader,
 		parseRequestCookie,
 		parseRequestURL,
+		parseRequestClientHints,
+		parseRequestFetchOrigin,
 		parseRequestBody,
 	}
 	afterResponse := []ResponseMiddleware{
+		parseResponseAcceptCH,
 		parseResponseBody,
 		handleDownload,
 	}
@@ -1592,6 +2782,9 @@ func C() *Client {
 		xmlMarshal:            xml.Marshal,
 		xmlUnmarshal:          xml.Unmarshal,
 		cookiejarFactory:      memoryCookieJarFactory,
+		impersonateClients:    new(sync.Map),
+		acceptCH:              new(sync.Map),
+		originHeaderOrders:    new(sync.Map),
 	}
 	c.SetRedirectPolicy(DefaultRedirectPolicy())
 	c.initCookieJar()
@@ -1721,6 +2914,10 @@ func (c *Client) roundTrip(r *Request) (resp *Response, err error) {
 
 	// setup header
 	contentLength := int64(len(r.Body))
+	if r.Body == nil && r.bodyLength > 0 {
+		// the length of the streamed body is known.
+		contentLength = r.bodyLength
+	}
 
 	var reqBody io.ReadCloser
 	if r.GetBody != nil {
@@ -1742,6 +2939,19 @@ func (c *Client) roundTrip(r *Request) (resp *Response, err error) {
 		GetBody:       r.GetBody,
 		Close:         r.close,
 	}
+	if r.extendedConnectProtocol != "" {
+		// the protocol of the extended CONNECT is carried by Proto, which
+		// is sent as the :protocol pseudo header.
+		req.Proto = r.extendedConnectProtocol
+	}
+	if len(req.Header[HeaderOderKey]) == 0 {
+		if keys := c.requestHeaderOrder(r); len(keys) > 0 {
+			if req.Header == nil {
+				req.Header = make(http.Header)
+			}
+			req.Header[HeaderOderKey] = keys
+		}
+	}
 	for _, cookie := range r.Cookies {
 		req.AddCookie(cookie)
 	}
@@ -1764,15 +2974,86 @@ func (c *Client) roundTrip(r *Request) (resp *Response, err error) {
 		}
 		ctx = context.WithValue(ctx, wrapResponseBodyKey, wrap)
 	}
-	if ctx != nil {
-		req = req.WithContext(ctx)
+	if r.forceHttpVersion != "" {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		ctx = context.WithValue(ctx, forceHttpVersionKey, r.forceHttpVersion)
+	}
+	if r.isWebSocket {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		ctx = context.WithValue(ctx, webSocketKey, true)
+	}
+	if r.webTransport != nil {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		ctx = context.WithValue(ctx, webTransportKey, r.webTransport)
+	}
+	if c.proxySelector != nil {
+		if u := c.proxySelector(r); u != nil {
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			ctx = transport.WithProxy(ctx, u)
+		}
+	}
+	if r.rawHeaderBlock != nil {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		ctx = context.WithValue(ctx, rawHeaderBlockKey, r.rawHeaderBlock)
+	}
+	if r.tlsHandshakeTimeout > 0 {
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		ctx = transport.WithTLSHandshakeTimeout(ctx, r.tlsHandshakeTimeout)
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if c.responseHeaderOrder {
+		ctx = transport.WithResponseHeaderOrderHook(ctx, func(names []string) {
+			resp.headerOrder = names
+		})
 	}
+	ctx = context.WithValue(ctx, h2internal.ServerSettingsHookKey{}, func(settings []http2.Setting) {
+		resp.serverHTTP2Settings = settings
+	})
+	if c.t3 != nil {
+		ctx = context.WithValue(ctx, h3internal.StreamIDHookKey{}, func(id quic.StreamID) {
+			resp.http3StreamID = &id
+		})
+	}
+	req = req.WithContext(ctx)
 	r.RawRequest = req
 	r.StartTime = time.Now()
 
+	httpClient := c.httpClient
+	if r.impersonateClient != nil {
+		// use the transport of the impersonated client, which has its own
+		// connection pool, so connections with incompatible tls fingerprint
+		// or http2 settings are never reused.
+		hc := *c.httpClient
+		hc.Transport = r.impersonateClient.Transport
+		httpClient = &hc
+	}
+	if (r.isWebSocket || r.extendedConnectProtocol != "") && httpClient.Timeout > 0 {
+		// the timeout would close the tunnel.
+		hc := *httpClient
+		hc.Timeout = 0
+		httpClient = &hc
+	}
+
 	var httpResponse *http.Response
-	httpResponse, resp.Err = c.httpClient.Do(r.RawRequest)
+	httpResponse, resp.Err = httpClient.Do(r.RawRequest)
 	resp.Response = httpResponse
+	if c.impersonateLogger != nil {
+		c.impersonateLogger(c.impersonateLogEntry(resp))
+	}
 
 	// auto-read response body if possible
 	if resp.Err == nil && !c.disableAutoReadResponse && !r.isSaveResponse && !r.disableAutoReadResponse && resp.StatusCode > 199 {
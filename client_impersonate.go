@@ -3,44 +3,57 @@ package req
 import (
 	"crypto/rand"
 	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 	"math/big"
+	mathrand "math/rand"
+	mathrandv2 "math/rand/v2"
+	"net/http"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/imroc/req/v3/http2"
+	"github.com/imroc/req/v3/http3"
 	utls "github.com/refraction-networking/utls"
+	"golang.org/x/net/http/httpguts"
 )
 
 // Identical for both Blink-based browsers (Chrome, Chromium, etc.) and WebKit-based browsers (Safari, etc.)
 // Blink implementation: https://source.chromium.org/chromium/chromium/src/+/main:third_party/blink/renderer/platform/network/form_data_encoder.cc;drc=1d694679493c7b2f7b9df00e967b4f8699321093;l=130
 // WebKit implementation: https://github.com/WebKit/WebKit/blob/47eea119fe9462721e5cc75527a4280c6d5f5214/Source/WebCore/platform/network/FormDataBuilder.cpp#L120
-func webkitMultipartBoundaryFunc() string {
+func webkitMultipartBoundary(r io.Reader) (string, error) {
 	const letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789AB"
 
 	sb := strings.Builder{}
 	sb.WriteString("----WebKitFormBoundary")
 
 	for i := 0; i < 16; i++ {
-		index, err := rand.Int(rand.Reader, big.NewInt(int64(len(letters)-1)))
+		index, err := rand.Int(r, big.NewInt(int64(len(letters)-1)))
 		if err != nil {
-			panic(err)
+			return "", err
 		}
 
 		sb.WriteByte(letters[index.Int64()])
 	}
 
-	return sb.String()
+	return sb.String(), nil
 }
 
 // Firefox implementation: https://searchfox.org/mozilla-central/source/dom/html/HTMLFormSubmission.cpp#355
-func firefoxMultipartBoundaryFunc() string {
+func firefoxMultipartBoundary(r io.Reader) (string, error) {
 	sb := strings.Builder{}
 	sb.WriteString("-------------------------")
 
 	for i := 0; i < 3; i++ {
 		var b [8]byte
-		if _, err := rand.Read(b[:]); err != nil {
-			panic(err)
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return "", err
 		}
 		u32 := binary.LittleEndian.Uint32(b[:])
 		s := strconv.FormatUint(uint64(u32), 10)
@@ -48,7 +61,36 @@ func firefoxMultipartBoundaryFunc() string {
 		sb.WriteString(s)
 	}
 
-	return sb.String()
+	return sb.String(), nil
+}
+
+// defaultMultipartBoundary is the same as the boundary generated by
+// mime/multipart, which is used if the boundary rand is set by
+// SetMultipartBoundaryRand without impersonating a browser.
+func defaultMultipartBoundary(r io.Reader) (string, error) {
+	var buf [30]byte
+	if _, err := io.ReadFull(r, buf[:]); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", buf[:]), nil
+}
+
+// newMultipartBoundary generates the multipart boundary with the boundary rand
+// of the client, returns an empty string to use the default boundary of
+// mime/multipart if it's not necessary.
+func (c *Client) newMultipartBoundary() (string, error) {
+	gen := c.multipartBoundaryGen
+	if gen == nil {
+		if c.multipartBoundaryRand == nil {
+			return "", nil
+		}
+		gen = defaultMultipartBoundary
+	}
+	r := c.multipartBoundaryRand
+	if r == nil {
+		r = rand.Reader
+	}
+	return gen(r)
 }
 
 var (
@@ -84,14 +126,19 @@ var (
 
 	chromeHeaderOrder = []string{
 		"host",
+		"connection",
+		"content-length",
 		"pragma",
 		"cache-control",
 		"sec-ch-ua",
 		"sec-ch-ua-mobile",
 		"sec-ch-ua-platform",
+		"origin",
+		"content-type",
 		"upgrade-insecure-requests",
 		"user-agent",
 		"accept",
+		"x-client-data",
 		"sec-fetch-site",
 		"sec-fetch-mode",
 		"sec-fetch-user",
@@ -100,12 +147,13 @@ var (
 		"accept-encoding",
 		"accept-language",
 		"cookie",
+		"priority",
 	}
 
 	chromeHeaders = map[string]string{
 		"pragma":                    "no-cache",
 		"cache-control":             "no-cache",
-		"sec-ch-ua":                 `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`,
+		"sec-ch-ua":                 buildChromeClientHints(120)["sec-ch-ua"],
 		"sec-ch-ua-mobile":          "?0",
 		"sec-ch-ua-platform":        `"macOS"`,
 		"upgrade-insecure-requests": "1",
@@ -115,6 +163,7 @@ var (
 		"sec-fetch-mode":            "navigate",
 		"sec-fetch-user":            "?1",
 		"sec-fetch-dest":            "document",
+		"accept-encoding":           "gzip, deflate, br",
 		"accept-language":           "zh-CN,zh;q=0.9",
 	}
 
@@ -123,22 +172,695 @@ var (
 		Exclusive: true,
 		Weight:    255,
 	}
+
+	// chromeHttp3Settings is the http3 settings of Chrome, the
+	// QPACK_MAX_TABLE_CAPACITY (65536 in Chrome) is not sent as the QPACK
+	// decoder does not support the dynamic table, it can be sent with
+	// SetHTTP3QPACKMaxTableCapacity at your own risk.
+	chromeHttp3Settings = &http3.Settings{
+		Datagram: true,
+		GREASE:   true,
+		Other: []http3.Setting{
+			{
+				ID:  http3.SettingMaxFieldSectionSize,
+				Val: 262144,
+			},
+			{
+				ID:  http3.SettingQpackBlockedStreams,
+				Val: 100,
+			},
+			{
+				ID:  http3.SettingH3Datagram,
+				Val: 1,
+			},
+		},
+	}
+
+	chrome131Http2Settings = []http2.Setting{
+		{
+			ID:  http2.SettingHeaderTableSize,
+			Val: 65536,
+		},
+		{
+			ID:  http2.SettingEnablePush,
+			Val: 0,
+		},
+		{
+			ID:  http2.SettingInitialWindowSize,
+			Val: 6291456,
+		},
+		{
+			ID:  http2.SettingMaxHeaderListSize,
+			Val: 262144,
+		},
+	}
+
+	// chrome100Http2Settings is the http2 settings of Chrome before 106,
+	// which does not disable the server push explicitly.
+	chrome100Http2Settings = []http2.Setting{
+		{
+			ID:  http2.SettingHeaderTableSize,
+			Val: 65536,
+		},
+		{
+			ID:  http2.SettingMaxConcurrentStreams,
+			Val: 1000,
+		},
+		{
+			ID:  http2.SettingInitialWindowSize,
+			Val: 6291456,
+		},
+		{
+			ID:  http2.SettingMaxHeaderListSize,
+			Val: 262144,
+		},
+	}
+)
+
+// chromePriorityHeaderVersion is the first Chrome version which sends the
+// RFC 9218 priority header.
+const chromePriorityHeaderVersion = 124
+
+// chromeZstdVersion is the first Chrome version which advertises zstd in the
+// accept-encoding header.
+const chromeZstdVersion = 123
+
+const chromeUserAgentFormat = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%d.0.0.0 Safari/537.36"
+
+// ClientHintBrand is a brand in the brand list of the sec-ch-ua header.
+type ClientHintBrand struct {
+	Brand   string
+	Version string
+}
+
+// formatClientHintBrands formats the brand list as the value of sec-ch-ua
+// header, the order of the brands is kept as is.
+func formatClientHintBrands(brands []ClientHintBrand) string {
+	var sb strings.Builder
+	for i, b := range brands {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString(strconv.Quote(b.Brand))
+		sb.WriteString(";v=")
+		sb.WriteString(strconv.Quote(b.Version))
+	}
+	return sb.String()
+}
+
+// chromeLegacyGreaseBrandVersion is the last Chrome version which sends the
+// legacy GREASE brand " Not A;Brand" at the first of the brand list.
+const chromeLegacyGreaseBrandVersion = 102
+
+var (
+	// chromeGreaseChars and chromeGreaseVersions generate the GREASE brand
+	// of the brand list from the Chromium major version, like
+	// GetGreasedUserAgentBrandVersion of Chromium.
+	chromeGreaseChars    = []string{" ", "(", ":", "-", ".", "/", ")", ";", "=", "?", "_"}
+	chromeGreaseVersions = []string{"8", "99", "24"}
+	// chromeBrandOrders is the positions of the GREASE brand, Chromium and
+	// the browser brand in the brand list, chosen by the Chromium major
+	// version, like ShuffleBrandList of Chromium.
+	chromeBrandOrders = [][3]int{{0, 1, 2}, {0, 2, 1}, {1, 0, 2}, {1, 2, 0}, {2, 0, 1}, {2, 1, 0}}
 )
 
-// ImpersonateChrome impersonates Chrome browser (version 120).
+// chromiumBrands returns the brand list of the Chromium based browser, which
+// is the GREASE brand, Chromium and the browser brand shuffled by the Chromium
+// major version, the versions are the full versions if full is true.
+func chromiumBrands(brand string, brandMajor, chromiumMajor int, full bool) []ClientHintBrand {
+	version := func(v string) string {
+		if full {
+			return v + ".0.0.0"
+		}
+		return v
+	}
+	chromium := ClientHintBrand{"Chromium", version(strconv.Itoa(chromiumMajor))}
+	browser := ClientHintBrand{brand, version(strconv.Itoa(brandMajor))}
+	if chromiumMajor <= chromeLegacyGreaseBrandVersion {
+		return []ClientHintBrand{{" Not A;Brand", version("99")}, chromium, browser}
+	}
+	n := len(chromeGreaseChars)
+	grease := ClientHintBrand{
+		Brand:   "Not" + chromeGreaseChars[chromiumMajor%n] + "A" + chromeGreaseChars[(chromiumMajor+1)%n] + "Brand",
+		Version: version(chromeGreaseVersions[chromiumMajor%len(chromeGreaseVersions)]),
+	}
+	order := chromeBrandOrders[chromiumMajor%len(chromeBrandOrders)]
+	brands := make([]ClientHintBrand, 3)
+	for i, b := range []ClientHintBrand{grease, chromium, browser} {
+		brands[order[i]] = b
+	}
+	return brands
+}
+
+// chromiumClientHints returns the client hint headers of the Chromium based
+// browser on desktop macOS.
+func chromiumClientHints(brand string, brandMajor, chromiumMajor int) map[string]string {
+	return map[string]string{
+		"sec-ch-ua":                   formatClientHintBrands(chromiumBrands(brand, brandMajor, chromiumMajor, false)),
+		"sec-ch-ua-full-version-list": formatClientHintBrands(chromiumBrands(brand, brandMajor, chromiumMajor, true)),
+		"sec-ch-ua-mobile":            "?0",
+		"sec-ch-ua-platform":          `"macOS"`,
+	}
+}
+
+// buildChromeClientHints returns the client hint headers of the Chrome major
+// version.
+func buildChromeClientHints(major int) map[string]string {
+	return chromiumClientHints("Google Chrome", major, major)
+}
+
+// ChromeClientHints returns the client hint headers of the specified major
+// version of Chrome on desktop macOS, which are sec-ch-ua, sec-ch-ua-mobile,
+// sec-ch-ua-platform and sec-ch-ua-full-version-list, the GREASE brand and the
+// order of the brands are generated from the version like Chrome does, e.g.
+// `"Google Chrome";v="131", "Chromium";v="131", "Not_A Brand";v="24"` for 131.
+// The full versions are reduced to "<major>.0.0.0" like the user-agent. Note
+// Chrome only sends sec-ch-ua-full-version-list when the server asks for it by
+// Accept-CH, so it is not in the Chrome profiles.
+func ChromeClientHints(major int) map[string]string {
+	return buildChromeClientHints(major)
+}
+
+// chromeVersion holds the parts of the Chrome fingerprint which vary
+// between major versions.
+type chromeVersion struct {
+	major         int
+	clientHelloID utls.ClientHelloID
+	http2Settings []http2.Setting
+}
+
+// chromeVersions is the list of supported Chrome versions, sorted by
+// major version in ascending order.
+var chromeVersions = []chromeVersion{
+	{
+		major:         100,
+		clientHelloID: utls.HelloChrome_100,
+		http2Settings: chrome100Http2Settings,
+	},
+	{
+		major:         102,
+		clientHelloID: utls.HelloChrome_102,
+		http2Settings: chrome100Http2Settings,
+	},
+	{
+		major:         106,
+		clientHelloID: utls.HelloChrome_106_Shuffle,
+		http2Settings: chromeHttp2Settings,
+	},
+	{
+		major:         112,
+		clientHelloID: utls.HelloChrome_112_PSK_Shuf,
+		http2Settings: chromeHttp2Settings,
+	},
+	{
+		major:         114,
+		clientHelloID: utls.HelloChrome_114_Padding_PSK_Shuf,
+		http2Settings: chromeHttp2Settings,
+	},
+	{
+		// the post-quantum key share is not enabled by default until Chrome
+		// 124, so Chrome 115 sends the same ClientHello as Chrome 114.
+		major:         115,
+		clientHelloID: utls.HelloChrome_114_Padding_PSK_Shuf,
+		http2Settings: chromeHttp2Settings,
+	},
+	{
+		major:         120,
+		clientHelloID: utls.HelloChrome_120,
+		http2Settings: chromeHttp2Settings,
+	},
+	{
+		major:         131,
+		clientHelloID: utls.HelloChrome_131,
+		http2Settings: chrome131Http2Settings,
+	},
+}
+
+// closestChromeVersion returns the supported Chrome version closest to
+// major, the newer one wins if two versions are equally close.
+func closestChromeVersion(major int) chromeVersion {
+	best := chromeVersions[len(chromeVersions)-1]
+	for i := len(chromeVersions) - 2; i >= 0; i-- {
+		v := chromeVersions[i]
+		if absInt(v.major-major) < absInt(best.major-major) {
+			best = v
+		}
+	}
+	return best
+}
+
+func absInt(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+// headers returns the common headers of this Chrome version.
+func (v chromeVersion) headers() map[string]string {
+	hdrs := make(map[string]string, len(chromeHeaders))
+	for k, val := range chromeHeaders {
+		hdrs[k] = val
+	}
+	hdrs["sec-ch-ua"] = buildChromeClientHints(v.major)["sec-ch-ua"]
+	hdrs["user-agent"] = fmt.Sprintf(chromeUserAgentFormat, v.major)
+	if v.major >= chromePriorityHeaderVersion {
+		hdrs["priority"] = formatPriorityHeader(0, true)
+	}
+	if v.major >= chromeZstdVersion {
+		hdrs["accept-encoding"] = "gzip, deflate, br, zstd"
+	}
+	return hdrs
+}
+
+// ChromeVersions returns the Chrome major versions supported by
+// ImpersonateChromeVersion in ascending order.
+func ChromeVersions() []int {
+	versions := make([]int, len(chromeVersions))
+	for i, v := range chromeVersions {
+		versions[i] = v.major
+	}
+	return versions
+}
+
+// ChromeProfile returns the BrowserProfile of Chrome browser (the newest
+// supported version).
+func ChromeProfile() BrowserProfile {
+	return ChromeVersionProfile(chromeVersions[len(chromeVersions)-1].major)
+}
+
+// ChromeVersionProfile returns the BrowserProfile of the specified major version
+// of Chrome browser, the closest supported version is used if the version is not
+// supported.
+func ChromeVersionProfile(major int) BrowserProfile {
+	v := closestChromeVersion(major)
+	return chromiumProfile(v, chromeHeaderOrder, v.headers())
+}
+
+// ImpersonateChrome impersonates Chrome browser (the newest supported version).
 func (c *Client) ImpersonateChrome() *Client {
-	c.
-		SetTLSFingerprint(utls.HelloChrome_120).
-		SetHTTP2SettingsFrame(chromeHttp2Settings...).
-		SetHTTP2ConnectionFlow(15663105).
-		SetCommonPseudoHeaderOder(chromePseudoHeaderOrder...).
-		SetCommonHeaderOrder(chromeHeaderOrder...).
-		SetCommonHeaders(chromeHeaders).
-		SetHTTP2HeaderPriority(chromeHeaderPriority).
-		SetMultipartBoundaryFunc(webkitMultipartBoundaryFunc)
+	return c.ImpersonateChromeVersion(chromeVersions[len(chromeVersions)-1].major)
+}
+
+// ImpersonateChrome100 impersonates Chrome browser (version 100).
+func (c *Client) ImpersonateChrome100() *Client {
+	return c.ImpersonateChromeVersion(100)
+}
+
+// ImpersonateChrome102 impersonates Chrome browser (version 102).
+func (c *Client) ImpersonateChrome102() *Client {
+	return c.ImpersonateChromeVersion(102)
+}
+
+// ImpersonateChrome106 impersonates Chrome browser (version 106).
+func (c *Client) ImpersonateChrome106() *Client {
+	return c.ImpersonateChromeVersion(106)
+}
+
+// ImpersonateChrome112 impersonates Chrome browser (version 112).
+func (c *Client) ImpersonateChrome112() *Client {
+	return c.ImpersonateChromeVersion(112)
+}
+
+// ImpersonateChrome114 impersonates Chrome browser (version 114).
+func (c *Client) ImpersonateChrome114() *Client {
+	return c.ImpersonateChromeVersion(114)
+}
+
+// ImpersonateChrome115 impersonates Chrome browser (version 115).
+func (c *Client) ImpersonateChrome115() *Client {
+	return c.ImpersonateChromeVersion(115)
+}
+
+// ImpersonateChrome120 impersonates Chrome browser (version 120).
+func (c *Client) ImpersonateChrome120() *Client {
+	return c.ImpersonateChromeVersion(120)
+}
+
+// ImpersonateChrome131 impersonates Chrome browser (version 131).
+func (c *Client) ImpersonateChrome131() *Client {
+	return c.ImpersonateChromeVersion(131)
+}
+
+// ImpersonateChromeVersion impersonates the specified major version of Chrome
+// browser, the TLS fingerprint, HTTP2 settings, user-agent and sec-ch-ua are
+// all kept consistent with that version. The supported versions are 100, 102,
+// 106, 112, 114, 115, 120 and 131 (see ChromeVersions), if the version is not
+// supported, the closest supported version is used instead, call
+// GetImpersonateChromeVersion to get the version which is actually used.
+func (c *Client) ImpersonateChromeVersion(major int) *Client {
+	v := closestChromeVersion(major)
+	if v.major != major {
+		c.Debugf("chrome version %d is not supported, impersonate chrome %d instead", major, v.major)
+	}
+	c.ApplyProfile(chromiumProfile(v, chromeHeaderOrder, v.headers()))
+	c.impersonateChromeVersion = v.major
+	return c
+}
+
+// The http2 connection flow of the browsers, which is the delta of the initial
+// connection-level WINDOW_UPDATE frame sent right after the SETTINGS frame.
+const (
+	chromeHttp2ConnectionFlow   = 15663105
+	firefoxHttp2ConnectionFlow  = 12517377
+	safariHttp2ConnectionFlow   = 10485760
+	safari18Http2ConnectionFlow = 10420225
+
+	// browserMaxHeaderFrameSize is the default http2 frame size, which the
+	// browsers split the header blocks at regardless of the server setting.
+	browserMaxHeaderFrameSize = 16384
+
+	// firefoxHttp2PingInterval is the network.http.http2.ping-threshold of
+	// Firefox, which pings the connection that has received nothing for it.
+	firefoxHttp2PingInterval = 58 * time.Second
+)
+
+// chromePingPayload returns the data of the PING frames sent by Chrome, which
+// is the odd sequence numbers 1, 3, 5... in big-endian.
+func chromePingPayload(seq uint64) (p [8]byte) {
+	binary.BigEndian.PutUint64(p[:], seq*2+1)
+	return
+}
+
+// firefoxPingPayload returns the data of the PING frames sent by Firefox,
+// which is all zeros.
+func firefoxPingPayload(seq uint64) (p [8]byte) {
+	return
+}
+
+// chromiumProfile returns the profile of a Chromium based browser, which shares
+// the tls fingerprint and HTTP2 settings of the Chrome version v.
+func chromiumProfile(v chromeVersion, headerOrder []string, hdrs map[string]string) BrowserProfile {
+	return BrowserProfile{
+		ClientHelloID:           v.clientHelloID,
+		HTTP2Settings:           v.http2Settings,
+		HTTP2ConnectionFlow:     chromeHttp2ConnectionFlow,
+		HTTP2MaxHeaderFrameSize: browserMaxHeaderFrameSize,
+		HTTP2PingPayload:        chromePingPayload,
+		PseudoHeaderOrder:       chromePseudoHeaderOrder,
+		HeaderOrder:             headerOrder,
+		Headers:                 hdrs,
+		HeaderPriority:          chromeHeaderPriority,
+		HTTP3Settings:           chromeHttp3Settings,
+		multipartBoundary:       webkitMultipartBoundary,
+	}.clone()
+}
+
+// GetImpersonateChromeVersion returns the Chrome major version used by the
+// last call of ImpersonateChrome or ImpersonateChromeVersion, returns 0 if
+// Chrome is not impersonated.
+func (c *Client) GetImpersonateChromeVersion() int {
+	return c.impersonateChromeVersion
+}
+
+var chromeAndroidHeaders = map[string]string{
+	"sec-ch-ua-mobile":   "?1",
+	"sec-ch-ua-platform": `"Android"`,
+	"user-agent":         "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Mobile Safari/537.36",
+}
+
+// ChromeAndroidProfile returns the BrowserProfile of Chrome browser on Android
+// (version 131).
+//
+// The http2 SETTINGS and the connection-level WINDOW_UPDATE are the desktop
+// ones (1:65536;2:0;4:6291456;6:262144|15663105 in the akamai fingerprint),
+// as both are hardcoded in the network stack shared by Chrome on all
+// platforms, only the headers differ.
+func ChromeAndroidProfile() BrowserProfile {
+	v := closestChromeVersion(131)
+	return chromiumProfile(v, chromeHeaderOrder, mergeProfileHeaders(v.headers(), chromeAndroidHeaders))
+}
+
+// ImpersonateChromeAndroid impersonates Chrome browser on Android (version 131).
+// Chrome on Android uses the same BoringSSL ClientHello as the desktop one, so
+// the tls fingerprint is the same as ImpersonateChrome131.
+func (c *Client) ImpersonateChromeAndroid() *Client {
+	return c.ApplyProfile(ChromeAndroidProfile())
+}
+
+// ChromeWindowsProfile returns the BrowserProfile of Chrome browser on Windows
+// (the newest supported version), which only differs from ChromeProfile in the
+// platform of the user-agent and sec-ch-ua-platform headers.
+func ChromeWindowsProfile() BrowserProfile {
+	v := chromeVersions[len(chromeVersions)-1]
+	hdrs := v.headers()
+	p := impersonatePlatforms["windows"]
+	hdrs["sec-ch-ua-platform"] = strconv.Quote(p.name)
+	hdrs["user-agent"] = rewriteUserAgentPlatform(hdrs["user-agent"], p)
+	return chromiumProfile(v, chromeHeaderOrder, hdrs)
+}
+
+// ImpersonateChromeWindows impersonates Chrome browser on Windows (the newest
+// supported version), which is the most common platform of Chrome. Chrome uses
+// the same BoringSSL ClientHello and http2 settings on all desktop platforms,
+// so only the user-agent and sec-ch-ua-platform headers differ from
+// ImpersonateChrome.
+func (c *Client) ImpersonateChromeWindows() *Client {
+	c.ApplyProfile(ChromeWindowsProfile())
+	c.impersonateChromeVersion = chromeVersions[len(chromeVersions)-1].major
+	return c
+}
+
+// chromeHeadlessHeaders is the headers of Chrome 131 in the new headless mode
+// (--headless=new, the only headless mode of Chrome since 132) on Linux, which
+// still sends the "HeadlessChrome" brand in the user-agent and sec-ch-ua unless
+// they are overridden, with the default language of the headless browser.
+var chromeHeadlessHeaders = map[string]string{
+	"sec-ch-ua":          chromiumClientHints("HeadlessChrome", 131, 131)["sec-ch-ua"],
+	"sec-ch-ua-platform": `"Linux"`,
+	"user-agent":         "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/131.0.0.0 Safari/537.36",
+	"accept-language":    "en-US,en;q=0.9",
+}
+
+// ChromeHeadlessProfile returns the BrowserProfile of Chrome in the new
+// headless mode on Linux (version 131).
+func ChromeHeadlessProfile() BrowserProfile {
+	v := closestChromeVersion(131)
+	return chromiumProfile(v, chromeHeaderOrder, mergeProfileHeaders(v.headers(), chromeHeadlessHeaders))
+}
+
+// ImpersonateChromeHeadless impersonates Chrome in the new headless mode on
+// Linux (version 131), e.g. to see what the headless detection of a site sees
+// from an unmodified headless browser driven by Puppeteer or Playwright. The new
+// headless mode runs the same network stack as the headed Chrome, so the tls
+// fingerprint and http2 settings are the same as ImpersonateChrome131, but the
+// user-agent and sec-ch-ua headers carry the "HeadlessChrome" brand instead of
+// "Google Chrome", and the platform and language are the defaults of a Linux
+// server. Use ImpersonateChrome to look like a headed Chrome instead.
+func (c *Client) ImpersonateChromeHeadless() *Client {
+	return c.ApplyProfile(ChromeHeadlessProfile())
+}
+
+var edgeHeaders = map[string]string{
+	"sec-ch-ua":       chromiumClientHints("Microsoft Edge", 131, 131)["sec-ch-ua"],
+	"user-agent":      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36 Edg/131.0.0.0",
+	"accept-language": "zh-CN,zh;q=0.9,en;q=0.8,en-GB;q=0.7,en-US;q=0.6",
+}
+
+// EdgeProfile returns the BrowserProfile of Microsoft Edge browser (version 131).
+func EdgeProfile() BrowserProfile {
+	v := closestChromeVersion(131)
+	return chromiumProfile(v, chromeHeaderOrder, mergeProfileHeaders(v.headers(), edgeHeaders))
+}
+
+// ImpersonateEdge impersonates Microsoft Edge browser (version 131), which
+// shares the fingerprint of Chrome except the user-agent, sec-ch-ua and
+// accept-language headers.
+func (c *Client) ImpersonateEdge() *Client {
+	return c.ApplyProfile(EdgeProfile())
+}
+
+// ImpersonateCustomEdge impersonates Microsoft Edge browser like ImpersonateEdge,
+// but with the headers and the raw ClientHello captured from a real Edge browser,
+// the captured headers override the default ones, and the tls fingerprint is
+// taken from rawClientHello if it's not empty. The headerOrder captured from the
+// real browser, if passed, overrides the default header order, so the extra
+// headers (e.g. x-client-data) are sent where the real browser sends them.
+func (c *Client) ImpersonateCustomEdge(hdrs http.Header, rawClientHello []byte, headerOrder ...string) *Client {
+	return c.impersonateCustom(EdgeProfile(), hdrs, rawClientHello, headerOrder)
+}
+
+// SetClientHintBrands set the brand list of the sec-ch-ua header, the brands
+// are sent in the order given, which overrides the list generated from the
+// version of the impersonated Chromium based browser, e.g. to place the GREASE
+// brand where the real browser does:
+//
+//	client.ImpersonateEdge().SetClientHintBrands(
+//	    req.ClientHintBrand{Brand: "Not_A Brand", Version: "8"},
+//	    req.ClientHintBrand{Brand: "Chromium", Version: "120"},
+//	    req.ClientHintBrand{Brand: "Microsoft Edge", Version: "120"},
+//	)
+//
+// Call it without brands to remove the sec-ch-ua header.
+func (c *Client) SetClientHintBrands(brands ...ClientHintBrand) *Client {
+	if len(brands) == 0 {
+		c.Headers.Del("sec-ch-ua")
+		c.resetImpersonateClients()
+		return c
+	}
+	return c.SetCommonHeader("sec-ch-ua", formatClientHintBrands(brands))
+}
+
+// mergeProfileHeaders returns a copy of base overridden by overrides.
+func mergeProfileHeaders(base, overrides map[string]string) map[string]string {
+	hdrs := make(map[string]string, len(base)+len(overrides))
+	for k, v := range base {
+		hdrs[k] = v
+	}
+	for k, v := range overrides {
+		hdrs[k] = v
+	}
+	return hdrs
+}
+
+// mergeHeaders returns the profile headers overridden by the headers captured
+// from a real browser, all values of the captured headers are preserved.
+func mergeHeaders(profile map[string]string, actual http.Header) http.Header {
+	hdrs := make(http.Header, len(profile)+len(actual))
+	for k, v := range profile {
+		hdrs.Set(k, v)
+	}
+	for k, vs := range actual {
+		vs = slices.DeleteFunc(slices.Clone(vs), func(v string) bool {
+			return v == ""
+		})
+		if len(vs) > 0 {
+			hdrs[http.CanonicalHeaderKey(k)] = vs
+		}
+	}
+	return hdrs
+}
+
+// mergeHeaderOrder returns the header order captured from a real browser, with
+// the headers of the profile order which are not captured inserted right after
+// the header preceding them in the profile order, so the extra headers sent by
+// the real browser stay where they were captured.
+func mergeHeaderOrder(profile, actual []string) []string {
+	order, _ := normalizeHeaderOrder(actual)
+	pos := -1
+	for _, key := range profile {
+		if i := slices.Index(order, key); i >= 0 {
+			pos = i
+			continue
+		}
+		pos++
+		order = slices.Insert(order, pos, key)
+	}
+	return order
+}
+
+// impersonateCustom applies the profile p with the headers captured from a real
+// browser, which override the profile headers, and the tls fingerprint is taken
+// from rawClientHello if it's not empty. The captured headerOrder, if not empty,
+// overrides the header order of the profile, see mergeHeaderOrder.
+func (c *Client) impersonateCustom(p BrowserProfile, hdrs http.Header, rawClientHello []byte, headerOrder []string) *Client {
+	// the fetch mode is applied after the captured headers are merged.
+	mode := c.impersonateFetchMode
+	c.impersonateFetchMode = ""
+	c.ApplyProfile(p)
+	c.impersonateFetchMode = mode
+	for k, vs := range mergeHeaders(p.Headers, hdrs) {
+		c.Headers[k] = vs
+	}
+	if len(headerOrder) > 0 {
+		c.SetCommonHeaderOrder(mergeHeaderOrder(p.HeaderOrder, headerOrder)...)
+	}
+	c.applyImpersonatePlatform()
+	c.applyImpersonateLanguages()
+	c.applyImpersonateFetchMode()
+	c.applyImpersonateClientHints()
+	c.applyImpersonateTE()
+	c.applyImpersonateAcceptEncoding()
+	if len(rawClientHello) > 0 {
+		c.SetCustomTLSFingerprint(rawClientHello)
+	}
 	return c
 }
 
+var (
+	// braveRemovedHeaders is the headers of Chrome profile which Brave
+	// does not send.
+	braveRemovedHeaders = []string{
+		"pragma",
+		"cache-control",
+	}
+
+	braveHeaderOrder = []string{
+		"host",
+		"connection",
+		"content-length",
+		"sec-ch-ua",
+		"sec-ch-ua-mobile",
+		"sec-ch-ua-platform",
+		"origin",
+		"content-type",
+		"upgrade-insecure-requests",
+		"user-agent",
+		"accept",
+		"sec-gpc",
+		"accept-language",
+		"sec-fetch-site",
+		"sec-fetch-mode",
+		"sec-fetch-user",
+		"sec-fetch-dest",
+		"referer",
+		"accept-encoding",
+		"cookie",
+		"priority",
+	}
+
+	braveHeaders = map[string]string{
+		"sec-ch-ua":       chromiumClientHints("Brave", 131, 131)["sec-ch-ua"],
+		"accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8",
+		"sec-gpc":         "1",
+		"accept-language": "zh-CN,zh;q=0.5",
+	}
+)
+
+// BraveProfile returns the BrowserProfile of Brave browser (version 131).
+func BraveProfile() BrowserProfile {
+	v := closestChromeVersion(131)
+	hdrs := mergeProfileHeaders(v.headers(), braveHeaders)
+	for _, h := range braveRemovedHeaders {
+		delete(hdrs, h)
+	}
+	return chromiumProfile(v, braveHeaderOrder, hdrs)
+}
+
+// ImpersonateBrave impersonates Brave browser (version 131), which is based on
+// the Chrome profile, but without the headers that Brave does not send, and
+// with the reduced accept-language and the sec-gpc header that Brave sends.
+func (c *Client) ImpersonateBrave() *Client {
+	return c.ApplyProfile(BraveProfile())
+}
+
+var operaHeaders = map[string]string{
+	// the brands of Opera 106 are shuffled by its Chromium version 120.
+	"sec-ch-ua":  chromiumClientHints("Opera", 106, 120)["sec-ch-ua"],
+	"user-agent": "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 OPR/106.0.0.0",
+}
+
+// OperaProfile returns the BrowserProfile of Opera browser (version 106).
+func OperaProfile() BrowserProfile {
+	return chromiumProfile(closestChromeVersion(120), chromeHeaderOrder, mergeProfileHeaders(chromeHeaders, operaHeaders))
+}
+
+// ImpersonateOpera impersonates Opera browser (version 106, based on Chromium
+// 120), which shares the fingerprint of Chrome 120 except the user-agent and
+// sec-ch-ua headers.
+func (c *Client) ImpersonateOpera() *Client {
+	return c.ApplyProfile(OperaProfile())
+}
+
+// ImpersonateCustomOpera impersonates Opera browser like ImpersonateOpera,
+// but with the headers and the raw ClientHello captured from a real Opera browser,
+// the captured headers override the default ones, and the tls fingerprint is
+// taken from rawClientHello if it's not empty. The captured headerOrder, if
+// passed, overrides the default header order like ImpersonateCustomEdge.
+func (c *Client) ImpersonateCustomOpera(hdrs http.Header, rawClientHello []byte, headerOrder ...string) *Client {
+	return c.impersonateCustom(OperaProfile(), hdrs, rawClientHello, headerOrder)
+}
+
 var (
 	firefoxHttp2Settings = []http2.Setting{
 		{
@@ -155,6 +877,27 @@ var (
 		},
 	}
 
+	// firefoxHttp3Settings is the http3 settings of Firefox, see
+	// chromeHttp3Settings for why QPACK_MAX_TABLE_CAPACITY is not sent.
+	firefoxHttp3Settings = &http3.Settings{
+		Datagram:        true,
+		ExtendedConnect: true,
+		Other: []http3.Setting{
+			{
+				ID:  http3.SettingQpackBlockedStreams,
+				Val: 20,
+			},
+			{
+				ID:  http3.SettingH3Datagram,
+				Val: 1,
+			},
+			{
+				ID:  http3.SettingEnableConnectProtocol,
+				Val: 1,
+			},
+		},
+	}
+
 	firefoxPriorityFrames = []http2.PriorityFrame{
 		{
 			StreamID: 3,
@@ -214,10 +957,15 @@ var (
 	}
 
 	firefoxHeaderOrder = []string{
+		"host",
 		"user-agent",
 		"accept",
 		"accept-language",
 		"accept-encoding",
+		"content-type",
+		"content-length",
+		"origin",
+		"connection",
 		"referer",
 		"cookie",
 		"upgrade-insecure-requests",
@@ -237,7 +985,8 @@ var (
 		"sec-fetch-mode":            "navigate",
 		"sec-fetch-site":            "same-origin",
 		"sec-fetch-user":            "?1",
-		//"te":                        "trailers",
+		"accept-encoding":           "gzip, deflate, br",
+		"te":                        "trailers", // only sent over HTTP/2 and HTTP/3
 	}
 
 	firefoxHeaderPriority = http2.PriorityParam{
@@ -247,26 +996,263 @@ var (
 	}
 )
 
+const firefoxUserAgentFormat = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:%d.0) Gecko/20100101 Firefox/%d.0"
+
+// firefoxVersion holds the parts of the Firefox fingerprint which vary
+// between major versions.
+type firefoxVersion struct {
+	major         int
+	clientHelloID utls.ClientHelloID
+	http2Settings []http2.Setting
+	// priorityHeader reports whether the RFC 9218 priority header is sent
+	// instead of the http2 PRIORITY frames.
+	priorityHeader bool
+}
+
+// firefoxVersions is the list of supported Firefox versions, sorted by major
+// version in ascending order. utls only defines the ClientHello of some Firefox
+// versions, the other versions use the closest older one, which approximates
+// their tls fingerprint but misses the changes made since, as noted for each
+// version.
+var firefoxVersions = []firefoxVersion{
+	{
+		major:         102,
+		clientHelloID: utls.HelloFirefox_102,
+		http2Settings: firefoxHttp2Settings,
+	},
+	{
+		major:         105,
+		clientHelloID: utls.HelloFirefox_105,
+		http2Settings: firefoxHttp2Settings,
+	},
+	{
+		// approximated by the ClientHello of Firefox 105.
+		major:         115,
+		clientHelloID: utls.HelloFirefox_105,
+		http2Settings: firefoxHttp2Settings,
+	},
+	{
+		major:         120,
+		clientHelloID: utls.HelloFirefox_120,
+		http2Settings: firefoxHttp2Settings,
+	},
+	{
+		// approximated by the ClientHello of Firefox 120.
+		major:          128,
+		clientHelloID:  utls.HelloFirefox_120,
+		http2Settings:  firefoxHttp2Settings,
+		priorityHeader: true,
+	},
+	{
+		// approximated by the ClientHello of Firefox 120.
+		major:          133,
+		clientHelloID:  utls.HelloFirefox_120,
+		http2Settings:  firefox133Http2Settings,
+		priorityHeader: true,
+	},
+}
+
+// closestFirefoxVersion returns the supported Firefox version closest to
+// major, the newer one wins if two versions are equally close.
+func closestFirefoxVersion(major int) firefoxVersion {
+	best := firefoxVersions[len(firefoxVersions)-1]
+	for i := len(firefoxVersions) - 2; i >= 0; i-- {
+		v := firefoxVersions[i]
+		if absInt(v.major-major) < absInt(best.major-major) {
+			best = v
+		}
+	}
+	return best
+}
+
+// profile returns the BrowserProfile of this Firefox version.
+func (v firefoxVersion) profile() BrowserProfile {
+	p := BrowserProfile{
+		ClientHelloID:           v.clientHelloID,
+		HTTP2Settings:           v.http2Settings,
+		HTTP2ConnectionFlow:     firefoxHttp2ConnectionFlow,
+		HTTP2MaxHeaderFrameSize: browserMaxHeaderFrameSize,
+		HTTP2PingInterval:       firefoxHttp2PingInterval,
+		HTTP2PingPayload:        firefoxPingPayload,
+		HTTP2PriorityFrames:     firefoxPriorityFrames,
+		PseudoHeaderOrder:       firefoxPseudoHeaderOrder,
+		HeaderOrder:             firefoxHeaderOrder,
+		Headers:                 firefoxHeaders,
+		HeaderPriority:          firefoxHeaderPriority,
+		HTTP3Settings:           firefoxHttp3Settings,
+		HTTP2SplitCookie:        true,
+		multipartBoundary:       firefoxMultipartBoundary,
+	}
+	if v.priorityHeader {
+		p.HTTP2PriorityFrames = nil
+		p.HeaderOrder = firefox133HeaderOrder
+		p.Headers = firefox133Headers
+		p.HeaderPriority = firefox133HeaderPriority
+	}
+	p.Headers = mergeProfileHeaders(p.Headers, map[string]string{
+		"user-agent": fmt.Sprintf(firefoxUserAgentFormat, v.major, v.major),
+	})
+	return p.clone()
+}
+
+// FirefoxVersions returns the Firefox major versions supported by
+// ImpersonateFirefoxVersion in ascending order.
+func FirefoxVersions() []int {
+	versions := make([]int, len(firefoxVersions))
+	for i, v := range firefoxVersions {
+		versions[i] = v.major
+	}
+	return versions
+}
+
+// FirefoxVersionProfile returns the BrowserProfile of the specified major
+// version of Firefox browser, the closest supported version is used if the
+// version is not supported.
+func FirefoxVersionProfile(major int) BrowserProfile {
+	return closestFirefoxVersion(major).profile()
+}
+
+// FirefoxProfile returns the BrowserProfile of Firefox browser (version 120).
+func FirefoxProfile() BrowserProfile {
+	return FirefoxVersionProfile(120)
+}
+
 // ImpersonateFirefox impersonates Firefox browser (version 120).
 func (c *Client) ImpersonateFirefox() *Client {
-	c.
-		SetTLSFingerprint(utls.HelloFirefox_120).
-		SetHTTP2SettingsFrame(firefoxHttp2Settings...).
-		SetHTTP2ConnectionFlow(12517377).
-		SetHTTP2PriorityFrames(firefoxPriorityFrames...).
-		SetCommonPseudoHeaderOder(firefoxPseudoHeaderOrder...).
-		SetCommonHeaderOrder(firefoxHeaderOrder...).
-		SetCommonHeaders(firefoxHeaders).
-		SetHTTP2HeaderPriority(firefoxHeaderPriority).
-		SetMultipartBoundaryFunc(firefoxMultipartBoundaryFunc)
+	return c.ImpersonateFirefoxVersion(120)
+}
+
+// ImpersonateFirefoxVersion impersonates the specified major version of
+// Firefox browser, the HTTP2 settings and user-agent are kept consistent with
+// that version, and the RFC 9218 priority header is sent instead of the http2
+// PRIORITY frames since Firefox 128. The TLS fingerprint of 115, 128 and 133 is
+// approximated by the closest older one defined by utls (105, 120 and 120). The supported
+// versions are 102, 105, 115 (ESR), 120, 128 (ESR) and 133 (see
+// FirefoxVersions), if the version is not supported, the closest supported
+// version is used instead, call GetImpersonateFirefoxVersion to get the
+// version which is actually used.
+func (c *Client) ImpersonateFirefoxVersion(major int) *Client {
+	v := closestFirefoxVersion(major)
+	if v.major != major {
+		c.Debugf("firefox version %d is not supported, impersonate firefox %d instead", major, v.major)
+	}
+	c.ApplyProfile(v.profile())
+	c.impersonateFirefoxVersion = v.major
 	return c
 }
 
+// GetImpersonateFirefoxVersion returns the Firefox major version used by the
+// last call of ImpersonateFirefox, ImpersonateFirefox133 or
+// ImpersonateFirefoxVersion, returns 0 if Firefox is not impersonated.
+func (c *Client) GetImpersonateFirefoxVersion() int {
+	return c.impersonateFirefoxVersion
+}
+
 var (
-	safariHttp2Settings = []http2.Setting{
+	// firefox133Http2Settings is the http2 settings of newer Firefox, which
+	// disables server push explicitly.
+	firefox133Http2Settings = []http2.Setting{
 		{
-			ID:  http2.SettingInitialWindowSize,
-			Val: 4194304,
+			ID:  http2.SettingHeaderTableSize,
+			Val: 65536,
+		},
+		{
+			ID:  http2.SettingEnablePush,
+			Val: 0,
+		},
+		{
+			ID:  http2.SettingInitialWindowSize,
+			Val: 131072,
+		},
+		{
+			ID:  http2.SettingMaxFrameSize,
+			Val: 16384,
+		},
+	}
+
+	firefox133HeaderOrder = []string{
+		"host",
+		"user-agent",
+		"accept",
+		"accept-language",
+		"accept-encoding",
+		"content-type",
+		"content-length",
+		"origin",
+		"connection",
+		"referer",
+		"cookie",
+		"upgrade-insecure-requests",
+		"sec-fetch-dest",
+		"sec-fetch-mode",
+		"sec-fetch-site",
+		"sec-fetch-user",
+		"priority",
+		"te",
+	}
+
+	// firefox133Headers sends the RFC 9218 priority header, which replaces
+	// the PRIORITY frames sent by older Firefox.
+	firefox133Headers = mergeProfileHeaders(firefoxHeaders, map[string]string{
+		"user-agent":      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:133.0) Gecko/20100101 Firefox/133.0",
+		"accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+		"accept-encoding": "gzip, deflate, br, zstd",
+		"priority":        formatPriorityHeader(0, true),
+	})
+
+	firefox133HeaderPriority = http2.PriorityParam{
+		StreamDep: 0,
+		Exclusive: false,
+		Weight:    41,
+	}
+)
+
+// Firefox133Profile returns the BrowserProfile of Firefox browser (version
+// 133), which sends the RFC 9218 priority header instead of the http2
+// PRIORITY frames. Its TLS fingerprint is approximated by Firefox 120.
+func Firefox133Profile() BrowserProfile {
+	return FirefoxVersionProfile(133)
+}
+
+// ImpersonateFirefox133 impersonates Firefox browser (version 133), which
+// sends the RFC 9218 priority header instead of the http2 PRIORITY frames. Its
+// TLS fingerprint is approximated by Firefox 120.
+func (c *Client) ImpersonateFirefox133() *Client {
+	return c.ImpersonateFirefoxVersion(133)
+}
+
+// torBrowserHeaders is the headers of Tor Browser which differ from Firefox,
+// Tor Browser reports the same Windows user-agent and the same language on
+// all platforms, so all users look alike.
+var torBrowserHeaders = map[string]string{
+	"user-agent":      "Mozilla/5.0 (Windows NT 10.0; rv:128.0) Gecko/20100101 Firefox/128.0",
+	"accept-language": "en-US,en;q=0.5",
+}
+
+// TorBrowserProfile returns the BrowserProfile of Tor Browser (version 14,
+// based on Firefox ESR 128), which shares the tls fingerprint, http2 settings
+// and header order of Firefox 128, but always sends the Windows user-agent and
+// "en-US,en;q=0.5" as the accept-language. Tor Browser never uses HTTP3.
+func TorBrowserProfile() BrowserProfile {
+	p := FirefoxVersionProfile(128)
+	p.Headers = mergeProfileHeaders(p.Headers, torBrowserHeaders)
+	p.HTTP3Settings = nil
+	return p
+}
+
+// ImpersonateTorBrowser impersonates Tor Browser (version 14, based on
+// Firefox ESR 128), see TorBrowserProfile. Note the uniform user-agent and
+// accept-language are overridden if SetImpersonatePlatform,
+// SetImpersonateAcceptLanguage or SetImpersonateSeed is called.
+func (c *Client) ImpersonateTorBrowser() *Client {
+	return c.ApplyProfile(TorBrowserProfile())
+}
+
+var (
+	safariHttp2Settings = []http2.Setting{
+		{
+			ID:  http2.SettingInitialWindowSize,
+			Val: 4194304,
 		},
 		{
 			ID:  http2.SettingMaxConcurrentStreams,
@@ -282,10 +1268,14 @@ var (
 	}
 
 	safariHeaderOrder = []string{
+		"host",
+		"content-type",
 		"accept",
 		"sec-fetch-site",
+		"origin",
 		"cookie",
 		"sec-fetch-dest",
+		"content-length",
 		"accept-language",
 		"sec-fetch-mode",
 		"user-agent",
@@ -299,7 +1289,8 @@ var (
 		"sec-fetch-dest":  "document",
 		"accept-language": "zh-CN,zh-Hans;q=0.9",
 		"sec-fetch-mode":  "navigate",
-		"user-agent":      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.6 Safari/605.1.15",
+		"user-agent":      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/16.0 Safari/605.1.15",
+		"accept-encoding": "gzip, deflate, br",
 	}
 
 	safariHeaderPriority = http2.PriorityParam{
@@ -309,16 +1300,1590 @@ var (
 	}
 )
 
-// ImpersonateSafari impersonates Safari browser (version 16.6).
+// SafariProfile returns the BrowserProfile of Safari browser (version 16.0).
+func SafariProfile() BrowserProfile {
+	return safariProfile(utls.HelloSafari_16_0, safariHeaders)
+}
+
+// safariProfile returns the profile of a WebKit based Safari browser, which
+// shares the HTTP2 fingerprint of the desktop Safari.
+func safariProfile(clientHelloID utls.ClientHelloID, hdrs map[string]string) BrowserProfile {
+	return BrowserProfile{
+		ClientHelloID:           clientHelloID,
+		HTTP2Settings:           safariHttp2Settings,
+		HTTP2ConnectionFlow:     safariHttp2ConnectionFlow,
+		HTTP2MaxHeaderFrameSize: browserMaxHeaderFrameSize,
+		PseudoHeaderOrder:       safariPseudoHeaderOrder,
+		HeaderOrder:             safariHeaderOrder,
+		Headers:                 hdrs,
+		HeaderPriority:          safariHeaderPriority,
+		multipartBoundary:       webkitMultipartBoundary,
+	}.clone()
+}
+
+// ImpersonateSafari impersonates Safari browser (version 16.0).
 func (c *Client) ImpersonateSafari() *Client {
+	return c.ApplyProfile(SafariProfile())
+}
+
+// ImpersonateCustomSafari impersonates Safari browser like ImpersonateSafari,
+// but with the headers and the raw ClientHello captured from a real Safari
+// browser (e.g. Safari 17), the captured headers override the default ones,
+// and the tls fingerprint is taken from rawClientHello if it's not empty,
+// otherwise the fingerprint of Safari 16 is used. The captured headerOrder, if
+// passed, overrides the default header order like ImpersonateCustomEdge.
+func (c *Client) ImpersonateCustomSafari(hdrs http.Header, rawClientHello []byte, headerOrder ...string) *Client {
+	return c.impersonateCustom(SafariProfile(), hdrs, rawClientHello, headerOrder)
+}
+
+// helloSafari17 is the ClientHelloID of Safari 17, which is not defined by
+// utls, see safari17ClientHelloSpec. Safari 18 sends the same ClientHello.
+var helloSafari17 = utls.ClientHelloID{Client: utls.HelloSafari_16_0.Client, Version: "17.0"}
+
+// safari17ClientHelloSpec builds the ClientHelloSpec of Safari 17, which no
+// longer offers the ecdsa_sha1 signature algorithm, and is the same as the one
+// of Safari 16 otherwise.
+func safari17ClientHelloSpec() (*utls.ClientHelloSpec, error) {
+	spec, err := utls.UTLSIdToSpec(utls.HelloSafari_16_0)
+	if err != nil {
+		return nil, err
+	}
+	for _, ext := range spec.Extensions {
+		if sa, ok := ext.(*utls.SignatureAlgorithmsExtension); ok {
+			sa.SupportedSignatureAlgorithms = slices.DeleteFunc(slices.Clone(sa.SupportedSignatureAlgorithms), func(s utls.SignatureScheme) bool {
+				return s == utls.ECDSAWithSHA1
+			})
+		}
+	}
+	return &spec, nil
+}
+
+var (
+	safari17Headers = mergeProfileHeaders(safariHeaders, map[string]string{
+		"user-agent": "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15",
+	})
+
+	// Safari 18 disables the http2 priorities with the
+	// SETTINGS_NO_RFC7540_PRIORITIES setting (RFC 9218), and sends the
+	// priority header instead.
+	safari18Http2Settings = []http2.Setting{
+		{
+			ID:  http2.SettingEnablePush,
+			Val: 0,
+		},
+		{
+			ID:  http2.SettingMaxConcurrentStreams,
+			Val: 100,
+		},
+		{
+			ID:  http2.SettingInitialWindowSize,
+			Val: 2097152,
+		},
+		{
+			ID:  http2.SettingID(0x9), // SETTINGS_NO_RFC7540_PRIORITIES
+			Val: 1,
+		},
+	}
+
+	safari18PseudoHeaderOrder = []string{
+		":method",
+		":scheme",
+		":authority",
+		":path",
+	}
+
+	safari18HeaderOrder = []string{
+		"host",
+		"content-type",
+		"content-length",
+		"origin",
+		"sec-fetch-dest",
+		"user-agent",
+		"accept",
+		"referer",
+		"sec-fetch-site",
+		"sec-fetch-mode",
+		"accept-language",
+		"priority",
+		"accept-encoding",
+		"cookie",
+	}
+
+	safari18Headers = mergeProfileHeaders(safariHeaders, map[string]string{
+		"user-agent": "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.0 Safari/605.1.15",
+		"priority":   formatPriorityHeader(0, true),
+	})
+)
+
+// Safari17Profile returns the BrowserProfile of Safari browser (version 17.0).
+func Safari17Profile() BrowserProfile {
+	p := safariProfile(helloSafari17, safari17Headers)
+	p.clientHelloSpec = safari17ClientHelloSpec
+	return p
+}
+
+// ImpersonateSafari17 impersonates Safari browser (version 17.0).
+func (c *Client) ImpersonateSafari17() *Client {
+	return c.ApplyProfile(Safari17Profile())
+}
+
+// Safari18Profile returns the BrowserProfile of Safari browser (version 18.0),
+// which sends the RFC 9218 priority header instead of the http2 priorities,
+// and the same ClientHello as Safari 17.
+func Safari18Profile() BrowserProfile {
+	return BrowserProfile{
+		ClientHelloID:           helloSafari17,
+		HTTP2Settings:           safari18Http2Settings,
+		HTTP2ConnectionFlow:     safari18Http2ConnectionFlow,
+		HTTP2MaxHeaderFrameSize: browserMaxHeaderFrameSize,
+		PseudoHeaderOrder:       safari18PseudoHeaderOrder,
+		HeaderOrder:             safari18HeaderOrder,
+		Headers:                 safari18Headers,
+		multipartBoundary:       webkitMultipartBoundary,
+		clientHelloSpec:         safari17ClientHelloSpec,
+	}.clone()
+}
+
+// ImpersonateSafari18 impersonates Safari browser (version 18.0), which sends
+// the RFC 9218 priority header instead of the http2 priorities.
+func (c *Client) ImpersonateSafari18() *Client {
+	return c.ApplyProfile(Safari18Profile())
+}
+
+var safariIOSHeaders = map[string]string{
+	"accept":          "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8",
+	"sec-fetch-site":  "none",
+	"sec-fetch-dest":  "document",
+	"accept-language": "zh-CN,zh-Hans;q=0.9",
+	"sec-fetch-mode":  "navigate",
+	"user-agent":      "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1",
+	"accept-encoding": "gzip, deflate, br",
+}
+
+// helloIOS17 is the ClientHelloID of Safari on iOS 17, which is not defined by
+// utls (utls.HelloIOS_Auto is the one of iOS 14). It sends the same
+// ClientHello as the desktop Safari 17, see safari17ClientHelloSpec.
+var helloIOS17 = utls.ClientHelloID{Client: utls.HelloIOS_14.Client, Version: "17.0"}
+
+// SafariIOSProfile returns the BrowserProfile of Safari browser on iOS
+// (version 17.0).
+func SafariIOSProfile() BrowserProfile {
+	p := safariProfile(helloIOS17, safariIOSHeaders)
+	p.clientHelloSpec = safari17ClientHelloSpec
+	return p
+}
+
+// ImpersonateSafariIOS impersonates Safari browser on iOS (version 17.0), which
+// shares the HTTP2 fingerprint and the ClientHello of the desktop Safari 17.
+func (c *Client) ImpersonateSafariIOS() *Client {
+	return c.ApplyProfile(SafariIOSProfile())
+}
+
+// ImpersonateCustomSafariIOS impersonates Safari browser on iOS like
+// ImpersonateSafariIOS, but with the headers and the raw ClientHello captured
+// from a real iOS device, the captured headers override the default ones, and
+// the tls fingerprint is taken from rawClientHello if it's not empty. The
+// captured headerOrder, if passed, overrides the default header order like
+// ImpersonateCustomEdge.
+func (c *Client) ImpersonateCustomSafariIOS(hdrs http.Header, rawClientHello []byte, headerOrder ...string) *Client {
+	return c.impersonateCustom(SafariIOSProfile(), hdrs, rawClientHello, headerOrder)
+}
+
+var (
+	impersonationsMu sync.RWMutex
+	impersonations   = map[string]func(c *Client) *Client{
+		"chrome":          (*Client).ImpersonateChrome,
+		"chrome_android":  (*Client).ImpersonateChromeAndroid,
+		"chrome_windows":  (*Client).ImpersonateChromeWindows,
+		"chrome_headless": (*Client).ImpersonateChromeHeadless,
+		"edge":            (*Client).ImpersonateEdge,
+		"brave":           (*Client).ImpersonateBrave,
+		"opera":           (*Client).ImpersonateOpera,
+		"firefox":         (*Client).ImpersonateFirefox,
+		"tor_browser":     (*Client).ImpersonateTorBrowser,
+		"safari":          (*Client).ImpersonateSafari,
+		"safari17":        (*Client).ImpersonateSafari17,
+		"safari18":        (*Client).ImpersonateSafari18,
+		"safari_ios":      (*Client).ImpersonateSafariIOS,
+	}
+)
+
+func init() {
+	for _, v := range chromeVersions {
+		major := v.major
+		impersonations["chrome"+strconv.Itoa(major)] = func(c *Client) *Client {
+			return c.ImpersonateChromeVersion(major)
+		}
+	}
+	for _, v := range firefoxVersions {
+		major := v.major
+		impersonations["firefox"+strconv.Itoa(major)] = func(c *Client) *Client {
+			return c.ImpersonateFirefoxVersion(major)
+		}
+	}
+}
+
+// ImpersonationProfiles returns the sorted names of all supported impersonation
+// profiles, which can be passed to Client.Impersonate.
+func ImpersonationProfiles() []string {
+	impersonationsMu.RLock()
+	defer impersonationsMu.RUnlock()
+	names := make([]string, 0, len(impersonations))
+	for name := range impersonations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Impersonate impersonates the browser of the named profile (case-insensitive),
+// see ImpersonationProfiles for all supported names, returns an error if the
+// profile does not exist.
+func (c *Client) Impersonate(name string) error {
+	fn, err := lookupImpersonation(name)
+	if err != nil {
+		return err
+	}
+	fn(c)
+	return nil
+}
+
+func lookupImpersonation(name string) (func(c *Client) *Client, error) {
+	impersonationsMu.RLock()
+	fn, ok := impersonations[strings.ToLower(name)]
+	impersonationsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown impersonation profile %q", name)
+	}
+	return fn, nil
+}
+
+// impersonateClient returns the clone of the client which impersonates the
+// named profile, it's created on first use and cached, so the requests
+// impersonating the same profile share the same connection pool. The cache is
+// reset by the setters of the common headers, proxy and tls settings of the
+// client, see resetImpersonateClients.
+func (c *Client) impersonateClient(name string) (*Client, error) {
+	name = strings.ToLower(name)
+	if cc, ok := c.impersonateClients.Load(name); ok {
+		return cc.(*Client), nil
+	}
+	fn, err := lookupImpersonation(name)
+	if err != nil {
+		return nil, err
+	}
+	cc, _ := c.impersonateClients.LoadOrStore(name, fn(c.Clone()))
+	return cc.(*Client), nil
+}
+
+// resetImpersonateClients drops the cached clients of Request.Impersonate and
+// SetImpersonateRotation, so they are recreated from the current settings of
+// the client on next use, and closes their idle connections. The timeout and
+// cookie jar are always taken from the client, so they need no reset. Note the
+// changes made to the client in other ways, e.g. modifying Headers or the
+// config returned by GetTLSClientConfig directly, are not detected.
+func (c *Client) resetImpersonateClients() {
+	if c.impersonateClients == nil {
+		return
+	}
+	c.impersonateClients.Range(func(name, cc any) bool {
+		if c.impersonateClients.CompareAndDelete(name, cc) {
+			cc.(*Client).Transport.CloseIdleConnections()
+		}
+		return true
+	})
+}
+
+// SetImpersonateRotation set the named profiles (case-insensitive) to rotate,
+// each request of the client which does not call Request.Impersonate picks one
+// of them randomly, and it's sent like calling Request.Impersonate with the
+// picked profile, e.g. SetImpersonateRotation("chrome", "firefox", "safari").
+// The tls fingerprint, http2 settings, header order and the common headers of
+// the picked profile are all applied, the retries of a request keep the same
+// profile. Each profile has a separate connection pool, so connections are
+// never shared between requests with different fingerprints. The clients of
+// the profiles are created from the client on first use, and recreated when
+// the common headers, proxy or tls settings of the client are changed with its
+// setters later. Call it without profiles to stop rotating. The unknown
+// profiles are skipped with an error log, and the known ones still rotate.
+func (c *Client) SetImpersonateRotation(profiles ...string) *Client {
+	var known []string
+	for _, name := range profiles {
+		if _, err := lookupImpersonation(name); err != nil {
+			c.log.Errorf("%v", err)
+			continue
+		}
+		known = append(known, name)
+	}
+	c.impersonateRotation = known
+	return c
+}
+
+// rotateImpersonation impersonates a random profile set by
+// SetImpersonateRotation for the request.
+func (r *Request) rotateImpersonation() {
+	profiles := r.client.impersonateRotation
+	if len(profiles) == 0 || r.impersonateClient != nil {
+		return
+	}
+	r.Impersonate(profiles[randIntn(len(profiles))])
+}
+
+// ImpersonateLogEntry is the impersonation decision of a request which is
+// passed to the logger set by SetImpersonateLogger.
+type ImpersonateLogEntry struct {
+	// Method and URL of the request.
+	Method string
+	URL    string
+	// Attempt is the retry attempt of the request, it's 0 for the first one.
+	Attempt int
+	// Profile is the profile impersonated by the request, which is set by
+	// Request.Impersonate, SetImpersonateRotation or RetryWithProfileRotation,
+	// it's empty if the request is sent with the fingerprint of the client.
+	Profile string
+	// ClientHelloID is the ClientHelloID of the tls fingerprint, it's empty if
+	// the tls fingerprint is not set.
+	ClientHelloID string
+	// JA3 and JA4 of the ClientHello built with the tls fingerprint, they're
+	// empty if the tls fingerprint is not set. Note the JA3 may differ from
+	// the one on the wire if the fingerprint shuffles the extensions.
+	JA3 string
+	JA4 string
+	// UserAgent is the User-Agent header sent.
+	UserAgent string
+	// HeaderOrder is the header order of the request, it's empty if the
+	// headers are sent in the default order.
+	HeaderOrder []string
+	// Protocol is the negotiated protocol, e.g. "h2", it's empty if the
+	// request failed without a response.
+	Protocol string
+	// Err is the error of the request if any.
+	Err error
+}
+
+// SetImpersonateLogger set the logger which is called with the impersonation
+// decision of each request once it's done, including each retry, which is
+// useful to reproduce issues when the profiles are rotated, see
+// ImpersonateLogEntry. The entry is only built if the logger is set, and it
+// is called synchronously, so it should not block. Call it with nil to remove
+// the logger.
+func (c *Client) SetImpersonateLogger(fn func(ImpersonateLogEntry)) *Client {
+	c.impersonateLogger = fn
+	return c
+}
+
+func (c *Client) impersonateLogEntry(resp *Response) ImpersonateLogEntry {
+	r := resp.Request
+	req := r.RawRequest
+	entry := ImpersonateLogEntry{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		Attempt:     r.RetryAttempt,
+		Profile:     r.impersonateProfile,
+		UserAgent:   req.Header.Get("User-Agent"),
+		HeaderOrder: req.Header[HeaderOderKey],
+		Err:         resp.Err,
+	}
+	fc := c
+	if r.impersonateClient != nil {
+		fc = r.impersonateClient
+	}
+	if fc.tlsFingerprintID.Client != "" {
+		entry.ClientHelloID = fc.tlsFingerprintID.Str()
+		if info, err := fc.clientHelloInfo(req.URL.Hostname()); err == nil {
+			entry.JA3 = info.ja3()
+			entry.JA4 = info.ja4()
+		}
+	}
+	if resp.Response != nil {
+		entry.Protocol = resp.NegotiatedProtocol()
+	}
+	return entry
+}
+
+// RetryWithProfileRotation returns a retry condition which retries the request
+// impersonating another one of the named profiles (case-insensitive) if the
+// response is 403 Forbidden or 429 Too Many Requests, which usually means the
+// fingerprint is blocked, e.g.
+//
+//	client.SetCommonRetryCount(3).
+//		SetCommonRetryCondition(req.RetryWithProfileRotation("chrome", "firefox", "safari"))
+//
+// The profiles are tried in order, the one impersonated by the request with
+// Request.Impersonate or SetImpersonateRotation is skipped, and each profile
+// is tried at most once, so there is no more retry once all of them are tried,
+// and the retries are also capped by the retry count. The retried request is
+// sent like calling Request.Impersonate with the new profile, so it's sent on
+// a connection of the profile's own pool, which is always established with
+// the fingerprint of the new profile, and the common headers of the previous
+// profile are replaced. It does not retry if the context of the request is
+// done, and the unknown profiles are skipped with an error log.
+func RetryWithProfileRotation(profiles ...string) RetryConditionFunc {
+	names := make([]string, len(profiles))
+	for i, name := range profiles {
+		names[i] = strings.ToLower(name)
+	}
+	return func(resp *Response, err error) bool {
+		if resp == nil || resp.Response == nil || resp.Request == nil {
+			return false
+		}
+		if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+			return false
+		}
+		r := resp.Request
+		if r.Context().Err() != nil {
+			return false
+		}
+		if r.triedProfiles == nil {
+			r.triedProfiles = []string{r.impersonateProfile}
+		}
+		for _, name := range names {
+			if slices.Contains(r.triedProfiles, name) {
+				continue
+			}
+			r.triedProfiles = append(r.triedProfiles, name)
+			if err := r.switchImpersonation(name); err != nil {
+				r.client.log.Errorf("%v", err)
+				continue
+			}
+			return true
+		}
+		return false
+	}
+}
+
+// switchImpersonation impersonates the named profile for the retries of the
+// request, the common headers merged from the previous profile are removed,
+// so they are replaced by the ones of the new profile.
+func (r *Request) switchImpersonation(name string) error {
+	cc, err := r.client.impersonateClient(name)
+	if err != nil {
+		return err
+	}
+	// remove the headers merged from the previous client, so the ones of the
+	// new client are merged instead, while the ones set by the request stay.
+	for _, k := range r.mergedHeaderKeys {
+		delete(r.Headers, k)
+	}
+	r.mergedHeaderKeys = nil
+	r.impersonateClient = cc
+	r.impersonateProfile = name
+	return nil
+}
+
+// randIntn returns a uniform random number in [0, n), it falls back to
+// math/rand/v2 if crypto/rand fails, as the picked profile or language only
+// needs to vary, rather than being secret.
+func randIntn(n int) int {
+	i, err := rand.Int(rand.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return mathrandv2.IntN(n)
+	}
+	return int(i.Int64())
+}
+
+// BrowserProfile bundles all fingerprint parameters required to impersonate
+// a browser, it can be applied with Client.ApplyProfile, or registered with
+// RegisterImpersonationProfile and then applied by name with Client.Impersonate.
+type BrowserProfile struct {
+	// ClientHelloID is the utls ClientHelloID of the TLS fingerprint, required.
+	ClientHelloID utls.ClientHelloID
+	// HTTP2Settings is the settings of the HTTP2 SETTINGS frame, required.
+	HTTP2Settings []http2.Setting
+	// HTTP2ConnectionFlow is the delta of the initial connection-level
+	// WINDOW_UPDATE frame sent right after the SETTINGS frame, required.
+	HTTP2ConnectionFlow uint32
+	// HTTP2PriorityFrames is the PRIORITY frames sent after the SETTINGS frame.
+	HTTP2PriorityFrames []http2.PriorityFrame
+	// HTTP2PriorityUpdate is the priority field value (e.g. "u=0, i") of the
+	// RFC 9218 PRIORITY_UPDATE frame sent before the HEADERS frame of each
+	// request, it can not be used with HTTP2PriorityFrames.
+	HTTP2PriorityUpdate string
+	// HTTP2SplitCookie splits the Cookie header into separate HTTP2 header
+	// fields of each cookie-pair like Firefox, it's sent as a single header
+	// field like Chrome and Safari if false.
+	HTTP2SplitCookie bool
+	// HTTP2MaxHeaderFrameSize is the maximum payload size of the HTTP2
+	// HEADERS and CONTINUATION frames, 0 means the frame size of the server
+	// is used.
+	HTTP2MaxHeaderFrameSize uint32
+	// HTTP2PingInterval is the interval of the HTTP2 PING frames sent on the
+	// idle connections, 0 keeps the interval of the client.
+	HTTP2PingInterval time.Duration
+	// HTTP2PingPayload returns the opaque data of the seq-th HTTP2 PING frame
+	// sent on each connection, the data is random if nil.
+	HTTP2PingPayload func(seq uint64) [8]byte
+	// PseudoHeaderOrder is the order of the HTTP2 pseudo headers, required.
+	PseudoHeaderOrder []string
+	// HeaderOrder is the order of the common headers, required.
+	HeaderOrder []string
+	// Headers is the common headers sent by the browser, required.
+	Headers map[string]string
+	// HeaderPriority is the priority param of the HTTP2 HEADERS frame.
+	HeaderPriority http2.PriorityParam
+	// HTTP3Settings is the settings of the HTTP3 SETTINGS frame, the default
+	// settings are sent if it's nil.
+	HTTP3Settings *http3.Settings
+	// MultipartBoundaryFunc generates the multipart boundary, the boundary
+	// of the browser is used if it's nil.
+	MultipartBoundaryFunc func() string
+
+	// multipartBoundary generates the multipart boundary of the built-in
+	// browser with the boundary rand of the client.
+	multipartBoundary func(r io.Reader) (string, error)
+	// clientHelloSpec builds the ClientHello of the built-in browser whose
+	// ClientHelloID is not defined by utls.
+	clientHelloSpec func() (*utls.ClientHelloSpec, error)
+}
+
+func (p *BrowserProfile) validate() error {
+	switch {
+	case p.ClientHelloID.Client == "":
+		return errors.New("missing ClientHelloID in impersonate profile")
+	case len(p.HTTP2Settings) == 0:
+		return errors.New("missing HTTP2Settings in impersonate profile")
+	case p.HTTP2ConnectionFlow == 0:
+		return errors.New("missing HTTP2ConnectionFlow in impersonate profile")
+	case len(p.PseudoHeaderOrder) == 0:
+		return errors.New("missing PseudoHeaderOrder in impersonate profile")
+	case len(p.HeaderOrder) == 0:
+		return errors.New("missing HeaderOrder in impersonate profile")
+	case len(p.Headers) == 0:
+		return errors.New("missing Headers in impersonate profile")
+	case len(p.HTTP2PriorityFrames) > 0 && p.HTTP2PriorityUpdate != "":
+		return errors.New("both HTTP2PriorityFrames and HTTP2PriorityUpdate are set in impersonate profile")
+	}
+	if _, err := validatePseudoHeaderOrder(p.PseudoHeaderOrder); err != nil {
+		return err
+	}
+	return validateHTTP2ConnectionFlow(p.HTTP2ConnectionFlow)
+}
+
+// clone returns a deep copy of the profile.
+func (p BrowserProfile) clone() BrowserProfile {
+	pp := p
+	pp.HTTP2Settings = cloneSlice(p.HTTP2Settings)
+	pp.HTTP2PriorityFrames = cloneSlice(p.HTTP2PriorityFrames)
+	pp.PseudoHeaderOrder = cloneSlice(p.PseudoHeaderOrder)
+	pp.HeaderOrder = cloneSlice(p.HeaderOrder)
+	pp.Headers = mergeProfileHeaders(p.Headers, nil)
+	pp.HTTP3Settings = p.HTTP3Settings.Clone()
+	return pp
+}
+
+// ApplyProfile applies all fingerprint parameters of the profile p to the
+// client, p is copied so it's safe to modify it afterwards. The common headers
+// set by the previously applied profile are removed first, so the headers of
+// different browsers are never mixed.
+func (c *Client) ApplyProfile(p BrowserProfile) *Client {
+	p = p.clone()
+	c.impersonateChromeVersion = 0
+	c.impersonateFirefoxVersion = 0
+	c.fetchModeRestore = nil
+	// remove the headers of the previous profile, so none of them leaks
+	// into the new one, e.g. the sec-ch-ua of Chrome sent by Firefox.
+	for _, key := range c.profileHeaderKeys {
+		c.Headers.Del(key)
+	}
+	c.profileHeaderKeys = make([]string, 0, len(p.Headers))
+	for key := range p.Headers {
+		c.profileHeaderKeys = append(c.profileHeaderKeys, key)
+	}
+	if p.clientHelloSpec != nil {
+		c.setUTLSHandshake(p.ClientHelloID, p.clientHelloSpec)
+	} else {
+		c.SetTLSFingerprint(p.ClientHelloID)
+	}
 	c.
-		SetTLSFingerprint(utls.HelloSafari_16_0).
-		SetHTTP2SettingsFrame(safariHttp2Settings...).
-		SetHTTP2ConnectionFlow(10485760).
-		SetCommonPseudoHeaderOder(safariPseudoHeaderOrder...).
-		SetCommonHeaderOrder(safariHeaderOrder...).
-		SetCommonHeaders(safariHeaders).
-		SetHTTP2HeaderPriority(safariHeaderPriority).
-		SetMultipartBoundaryFunc(webkitMultipartBoundaryFunc)
+		SetHTTP2SettingsFrame(p.HTTP2Settings...).
+		SetHTTP2ConnectionFlow(p.HTTP2ConnectionFlow).
+		SetHTTP2PriorityFrames(p.HTTP2PriorityFrames...).
+		SetCommonPseudoHeaderOder(p.PseudoHeaderOrder...).
+		SetCommonHeaderOrder(p.HeaderOrder...).
+		SetCommonHeaders(p.Headers).
+		SetHTTP2HeaderPriority(p.HeaderPriority).
+		SetHTTP3Settings(p.HTTP3Settings).
+		SetMultipartBoundaryFunc(p.MultipartBoundaryFunc)
+	c.Transport.SetHTTP2PriorityUpdate(p.HTTP2PriorityUpdate)
+	c.Transport.SetHTTP2SplitCookie(p.HTTP2SplitCookie)
+	c.Transport.SetHTTP2MaxHeaderFrameSize(p.HTTP2MaxHeaderFrameSize)
+	c.Transport.SetHTTP2PingPayload(p.HTTP2PingPayload)
+	// reset the ping interval of the previous profile, unless it's changed
+	// with SetHTTP2PingInterval since.
+	if p.HTTP2PingInterval > 0 {
+		c.SetHTTP2PingInterval(p.HTTP2PingInterval)
+	} else if c.profilePingInterval > 0 && c.t2.ReadIdleTimeout == c.profilePingInterval {
+		c.SetHTTP2PingInterval(0)
+	}
+	c.profilePingInterval = p.HTTP2PingInterval
+	c.multipartBoundaryGen = p.multipartBoundary
+	c.applyImpersonatePlatform()
+	c.applyImpersonateLanguages()
+	c.applyImpersonateFetchMode()
+	c.applyImpersonateClientHints()
+	c.applyImpersonateTE()
+	c.applyImpersonateAcceptEncoding()
 	return c
 }
+
+// RegisterImpersonationProfile registers the profile with the given name
+// (case-insensitive) so that it can be applied with Client.Impersonate, an
+// existing profile with the same name will be replaced. It returns an error if
+// the name is empty or any required field of the profile is missing.
+func RegisterImpersonationProfile(name string, profile BrowserProfile) error {
+	if name == "" {
+		return errors.New("missing impersonate profile name")
+	}
+	if err := profile.validate(); err != nil {
+		return err
+	}
+	p := profile.clone()
+	impersonationsMu.Lock()
+	impersonations[strings.ToLower(name)] = func(c *Client) *Client {
+		return c.ApplyProfile(p)
+	}
+	impersonationsMu.Unlock()
+	return nil
+}
+
+// platformTokens is the platform related tokens of the impersonated browser.
+type platformTokens struct {
+	// name is the value of sec-ch-ua-platform (without quotes).
+	name string
+	// userAgent is the platform token in the user-agent of Chromium based
+	// browsers and Safari.
+	userAgent string
+	// firefoxUserAgent is the platform token in the user-agent of Firefox,
+	// which is followed by the rv token.
+	firefoxUserAgent string
+}
+
+var impersonatePlatforms = map[string]platformTokens{
+	"windows": {"Windows", "Windows NT 10.0; Win64; x64", "Windows NT 10.0; Win64; x64"},
+	"macos":   {"macOS", "Macintosh; Intel Mac OS X 10_15_7", "Macintosh; Intel Mac OS X 10.15"},
+	"linux":   {"Linux", "X11; Linux x86_64", "X11; Linux x86_64"},
+}
+
+// SetImpersonateExtraHeader set an extra header which is not in the profile of
+// the impersonated browser, and insert it into the header order right after the
+// afterHeader (case-insensitive), or at the beginning if afterHeader is empty,
+// e.g. SetImpersonateExtraHeader("x-foo", "bar", "accept"). The header is
+// appended to the order if afterHeader is not in the order. Note it should be
+// called after ImpersonateXXX, which resets the header order. The x-client-data
+// header sent by Chrome is already in the order of the Chrome profile, so it
+// can be simply set with SetCommonHeader.
+func (c *Client) SetImpersonateExtraHeader(name, value, afterHeader string) *Client {
+	if !httpguts.ValidHeaderFieldName(name) {
+		c.log.Errorf("invalid header name %q", name)
+		return c
+	}
+	c.SetCommonHeader(name, value)
+	if c.headerOrder == nil {
+		if c.headerOrderFunc != nil {
+			c.log.Warnf("the header order is computed by SetCommonHeaderOrderFunc, the position of header %s is not changed", name)
+		}
+		return c
+	}
+	name = strings.ToLower(name)
+	order := slices.DeleteFunc(slices.Clone(c.headerOrder), func(key string) bool {
+		return key == name
+	})
+	i := 0
+	if afterHeader != "" {
+		i = slices.Index(order, strings.ToLower(afterHeader)) + 1
+		if i == 0 {
+			c.log.Warnf("header %s is not in the header order, append header %s to the order", afterHeader, name)
+			i = len(order)
+		}
+	}
+	return c.setCommonHeaderOrder(slices.Insert(order, i, name))
+}
+
+// RemoveImpersonateHeader removes the header (case-insensitive) of the
+// impersonated browser, and removes it from the header order too, so the other
+// headers keep their order, e.g. RemoveImpersonateHeader("upgrade-insecure-requests").
+// The header stays removed when switching the fetch mode by ImpersonateFetchMode.
+// Note it should be called after ImpersonateXXX, which resets the headers.
+func (c *Client) RemoveImpersonateHeader(name string) *Client {
+	name = strings.ToLower(name)
+	if c.Headers != nil {
+		c.Headers.Del(name)
+	}
+	if r := c.fetchModeRestore; r != nil {
+		r.headers[name] = ""
+		r.order = slices.DeleteFunc(slices.Clone(r.order), func(key string) bool {
+			return key == name
+		})
+	}
+	if c.headerOrder != nil {
+		c.setCommonHeaderOrder(slices.DeleteFunc(slices.Clone(c.headerOrder), func(key string) bool {
+			return key == name
+		}))
+	}
+	return c
+}
+
+// DisableImpersonateTETrailers disables sending the "te: trailers" header of
+// the impersonated browser (e.g. Firefox), as some HTTP/2 implementations
+// reject the te header. It takes effect on the current impersonated browser
+// and all the browsers impersonated later.
+func (c *Client) DisableImpersonateTETrailers() *Client {
+	c.disableImpersonateTE = true
+	c.applyImpersonateTE()
+	return c
+}
+
+// EnableImpersonateTETrailers enables sending the "te: trailers" header of the
+// impersonated browser which sends it, e.g. Firefox (enabled by default). The
+// header is only sent over HTTP/2 and HTTP/3, as TE is a hop-by-hop header in
+// HTTP/1.1.
+func (c *Client) EnableImpersonateTETrailers() *Client {
+	c.disableImpersonateTE = false
+	c.applyImpersonateTE()
+	return c
+}
+
+// applyImpersonateTE sets the te header if the impersonated browser sends it,
+// which is known from the header order, and it's not disabled by
+// DisableImpersonateTETrailers, otherwise the te header is removed, e.g. the
+// one set by the previous profile.
+func (c *Client) applyImpersonateTE() {
+	if c.Headers == nil {
+		return
+	}
+	if !c.disableImpersonateTE && slices.Contains(c.headerOrder, "te") {
+		c.Headers.Set("te", "trailers")
+	} else {
+		c.Headers.Del("te")
+	}
+}
+
+// applyImpersonateAcceptEncoding advertises the accept-encoding of the
+// impersonated browser with the encodings which can be decoded, see
+// SetAcceptEncoding.
+func (c *Client) applyImpersonateAcceptEncoding() {
+	if c.Headers == nil {
+		return
+	}
+	if v := c.Headers.Get("accept-encoding"); v != "" {
+		c.SetAcceptEncoding(strings.Split(v, ",")...)
+	}
+}
+
+// SetImpersonateUserAgent overrides the user-agent of the impersonated browser,
+// e.g. to append a contact token for crawling, the other headers and the header
+// order are kept intact. A warning is logged if the Chrome version in the
+// user-agent does not match the Chromium version in the sec-ch-ua header, or the
+// sec-ch-ua header is sent with a user-agent which is not Chromium based. Note
+// it should be called after ImpersonateXXX, which resets the user-agent.
+func (c *Client) SetImpersonateUserAgent(ua string) *Client {
+	if ua == "" || !httpguts.ValidHeaderFieldValue(ua) {
+		c.log.Errorf("invalid user-agent %q", ua)
+		return c
+	}
+	c.SetCommonHeader("user-agent", ua)
+	if brands := c.Headers.Get("sec-ch-ua"); brands != "" {
+		major := chromeMajorVersion(ua)
+		if major == "" {
+			c.log.Warnf("the user-agent %q is not Chromium based, but sec-ch-ua %s is sent", ua, brands)
+		} else if !strings.Contains(brands, `"Chromium";v="`+major+`"`) {
+			c.log.Warnf("the Chrome version %s of the user-agent does not match sec-ch-ua %s", major, brands)
+		}
+	}
+	return c
+}
+
+// chromeMajorVersion returns the major version of the Chrome token in the
+// user-agent, e.g. "131" of "... Chrome/131.0.0.0 Safari/537.36", or an empty
+// string if there is no Chrome token.
+func chromeMajorVersion(ua string) string {
+	i := strings.Index(ua, "Chrome/")
+	if i < 0 {
+		return ""
+	}
+	v := ua[i+len("Chrome/"):]
+	end := 0
+	for end < len(v) && v[end] >= '0' && v[end] <= '9' {
+		end++
+	}
+	return v[:end]
+}
+
+// SetImpersonatePlatform set the operating system of the impersonated browser,
+// the allowed values are "Windows", "macOS" and "Linux" (case-insensitive).
+// Both the sec-ch-ua-platform header and the platform token in the user-agent
+// are rewritten consistently, and it takes effect on the current impersonated
+// browser and all the browsers impersonated later, pass an empty string to
+// stop rewriting for the browsers impersonated later. It is intended for
+// desktop browsers.
+func (c *Client) SetImpersonatePlatform(os string) *Client {
+	if os != "" {
+		if _, ok := impersonatePlatforms[strings.ToLower(os)]; !ok {
+			c.log.Errorf("unsupported impersonate platform %q, should be one of Windows, macOS and Linux", os)
+			return c
+		}
+	}
+	c.impersonatePlatform = strings.ToLower(os)
+	c.applyImpersonatePlatform()
+	return c
+}
+
+// applyImpersonatePlatform rewrites the platform related headers according to
+// the platform set by SetImpersonatePlatform.
+func (c *Client) applyImpersonatePlatform() {
+	p, ok := impersonatePlatforms[c.impersonatePlatform]
+	if !ok || c.Headers == nil {
+		return
+	}
+	if c.Headers.Get("sec-ch-ua-platform") != "" {
+		c.Headers.Set("sec-ch-ua-platform", strconv.Quote(p.name))
+	}
+	if ua := c.Headers.Get("user-agent"); ua != "" {
+		c.Headers.Set("user-agent", rewriteUserAgentPlatform(ua, p))
+	}
+}
+
+// rewriteUserAgentPlatform replaces the platform token, which is the first
+// comment of the user-agent, and keeps the other tokens intact, e.g.
+// "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 ..." to
+// "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 ...".
+func rewriteUserAgentPlatform(ua string, p platformTokens) string {
+	start := strings.IndexByte(ua, '(')
+	end := strings.IndexByte(ua, ')')
+	if start < 0 || end < start {
+		return ua
+	}
+	token := p.userAgent
+	if i := strings.Index(ua[start:end], "; rv:"); i >= 0 {
+		token = p.firefoxUserAgent + ua[start+i:end]
+	}
+	return ua[:start+1] + token + ua[end:]
+}
+
+// ClientHints is the high entropy client hints of the impersonated Chromium
+// based browser, the empty fields are not sent.
+type ClientHints struct {
+	// Arch is the value of sec-ch-ua-arch, e.g. "x86" or "arm".
+	Arch string
+	// Bitness is the value of sec-ch-ua-bitness, e.g. "64".
+	Bitness string
+	// FullVersion is the full version of the browser, e.g. "131.0.6778.86",
+	// which generates sec-ch-ua-full-version-list from the brand list of
+	// sec-ch-ua. The brands whose major version differs from FullVersion,
+	// e.g. the GREASE brand, get the reduced version "<major>.0.0.0".
+	FullVersion string
+	// PlatformVersion is the value of sec-ch-ua-platform-version, e.g.
+	// "15.0.0" for Windows 11 and "14.6.1" for macOS.
+	PlatformVersion string
+}
+
+// highEntropyClientHints is the client hints set by SetImpersonateClientHints.
+var highEntropyClientHints = []string{
+	"sec-ch-ua-arch",
+	"sec-ch-ua-bitness",
+	"sec-ch-ua-full-version-list",
+	"sec-ch-ua-platform-version",
+}
+
+// clientHintsHeaderOrder is the order of the client hints sent by Chrome, the
+// high entropy ones are sent among the low entropy ones.
+var clientHintsHeaderOrder = []string{
+	"sec-ch-ua",
+	"sec-ch-ua-arch",
+	"sec-ch-ua-bitness",
+	"sec-ch-ua-full-version-list",
+	"sec-ch-ua-mobile",
+	"sec-ch-ua-platform",
+	"sec-ch-ua-platform-version",
+}
+
+// SetImpersonateClientHints set the high entropy client hints of the
+// impersonated Chromium based browser, which are sec-ch-ua-arch,
+// sec-ch-ua-bitness, sec-ch-ua-full-version-list and sec-ch-ua-platform-version.
+// Chrome only sends them to the sites asking for them via Accept-CH, so only
+// set them for such sites. The values are quoted as structured header strings,
+// and sent in the order of Chrome among the low entropy client hints, e.g.:
+//
+//	client.ImpersonateChrome().SetImpersonateClientHints(req.ClientHints{
+//		Arch:            "x86",
+//		Bitness:         "64",
+//		FullVersion:     "131.0.6778.86",
+//		PlatformVersion: "15.0.0",
+//	})
+//
+// It takes effect on the current impersonated browser and all the browsers
+// impersonated later, the browsers without sec-ch-ua (e.g. Firefox) are not
+// affected, pass an empty ClientHints to stop sending them.
+func (c *Client) SetImpersonateClientHints(hints ClientHints) *Client {
+	if hints == (ClientHints{}) {
+		c.impersonateClientHints = nil
+	} else {
+		c.impersonateClientHints = &hints
+	}
+	c.applyImpersonateClientHints()
+	return c
+}
+
+// applyImpersonateClientHints rewrites the high entropy client hints according
+// to the hints set by SetImpersonateClientHints.
+func (c *Client) applyImpersonateClientHints() {
+	if c.Headers == nil {
+		return
+	}
+	for _, name := range highEntropyClientHints {
+		c.Headers.Del(name)
+	}
+	c.clientHintHeaders = nil
+	h := c.impersonateClientHints
+	brands := c.Headers.Get("sec-ch-ua")
+	if h == nil || brands == "" || chromeMajorVersion(c.Headers.Get("user-agent")) == "" {
+		return
+	}
+	hdrs := make(map[string]string)
+	set := func(name, value string) {
+		if value != "" {
+			hdrs[name] = value
+		}
+	}
+	set("sec-ch-ua-arch", quoteClientHint(h.Arch))
+	set("sec-ch-ua-bitness", quoteClientHint(h.Bitness))
+	if h.FullVersion != "" {
+		set("sec-ch-ua-full-version-list", fullVersionList(brands, h.FullVersion))
+	}
+	set("sec-ch-ua-platform-version", quoteClientHint(h.PlatformVersion))
+	c.clientHintHeaders = hdrs
+	if !c.clientHintsAuto {
+		for name, value := range hdrs {
+			c.Headers.Set(name, value)
+		}
+	}
+	if c.headerOrder != nil {
+		c.setCommonHeaderOrder(withClientHintsOrder(c.headerOrder))
+	}
+}
+
+// SetClientHintsAuto enables or disables sending the high entropy client hints
+// set by SetImpersonateClientHints only to the origins asking for them, like
+// the real browsers do. When enabled, the Accept-CH header of the https
+// responses is remembered per origin, and the subsequent requests to that
+// origin are sent with the requested high entropy client hints, e.g. only
+// sec-ch-ua-platform-version is sent after "Accept-CH: Sec-CH-UA-Platform-Version".
+// A new Accept-CH of the origin replaces the remembered one. The low entropy
+// client hints (e.g. sec-ch-ua) are always sent like before.
+func (c *Client) SetClientHintsAuto(enable bool) *Client {
+	c.clientHintsAuto = enable
+	c.applyImpersonateClientHints()
+	return c
+}
+
+// parseAcceptCH returns the lowercase client hint names of the Accept-CH
+// header values.
+func parseAcceptCH(values []string) []string {
+	var names []string
+	for _, v := range values {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+func quoteClientHint(v string) string {
+	if v == "" {
+		return ""
+	}
+	return strconv.Quote(v)
+}
+
+// fullVersionList returns sec-ch-ua-full-version-list of the brand list of
+// sec-ch-ua, the brands of the major version of fullVersion get the
+// fullVersion, and the others get the reduced version.
+func fullVersionList(brands, fullVersion string) string {
+	major, _, _ := strings.Cut(fullVersion, ".")
+	list := parseClientHintBrands(brands)
+	for i, b := range list {
+		if b.Version == major {
+			list[i].Version = fullVersion
+		} else {
+			list[i].Version = b.Version + ".0.0.0"
+		}
+	}
+	return formatClientHintBrands(list)
+}
+
+// parseClientHintBrands parses the brand list of sec-ch-ua, e.g.
+// `"Google Chrome";v="131", "Chromium";v="131", "Not_A Brand";v="24"`, the
+// malformed brands are skipped.
+func parseClientHintBrands(s string) []ClientHintBrand {
+	var brands []ClientHintBrand
+	for s != "" {
+		s = strings.TrimLeft(s, ", ")
+		brand, rest, ok := cutQuoted(s)
+		if !ok {
+			break
+		}
+		rest, ok = strings.CutPrefix(rest, ";v=")
+		if !ok {
+			break
+		}
+		version, rest, ok := cutQuoted(rest)
+		if !ok {
+			break
+		}
+		brands = append(brands, ClientHintBrand{brand, version})
+		s = rest
+	}
+	return brands
+}
+
+// cutQuoted cuts the leading quoted string of s, and returns the unquoted
+// string and the rest of s.
+func cutQuoted(s string) (unquoted, rest string, ok bool) {
+	if !strings.HasPrefix(s, `"`) {
+		return "", s, false
+	}
+	end := strings.IndexByte(s[1:], '"')
+	if end < 0 {
+		return "", s, false
+	}
+	return s[1 : end+1], s[end+2:], true
+}
+
+// withClientHintsOrder returns the header order with the client hints moved to
+// the position of the first client hint in the order of Chrome, the order is
+// returned as is if there is no sec-ch-ua.
+func withClientHintsOrder(order []string) []string {
+	if !slices.Contains(order, "sec-ch-ua") {
+		return order
+	}
+	isClientHint := func(key string) bool {
+		return slices.Contains(clientHintsHeaderOrder, key)
+	}
+	i := slices.IndexFunc(order, isClientHint)
+	order = slices.DeleteFunc(slices.Clone(order), isClientHint)
+	return slices.Insert(order, i, clientHintsHeaderOrder...)
+}
+
+// fetchMode is how the browser family sends the fetch requests of javascript,
+// which differ from the navigation requests of the profiles.
+type fetchMode struct {
+	// headers overrides the navigation headers.
+	headers map[string]string
+	// removed is the navigation headers which are not sent.
+	removed []string
+	// priority is the value of the priority header, which is only set if
+	// the profile sends the priority header.
+	priority string
+	order    []string
+}
+
+var (
+	chromiumFetchMode = fetchMode{
+		headers: map[string]string{
+			"accept":         "*/*",
+			"sec-fetch-site": "same-origin",
+			"sec-fetch-mode": "cors",
+			"sec-fetch-dest": "empty",
+		},
+		removed:  []string{"pragma", "cache-control", "upgrade-insecure-requests", "sec-fetch-user"},
+		priority: formatPriorityHeader(1, true),
+		order: []string{
+			"host",
+			"connection",
+			"content-length",
+			"sec-ch-ua-platform",
+			"user-agent",
+			"sec-ch-ua",
+			"content-type",
+			"sec-ch-ua-mobile",
+			"accept",
+			"origin",
+			"sec-fetch-site",
+			"sec-fetch-mode",
+			"sec-fetch-dest",
+			"referer",
+			"accept-encoding",
+			"accept-language",
+			"cookie",
+			"priority",
+		},
+	}
+
+	firefoxFetchMode = fetchMode{
+		headers: map[string]string{
+			"accept":         "*/*",
+			"sec-fetch-dest": "empty",
+			"sec-fetch-mode": "cors",
+			"sec-fetch-site": "same-origin",
+		},
+		removed:  []string{"upgrade-insecure-requests", "sec-fetch-user"},
+		priority: formatPriorityHeader(4, false),
+		order: []string{
+			"host",
+			"user-agent",
+			"accept",
+			"accept-language",
+			"accept-encoding",
+			"referer",
+			"content-type",
+			"content-length",
+			"origin",
+			"connection",
+			"cookie",
+			"sec-fetch-dest",
+			"sec-fetch-mode",
+			"sec-fetch-site",
+			"priority",
+			"te",
+		},
+	}
+
+	safariFetchMode = fetchMode{
+		headers: map[string]string{
+			"accept":         "*/*",
+			"sec-fetch-site": "same-origin",
+			"sec-fetch-dest": "empty",
+			"sec-fetch-mode": "cors",
+		},
+		order: []string{
+			"host",
+			"accept",
+			"content-type",
+			"origin",
+			"sec-fetch-site",
+			"cookie",
+			"sec-fetch-dest",
+			"content-length",
+			"accept-language",
+			"sec-fetch-mode",
+			"user-agent",
+			"referer",
+			"accept-encoding",
+		},
+	}
+)
+
+// fetchModeRestore is the navigation headers and header order replaced by the
+// fetch mode, an empty value means the header is not sent.
+type fetchModeRestore struct {
+	headers map[string]string
+	order   []string
+}
+
+// ImpersonateFetchMode set the request mode of the impersonated browser, the
+// allowed values are "navigate" (the default), which sends the headers of the
+// top-level navigation like the profiles, and "cors", which sends the headers
+// of the fetch/XHR requests of javascript, as the navigation headers on an API
+// call are suspicious. In the "cors" mode, the sec-fetch-mode is "cors", the
+// sec-fetch-dest is "empty", the sec-fetch-site is "same-origin", the accept is
+// "*/*", the navigation only headers (e.g. upgrade-insecure-requests) are not
+// sent, the priority header (if sent by the browser) and the header order are
+// the ones of the fetch requests, and the origin header is set unless it's set
+// like browsers, i.e. on the requests whose method is not GET or HEAD, and the
+// cross-origin ones. The page is of the origin of the referer if it's set, or
+// of the same origin as the request otherwise. It takes effect on the current
+// impersonated browser and all the browsers impersonated later.
+func (c *Client) ImpersonateFetchMode(mode string) *Client {
+	switch mode = strings.ToLower(mode); mode {
+	case "navigate":
+		c.impersonateFetchMode = ""
+	case "cors":
+		c.impersonateFetchMode = mode
+	default:
+		c.log.Errorf("unsupported fetch mode %q, should be navigate or cors", mode)
+		return c
+	}
+	c.applyImpersonateFetchMode()
+	return c
+}
+
+// applyImpersonateFetchMode rewrites the headers and the header order
+// according to the mode set by ImpersonateFetchMode, the navigation headers
+// are restored if the mode is switched back to "navigate".
+func (c *Client) applyImpersonateFetchMode() {
+	if c.Headers == nil {
+		return
+	}
+	if c.impersonateFetchMode == "" {
+		if r := c.fetchModeRestore; r != nil {
+			c.fetchModeRestore = nil
+			for name, value := range r.headers {
+				if value == "" {
+					c.Headers.Del(name)
+				} else {
+					c.Headers.Set(name, value)
+				}
+			}
+			if r.order != nil {
+				c.setCommonHeaderOrder(r.order)
+			}
+		}
+		return
+	}
+	if c.fetchModeRestore != nil {
+		return
+	}
+	var m fetchMode
+	ua := c.Headers.Get("user-agent")
+	switch {
+	case strings.Contains(ua, "Firefox/"):
+		m = firefoxFetchMode
+	case strings.Contains(ua, "Chrome/"):
+		m = chromiumFetchMode
+	case strings.Contains(ua, "Safari/"):
+		m = safariFetchMode
+	default:
+		return
+	}
+	r := &fetchModeRestore{headers: make(map[string]string), order: c.headerOrder}
+	set := func(name, value string) {
+		if _, ok := r.headers[name]; !ok {
+			r.headers[name] = c.Headers.Get(name)
+		}
+		if value == "" {
+			c.Headers.Del(name)
+		} else {
+			c.Headers.Set(name, value)
+		}
+	}
+	for name, value := range m.headers {
+		set(name, value)
+	}
+	for _, name := range m.removed {
+		set(name, "")
+	}
+	if m.priority != "" && c.Headers.Get("priority") != "" {
+		set("priority", m.priority)
+	}
+	if c.headerOrder != nil {
+		c.setCommonHeaderOrder(slices.Clone(m.order))
+	}
+	c.fetchModeRestore = r
+}
+
+// AcceptLanguageChoice is a weighted choice of the preferred languages for
+// SetImpersonateAcceptLanguageRotation.
+type AcceptLanguageChoice struct {
+	// Languages is the preferred languages in order, e.g. ["en-US", "fr"].
+	Languages []string
+	// Weight is the relative weight of the choice, the choice is never
+	// picked if it's not positive.
+	Weight int
+}
+
+// SetImpersonateAcceptLanguage set the preferred languages of the impersonated
+// browser in order, e.g. SetImpersonateAcceptLanguage("en-US", "fr"). The
+// accept-language header is formatted the way the impersonated browser does,
+// e.g. "en-US,en;q=0.9,fr;q=0.8" for Chromium based browsers, which add the
+// base language after the regional ones, and "en-US,fr;q=0.5" for Firefox,
+// which spreads the q-values evenly. It takes effect on the current
+// impersonated browser and all the browsers impersonated later, call it
+// without languages to stop rewriting for the browsers impersonated later.
+func (c *Client) SetImpersonateAcceptLanguage(langs ...string) *Client {
+	for _, lang := range langs {
+		if !validLanguageTag(lang) {
+			c.log.Errorf("invalid language tag %q", lang)
+			return c
+		}
+	}
+	c.impersonateLanguages = cloneSlice(langs)
+	c.applyImpersonateLanguages()
+	return c
+}
+
+// SetImpersonateAcceptLanguageRotation randomly pick the preferred languages
+// of the impersonated browser from the weighted choices, e.g. pick the
+// [en-US] three times as often as the [de-DE, en-US] with:
+//
+//	client.SetImpersonateAcceptLanguageRotation(
+//		req.AcceptLanguageChoice{Languages: []string{"en-US"}, Weight: 3},
+//		req.AcceptLanguageChoice{Languages: []string{"de-DE", "en-US"}, Weight: 1},
+//	)
+//
+// The languages are picked once and then used like SetImpersonateAcceptLanguage,
+// so all the requests of the client share the same accept-language, create a
+// client per identity to rotate it.
+func (c *Client) SetImpersonateAcceptLanguageRotation(choices ...AcceptLanguageChoice) *Client {
+	total := 0
+	for _, choice := range choices {
+		if choice.Weight > 0 {
+			total += choice.Weight
+		}
+	}
+	if total == 0 {
+		c.log.Errorf("no accept-language choice with positive weight")
+		return c
+	}
+	i := randIntn(total)
+	for _, choice := range choices {
+		if choice.Weight <= 0 {
+			continue
+		}
+		if i < choice.Weight {
+			return c.SetImpersonateAcceptLanguage(choice.Languages...)
+		}
+		i -= choice.Weight
+	}
+	return c
+}
+
+// applyImpersonateLanguages rewrites the accept-language header according to
+// the languages set by SetImpersonateAcceptLanguage.
+func (c *Client) applyImpersonateLanguages() {
+	if len(c.impersonateLanguages) == 0 {
+		return
+	}
+	ua := ""
+	if c.Headers != nil {
+		ua = c.Headers.Get("user-agent")
+	}
+	var value string
+	switch {
+	case strings.Contains(ua, "Firefox/"):
+		value = firefoxAcceptLanguage(c.impersonateLanguages)
+	case strings.Contains(ua, "Chrome/"):
+		value = chromeAcceptLanguage(c.impersonateLanguages)
+	default:
+		value = formatAcceptLanguage(c.impersonateLanguages)
+	}
+	c.SetCommonHeader("accept-language", value)
+}
+
+// validLanguageTag reports whether lang looks like a language tag, e.g. "en"
+// and "zh-Hans-CN".
+func validLanguageTag(lang string) bool {
+	if lang == "" {
+		return false
+	}
+	for _, sub := range strings.Split(lang, "-") {
+		if sub == "" || len(sub) > 8 {
+			return false
+		}
+		for _, r := range sub {
+			if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// formatAcceptLanguage formats the languages with the q-value decreased by 0.1
+// from 0.9 down to 0.1 after the first one, which is used by Chromium based
+// browsers and Safari.
+func formatAcceptLanguage(langs []string) string {
+	var sb strings.Builder
+	for i, lang := range langs {
+		if i == 0 {
+			sb.WriteString(lang)
+			continue
+		}
+		q := max(10-i, 1)
+		fmt.Fprintf(&sb, ",%s;q=0.%d", lang, q)
+	}
+	return sb.String()
+}
+
+// chromeAcceptLanguage formats the languages like Chromium based browsers,
+// which add the base language right after the last consecutive regional ones
+// if it's not in the list, e.g. ["en-US", "en-GB", "fr"] is sent as
+// "en-US,en-GB;q=0.9,en;q=0.8,fr;q=0.7".
+func chromeAcceptLanguage(langs []string) string {
+	base := func(lang string) string {
+		b, _, _ := strings.Cut(lang, "-")
+		return strings.ToLower(b)
+	}
+	present := make(map[string]bool)
+	for _, lang := range langs {
+		present[strings.ToLower(lang)] = true
+	}
+	var expanded []string
+	for i, lang := range langs {
+		expanded = append(expanded, lang)
+		b := base(lang)
+		if b == strings.ToLower(lang) || present[b] {
+			continue
+		}
+		if i+1 < len(langs) && base(langs[i+1]) == b {
+			continue
+		}
+		expanded = append(expanded, b)
+		present[b] = true
+	}
+	return formatAcceptLanguage(expanded)
+}
+
+// firefoxAcceptLanguage formats the languages like Firefox, which spreads the
+// q-values evenly, e.g. ["zh-CN", "zh", "en-US", "en"] is sent as
+// "zh-CN,zh;q=0.8,en-US;q=0.5,en;q=0.3", with two decimals if there are more
+// than 10 languages.
+func firefoxAcceptLanguage(langs []string) string {
+	n := len(langs)
+	var sb strings.Builder
+	for i, lang := range langs {
+		if i == 0 {
+			sb.WriteString(lang)
+			continue
+		}
+		if n > 10 {
+			q := math.Round(float64(n-i) * 100 / float64(n))
+			fmt.Fprintf(&sb, ",%s;q=0.%02d", lang, int(q))
+		} else {
+			q := math.Round(float64(n-i) * 10 / float64(n))
+			fmt.Fprintf(&sb, ",%s;q=0.%d", lang, int(q))
+		}
+	}
+	return sb.String()
+}
+
+// The choices of the identity picked by SetImpersonateSeed.
+var (
+	seedPlatforms = []string{"windows", "macos", "linux"}
+	seedLanguages = [][]string{
+		{"en-US"},
+		{"en-US", "en"},
+		{"en-GB", "en"},
+		{"en-GB", "en-US", "en"},
+		{"de-DE", "de", "en-US", "en"},
+		{"fr-FR", "fr", "en-US", "en"},
+		{"es-ES", "es", "en"},
+		{"it-IT", "it", "en-US", "en"},
+		{"pt-BR", "pt", "en-US", "en"},
+		{"ja-JP", "ja", "en-US", "en"},
+	}
+)
+
+// SetImpersonateSeed derives a stable identity of the impersonated browser from
+// the seed, so the requests of the client look like one browser session, and
+// the clients with different seeds look like different ones. The seed picks:
+//
+//   - the Chrome version if Chrome is impersonated, see ImpersonateChromeVersion.
+//   - the platform of the desktop browsers, see SetImpersonatePlatform.
+//   - the preferred languages, see SetImpersonateAcceptLanguage.
+//   - the randomness of the TLS handshake (client random, session id, GREASE
+//     values and the extension order of Chrome), the multipart boundary and
+//     the http2 settings jitter if it's enabled.
+//
+// The same seed reproduces the same wire bytes as long as the connections are
+// made in the same order, except the key shares of the ClientHello, which are
+// always generated with crypto/rand by Go. Note it should be called after
+// ImpersonateXXX, and SetImpersonatePlatform or SetImpersonateAcceptLanguage
+// can be called after it to override the picked ones.
+func (c *Client) SetImpersonateSeed(seed int64) *Client {
+	r := mathrand.New(mathrand.NewSource(seed))
+	// always draw all the choices in the same order, so each part of the
+	// identity only depends on the seed.
+	version := chromeVersions[r.Intn(len(chromeVersions))]
+	platform := seedPlatforms[r.Intn(len(seedPlatforms))]
+	langs := seedLanguages[r.Intn(len(seedLanguages))]
+	tlsSeed, boundarySeed, jitterSeed := r.Int63(), r.Int63(), r.Int63()
+
+	if c.impersonateChromeVersion != 0 {
+		c.ImpersonateChromeVersion(version.major)
+	}
+	if isDesktopUserAgent(c.Headers.Get("user-agent")) {
+		c.SetImpersonatePlatform(platform)
+	}
+	c.SetImpersonateAcceptLanguage(langs...)
+	c.tlsSeedRand = newSeededRand(tlsSeed)
+	c.SetMultipartBoundaryRand(newSeededRand(boundarySeed))
+	if c.Transport.t2.JitterSettings != nil {
+		c.Transport.SetHTTP2SettingsJitterSeed(jitterSeed)
+	}
+	return c
+}
+
+// isDesktopUserAgent reports whether ua is the user-agent of a desktop browser
+// whose platform can be changed, Safari is always on macOS.
+func isDesktopUserAgent(ua string) bool {
+	if ua == "" || strings.Contains(ua, "Mobile") || strings.Contains(ua, "Android") {
+		return false
+	}
+	return strings.Contains(ua, "Chrome/") || strings.Contains(ua, "Firefox/")
+}
+
+// seededRand is a deterministic source of randomness which is safe for
+// concurrent use.
+type seededRand struct {
+	mu sync.Mutex
+	r  *mathrand.Rand
+}
+
+func newSeededRand(seed int64) *seededRand {
+	return &seededRand{r: mathrand.New(mathrand.NewSource(seed))}
+}
+
+func (s *seededRand) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Read(p)
+}
+
+func (s *seededRand) Int63() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.r.Int63()
+}
+
+// shufflesTLSExtensions reports whether utls shuffles the extensions of the
+// ClientHello, which is done for Chrome since 106.
+func shufflesTLSExtensions(id utls.ClientHelloID) bool {
+	if id.Client != "Chrome" {
+		return false
+	}
+	end := strings.IndexFunc(id.Version, func(r rune) bool { return r < '0' || r > '9' })
+	if end < 0 {
+		end = len(id.Version)
+	}
+	major, err := strconv.Atoi(id.Version[:end])
+	return err == nil && major >= 106
+}
+
+// seededShuffleSpec returns the spec of id with the extensions shuffled with
+// the seed instead of the crypto random shuffle of utls, the GREASE, padding and
+// pre_shared_key extensions keep their positions like utls does.
+func seededShuffleSpec(id utls.ClientHelloID, seed int64) (*utls.ClientHelloSpec, error) {
+	spec, err := utls.UTLSIdToSpec(id)
+	if err != nil {
+		return nil, err
+	}
+	exts := spec.Extensions
+	fixed := func(ext utls.TLSExtension) bool {
+		switch ext.(type) {
+		case *utls.UtlsGREASEExtension, *utls.UtlsPaddingExtension, utls.PreSharedKeyExtension:
+			return true
+		}
+		return false
+	}
+	var idx []int
+	var movable []utls.TLSExtension
+	for i, ext := range exts {
+		if !fixed(ext) {
+			idx = append(idx, i)
+			movable = append(movable, ext)
+		}
+	}
+	// undo the shuffle of utls before shuffling with the seed.
+	sort.SliceStable(movable, func(i, j int) bool {
+		return tlsExtensionType(movable[i]) < tlsExtensionType(movable[j])
+	})
+	mathrand.New(mathrand.NewSource(seed)).Shuffle(len(movable), func(i, j int) {
+		movable[i], movable[j] = movable[j], movable[i]
+	})
+	for i, ext := range movable {
+		exts[idx[i]] = ext
+	}
+	return &spec, nil
+}
+
+// tlsExtensionType returns the type of the extension, which is the first two
+// bytes of the encoded extension.
+func tlsExtensionType(ext utls.TLSExtension) uint16 {
+	b := make([]byte, ext.Len())
+	if n, _ := ext.Read(b); n < 2 {
+		return 0
+	}
+	return binary.BigEndian.Uint16(b)
+}
@@ -1,24 +1,50 @@
 package req
 
 import (
+	"bufio"
 	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
 	"context"
+	"crypto/ecdh"
+	"crypto/rand"
 	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/http/cookiejar"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/andybalholm/brotli"
+	"github.com/imroc/req/v3/http2"
+	"github.com/imroc/req/v3/http3"
+	"github.com/imroc/req/v3/internal/compress"
 	"github.com/imroc/req/v3/internal/header"
+	"github.com/imroc/req/v3/internal/testcert"
 	"github.com/imroc/req/v3/internal/tests"
+	"github.com/klauspost/compress/zstd"
+	"github.com/quic-go/quic-go"
+	quichttp3 "github.com/quic-go/quic-go/http3"
+	utls "github.com/refraction-networking/utls"
+	xhttp2 "golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
 	"golang.org/x/net/publicsuffix"
 )
 
@@ -376,6 +402,137 @@ func TestCompression(t *testing.T) {
 	tests.AssertEqual(t, false, c.Transport.DisableCompression)
 }
 
+func TestSetAcceptEncoding(t *testing.T) {
+	encoders := map[string]func(w io.Writer) io.WriteCloser{
+		"gzip":    func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"deflate": func(w io.Writer) io.WriteCloser { return zlib.NewWriter(w) },
+		"br":      func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+		"zstd": func(w io.Writer) io.WriteCloser {
+			zw, _ := zstd.NewWriter(w)
+			return zw
+		},
+		"raw-deflate": func(w io.Writer) io.WriteCloser {
+			fw, _ := flate.NewWriter(w, flate.DefaultCompression)
+			return fw
+		},
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := r.URL.Query().Get("encoding")
+		w.Header().Set("Content-Encoding", strings.TrimPrefix(encoding, "raw-"))
+		ew := encoders[encoding](w)
+		ew.Write([]byte(r.Header.Get("Accept-Encoding")))
+		ew.Close()
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	// the br and zstd are not advertised if their decoders are excluded by
+	// the req_nobrotli and req_nozstd build tags.
+	supported := strings.Join(compress.SupportedEncodings(), ", ")
+	c := C().EnableInsecureSkipVerify().SetAcceptEncoding("gzip", "deflate", "br", "zstd", "compress")
+	tests.AssertEqual(t, supported, c.Headers.Get("Accept-Encoding"))
+	tests.AssertEqual(t, true, c.Transport.AutoDecompression)
+	for _, force := range []func() *Client{c.EnableForceHTTP1, c.EnableForceHTTP2} {
+		force()
+		for encoding := range encoders {
+			if !compress.IsSupported(strings.TrimPrefix(encoding, "raw-")) {
+				continue
+			}
+			resp, err := c.R().SetQueryParam("encoding", encoding).Get(server.URL)
+			assertSuccess(t, resp, err)
+			tests.AssertEqual(t, supported, resp.String())
+		}
+	}
+
+	c.SetAcceptEncoding()
+	tests.AssertEqual(t, "", c.Headers.Get("Accept-Encoding"))
+
+	c.ImpersonateChrome()
+	tests.AssertEqual(t, supported, c.Headers.Get("Accept-Encoding"))
+	tests.AssertEqual(t, true, c.Transport.AutoDecompression)
+	c.ImpersonateSafari()
+	safari := slices.DeleteFunc(compress.SupportedEncodings(), func(encoding string) bool {
+		return encoding == "zstd"
+	})
+	tests.AssertEqual(t, strings.Join(safari, ", "), c.Headers.Get("Accept-Encoding"))
+}
+
+func TestZstdStreamDecoding(t *testing.T) {
+	if !compress.IsSupported("zstd") {
+		t.Skip("zstd is excluded by the req_nozstd build tag")
+	}
+	firstRead := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "zstd")
+		zw, _ := zstd.NewWriter(w)
+		zw.Write([]byte("hello "))
+		zw.Flush()
+		w.(http.Flusher).Flush()
+		<-firstRead
+		zw.Write([]byte("world"))
+		zw.Close()
+	}))
+	defer server.Close()
+
+	c := C().ImpersonateChrome()
+	resp, err := c.R().DisableAutoReadResponse().Get(server.URL)
+	assertSuccess(t, resp, err)
+	defer resp.Body.Close()
+	b := make([]byte, 6)
+	// the first frame is decoded before the rest of the body is sent.
+	_, err = io.ReadFull(resp.Body, b)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "hello ", string(b))
+	close(firstRead)
+	b, err = io.ReadAll(resp.Body)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "world", string(b))
+}
+
+func TestSetMaxDecompressedSize(t *testing.T) {
+	if !compress.IsSupported("br") {
+		t.Skip("br is excluded by the req_nobrotli build tag")
+	}
+	// 16 MB of zeros compressed to a few bytes.
+	var bomb bytes.Buffer
+	bw := brotli.NewWriter(&bomb)
+	bw.Write(make([]byte, 16<<20))
+	bw.Close()
+	tests.AssertEqual(t, true, bomb.Len() < 1024)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "br")
+		w.Write(bomb.Bytes())
+	}))
+	defer server.Close()
+
+	c := C().ImpersonateChrome().SetMaxDecompressedSize(1 << 20)
+	_, err := c.R().Get(server.URL)
+	var sizeErr *DecompressedSizeError
+	if !errors.As(err, &sizeErr) {
+		t.Fatalf("expected DecompressedSizeError, got %v", err)
+	}
+	tests.AssertEqual(t, int64(1<<20), sizeErr.Limit)
+
+	// the body is streamed up to the limit.
+	resp, err := c.R().DisableAutoReadResponse().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertSuccess(t, resp, err)
+	n, err := io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	tests.AssertEqual(t, true, errors.As(err, &sizeErr))
+	tests.AssertEqual(t, int64(1<<20), n)
+
+	_, err = c.Clone().R().Get(server.URL)
+	tests.AssertEqual(t, true, errors.As(err, &sizeErr))
+
+	resp, err = c.SetMaxDecompressedSize(0).R().Get(server.URL)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, 16<<20, len(resp.Bytes()))
+}
+
 func TestKeepAlives(t *testing.T) {
 	c := tc().DisableKeepAlives()
 	tests.AssertEqual(t, true, c.Transport.DisableKeepAlives)
@@ -466,64 +623,2191 @@ func TestSetOutputDirectory(t *testing.T) {
 	tests.AssertEqual(t, "TestGet: text response", content)
 }
 
-func TestSetBaseURL(t *testing.T) {
-	baseURL := "http://dummy-req.local/test"
-	resp, _ := tc().SetTimeout(time.Nanosecond).SetBaseURL(baseURL).R().Get("/req")
-	tests.AssertEqual(t, baseURL+"/req", resp.Request.RawRequest.URL.String())
+func TestSetBaseURL(t *testing.T) {
+	baseURL := "http://dummy-req.local/test"
+	resp, _ := tc().SetTimeout(time.Nanosecond).SetBaseURL(baseURL).R().Get("/req")
+	tests.AssertEqual(t, baseURL+"/req", resp.Request.RawRequest.URL.String())
+}
+
+func TestSetCommonFormDataFromValues(t *testing.T) {
+	expectedForm := make(url.Values)
+	gotForm := make(url.Values)
+	expectedForm.Set("test", "test")
+	resp, err := tc().
+		SetCommonFormDataFromValues(expectedForm).
+		R().SetSuccessResult(&gotForm).
+		Post("/form")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "test", gotForm.Get("test"))
+}
+
+func TestSetCommonFormData(t *testing.T) {
+	form := make(url.Values)
+	resp, err := tc().
+		SetCommonFormData(
+			map[string]string{
+				"test": "test",
+			}).R().
+		SetSuccessResult(&form).
+		Post("/form")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "test", form.Get("test"))
+}
+
+func TestSetMultipartBoundaryFunc(t *testing.T) {
+	delimiter := "test-delimiter"
+	expectedContentType := fmt.Sprintf("multipart/form-data; boundary=%s", delimiter)
+	resp, err := tc().
+		SetMultipartBoundaryFunc(func() string {
+			return delimiter
+		}).R().
+		EnableForceMultipart().
+		SetFormData(
+			map[string]string{
+				"test": "test",
+			}).
+		Post("/content-type")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, expectedContentType, resp.String())
+}
+
+func TestFirefoxMultipartBoundaryFunc(t *testing.T) {
+	r := regexp.MustCompile(`^-------------------------\d{1,10}\d{1,10}\d{1,10}$`)
+	b, err := firefoxMultipartBoundary(rand.Reader)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, true, r.MatchString(b))
+}
+
+func TestWebkitMultipartBoundaryFunc(t *testing.T) {
+	r := regexp.MustCompile(`^----WebKitFormBoundary[0-9a-zA-Z]{16}$`)
+	b, err := webkitMultipartBoundary(rand.Reader)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, true, r.MatchString(b))
+}
+
+func TestSetMultipartBoundaryRand(t *testing.T) {
+	post := func(c *Client) string {
+		resp, err := c.R().
+			EnableForceMultipart().
+			SetFormData(map[string]string{"test": "test"}).
+			Post("/content-type")
+		assertSuccess(t, resp, err)
+		return resp.String()
+	}
+	seeded := func() io.Reader {
+		return bytes.NewReader(bytes.Repeat([]byte{1, 2, 3, 4, 5, 6, 7, 8}, 64))
+	}
+
+	tests.AssertEqual(t, "multipart/form-data; boundary=----WebKitFormBoundaryCCCCCCCCCCCCCCCC",
+		post(tc().ImpersonateChrome().SetMultipartBoundaryRand(bytes.NewReader(bytes.Repeat([]byte{2}, 64)))))
+	tests.AssertEqual(t, post(tc().ImpersonateFirefox().SetMultipartBoundaryRand(seeded())),
+		post(tc().ImpersonateFirefox().SetMultipartBoundaryRand(seeded())))
+	tests.AssertEqual(t, post(tc().SetMultipartBoundaryRand(seeded())),
+		post(tc().SetMultipartBoundaryRand(seeded())))
+
+	// return the error if the rand is exhausted.
+	_, err := tc().ImpersonateFirefox().SetMultipartBoundaryRand(bytes.NewReader([]byte{1})).R().
+		EnableForceMultipart().
+		SetFormData(map[string]string{"test": "test"}).
+		Post("/content-type")
+	tests.AssertErrorContains(t, err, "failed to generate multipart boundary: unexpected EOF")
+}
+
+func TestSetMultipartBoundaryFuncE(t *testing.T) {
+	resp, err := tc().
+		SetMultipartBoundaryFuncE(func() (string, error) {
+			return "test-delimiter", nil
+		}).R().
+		EnableForceMultipart().
+		SetFormData(map[string]string{"test": "test"}).
+		Post("/content-type")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "multipart/form-data; boundary=test-delimiter", resp.String())
+
+	_, err = tc().
+		SetMultipartBoundaryFuncE(func() (string, error) {
+			return "", errors.New("entropy exhausted")
+		}).R().
+		EnableForceMultipart().
+		SetFormData(map[string]string{"test": "test"}).
+		Post("/content-type")
+	tests.AssertErrorContains(t, err, "entropy exhausted")
+}
+
+func TestImpersonateChromeVersion(t *testing.T) {
+	c := tc().ImpersonateChromeVersion(131)
+	tests.AssertEqual(t, 131, c.GetImpersonateChromeVersion())
+	tests.AssertContains(t, c.Headers.Get("user-agent"), "chrome/131.0.0.0", true)
+	tests.AssertContains(t, c.Headers.Get("sec-ch-ua"), `"chromium";v="131"`, true)
+
+	c.ImpersonateChromeVersion(121)
+	tests.AssertEqual(t, 120, c.GetImpersonateChromeVersion())
+	tests.AssertContains(t, c.Headers.Get("user-agent"), "chrome/120.0.0.0", true)
+
+	c.ImpersonateChrome()
+	tests.AssertEqual(t, ChromeVersions()[len(ChromeVersions())-1], c.GetImpersonateChromeVersion())
+
+	c.ImpersonateFirefox()
+	tests.AssertEqual(t, 0, c.GetImpersonateChromeVersion())
+
+	c.ImpersonateChrome100()
+	tests.AssertEqual(t, `" Not A;Brand";v="99", "Chromium";v="100", "Google Chrome";v="100"`, c.Headers.Get("sec-ch-ua"))
+	tests.AssertEqual(t, http2.SettingMaxConcurrentStreams, c.Transport.t2.Settings[1].ID)
+	c.ImpersonateChromeVersion(110)
+	tests.AssertEqual(t, 112, c.GetImpersonateChromeVersion())
+	tests.AssertEqual(t, utls.HelloChrome_114_Padding_PSK_Shuf, ChromeVersionProfile(115).ClientHelloID)
+
+	for _, major := range ChromeVersions() {
+		c := tc()
+		tests.AssertNoError(t, c.Impersonate(fmt.Sprintf("chrome%d", major)))
+		tests.AssertEqual(t, major, c.GetImpersonateChromeVersion())
+		_, err := c.JA4()
+		tests.AssertNoError(t, err)
+		resp, err := c.R().Get("/")
+		assertSuccess(t, resp, err)
+	}
+}
+
+func TestChromeClientHints(t *testing.T) {
+	for major, want := range map[int]string{
+		// the legacy GREASE brand.
+		102: `" Not A;Brand";v="99", "Chromium";v="102", "Google Chrome";v="102"`,
+		// the GREASE brand and its version vary by version, and so does the
+		// order of the brands.
+		106: `"Chromium";v="106", "Google Chrome";v="106", "Not;A=Brand";v="99"`,
+		114: `"Not.A/Brand";v="8", "Chromium";v="114", "Google Chrome";v="114"`,
+		115: `"Not/A)Brand";v="99", "Google Chrome";v="115", "Chromium";v="115"`,
+		120: `"Not_A Brand";v="8", "Chromium";v="120", "Google Chrome";v="120"`,
+		131: `"Google Chrome";v="131", "Chromium";v="131", "Not_A Brand";v="24"`,
+		133: `"Not(A:Brand";v="99", "Google Chrome";v="133", "Chromium";v="133"`,
+	} {
+		tests.AssertEqual(t, want, ChromeClientHints(major)["sec-ch-ua"])
+	}
+	hints := ChromeClientHints(131)
+	tests.AssertEqual(t, `"Google Chrome";v="131.0.0.0", "Chromium";v="131.0.0.0", "Not_A Brand";v="24.0.0.0"`, hints["sec-ch-ua-full-version-list"])
+	tests.AssertEqual(t, "?0", hints["sec-ch-ua-mobile"])
+	tests.AssertEqual(t, `"macOS"`, hints["sec-ch-ua-platform"])
+
+	for _, major := range ChromeVersions() {
+		tests.AssertEqual(t, ChromeClientHints(major)["sec-ch-ua"], ChromeVersionProfile(major).Headers["sec-ch-ua"])
+	}
+	tests.AssertEqual(t, `"Microsoft Edge";v="131", "Chromium";v="131", "Not_A Brand";v="24"`, EdgeProfile().Headers["sec-ch-ua"])
+	// Opera 106 is shuffled by its Chromium version.
+	tests.AssertEqual(t, `"Not_A Brand";v="8", "Chromium";v="120", "Opera";v="106"`, OperaProfile().Headers["sec-ch-ua"])
+}
+
+func TestImpersonateFirefoxVersion(t *testing.T) {
+	c := tc().ImpersonateFirefoxVersion(115)
+	tests.AssertEqual(t, 115, c.GetImpersonateFirefoxVersion())
+	tests.AssertContains(t, c.Headers.Get("user-agent"), "rv:115.0) gecko/20100101 firefox/115.0", true)
+	tests.AssertEqual(t, 6, len(c.Transport.t2.PriorityFrames))
+	tests.AssertEqual(t, "", c.Headers.Get("priority"))
+
+	c.ImpersonateFirefoxVersion(127)
+	tests.AssertEqual(t, 128, c.GetImpersonateFirefoxVersion())
+	tests.AssertEqual(t, 0, len(c.Transport.t2.PriorityFrames))
+	tests.AssertEqual(t, "u=0, i", c.Headers.Get("priority"))
+
+	c.ImpersonateFirefox()
+	tests.AssertEqual(t, 120, c.GetImpersonateFirefoxVersion())
+	c.ImpersonateFirefox133()
+	tests.AssertEqual(t, 133, c.GetImpersonateFirefoxVersion())
+	c.ImpersonateChrome()
+	tests.AssertEqual(t, 0, c.GetImpersonateFirefoxVersion())
+
+	for _, major := range FirefoxVersions() {
+		c := tc()
+		tests.AssertNoError(t, c.Impersonate(fmt.Sprintf("firefox%d", major)))
+		tests.AssertEqual(t, major, c.GetImpersonateFirefoxVersion())
+		// the http2 settings shared by all versions.
+		settings := make(map[http2.SettingID]uint32)
+		for _, s := range c.Transport.t2.Settings {
+			settings[s.ID] = s.Val
+		}
+		tests.AssertEqual(t, uint32(16384), settings[http2.SettingMaxFrameSize])
+		tests.AssertEqual(t, uint32(131072), settings[http2.SettingInitialWindowSize])
+		tests.AssertEqual(t, uint32(65536), settings[http2.SettingHeaderTableSize])
+		resp, err := c.R().Get("/")
+		assertSuccess(t, resp, err)
+	}
+}
+
+func TestImpersonateFirefoxClientHello(t *testing.T) {
+	// the versions whose ClientHello is approximated by the closest older
+	// one defined by utls.
+	approximated := map[int]int{115: 105, 128: 120, 133: 120}
+	var helloVersions []int
+	for _, id := range []utls.ClientHelloID{utls.HelloFirefox_55, utls.HelloFirefox_56, utls.HelloFirefox_63, utls.HelloFirefox_65,
+		utls.HelloFirefox_99, utls.HelloFirefox_102, utls.HelloFirefox_105, utls.HelloFirefox_120} {
+		v, err := strconv.Atoi(id.Version)
+		tests.AssertNoError(t, err)
+		helloVersions = append(helloVersions, v)
+	}
+	uaRegexp := regexp.MustCompile(`Firefox/(\d+)\.`)
+	for _, major := range FirefoxVersions() {
+		p := FirefoxVersionProfile(major)
+		m := uaRegexp.FindStringSubmatch(p.Headers["user-agent"])
+		tests.AssertEqual(t, 2, len(m))
+		tests.AssertEqual(t, strconv.Itoa(major), m[1])
+
+		helloVersion, err := strconv.Atoi(p.ClientHelloID.Version)
+		tests.AssertNoError(t, err)
+		want, ok := approximated[major]
+		if !ok {
+			want = major
+		}
+		tests.AssertEqual(t, want, helloVersion)
+		// the closest older one is used.
+		i, _ := slices.BinarySearch(helloVersions, major+1)
+		tests.AssertEqual(t, helloVersions[i-1], helloVersion)
+	}
+}
+
+func TestImpersonateTorBrowser(t *testing.T) {
+	c := tc().ImpersonateTorBrowser()
+	tests.AssertEqual(t, "Mozilla/5.0 (Windows NT 10.0; rv:128.0) Gecko/20100101 Firefox/128.0", c.Headers.Get("user-agent"))
+	tests.AssertEqual(t, "en-US,en;q=0.5", c.Headers.Get("accept-language"))
+	tests.AssertEqual(t, "u=0, i", c.Headers.Get("priority"))
+	diff := DiffProfiles(FirefoxVersionProfile(128), TorBrowserProfile())
+	for _, d := range diff.Differences {
+		switch d.Field {
+		case "Headers[user-agent]", "Headers[accept-language]", "HTTP3Settings":
+		default:
+			t.Errorf("unexpected difference from firefox 128: %s", d.Field)
+		}
+	}
+	resp, err := c.R().Get("/header")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "HTTP/2.0", resp.Proto)
+
+	c = tc()
+	tests.AssertNoError(t, c.Impersonate("tor_browser"))
+	tests.AssertEqual(t, "en-US,en;q=0.5", c.Headers.Get("accept-language"))
+}
+
+func TestImpersonateConnectionPool(t *testing.T) {
+	c := tc().ImpersonateChrome()
+	get := func() *Response {
+		resp, err := c.R().EnableTrace().Get("/")
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, "HTTP/2.0", resp.Proto)
+		return resp
+	}
+	tests.AssertEqual(t, false, get().TraceInfo().IsConnReused)
+	tests.AssertEqual(t, true, get().TraceInfo().IsConnReused)
+
+	// different tls fingerprints to the same host.
+	c.ImpersonateFirefox()
+	tests.AssertEqual(t, false, get().TraceInfo().IsConnReused)
+	// the same tls fingerprint with different http2 settings.
+	c.ImpersonateFirefox133()
+	tests.AssertEqual(t, false, get().TraceInfo().IsConnReused)
+
+	// the connections of the profiles are kept.
+	c.ImpersonateChrome()
+	tests.AssertEqual(t, true, get().TraceInfo().IsConnReused)
+	c.ImpersonateFirefox()
+	tests.AssertEqual(t, true, get().TraceInfo().IsConnReused)
+
+	// the cached key is rebuilt when the http2 settings change.
+	c.SetHTTP2ConnectionFlow(c.GetHTTP2ConnectionFlow() + 1)
+	tests.AssertEqual(t, false, get().TraceInfo().IsConnReused)
+	tests.AssertEqual(t, true, get().TraceInfo().IsConnReused)
+
+	// the key of a predefined ClientHelloID is stable without the GREASE.
+	key := tlsFingerprintKey(utls.HelloChrome_120, nil)
+	tests.AssertEqual(t, key, tlsFingerprintKey(utls.HelloChrome_120, nil))
+	cached, ok := tlsFingerprintKeys.Load(utls.HelloChrome_120.Str())
+	tests.AssertEqual(t, true, ok)
+	tests.AssertEqual(t, key, cached)
+	tlsFingerprintKey(utls.HelloRandomized, nil)
+	_, ok = tlsFingerprintKeys.Load(utls.HelloRandomized.Str())
+	tests.AssertEqual(t, false, ok)
+}
+
+func TestImpersonateTETrailers(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto + " " + r.Header.Get("Te")))
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	c := C().EnableInsecureSkipVerify().ImpersonateFirefox()
+	tests.AssertEqual(t, "trailers", c.Headers.Get("te"))
+	resp, err := c.R().Get(server.URL)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "HTTP/2.0 trailers", resp.String())
+	// not sent over HTTP/1.1.
+	raw := captureRawRequest(t, func(url string) {
+		c.R().Get(url)
+	})
+	tests.AssertEqual(t, false, strings.Contains(strings.ToLower(raw), "\r\nte:"))
+	raw = captureRawRequest(t, func(url string) {
+		c.R().SetHeader("Connection", "TE").Get(url)
+	})
+	tests.AssertContains(t, raw, "te: trailers", true)
+
+	c.DisableImpersonateTETrailers()
+	resp, err = c.R().Get(server.URL)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "HTTP/2.0 ", resp.String())
+	c.ImpersonateFirefox133()
+	tests.AssertEqual(t, "", c.Headers.Get("te"))
+	c.EnableImpersonateTETrailers()
+	tests.AssertEqual(t, "trailers", c.Headers.Get("te"))
+	c.ImpersonateChrome().EnableImpersonateTETrailers()
+	tests.AssertEqual(t, "", c.Headers.Get("te"))
+}
+
+func TestImpersonateEdge(t *testing.T) {
+	c := tc().ImpersonateEdge()
+	tests.AssertContains(t, c.Headers.Get("user-agent"), "edg/131.0.0.0", true)
+	tests.AssertEqual(t, `"Microsoft Edge";v="131", "Chromium";v="131", "Not_A Brand";v="24"`, c.Headers.Get("sec-ch-ua"))
+
+	// the brand list and the position of the GREASE brand are configurable.
+	c.SetClientHintBrands(
+		ClientHintBrand{Brand: "Not_A Brand", Version: "8"},
+		ClientHintBrand{Brand: "Chromium", Version: "120"},
+		ClientHintBrand{Brand: "Microsoft Edge", Version: "120"},
+	)
+	tests.AssertEqual(t, `"Not_A Brand";v="8", "Chromium";v="120", "Microsoft Edge";v="120"`, c.Headers.Get("sec-ch-ua"))
+	raw := captureRawRequest(t, func(url string) {
+		c.R().Get(url)
+	})
+	tests.AssertContains(t, raw, "\r\nsec-ch-ua: \"not_a brand\";v=\"8\", \"chromium\"", true)
+	c.SetClientHintBrands()
+	tests.AssertEqual(t, 0, len(c.Headers.Values("sec-ch-ua")))
+
+	hdrs := make(http.Header)
+	hdrs.Set("Accept-Language", "en-US,en;q=0.9")
+	hdrs.Set("X-Empty", "")
+	c = tc().ImpersonateCustomEdge(hdrs, nil)
+	tests.AssertEqual(t, "en-US,en;q=0.9", c.Headers.Get("accept-language"))
+	tests.AssertEqual(t, 0, len(c.Headers.Values("x-empty")))
+	tests.AssertContains(t, c.Headers.Get("user-agent"), "edg/131.0.0.0", true)
+
+	// multi-value headers are preserved in order.
+	hdrs = make(http.Header)
+	hdrs.Add("x-multi", "1")
+	hdrs.Add("x-multi", "2")
+	c = C().ImpersonateCustomEdge(hdrs, nil).SetCommonHeaderOrder("x-multi")
+	tests.AssertEqual(t, []string{"1", "2"}, c.Headers.Values("x-multi"))
+	raw = captureRawRequest(t, func(url string) {
+		c.R().Get(url)
+	})
+	tests.AssertContains(t, raw, "\r\nx-multi: 1\r\nx-multi: 2\r\n", true)
+
+	// the extra header is sent at the captured position.
+	hdrs = make(http.Header)
+	hdrs.Set("x-client-data", "CJa2yQEIpLbJAQ==")
+	c = C().ImpersonateCustomEdge(hdrs, nil, "user-agent", "Accept", "x-client-data", "sec-fetch-site")
+	raw = captureRawRequest(t, func(url string) {
+		c.R().Get(url)
+	})
+	names := rawHeaderNames(raw)
+	i := slices.Index(names, "x-client-data")
+	tests.AssertEqual(t, []string{"accept", "x-client-data", "sec-fetch-site"}, names[i-1:i+2])
+}
+
+func TestSetImpersonateExtraHeader(t *testing.T) {
+	headerNames := func(c *Client) []string {
+		raw := captureRawRequest(t, func(url string) {
+			c.R().Get(url)
+		})
+		return rawHeaderNames(raw)
+	}
+	neighbours := func(names []string, name string) []string {
+		i := slices.Index(names, name)
+		tests.AssertEqual(t, true, i > 0 && i < len(names)-1)
+		return names[i-1 : i+2]
+	}
+
+	// x-client-data is in the order of the Chrome profile.
+	c := C().ImpersonateChrome().SetCommonHeader("x-client-data", "CJa2yQEIpLbJAQ==")
+	tests.AssertEqual(t, []string{"accept", "x-client-data", "sec-fetch-site"}, neighbours(headerNames(c), "x-client-data"))
+
+	c = C().ImpersonateFirefox().SetImpersonateExtraHeader("X-Foo", "bar", "Accept-Language")
+	tests.AssertEqual(t, "bar", c.Headers.Get("x-foo"))
+	tests.AssertEqual(t, []string{"accept-language", "x-foo", "accept-encoding"}, neighbours(headerNames(c), "x-foo"))
+	// move the header.
+	c.SetImpersonateExtraHeader("x-foo", "baz", "accept")
+	tests.AssertEqual(t, []string{"accept", "x-foo", "accept-language"}, neighbours(headerNames(c), "x-foo"))
+	tests.AssertEqual(t, []string{"x-foo", "host", "user-agent"}, c.SetImpersonateExtraHeader("x-foo", "baz", "").headerOrder[:3])
+	tests.AssertEqual(t, "x-foo", c.SetImpersonateExtraHeader("x-foo", "baz", "x-missing").headerOrder[len(c.headerOrder)-1])
+
+	c.SetImpersonateExtraHeader("bad header", "1", "accept")
+	tests.AssertEqual(t, "", c.Headers.Get("bad header"))
+}
+
+func TestRemoveImpersonateHeader(t *testing.T) {
+	c := C().ImpersonateChrome()
+	order := slices.DeleteFunc(slices.Clone(c.headerOrder), func(key string) bool {
+		return key == "upgrade-insecure-requests"
+	})
+	c.RemoveImpersonateHeader("Upgrade-Insecure-Requests")
+	tests.AssertEqual(t, "", c.Headers.Get("upgrade-insecure-requests"))
+	tests.AssertEqual(t, order, c.headerOrder)
+	raw := captureRawRequest(t, func(url string) {
+		c.R().Get(url)
+	})
+	tests.AssertEqual(t, false, strings.Contains(raw, "upgrade-insecure-requests"))
+	names := rawHeaderNames(raw)
+	tests.AssertEqual(t, []string{"sec-ch-ua-platform", "user-agent"}, names[slices.Index(names, "sec-ch-ua-platform"):slices.Index(names, "user-agent")+1])
+
+	// the header stays removed when switching the fetch mode.
+	c.ImpersonateFetchMode("cors").RemoveImpersonateHeader("priority").ImpersonateFetchMode("navigate")
+	tests.AssertEqual(t, "", c.Headers.Get("priority"))
+	tests.AssertEqual(t, "navigate", c.Headers.Get("sec-fetch-mode"))
+	tests.AssertEqual(t, false, slices.Contains(c.headerOrder, "priority"))
+
+	// reset by impersonating again.
+	c.ImpersonateChrome()
+	tests.AssertEqual(t, "1", c.Headers.Get("upgrade-insecure-requests"))
+}
+
+func TestSetImpersonateUserAgent(t *testing.T) {
+	var buf bytes.Buffer
+	c := C().SetLogger(NewLogger(&buf, "", 0)).ImpersonateChrome()
+	order := slices.Clone(c.headerOrder)
+	brands := c.Headers.Get("sec-ch-ua")
+	ua := c.Headers.Get("user-agent") + " MyCrawler/1.0 (+https://example.com/bot)"
+	c.SetImpersonateUserAgent(ua)
+	tests.AssertEqual(t, ua, c.Headers.Get("user-agent"))
+	tests.AssertEqual(t, brands, c.Headers.Get("sec-ch-ua"))
+	tests.AssertEqual(t, order, c.headerOrder)
+	tests.AssertEqual(t, "", buf.String())
+
+	c.SetImpersonateUserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/99.0.0.0 Safari/537.36")
+	tests.AssertContains(t, buf.String(), "the chrome version 99 of the user-agent does not match", true)
+	buf.Reset()
+	c.SetImpersonateUserAgent("curl/8.0")
+	tests.AssertContains(t, buf.String(), "is not chromium based", true)
+	buf.Reset()
+	c.SetImpersonateUserAgent("")
+	tests.AssertEqual(t, "curl/8.0", c.Headers.Get("user-agent"))
+	tests.AssertContains(t, buf.String(), "invalid user-agent", true)
+
+	// no warning for the browsers without sec-ch-ua.
+	buf.Reset()
+	C().SetLogger(NewLogger(&buf, "", 0)).ImpersonateFirefox().SetImpersonateUserAgent("curl/8.0")
+	tests.AssertEqual(t, "", buf.String())
+}
+
+func TestSetImpersonateClientHints(t *testing.T) {
+	c := C().ImpersonateChrome().SetImpersonateClientHints(ClientHints{
+		Arch:            "x86",
+		Bitness:         "64",
+		FullVersion:     "131.0.6778.86",
+		PlatformVersion: "15.0.0",
+	})
+	tests.AssertEqual(t, `"x86"`, c.Headers.Get("sec-ch-ua-arch"))
+	tests.AssertEqual(t, `"64"`, c.Headers.Get("sec-ch-ua-bitness"))
+	tests.AssertEqual(t, `"15.0.0"`, c.Headers.Get("sec-ch-ua-platform-version"))
+	tests.AssertEqual(t, `"Google Chrome";v="131.0.6778.86", "Chromium";v="131.0.6778.86", "Not_A Brand";v="24.0.0.0"`, c.Headers.Get("sec-ch-ua-full-version-list"))
+
+	raw := captureRawRequest(t, func(url string) {
+		c.R().Get(url)
+	})
+	names := rawHeaderNames(raw)
+	i := slices.Index(names, "sec-ch-ua")
+	tests.AssertEqual(t, true, i >= 0 && i+7 <= len(names))
+	tests.AssertEqual(t, clientHintsHeaderOrder, names[i:i+7])
+
+	// the hints are kept for the browsers impersonated later.
+	c.ImpersonateOpera()
+	tests.AssertEqual(t, `"Not_A Brand";v="8.0.0.0", "Chromium";v="120.0.0.0", "Opera";v="106.0.0.0"`, c.Headers.Get("sec-ch-ua-full-version-list"))
+	tests.AssertEqual(t, `"x86"`, c.Headers.Get("sec-ch-ua-arch"))
+	c.ImpersonateFirefox()
+	tests.AssertEqual(t, "", c.Headers.Get("sec-ch-ua-arch"))
+
+	c.ImpersonateChrome().SetImpersonateClientHints(ClientHints{})
+	tests.AssertEqual(t, "", c.Headers.Get("sec-ch-ua-arch"))
+	tests.AssertEqual(t, "", c.Headers.Get("sec-ch-ua-full-version-list"))
+}
+
+func TestSetClientHintsAuto(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/accept-ch" {
+			w.Header().Set("Accept-CH", "Sec-CH-UA-Platform-Version, sec-ch-ua-arch, Sec-CH-UA-Model")
+		}
+		w.Write([]byte(r.Header.Get("sec-ch-ua-arch") + "|" + r.Header.Get("sec-ch-ua-bitness") + "|" + r.Header.Get("sec-ch-ua-platform-version")))
+	}))
+	defer server.Close()
+	c := C().EnableInsecureSkipVerify().SetBaseURL(server.URL).
+		ImpersonateChrome().
+		SetImpersonateClientHints(ClientHints{Arch: "x86", Bitness: "64", PlatformVersion: "15.0.0"}).
+		SetClientHintsAuto(true)
+	tests.AssertEqual(t, "", c.Headers.Get("sec-ch-ua-arch"))
+	get := func(path string) string {
+		resp, err := c.R().Get(path)
+		assertSuccess(t, resp, err)
+		return resp.String()
+	}
+	tests.AssertEqual(t, "||", get("/"))
+	tests.AssertEqual(t, "||", get("/accept-ch"))
+	// the hints requested by Accept-CH, sec-ch-ua-model is not set.
+	tests.AssertEqual(t, `"x86"||"15.0.0"`, get("/"))
+	tests.AssertEqual(t, `"x86"||"15.0.0"`, get("/other"))
+
+	// sent to all origins when disabled.
+	c.SetClientHintsAuto(false)
+	tests.AssertEqual(t, `"x86"|"64"|"15.0.0"`, get("/"))
+}
+
+func TestImpersonateFetchMode(t *testing.T) {
+	c := C().ImpersonateChrome()
+	navigateOrder := slices.Clone(c.headerOrder)
+	c.ImpersonateFetchMode("cors")
+	tests.AssertEqual(t, "*/*", c.Headers.Get("accept"))
+	tests.AssertEqual(t, "cors", c.Headers.Get("sec-fetch-mode"))
+	tests.AssertEqual(t, "empty", c.Headers.Get("sec-fetch-dest"))
+	tests.AssertEqual(t, "same-origin", c.Headers.Get("sec-fetch-site"))
+	tests.AssertEqual(t, "u=1, i", c.Headers.Get("priority"))
+	tests.AssertEqual(t, "", c.Headers.Get("upgrade-insecure-requests"))
+	tests.AssertEqual(t, "", c.Headers.Get("sec-fetch-user"))
+
+	var origin string
+	raw := captureRawRequest(t, func(url string) {
+		origin = strings.TrimSuffix(url, "/")
+		c.R().SetBody("{}").Post(origin + "/api")
+	})
+	tests.AssertContains(t, raw, "origin: "+origin+"\r\n", true)
+	names := slices.DeleteFunc(rawHeaderNames(raw), func(name string) bool {
+		return !strings.HasPrefix(name, "sec-") && name != "user-agent" && name != "origin"
+	})
+	tests.AssertEqual(t, []string{"sec-ch-ua-platform", "user-agent", "sec-ch-ua", "sec-ch-ua-mobile", "origin", "sec-fetch-site", "sec-fetch-mode", "sec-fetch-dest"}, names)
+	// the same-origin GET request has no origin.
+	raw = captureRawRequest(t, func(url string) {
+		c.R().Get(url + "api")
+	})
+	tests.AssertEqual(t, false, strings.Contains(raw, "origin:"))
+	// the cross-origin GET request has the origin of the referer.
+	raw = captureRawRequest(t, func(url string) {
+		c.R().SetHeader("Referer", "https://www.example.com/page").Get(url + "api")
+	})
+	tests.AssertContains(t, raw, "origin: https://www.example.com\r\n", true)
+	// the origin set by the request takes precedence.
+	raw = captureRawRequest(t, func(url string) {
+		c.R().SetHeader("Origin", "https://example.com").Get(url)
+	})
+	tests.AssertContains(t, raw, "origin: https://example.com\r\n", true)
+
+	// the mode is kept for the browsers impersonated later.
+	c.ImpersonateFirefox133()
+	tests.AssertEqual(t, "cors", c.Headers.Get("sec-fetch-mode"))
+	tests.AssertEqual(t, "u=4", c.Headers.Get("priority"))
+	// the headers added by the transport are at the positions of the browser.
+	raw = captureRawRequest(t, func(url string) {
+		c.R().SetHeader("Content-Type", "application/json").SetBody("{}").Post(url)
+	})
+	tests.AssertEqual(t, []string{"host", "user-agent", "accept", "accept-language", "accept-encoding", "content-type", "content-length", "origin"},
+		slices.DeleteFunc(rawHeaderNames(raw), func(name string) bool {
+			return strings.HasPrefix(name, "sec-") || name == "priority" || name == "te"
+		}))
+	c.ImpersonateSafari()
+	tests.AssertEqual(t, "*/*", c.Headers.Get("accept"))
+	tests.AssertEqual(t, "empty", c.Headers.Get("sec-fetch-dest"))
+
+	// restore the navigation headers.
+	c.ImpersonateChrome().ImpersonateFetchMode("navigate")
+	tests.AssertEqual(t, "navigate", c.Headers.Get("sec-fetch-mode"))
+	tests.AssertEqual(t, "document", c.Headers.Get("sec-fetch-dest"))
+	tests.AssertEqual(t, "1", c.Headers.Get("upgrade-insecure-requests"))
+	tests.AssertEqual(t, "u=0, i", c.Headers.Get("priority"))
+	tests.AssertEqual(t, navigateOrder, c.headerOrder)
+	raw = captureRawRequest(t, func(url string) {
+		c.R().Get(url)
+	})
+	tests.AssertEqual(t, false, strings.Contains(raw, "origin:"))
+
+	var buf bytes.Buffer
+	c.SetLogger(NewLogger(&buf, "", 0)).ImpersonateFetchMode("websocket")
+	tests.AssertContains(t, buf.String(), `unsupported fetch mode "websocket"`, true)
+	tests.AssertEqual(t, "navigate", c.Headers.Get("sec-fetch-mode"))
+}
+
+func TestParseRawHeaders(t *testing.T) {
+	raw := "GET /search?q=a:b HTTP/1.1\r\n" +
+		"Host: example.com\r\n" +
+		"User-Agent: Mozilla/5.0\r\n" +
+		"X-Folded: a\r\n" +
+		" \tb\r\n" +
+		"Accept: text/html\r\n" +
+		"x-multi: 1\r\n" +
+		"X-Multi: 2\r\n" +
+		"\r\n" +
+		"ignored: body\r\n"
+	hdrs, order, err := ParseRawHeaders(raw)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, []string{"host", "user-agent", "x-folded", "accept", "x-multi"}, order)
+	tests.AssertEqual(t, "a b", hdrs.Get("x-folded"))
+	tests.AssertEqual(t, []string{"1", "2"}, hdrs.Values("x-multi"))
+	tests.AssertEqual(t, "", hdrs.Get("ignored"))
+
+	// the pseudo headers copied from a HTTP/2 request are skipped.
+	hdrs, order, err = ParseRawHeaders(":authority: example.com\n:method: GET\naccept: */*\n")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, []string{"accept"}, order)
+	tests.AssertEqual(t, 1, len(hdrs))
+
+	_, _, err = ParseRawHeaders(" folded\r\n")
+	tests.AssertErrorContains(t, err, "unexpected folded line")
+	_, _, err = ParseRawHeaders("Accept text/html\r\n")
+	tests.AssertErrorContains(t, err, "malformed header line")
+	_, _, err = ParseRawHeaders("Bad Header: 1\r\n")
+	tests.AssertErrorContains(t, err, "invalid header name")
+
+	hdrs, order, err = ParseRawHeaders("accept: */*\nx-client-data: CJa2yQE=\nsec-fetch-site: none\n")
+	tests.AssertNoError(t, err)
+	c := tc().ImpersonateCustomEdge(hdrs, nil, order...)
+	tests.AssertEqual(t, "CJa2yQE=", c.Headers.Get("x-client-data"))
+	i := slices.Index(c.headerOrder, "x-client-data")
+	tests.AssertEqual(t, []string{"accept", "x-client-data", "sec-fetch-site"}, c.headerOrder[i-1:i+2])
+}
+
+func TestRequestFromHAR(t *testing.T) {
+	data := `{"log": {"entries": [{"request": {
+		"method": "POST",
+		"url": "` + getTestServerURL() + `/echo?a=1",
+		"httpVersion": "HTTP/1.1",
+		"headers": [
+			{"name": "Host", "value": "example.com"},
+			{"name": "X-B", "value": "b"},
+			{"name": "Content-Type", "value": "application/octet-stream"},
+			{"name": "Content-Length", "value": "3"},
+			{"name": "X-A", "value": "a1"},
+			{"name": "X-A", "value": "a2"}
+		],
+		"cookies": [{"name": "session", "value": "abc"}],
+		"postData": {"mimeType": "application/octet-stream", "text": "AQID", "encoding": "base64"}
+	}}]}}`
+	var har HAR
+	tests.AssertNoError(t, json.Unmarshal([]byte(data), &har))
+	c := tc()
+	r, err := c.RequestFromHAR(har.Log.Entries[0])
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, []string{"host", "x-b", "content-type", "content-length", "x-a"}, r.Headers[HeaderOderKey])
+	var e Echo
+	resp, err := r.SetSuccessResult(&e).Send(r.Method, r.RawURL)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "\x01\x02\x03", e.Body)
+	tests.AssertEqual(t, []string{"a1", "a2"}, e.Header.Values("x-a"))
+	tests.AssertEqual(t, "session=abc", e.Header.Get("cookie"))
+	tests.AssertEqual(t, "application/octet-stream", e.Header.Get("content-type"))
+
+	// the multipart body is rebuilt from the params.
+	entry := HAREntry{Request: HARRequest{
+		Method: "post",
+		URL:    getTestServerURL() + "/multipart",
+		Headers: []HARNameValue{
+			{Name: ":method", Value: "POST"},
+			{Name: ":authority", Value: "example.com"},
+			{Name: "content-type", Value: "multipart/form-data; boundary=----captured"},
+		},
+		PostData: &HARPostData{
+			MimeType: "multipart/form-data; boundary=----captured",
+			Params: []HARParam{
+				{Name: "k", Value: "v"},
+				{Name: "file", FileName: "a.txt", Value: "content", ContentType: "text/plain"},
+			},
+		},
+	}}
+	r, err = c.RequestFromHAR(entry)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, []string{":method", ":authority"}, r.Headers[PseudoHeaderOderKey])
+	resp, err = r.Send(r.Method, r.RawURL)
+	assertSuccess(t, resp, err)
+	tests.AssertContains(t, resp.String(), `"k":["v"]`, true)
+	tests.AssertContains(t, resp.String(), `"a.txt"`, true)
+
+	_, err = c.RequestFromHAR(HAREntry{})
+	tests.AssertErrorContains(t, err, "missing method or url")
+	entry.Request.PostData = &HARPostData{Text: "!", Encoding: "base64"}
+	_, err = c.RequestFromHAR(entry)
+	tests.AssertErrorContains(t, err, "failed to decode base64 post data")
+}
+
+func TestParseCurlCommand(t *testing.T) {
+	url := getTestServerURL() + "/echo"
+	bash := "curl '" + url + "' \\\n" +
+		"  -H 'x-b: b' \\\n" +
+		"  -H $'x-quote: it\\'s' \\\n" +
+		"  -b 'session=abc' \\\n" +
+		"  -H \"X-A: \\\"a\\\"\" \\\n" +
+		"  --data-raw '{\"k\":\"v\"}' \\\n" +
+		"  --compressed"
+	c := tc()
+	r, err := c.ParseCurlCommand(bash)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, http.MethodPost, r.Method)
+	tests.AssertEqual(t, []string{"x-b", "x-quote", "cookie", "x-a"}, r.Headers[HeaderOderKey])
+	var e Echo
+	resp, err := r.SetSuccessResult(&e).Send(r.Method, r.RawURL)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, `{"k":"v"}`, e.Body)
+	tests.AssertEqual(t, "it's", e.Header.Get("x-quote"))
+	tests.AssertEqual(t, `"a"`, e.Header.Get("x-a"))
+	tests.AssertEqual(t, "session=abc", e.Header.Get("cookie"))
+	tests.AssertEqual(t, header.FormContentType, e.Header.Get("content-type"))
+
+	cmd := "curl ^\"" + url + "^\" ^\r\n" +
+		"  -H ^\"x-b: 100^%^\" ^\r\n" +
+		"  -H ^\"x-a: \\^\"a\\^\"^\" ^\r\n" +
+		"  -X post ^\r\n" +
+		"  --data-raw ^\"a=1^&b=2^\""
+	r, err = c.ParseCurlCommand(cmd)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, http.MethodPost, r.Method)
+	e = Echo{}
+	resp, err = r.SetSuccessResult(&e).Send(r.Method, r.RawURL)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "a=1&b=2", e.Body)
+	tests.AssertEqual(t, "100%", e.Header.Get("x-b"))
+	tests.AssertEqual(t, `"a"`, e.Header.Get("x-a"))
+
+	r, err = c.ParseCurlCommand("curl -XDELETE -H 'A: 1' " + url)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, http.MethodDelete, r.Method)
+	r, err = c.ParseCurlCommand("curl " + url)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, http.MethodGet, r.Method)
+
+	_, err = c.ParseCurlCommand("wget " + url)
+	tests.AssertErrorContains(t, err, "not a curl command")
+	_, err = c.ParseCurlCommand("curl -H")
+	tests.AssertErrorContains(t, err, "missing value of curl option -H")
+	_, err = c.ParseCurlCommand("curl --proxy http://127.0.0.1 " + url)
+	tests.AssertErrorContains(t, err, "unsupported curl option --proxy")
+	_, err = c.ParseCurlCommand("curl 'unterminated")
+	tests.AssertErrorContains(t, err, "unterminated single quote")
+	_, err = c.ParseCurlCommand("curl -d @body.json " + url)
+	tests.AssertErrorContains(t, err, "reading data from file")
+	_, err = c.ParseCurlCommand("curl -H 'A: 1'")
+	tests.AssertErrorContains(t, err, "missing url")
+}
+
+func TestToCurl(t *testing.T) {
+	c := C().SetBaseURL("https://example.com").
+		SetCommonHeader("User-Agent", "test-agent").
+		SetCommonHeaderOrder("x-b", "user-agent")
+	r := c.R().
+		SetQueryParam("q", "1").
+		SetHeader("X-A", "it's").
+		SetHeader("X-B", "b").
+		SetCookies(&http.Cookie{Name: "session", Value: "abc"}).
+		SetBodyJsonString(`{"k":"v"}`).
+		SetURL("/api")
+	r.Method = http.MethodPost
+	cmd := r.ToCurl()
+	want := "curl 'https://example.com/api?q=1' \\\n" +
+		"  -H 'X-B: b' \\\n" +
+		"  -H 'User-Agent: test-agent' \\\n" +
+		"  -H 'Content-Type: application/json; charset=utf-8' \\\n" +
+		"  -H 'Cookie: session=abc' \\\n" +
+		"  -H 'X-A: it'\\''s' \\\n" +
+		"  --data-raw '{\"k\":\"v\"}'"
+	tests.AssertEqual(t, want, cmd)
+
+	// the command can be parsed back.
+	r, err := c.ParseCurlCommand(cmd)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "it's", r.Headers.Get("x-a"))
+	tests.AssertEqual(t, []string{"x-b", "user-agent", "content-type", "cookie", "x-a"}, r.Headers[HeaderOderKey])
+
+	cmd = c.R().SetHeaderOrder("x-a").SetHeader("x-a", "1").SetBodyString("a\nb").SetURL("/").ToCurl()
+	tests.AssertContains(t, cmd, "--data-raw $'a\\nb'", true)
+	tests.AssertContains(t, cmd, "curl 'https://example.com/' \\\n  -x 'get' \\\n  -h 'x-a: 1'", true)
+
+	cmd = c.R().SetFileBytes("file", "a.txt", []byte("content")).SetFormData(map[string]string{"k": "v"}).SetURL("/").ToCurl()
+	tests.AssertContains(t, cmd, "-f 'k=v' \\\n  -f 'file=@a.txt'", true)
+	tests.AssertEqual(t, false, strings.Contains(cmd, "Content-Type"))
+
+	// the headers of the impersonated browser are reflected.
+	cmd = tc().ImpersonateChrome().R().SetURL("/").ToCurl()
+	tests.AssertContains(t, cmd, "-h 'sec-ch-ua: ", true)
+	tests.AssertEqual(t, true, strings.Index(cmd, "User-Agent") < strings.Index(cmd, "Accept-Language"))
+}
+
+func TestMergeHeaderOrder(t *testing.T) {
+	tests.AssertEqual(t,
+		[]string{"x", "a", "b", "d", "c", "y"},
+		mergeHeaderOrder([]string{"a", "b", "c", "d"}, []string{"X", "a", "d", "c", "y"}))
+	tests.AssertEqual(t,
+		[]string{"a", "b", "x"},
+		mergeHeaderOrder([]string{"a", "b"}, []string{"x"}))
+}
+
+func buildRawClientHello(t *testing.T, clientHelloID utls.ClientHelloID) []byte {
+	uconn := utls.UClient(nil, &utls.Config{ServerName: "example.com"}, clientHelloID)
+	tests.AssertNoError(t, uconn.BuildHandshakeState())
+	hello := uconn.HandshakeState.Hello.Raw
+	record := []byte{0x16, 0x03, 0x01, byte(len(hello) >> 8), byte(len(hello))}
+	return append(record, hello...)
+}
+
+func TestSetCustomTLSFingerprint(t *testing.T) {
+	raw := buildRawClientHello(t, utls.HelloChrome_120)
+	resp, err := tc().SetCustomTLSFingerprint(raw).R().Get("/")
+	assertSuccess(t, resp, err)
+}
+
+func TestSetCustomTLSFingerprintEncoded(t *testing.T) {
+	raw := buildRawClientHello(t, utls.HelloChrome_120)
+	c := tc()
+	tests.AssertNoError(t, c.SetCustomTLSFingerprintBase64(base64.StdEncoding.EncodeToString(raw)))
+	resp, err := c.R().Get("/")
+	assertSuccess(t, resp, err)
+
+	c = tc()
+	tests.AssertNoError(t, c.SetCustomTLSFingerprintBase64(base64.RawStdEncoding.EncodeToString(raw)))
+	tests.AssertEqual(t, utls.HelloCustom, c.tlsFingerprintID)
+	c = tc()
+	s := hex.EncodeToString(raw)
+	tests.AssertNoError(t, c.SetCustomTLSFingerprintHex(s[:10]+"\n"+s[10:]))
+	resp, err = c.R().Get("/")
+	assertSuccess(t, resp, err)
+
+	for _, tt := range []struct {
+		name string
+		set  func(c *Client) error
+		err  string
+	}{
+		{"bad base64", func(c *Client) error { return c.SetCustomTLSFingerprintBase64("not base64!") }, "failed to decode base64 client hello"},
+		{"bad hex", func(c *Client) error { return c.SetCustomTLSFingerprintHex("16030z") }, "failed to decode hex client hello"},
+		{"empty", func(c *Client) error { return c.SetCustomTLSFingerprintHex("") }, "failed to parse client hello"},
+		{"not tls", func(c *Client) error {
+			return c.SetCustomTLSFingerprintBase64(base64.StdEncoding.EncodeToString([]byte("GET / HTTP/1.1\r\n")))
+		}, "failed to parse client hello"},
+		{"truncated", func(c *Client) error { return c.SetCustomTLSFingerprintHex(s[:len(s)/4*2]) }, "failed to parse client hello"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := C()
+			tests.AssertErrorContains(t, tt.set(c), tt.err)
+			// the fingerprint is not changed.
+			tests.AssertEqual(t, "", c.tlsFingerprintID.Client)
+		})
+	}
+}
+
+func TestSetClientHelloObserver(t *testing.T) {
+	observed := make(chan []byte, 1)
+	c := tc().ImpersonateChrome().SetClientHelloObserver(func(raw []byte) {
+		observed <- raw
+	})
+	record := captureClientHello(t, c)
+	select {
+	case raw := <-observed:
+		tests.AssertEqual(t, record[5:], raw)
+		resp, err := tc().SetCustomTLSFingerprint(raw).R().Get("/")
+		assertSuccess(t, resp, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the observed client hello")
+	}
+
+	// the observer is kept when the fingerprint changes.
+	c.ImpersonateFirefox()
+	record = captureClientHello(t, c)
+	tests.AssertEqual(t, record[5:], <-observed)
+
+	c.SetClientHelloObserver(nil)
+	captureClientHello(t, c)
+	tests.AssertEqual(t, 0, len(observed))
+}
+
+func TestSetTLSHandshakeObserver(t *testing.T) {
+	observed := make(chan utls.ConnectionState, 3)
+	c := tc().ImpersonateChrome().SetTLSHandshakeObserver(func(state utls.ConnectionState) {
+		observed <- state
+	})
+	for i := 0; i < 3; i++ {
+		resp, err := c.R().Get("/")
+		assertSuccess(t, resp, err)
+	}
+	select {
+	case state := <-observed:
+		tests.AssertEqual(t, true, state.HandshakeComplete)
+		tests.AssertEqual(t, uint16(utls.VersionTLS13), state.Version)
+		tests.AssertEqual(t, "h2", state.NegotiatedProtocol)
+		tests.AssertEqual(t, true, state.CipherSuite != 0)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the observed tls handshake")
+	}
+	// the connection is reused, so the observer is called only once.
+	time.Sleep(50 * time.Millisecond)
+	tests.AssertEqual(t, 0, len(observed))
+
+	c.SetTLSHandshakeObserver(nil).DisableKeepAlives()
+	resp, err := c.R().Get("/")
+	assertSuccess(t, resp, err)
+	time.Sleep(50 * time.Millisecond)
+	tests.AssertEqual(t, 0, len(observed))
+}
+
+func TestRequestSetTLSHandshakeTimeout(t *testing.T) {
+	// the server never responds to the ClientHello.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	url := "https://" + ln.Addr().String()
+	for _, c := range []*Client{tc(), tc().ImpersonateChrome()} {
+		c.SetTLSHandshakeTimeout(time.Minute)
+		start := time.Now()
+		_, err = c.R().SetTLSHandshakeTimeout(50 * time.Millisecond).Get(url)
+		tests.AssertEqual(t, true, errors.Is(err, ErrTLSHandshakeTimeout))
+		tests.AssertEqual(t, true, time.Since(start) < 10*time.Second)
+		var netErr net.Error
+		tests.AssertEqual(t, true, errors.As(err, &netErr) && netErr.Timeout())
+	}
+	_, err = tc().ImpersonateFirefox().R().ForceHTTP2().SetTLSHandshakeTimeout(50 * time.Millisecond).Get(url)
+	tests.AssertEqual(t, true, errors.Is(err, ErrTLSHandshakeTimeout))
+}
+
+func TestSetTLSSessionResumption(t *testing.T) {
+	testResume := func(t *testing.T, c *Client, resume bool) {
+		c.DisableKeepAlives()
+		for i := 0; i < 3; i++ {
+			resp, err := c.R().Get("/")
+			assertSuccess(t, resp, err)
+			if i > 0 || !resume {
+				tests.AssertEqual(t, resume, resp.TLS.DidResume)
+			}
+		}
+	}
+	t.Run("chrome", func(t *testing.T) {
+		testResume(t, tc().ImpersonateChrome().SetTLSSessionResumption(true), true)
+	})
+	t.Run("firefox", func(t *testing.T) {
+		testResume(t, tc().ImpersonateFirefox().SetTLSSessionResumption(true), true)
+	})
+	t.Run("std", func(t *testing.T) {
+		testResume(t, tc().EnableForceHTTP1().SetTLSSessionResumption(true), true)
+	})
+	t.Run("disabled", func(t *testing.T) {
+		testResume(t, tc().ImpersonateChrome().SetTLSSessionResumption(true).SetTLSSessionResumption(false), false)
+	})
+}
+
+func TestSetALPN(t *testing.T) {
+	alpn := func(c *Client) []string {
+		spec, err := ParseClientHello(captureClientHello(t, c))
+		tests.AssertNoError(t, err)
+		for _, ext := range spec.Extensions {
+			if e, ok := ext.(*utls.ALPNExtension); ok {
+				return e.AlpnProtocols
+			}
+		}
+		return nil
+	}
+	c := tc().ImpersonateChrome().SetALPN("http/1.1", "h2")
+	tests.AssertEqual(t, []string{"http/1.1", "h2"}, alpn(c))
+	resp, err := c.R().Get("/")
+	assertSuccess(t, resp, err)
+
+	// the existing connections are not affected.
+	c.SetALPN("http/1.1").Transport.CloseIdleConnections()
+	resp, err = c.R().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "HTTP/1.1", resp.Proto)
+
+	// ignore unsupported protocol.
+	c.SetALPN("h3")
+	tests.AssertEqual(t, []string{"http/1.1"}, alpn(c))
+
+	// the protocols of the tls fingerprint are used.
+	c.SetALPN()
+	tests.AssertEqual(t, []string{"h2", "http/1.1"}, alpn(c))
+
+	resp, err = tc().SetALPN("http/1.1").R().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "HTTP/1.1", resp.Proto)
+
+	// conflict with the forced http version.
+	c = tc().ImpersonateChrome().EnableForceHTTP2().SetALPN("http/1.1")
+	tests.AssertEqual(t, []string{"h2", "http/1.1"}, alpn(c))
+	_, err = tc().ImpersonateChrome().SetALPN("http/1.1").EnableForceHTTP2().R().Get("/")
+	tests.AssertErrorContains(t, err, "conflict with EnableForceHTTP2")
+}
+
+func TestSetTLSClientHelloSpec(t *testing.T) {
+	spec, err := utls.UTLSIdToSpec(utls.HelloChrome_100)
+	tests.AssertNoError(t, err)
+	c := tc().SetTLSClientHelloSpec(&spec)
+	ja3, err := c.JA3()
+	tests.AssertNoError(t, err)
+	expected, err := tc().SetTLSFingerprint(utls.HelloChrome_100).JA3()
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, expected, ja3)
+	resp, err := c.R().Get("/")
+	assertSuccess(t, resp, err)
+
+	// reorder the signature algorithms.
+	spec, _ = utls.UTLSIdToSpec(utls.HelloChrome_100)
+	var algs []utls.SignatureScheme
+	for _, ext := range spec.Extensions {
+		if e, ok := ext.(*utls.SignatureAlgorithmsExtension); ok {
+			slices.Reverse(e.SupportedSignatureAlgorithms)
+			algs = e.SupportedSignatureAlgorithms
+		}
+	}
+	c = tc().SetTLSClientHelloSpec(&spec)
+	parsed, err := ParseClientHello(captureClientHello(t, c))
+	tests.AssertNoError(t, err)
+	for _, ext := range parsed.Extensions {
+		if e, ok := ext.(*utls.SignatureAlgorithmsExtension); ok {
+			tests.AssertEqual(t, algs, e.SupportedSignatureAlgorithms)
+		}
+	}
+	ja3, _ = c.JA3()
+	tests.AssertEqual(t, expected, ja3)
+	resp, err = c.R().Get("/")
+	assertSuccess(t, resp, err)
+
+	// ignore nil spec.
+	c.SetTLSClientHelloSpec(nil)
+	ja3, _ = c.JA3()
+	tests.AssertEqual(t, expected, ja3)
+}
+
+func TestSetGREASEDeterministic(t *testing.T) {
+	greaseValues := func(c *Client) []uint16 {
+		info, err := parseClientHelloInfo(captureClientHello(t, c))
+		tests.AssertNoError(t, err)
+		var values []uint16
+		for _, vals := range [][]uint16{info.cipherSuites, info.extensions, info.supportedGroups, info.supportedVersions} {
+			for _, v := range vals {
+				if isGREASE(v) {
+					values = append(values, v)
+				}
+			}
+		}
+		return values
+	}
+	c := tc().SetTLSFingerprint(utls.HelloChrome_120).SetGREASEDeterministic(42)
+	expected := greaseValues(c)
+	tests.AssertEqual(t, 5, len(expected))
+	tests.AssertEqual(t, true, expected[1] != expected[2]) // two GREASE extensions
+	tests.AssertEqual(t, expected, greaseValues(c))
+	tests.AssertEqual(t, expected, greaseValues(tc().SetTLSFingerprint(utls.HelloChrome_120).SetGREASEDeterministic(42)))
+	tests.AssertEqual(t, false, slices.Equal(expected, greaseValues(tc().SetTLSFingerprint(utls.HelloChrome_120).SetGREASEDeterministic(7))))
+	resp, err := c.R().Get("/")
+	assertSuccess(t, resp, err)
+
+	// also valid if the spec is modified.
+	c = tc().SetTLSFingerprint(utls.HelloChrome_120).SetGREASEDeterministic(42).SetALPN("http/1.1")
+	tests.AssertEqual(t, expected, greaseValues(c))
+	resp, err = c.R().Get("/")
+	assertSuccess(t, resp, err)
+}
+
+// startECHServer starts a https server which accepts ECH, the handler writes
+// whether ECH is accepted, and returns the url and the ECHConfigList.
+func startECHServer(t *testing.T) (string, []byte) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	tests.AssertNoError(t, err)
+	// ECHConfig of draft-ietf-tls-esni-18 with the HPKE suite of
+	// DHKEM(X25519, HKDF-SHA256), HKDF-SHA256 and AES-128-GCM.
+	var contents []byte
+	contents = append(contents, 1, 0x00, 0x20)
+	contents = binary.BigEndian.AppendUint16(contents, 32)
+	contents = append(contents, key.PublicKey().Bytes()...)
+	contents = append(contents, 0, 4, 0, 1, 0, 1)
+	contents = append(contents, 0, byte(len("example.com")))
+	contents = append(contents, "example.com"...)
+	contents = append(contents, 0, 0)
+	config := []byte{0xfe, 0x0d}
+	config = binary.BigEndian.AppendUint16(config, uint16(len(contents)))
+	config = append(config, contents...)
+	configList := binary.BigEndian.AppendUint16(nil, uint16(len(config)))
+	configList = append(configList, config...)
+
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	tests.AssertNoError(t, err)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.TLS.ECHAccepted)
+	}))
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		EncryptedClientHelloKeys: []tls.EncryptedClientHelloKey{{
+			Config:     config,
+			PrivateKey: key.Bytes(),
+		}},
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server.URL, configList
+}
+
+func TestSetECH(t *testing.T) {
+	url, configList := startECHServer(t)
+	for name, c := range map[string]*Client{
+		"chrome": tc().ImpersonateChrome(),
+		"safari": tc().ImpersonateSafari(),
+		"std":    tc(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			resp, err := c.SetECH(configList).R().Get(url)
+			assertSuccess(t, resp, err)
+			tests.AssertEqual(t, "true", resp.String())
+			tests.AssertEqual(t, true, resp.TLS.ECHAccepted)
+		})
+	}
+	// ignore malformed config.
+	c := tc().SetECH(configList[1:])
+	tests.AssertIsNil(t, c.echConfigList)
+
+	// rejected by the server without ECH.
+	_, err := tc().ImpersonateChrome().SetECH(configList).R().Get("/")
+	tests.AssertNotNil(t, err)
+}
+
+func TestSetGREASEECH(t *testing.T) {
+	hasECH := func(c *Client) bool {
+		spec, err := ParseClientHello(captureClientHello(t, c))
+		tests.AssertNoError(t, err)
+		return slices.ContainsFunc(spec.Extensions, func(ext utls.TLSExtension) bool {
+			return tlsExtensionType(ext) == 0xfe0d
+		})
+	}
+	tests.AssertEqual(t, true, hasECH(tc().ImpersonateChrome()))
+	tests.AssertEqual(t, false, hasECH(tc().ImpersonateChrome().SetGREASEECH(false)))
+	tests.AssertEqual(t, false, hasECH(tc().ImpersonateSafari()))
+	c := tc().ImpersonateSafari().SetGREASEECH(true)
+	tests.AssertEqual(t, true, hasECH(c))
+	resp, err := c.R().Get("/")
+	assertSuccess(t, resp, err)
+}
+
+// captureRawRequest starts a plain http server which records the raw header
+// block of the first request it receives.
+func captureRawRequest(t *testing.T, send func(url string)) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	defer ln.Close()
+	raw := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			raw <- ""
+			return
+		}
+		defer conn.Close()
+		var sb strings.Builder
+		buf := make([]byte, 4096)
+		for !strings.Contains(sb.String(), "\r\n\r\n") {
+			n, err := conn.Read(buf)
+			sb.Write(buf[:n])
+			if err != nil {
+				break
+			}
+		}
+		conn.Write([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"))
+		raw <- sb.String()
+	}()
+	send("http://" + ln.Addr().String() + "/")
+	return <-raw
+}
+
+func rawHeaderNames(raw string) []string {
+	var names []string
+	lines := strings.Split(raw, "\r\n")
+	for _, line := range lines[1:] {
+		if line == "" {
+			break
+		}
+		if i := strings.Index(line, ":"); i > 0 {
+			names = append(names, strings.ToLower(line[:i]))
+		}
+	}
+	return names
+}
+
+// capturedBraveRequest is the navigation request captured from Brave 131 on macOS.
+const capturedBraveRequest = "GET / HTTP/1.1\r\n" +
+	"Host: example.com\r\n" +
+	"sec-ch-ua: \"Brave\";v=\"131\", \"Chromium\";v=\"131\", \"Not_A Brand\";v=\"24\"\r\n" +
+	"sec-ch-ua-mobile: ?0\r\n" +
+	"sec-ch-ua-platform: \"macOS\"\r\n" +
+	"Upgrade-Insecure-Requests: 1\r\n" +
+	"User-Agent: Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36\r\n" +
+	"Accept: text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8\r\n" +
+	"Sec-GPC: 1\r\n" +
+	"Accept-Language: en-US,en;q=0.5\r\n" +
+	"Sec-Fetch-Site: none\r\n" +
+	"Sec-Fetch-Mode: navigate\r\n" +
+	"Sec-Fetch-User: ?1\r\n" +
+	"Sec-Fetch-Dest: document\r\n" +
+	"Accept-Encoding: gzip, deflate, br, zstd\r\n" +
+	"\r\n"
+
+func TestImpersonateBrave(t *testing.T) {
+	c := C().ImpersonateChrome().ImpersonateBrave()
+	tests.AssertEqual(t, "", c.Headers.Get("pragma"))
+	tests.AssertEqual(t, "", c.Headers.Get("cache-control"))
+	tests.AssertEqual(t, "1", c.Headers.Get("sec-gpc"))
+
+	raw := captureRawRequest(t, func(url string) {
+		c.R().Get(url)
+	})
+	sent := make(map[string]bool)
+	for _, name := range rawHeaderNames(raw) {
+		sent[name] = true
+	}
+	var expected []string
+	for _, name := range rawHeaderNames(capturedBraveRequest) {
+		if sent[name] {
+			expected = append(expected, name)
+		}
+	}
+	var actual []string
+	for _, name := range rawHeaderNames(raw) {
+		if slices.Contains(expected, name) {
+			actual = append(actual, name)
+		}
+	}
+	tests.AssertEqual(t, len(rawHeaderNames(capturedBraveRequest)), len(expected))
+	tests.AssertEqual(t, expected, actual)
+}
+
+func TestImpersonateOpera(t *testing.T) {
+	c := tc().ImpersonateOpera()
+	tests.AssertContains(t, c.Headers.Get("user-agent"), "chrome/120.0.0.0 safari/537.36 opr/106.0.0.0", true)
+	tests.AssertEqual(t, `"Not_A Brand";v="8", "Chromium";v="120", "Opera";v="106"`, c.Headers.Get("sec-ch-ua"))
+
+	hdrs := make(http.Header)
+	hdrs.Set("Accept-Language", "en-US,en;q=0.9")
+	c = tc().ImpersonateCustomOpera(hdrs, nil)
+	tests.AssertEqual(t, "en-US,en;q=0.9", c.Headers.Get("accept-language"))
+	tests.AssertContains(t, c.Headers.Get("user-agent"), "opr/106.0.0.0", true)
+}
+
+func TestImpersonateChromeAndroid(t *testing.T) {
+	hdrs := tc().ImpersonateChromeAndroid().GetCommonHeaders()
+	tests.AssertEqual(t, "?1", hdrs.Get("sec-ch-ua-mobile"))
+	tests.AssertEqual(t, `"Android"`, hdrs.Get("sec-ch-ua-platform"))
+	tests.AssertContains(t, hdrs.Get("user-agent"), "android", true)
+	tests.AssertContains(t, hdrs.Get("user-agent"), "mobile safari", true)
+	tests.AssertContains(t, hdrs.Get("sec-ch-ua"), `"chromium";v="131"`, true)
+
+	p := ChromeAndroidProfile()
+	tests.AssertEqual(t, []http2.Setting{
+		{ID: http2.SettingHeaderTableSize, Val: 65536},
+		{ID: http2.SettingEnablePush, Val: 0},
+		{ID: http2.SettingInitialWindowSize, Val: 6291456},
+		{ID: http2.SettingMaxHeaderListSize, Val: 262144},
+	}, p.HTTP2Settings)
+	tests.AssertEqual(t, uint32(15663105), p.HTTP2ConnectionFlow)
+}
+
+func TestImpersonateChromeWindows(t *testing.T) {
+	c := tc().ImpersonateChromeWindows()
+	hdrs := c.GetCommonHeaders()
+	tests.AssertEqual(t, `"Windows"`, hdrs.Get("sec-ch-ua-platform"))
+	tests.AssertEqual(t, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36", hdrs.Get("user-agent"))
+	tests.AssertEqual(t, 131, c.GetImpersonateChromeVersion())
+	diff := DiffProfiles(ChromeProfile(), ChromeWindowsProfile())
+	tests.AssertEqual(t, 2, len(diff.Differences))
+	tests.AssertEqual(t, "Headers[sec-ch-ua-platform]", diff.Differences[0].Field)
+	tests.AssertEqual(t, "Headers[user-agent]", diff.Differences[1].Field)
+	resp, err := c.R().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "HTTP/2.0", resp.Proto)
+}
+
+func TestImpersonateSwitchProfileHeaders(t *testing.T) {
+	assertNoClientHints := func(t *testing.T, hdrs http.Header) {
+		t.Helper()
+		for name := range hdrs {
+			if strings.HasPrefix(strings.ToLower(name), "sec-ch-") {
+				t.Errorf("unexpected header %s: %s", name, hdrs.Get(name))
+			}
+		}
+	}
+	c := tc().ImpersonateChrome().ImpersonateFirefox()
+	assertNoClientHints(t, c.Headers)
+	tests.AssertEqual(t, "", c.Headers.Get("pragma"))
+	tests.AssertEqual(t, "", c.Headers.Get("cache-control"))
+
+	c = tc().ImpersonateChrome().ImpersonateSafari()
+	assertNoClientHints(t, c.Headers)
+	tests.AssertEqual(t, "", c.Headers.Get("priority"))
+
+	// back to Chrome, the headers of Chrome are sent again.
+	c.ImpersonateChrome()
+	tests.AssertEqual(t, "?0", c.Headers.Get("sec-ch-ua-mobile"))
+
+	// the headers set by the user are kept.
+	c = tc().ImpersonateChrome().SetCommonHeader("X-Token", "abc").ImpersonateFirefox()
+	tests.AssertEqual(t, "abc", c.Headers.Get("X-Token"))
+
+	c = tc().ImpersonateChrome()
+	for _, name := range []string{"firefox", "safari"} {
+		raw := captureRawRequest(t, func(url string) {
+			c.R().Impersonate(name).Get(url)
+		})
+		tests.AssertEqual(t, false, strings.Contains(strings.ToLower(raw), "sec-ch-"))
+		tests.AssertEqual(t, false, strings.Contains(strings.ToLower(raw), "pragma"))
+	}
+}
+
+func TestImpersonateChromeHeadless(t *testing.T) {
+	c := tc().ImpersonateChromeHeadless()
+	hdrs := c.GetCommonHeaders()
+	tests.AssertEqual(t, "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) HeadlessChrome/131.0.0.0 Safari/537.36", hdrs.Get("user-agent"))
+	tests.AssertContains(t, hdrs.Get("sec-ch-ua"), `"headlesschrome";v="131"`, true)
+	tests.AssertEqual(t, false, strings.Contains(hdrs.Get("sec-ch-ua"), "Google Chrome"))
+	tests.AssertEqual(t, `"Linux"`, hdrs.Get("sec-ch-ua-platform"))
+	tests.AssertEqual(t, "en-US,en;q=0.9", hdrs.Get("accept-language"))
+	// the same network stack as the headed Chrome.
+	ja4, err := c.JA4()
+	tests.AssertNoError(t, err)
+	chromeJA4, err := tc().ImpersonateChrome131().JA4()
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, chromeJA4, ja4)
+	tests.AssertEqual(t, true, slices.Contains(ImpersonationProfiles(), "chrome_headless"))
+	resp, err := c.R().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "HTTP/2.0", resp.Proto)
+}
+
+func TestImpersonateCustomSafari(t *testing.T) {
+	custom := make(http.Header)
+	custom.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15")
+	raw := buildRawClientHello(t, utls.HelloIOS_14)
+	c := tc().ImpersonateCustomSafari(custom, raw)
+	tests.AssertContains(t, c.Headers.Get("user-agent"), "version/17.0", true)
+	tests.AssertEqual(t, "zh-CN,zh-Hans;q=0.9", c.Headers.Get("accept-language"))
+	resp, err := c.R().Get("/")
+	assertSuccess(t, resp, err)
+
+	// fall back to the fingerprint of Safari 16 without raw ClientHello.
+	resp, err = tc().ImpersonateCustomSafari(custom, nil).R().Get("/")
+	assertSuccess(t, resp, err)
+}
+
+// profileClientHelloSpec returns the ClientHelloSpec built by the profile.
+func profileClientHelloSpec(t *testing.T, p BrowserProfile) *utls.ClientHelloSpec {
+	if p.clientHelloSpec != nil {
+		spec, err := p.clientHelloSpec()
+		tests.AssertNoError(t, err)
+		return spec
+	}
+	spec, err := utls.UTLSIdToSpec(p.ClientHelloID)
+	tests.AssertNoError(t, err)
+	return &spec
+}
+
+// safariHelloVersion derives the major version of Safari from the spec of
+// its ClientHello, Safari 17 drops the ecdsa_sha1 signature algorithm.
+func safariHelloVersion(spec *utls.ClientHelloSpec) int {
+	for _, ext := range spec.Extensions {
+		if sa, ok := ext.(*utls.SignatureAlgorithmsExtension); ok && slices.Contains(sa.SupportedSignatureAlgorithms, utls.ECDSAWithSHA1) {
+			return 16
+		}
+	}
+	return 17
+}
+
+var safariVersionRegexp = regexp.MustCompile(`Version/(\d+)\.`)
+
+func TestImpersonateSafariVersions(t *testing.T) {
+	// the version of the user-agent agrees with the one of the ClientHello,
+	// Safari 18 sends the ClientHello of Safari 17, so does Safari on iOS 17.
+	for _, p := range []BrowserProfile{SafariProfile(), Safari17Profile(), Safari18Profile(), SafariIOSProfile()} {
+		m := safariVersionRegexp.FindStringSubmatch(p.Headers["user-agent"])
+		tests.AssertEqual(t, 2, len(m))
+		uaVersion, err := strconv.Atoi(m[1])
+		tests.AssertNoError(t, err)
+		helloVersion := safariHelloVersion(profileClientHelloSpec(t, p))
+		tests.AssertEqual(t, min(uaVersion, 17), helloVersion)
+		tests.AssertEqual(t, true, strings.HasPrefix(p.ClientHelloID.Version, strconv.Itoa(helloVersion)+"."))
+	}
+
+	safari16, err := tc().ImpersonateSafari().JA4()
+	tests.AssertNoError(t, err)
+	safari17, err := tc().ImpersonateSafari17().JA4()
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, false, safari16 == safari17)
+	for name, c := range map[string]*Client{
+		"safari17":   tc().ImpersonateSafari17(),
+		"safari18":   tc().ImpersonateSafari18(),
+		"safari_ios": tc().ImpersonateSafariIOS(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ja4, err := c.JA4()
+			tests.AssertNoError(t, err)
+			tests.AssertEqual(t, safari17, ja4)
+			resp, err := c.R().Get("/")
+			assertSuccess(t, resp, err)
+		})
+	}
+	c := tc()
+	tests.AssertNoError(t, c.Impersonate("safari18"))
+	tests.AssertEqual(t, "u=0, i", c.Headers.Get("priority"))
+	tests.AssertEqual(t, uint32(10420225), c.Transport.t2.ConnectionFlow)
+}
+
+func TestImpersonateSafariIOS(t *testing.T) {
+	hdrs := tc().ImpersonateSafariIOS().GetCommonHeaders()
+	tests.AssertContains(t, hdrs.Get("user-agent"), "iphone; cpu iphone os 17_0 like mac os x", true)
+
+	custom := make(http.Header)
+	custom.Set("Accept-Language", "en-US,en;q=0.9")
+	raw := buildRawClientHello(t, utls.HelloIOS_14)
+	c := tc().ImpersonateCustomSafariIOS(custom, raw)
+	tests.AssertEqual(t, "en-US,en;q=0.9", c.Headers.Get("accept-language"))
+	resp, err := c.R().Get("/")
+	assertSuccess(t, resp, err)
+}
+
+func TestImpersonate(t *testing.T) {
+	names := ImpersonationProfiles()
+	tests.AssertEqual(t, true, slices.IsSorted(names))
+	tests.AssertEqual(t, true, slices.Contains(names, "firefox"))
+
+	c := tc()
+	tests.AssertNoError(t, c.Impersonate("Firefox"))
+	tests.AssertContains(t, c.Headers.Get("user-agent"), "firefox", true)
+	tests.AssertNoError(t, c.Impersonate("chrome120"))
+	tests.AssertEqual(t, 120, c.GetImpersonateChromeVersion())
+	tests.AssertErrorContains(t, c.Impersonate("netscape"), "unknown impersonation profile")
+}
+
+func TestRegisterImpersonationProfile(t *testing.T) {
+	profile := BrowserProfile{
+		ClientHelloID: utls.HelloChrome_120,
+		HTTP2Settings: []http2.Setting{
+			{ID: http2.SettingInitialWindowSize, Val: 6291456},
+		},
+		HTTP2ConnectionFlow: 15663105,
+		PseudoHeaderOrder:   []string{":method", ":authority", ":scheme", ":path"},
+		HeaderOrder:         []string{"user-agent", "accept"},
+		Headers: map[string]string{
+			"user-agent": "custom-browser/1.0",
+		},
+	}
+	tests.AssertErrorContains(t, RegisterImpersonationProfile("", profile), "missing impersonate profile name")
+	invalid := profile
+	invalid.HeaderOrder = nil
+	tests.AssertErrorContains(t, RegisterImpersonationProfile("custom", invalid), "missing HeaderOrder")
+	invalid = profile
+	invalid.HTTP2ConnectionFlow = 1 << 31
+	tests.AssertErrorContains(t, RegisterImpersonationProfile("custom", invalid), "invalid http2 connection flow")
+	invalid = FirefoxProfile()
+	invalid.HTTP2PriorityUpdate = "u=0, i"
+	tests.AssertErrorContains(t, RegisterImpersonationProfile("custom", invalid), "both HTTP2PriorityFrames and HTTP2PriorityUpdate")
+
+	tests.AssertNoError(t, RegisterImpersonationProfile("Custom-Test", profile))
+	profile.Headers["user-agent"] = "modified"
+	tests.AssertEqual(t, true, slices.Contains(ImpersonationProfiles(), "custom-test"))
+
+	c := tc()
+	tests.AssertNoError(t, c.Impersonate("custom-test"))
+	tests.AssertEqual(t, "custom-browser/1.0", c.Headers.Get("user-agent"))
+}
+
+func TestSetHTTP2ConnectionFlow(t *testing.T) {
+	c := tc().ImpersonateChrome()
+	tests.AssertEqual(t, uint32(15663105), c.GetHTTP2ConnectionFlow())
+	c.ImpersonateFirefox()
+	tests.AssertEqual(t, uint32(12517377), c.GetHTTP2ConnectionFlow())
+
+	// ignore the flow out of range.
+	c.SetHTTP2ConnectionFlow(1 << 31)
+	tests.AssertEqual(t, uint32(12517377), c.GetHTTP2ConnectionFlow())
+	c.SetHTTP2ConnectionFlow(100)
+	tests.AssertEqual(t, uint32(12517377), c.GetHTTP2ConnectionFlow())
+	c.SetHTTP2ConnectionFlow(1<<31 - 1 - 65535)
+	tests.AssertEqual(t, uint32(1<<31-1-65535), c.GetHTTP2ConnectionFlow())
+
+	// reset to the default flow.
+	c.SetHTTP2ConnectionFlow(0)
+	tests.AssertEqual(t, uint32(0), c.GetHTTP2ConnectionFlow())
+}
+
+func TestSetHTTP2SettingsJitter(t *testing.T) {
+	c := tc().ImpersonateChrome().SetHTTP2SettingsJitterSeed(42)
+	settings := c.t2.Settings
+	jittered := c.t2.JitterSettings(settings)
+	tests.AssertEqual(t, jittered, c.t2.JitterSettings(settings))
+	tests.AssertEqual(t, jittered, tc().ImpersonateChrome().SetHTTP2SettingsJitterSeed(42).t2.JitterSettings(settings))
+	tests.AssertEqual(t, len(settings), len(jittered))
+	for i, s := range jittered {
+		tests.AssertEqual(t, settings[i].ID, s.ID)
+		tests.AssertNoError(t, xhttp2.Setting{ID: xhttp2.SettingID(s.ID), Val: s.Val}.Valid())
+		if s.ID == http2.SettingEnablePush {
+			tests.AssertEqual(t, settings[i].Val, s.Val)
+		}
+	}
+	tests.AssertEqual(t, uint32(65536), ChromeProfile().HTTP2Settings[0].Val)
+
+	// keep the seed when re-enabled.
+	c.SetHTTP2SettingsJitter(false)
+	tests.AssertIsNil(t, c.t2.JitterSettings)
+	c.SetHTTP2SettingsJitter(true)
+	tests.AssertEqual(t, jittered, c.t2.JitterSettings(settings))
+	tests.AssertEqual(t, jittered, c.Clone().t2.JitterSettings(settings))
+
+	resp, err := tc().EnableForceHTTP2().SetHTTP2SettingsJitter(true).R().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "HTTP/2.0", resp.Proto)
+}
+
+func TestGetHTTP2Settings(t *testing.T) {
+	c := tc()
+	tests.AssertIsNil(t, c.GetHTTP2Settings())
+	tests.AssertEqual(t, http2.PriorityParam{}, c.GetHTTP2HeaderPriority())
+
+	c.ImpersonateChrome()
+	tests.AssertEqual(t, ChromeProfile().HTTP2Settings, c.GetHTTP2Settings())
+	tests.AssertEqual(t, http2.PriorityParam{StreamDep: 0, Exclusive: true, Weight: 255}, c.GetHTTP2HeaderPriority())
+	tests.AssertEqual(t, uint32(15663105), c.GetHTTP2ConnectionFlow())
+
+	// modifying the returned settings does not affect the client.
+	c.GetHTTP2Settings()[0].Val = 1
+	tests.AssertEqual(t, uint32(65536), c.GetHTTP2Settings()[0].Val)
+}
+
+func TestSetHTTP2PriorityFrames(t *testing.T) {
+	c := tc().ImpersonateFirefox()
+	tests.AssertEqual(t, 6, len(c.GetHTTP2PriorityFrames()))
+	tests.AssertEqual(t, uint32(3), c.GetHTTP2PriorityFrames()[0].StreamID)
+	c.SetHTTP2PriorityFrames()
+	tests.AssertIsNil(t, c.GetHTTP2PriorityFrames())
+
+	c.ImpersonateFirefox133()
+	tests.AssertIsNil(t, c.GetHTTP2PriorityFrames())
+	tests.AssertEqual(t, "u=0, i", c.Headers.Get("priority"))
+	tests.AssertEqual(t, http2.PriorityParam{Weight: 41}, c.GetHTTP2HeaderPriority())
+	tests.AssertEqual(t, true, slices.Contains(ImpersonationProfiles(), "firefox133"))
+}
+
+func TestSetPriorityHeader(t *testing.T) {
+	c := tc().SetPriorityHeader(0, true)
+	tests.AssertEqual(t, "u=0, i", c.Headers.Get("priority"))
+	c.SetPriorityHeader(3, false)
+	tests.AssertEqual(t, "u=3", c.Headers.Get("priority"))
+	c.SetPriorityHeader(8, false)
+	tests.AssertEqual(t, "u=3", c.Headers.Get("priority"))
+
+	c.ImpersonateChrome()
+	tests.AssertEqual(t, "u=0, i", c.Headers.Get("priority"))
+	c.ImpersonateChrome120()
+	tests.AssertEqual(t, "", c.Headers.Get("priority"))
+	c.ImpersonateEdge()
+	tests.AssertEqual(t, "u=0, i", c.Headers.Get("priority"))
+	c.ImpersonateFirefox()
+	tests.AssertEqual(t, "", c.Headers.Get("priority"))
+
+	raw := captureRawRequest(t, func(url string) {
+		C().ImpersonateChrome().R().Get(url)
+	})
+	names := rawHeaderNames(raw)
+	tests.AssertEqual(t, "priority", names[len(names)-1])
+}
+
+func TestSetHTTP2PriorityUpdate(t *testing.T) {
+	c := tc().SetHTTP2PriorityUpdate(0, true)
+	tests.AssertEqual(t, "u=0, i", c.t2.PriorityUpdate)
+	c.SetHTTP2PriorityUpdate(-1, false)
+	tests.AssertEqual(t, "u=0, i", c.t2.PriorityUpdate)
+	tests.AssertEqual(t, "u=0, i", c.Clone().t2.PriorityUpdate)
+
+	// the server ignores the PRIORITY_UPDATE frame it does not support.
+	resp, err := c.EnableForceHTTP2().R().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "HTTP/2.0", resp.Proto)
+
+	c.DisableHTTP2PriorityUpdate()
+	tests.AssertEqual(t, "", c.t2.PriorityUpdate)
+
+	profile := Firefox133Profile()
+	profile.HTTP2PriorityUpdate = "u=0, i"
+	c.ApplyProfile(profile)
+	tests.AssertEqual(t, "u=0, i", c.t2.PriorityUpdate)
+	c.ImpersonateFirefox()
+	tests.AssertEqual(t, "", c.t2.PriorityUpdate)
+}
+
+func TestSetHTTP2SettingsOrder(t *testing.T) {
+	c := tc().ImpersonateChrome()
+	c.SetHTTP2SettingsOrder(
+		http2.SettingMaxHeaderListSize,
+		http2.SettingHeaderTableSize,
+		http2.SettingInitialWindowSize,
+		http2.SettingEnablePush,
+	)
+	tests.AssertEqual(t, []http2.Setting{
+		{ID: http2.SettingMaxHeaderListSize, Val: 262144},
+		{ID: http2.SettingHeaderTableSize, Val: 65536},
+		{ID: http2.SettingInitialWindowSize, Val: 6291456},
+		{ID: http2.SettingEnablePush, Val: 0},
+	}, c.t2.Settings)
+	tests.AssertEqual(t, http2.SettingHeaderTableSize, ChromeProfile().HTTP2Settings[0].ID)
+
+	// ignore the invalid order.
+	settings := slices.Clone(c.t2.Settings)
+	c.SetHTTP2SettingsOrder(http2.SettingHeaderTableSize)
+	tests.AssertEqual(t, settings, c.t2.Settings)
+	c.SetHTTP2SettingsOrder(
+		http2.SettingMaxConcurrentStreams,
+		http2.SettingHeaderTableSize,
+		http2.SettingInitialWindowSize,
+		http2.SettingEnablePush,
+	)
+	tests.AssertEqual(t, settings, c.t2.Settings)
+	c.SetHTTP2SettingsOrder(
+		http2.SettingHeaderTableSize,
+		http2.SettingHeaderTableSize,
+		http2.SettingInitialWindowSize,
+		http2.SettingEnablePush,
+	)
+	tests.AssertEqual(t, settings, c.t2.Settings)
+}
+
+func TestDiffProfiles(t *testing.T) {
+	tests.AssertEqual(t, true, DiffProfiles(ChromeProfile(), ChromeProfile()).Equal())
+	tests.AssertEqual(t, "", DiffProfiles(ChromeProfile(), ChromeProfile()).String())
+
+	a := ChromeVersionProfile(120)
+	b := ChromeVersionProfile(120)
+	b.Headers["user-agent"] = "custom"
+	b.Headers["x-custom"] = "1"
+	b.HeaderOrder = b.HeaderOrder[1:]
+	b.HTTP2ConnectionFlow++
+	diff := DiffProfiles(a, b)
+	fields := make([]string, len(diff.Differences))
+	for i, d := range diff.Differences {
+		fields[i] = d.Field
+	}
+	tests.AssertEqual(t, []string{"HTTP2ConnectionFlow", "HeaderOrder", "Headers[user-agent]", "Headers[x-custom]"}, fields)
+	tests.AssertEqual(t, "<none>", diff.Differences[3].A)
+	tests.AssertEqual(t, `"1"`, diff.Differences[3].B)
+	tests.AssertContains(t, diff.String(), "headers[x-custom]: <none> != \"1\"\n", true)
+	// stable output.
+	tests.AssertEqual(t, diff.String(), DiffProfiles(a, b).String())
+
+	diff = DiffProfiles(FirefoxProfile(), Firefox133Profile())
+	s := diff.String()
+	tests.AssertContains(t, s, "http2priorityframes: 3:0:0:201,", true)
+	tests.AssertContains(t, s, "http2settings: 1:65536;4:131072;5:16384 != 1:65536;2:0;4:131072;5:16384\n", true)
+	tests.AssertContains(t, s, `headers[priority]: <none> != "u=0, i"`, true)
+
+	diff = DiffProfiles(ChromeVersionProfile(100), FirefoxProfile())
+	tests.AssertEqual(t, "ClientHelloID", diff.Differences[0].Field)
+	tests.AssertEqual(t, "TLS.JA4", diff.Differences[1].Field)
+	tests.AssertEqual(t, "TLS.CipherSuites", diff.Differences[2].Field)
+}
+
+func TestApplyProfile(t *testing.T) {
+	profile := ChromeProfile()
+	profile.Headers["accept-language"] = "en-US"
+	profile.HTTP2Settings[0].Val = 1
+	tests.AssertEqual(t, "zh-CN,zh;q=0.9", ChromeProfile().Headers["accept-language"])
+	tests.AssertEqual(t, uint32(65536), ChromeProfile().HTTP2Settings[0].Val)
+
+	c := tc().ApplyProfile(profile)
+	tests.AssertEqual(t, "en-US", c.Headers.Get("accept-language"))
+	tests.AssertEqual(t, ChromeProfile().Headers["user-agent"], c.Headers.Get("user-agent"))
+	profile.Headers["accept-language"] = "fr-FR"
+	tests.AssertEqual(t, "en-US", c.Headers.Get("accept-language"))
+}
+
+func TestSetHTTP3Settings(t *testing.T) {
+	c := tc().EnableHTTP3().ImpersonateChrome()
+	tests.AssertEqual(t, true, c.t3.EnableDatagrams)
+	tests.AssertEqual(t, false, c.t3.EnableExtendedConnect)
+	tests.AssertEqual(t, http3.Setting{ID: http3.SettingMaxFieldSectionSize, Val: 262144}, c.t3.AdditionalSettings[0])
+
+	// settings are applied once http3 is enabled.
+	c = tc().ImpersonateFirefox().EnableHTTP3()
+	tests.AssertEqual(t, true, c.t3.EnableDatagrams)
+	tests.AssertEqual(t, true, c.t3.EnableExtendedConnect)
+	tests.AssertEqual(t, http3.Setting{ID: http3.SettingQpackBlockedStreams, Val: 20}, c.t3.AdditionalSettings[0])
+	tests.AssertEqual(t, true, c.Clone().t3.EnableExtendedConnect)
+
+	// reset to the default settings.
+	c.SetHTTP3Settings(nil)
+	tests.AssertEqual(t, false, c.t3.EnableDatagrams)
+	tests.AssertEqual(t, false, c.t3.EnableExtendedConnect)
+	tests.AssertEqual(t, 0, len(c.t3.AdditionalSettings))
+}
+
+func TestSetHTTP3SettingsFrame(t *testing.T) {
+	settings := []http3.Setting{
+		{ID: http3.SettingQpackMaxTableCapacity, Val: 65536},
+		{ID: http3.SettingH3Datagram, Val: 1},
+		{ID: 0x1f*3 + 0x21, Val: 0},
+	}
+	c := tc().EnableHTTP3().SetHTTP3SettingsFrame(settings...)
+	tests.AssertEqual(t, true, c.t3.EnableDatagrams)
+	tests.AssertEqual(t, false, c.t3.EnableExtendedConnect)
+	tests.AssertEqual(t, settings, c.t3.AdditionalSettings)
+
+	// invalid settings are ignored.
+	c.SetHTTP3SettingsFrame(http3.Setting{ID: http3.SettingEnableConnectProtocol, Val: 2})
+	tests.AssertEqual(t, false, c.t3.EnableExtendedConnect)
+	c.SetHTTP3SettingsFrame(http3.Setting{ID: 0x4, Val: 65535})
+	tests.AssertEqual(t, settings, c.t3.AdditionalSettings)
+	c.SetHTTP3SettingsFrame(http3.Setting{ID: 0x1, Val: 0}, http3.Setting{ID: 0x1, Val: 1})
+	tests.AssertEqual(t, settings, c.t3.AdditionalSettings)
+}
+
+func TestSetHTTP3GREASE(t *testing.T) {
+	c := tc().EnableHTTP3().SetHTTP3GREASE(true)
+	tests.AssertEqual(t, true, c.t3.EnableGREASE)
+	c.ImpersonateFirefox()
+	tests.AssertEqual(t, false, c.t3.EnableGREASE)
+	c.ImpersonateChrome()
+	tests.AssertEqual(t, true, c.t3.EnableGREASE)
+	c.SetHTTP3GREASE(false)
+	tests.AssertEqual(t, false, c.t3.EnableGREASE)
+	tests.AssertEqual(t, true, c.t3.EnableDatagrams)
+}
+
+func TestSetHTTP3QPACKSettings(t *testing.T) {
+	var buf bytes.Buffer
+	c := tc().SetLogger(NewLogger(&buf, "", 0)).EnableHTTP3().ImpersonateChrome().SetHTTP3QPACKBlockedStreams(16)
+	tests.AssertEqual(t, []http3.Setting{
+		{ID: http3.SettingMaxFieldSectionSize, Val: 262144},
+		{ID: http3.SettingQpackBlockedStreams, Val: 16},
+		{ID: http3.SettingH3Datagram, Val: 1},
+	}, c.t3.AdditionalSettings)
+	tests.AssertEqual(t, true, c.t3.EnableGREASE)
+	// the settings of the profile are not modified.
+	tests.AssertEqual(t, uint64(100), chromeHttp3Settings.Other[1].Val)
+	tests.AssertEqual(t, "", buf.String())
+
+	c.SetHTTP3QPACKMaxTableCapacity(65536)
+	tests.AssertEqual(t, http3.Setting{ID: http3.SettingQpackMaxTableCapacity, Val: 65536}, c.t3.AdditionalSettings[3])
+	tests.AssertContains(t, buf.String(), "qpack dynamic table is not supported", true)
+	c.SetHTTP3QPACKMaxTableCapacity(0)
+	tests.AssertEqual(t, 4, len(c.t3.AdditionalSettings))
+	tests.AssertEqual(t, uint64(0), c.t3.AdditionalSettings[3].Val)
+
+	c = tc().SetHTTP3QPACKBlockedStreams(20).EnableHTTP3()
+	tests.AssertEqual(t, []http3.Setting{{ID: http3.SettingQpackBlockedStreams, Val: 20}}, c.t3.AdditionalSettings)
+}
+
+func TestSetMaxHTTP3FrameSize(t *testing.T) {
+	c := tc().SetMaxHTTP3FrameSize(1 << 20).EnableHTTP3()
+	tests.AssertEqual(t, uint64(1<<20), c.t3.MaxFrameSize)
+	c.SetMaxHTTP3FrameSize(1 << 10)
+	tests.AssertEqual(t, uint64(1<<10), c.t3.MaxFrameSize)
+	tests.AssertEqual(t, uint64(1<<10), c.Clone().t3.MaxFrameSize)
+}
+
+func TestSetHTTP3UnknownFrameHandler(t *testing.T) {
+	var called bool
+	fn := func(frameType http3.FrameType, payload io.Reader) (bool, error) {
+		called = true
+		return false, nil
+	}
+	c := tc().SetHTTP3UnknownFrameHandler(fn).EnableHTTP3()
+	tests.AssertNotNil(t, c.t3.UnknownFrameHandler)
+	c.Clone().t3.UnknownFrameHandler(0x21, nil)
+	tests.AssertEqual(t, true, called)
+	c.SetHTTP3UnknownFrameHandler(nil)
+	tests.AssertIsNil(t, c.t3.UnknownFrameHandler)
+}
+
+func TestSetImpersonatePlatform(t *testing.T) {
+	c := tc().ImpersonateChrome().SetImpersonatePlatform("windows")
+	tests.AssertEqual(t, `"Windows"`, c.Headers.Get("sec-ch-ua-platform"))
+	tests.AssertEqual(t, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36", c.Headers.Get("user-agent"))
+
+	// keep the platform for browsers impersonated later.
+	c = tc().SetImpersonatePlatform("Windows").ImpersonateFirefox()
+	tests.AssertEqual(t, "", c.Headers.Get("sec-ch-ua-platform"))
+	tests.AssertEqual(t, "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:120.0) Gecko/20100101 Firefox/120.0", c.Headers.Get("user-agent"))
+	c.SetImpersonatePlatform("Linux")
+	tests.AssertEqual(t, "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0", c.Headers.Get("user-agent"))
+
+	// ignore unsupported platform.
+	c.SetImpersonatePlatform("BeOS")
+	tests.AssertEqual(t, "Mozilla/5.0 (X11; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0", c.Headers.Get("user-agent"))
+
+	c.SetImpersonatePlatform("").ImpersonateEdge()
+	tests.AssertEqual(t, `"macOS"`, c.Headers.Get("sec-ch-ua-platform"))
+}
+
+func TestSetImpersonateAcceptLanguage(t *testing.T) {
+	c := tc().ImpersonateChrome().SetImpersonateAcceptLanguage("en-US", "en-GB", "fr")
+	tests.AssertEqual(t, "en-US,en-GB;q=0.9,en;q=0.8,fr;q=0.7", c.Headers.Get("accept-language"))
+
+	// keep the languages for browsers impersonated later.
+	c.ImpersonateFirefox()
+	tests.AssertEqual(t, "en-US,en-GB;q=0.7,fr;q=0.3", c.Headers.Get("accept-language"))
+	c.SetImpersonateAcceptLanguage("zh-CN", "zh", "zh-TW", "zh-HK", "en-US", "en")
+	tests.AssertEqual(t, "zh-CN,zh;q=0.8,zh-TW;q=0.7,zh-HK;q=0.5,en-US;q=0.3,en;q=0.2", c.Headers.Get("accept-language"))
+	c.ImpersonateSafari()
+	tests.AssertEqual(t, "zh-CN,zh;q=0.9,zh-TW;q=0.8,zh-HK;q=0.7,en-US;q=0.6,en;q=0.5", c.Headers.Get("accept-language"))
+
+	// ignore invalid language tag.
+	c.SetImpersonateAcceptLanguage("en-US", "fr;q=0.5")
+	tests.AssertEqual(t, "zh-CN,zh;q=0.9,zh-TW;q=0.8,zh-HK;q=0.7,en-US;q=0.6,en;q=0.5", c.Headers.Get("accept-language"))
+
+	c.SetImpersonateAcceptLanguage().ImpersonateChrome()
+	tests.AssertEqual(t, "zh-CN,zh;q=0.9", c.Headers.Get("accept-language"))
+
+	c.SetImpersonateAcceptLanguageRotation(
+		AcceptLanguageChoice{Languages: []string{"de-DE"}, Weight: 0},
+		AcceptLanguageChoice{Languages: []string{"fr-FR", "fr"}, Weight: 1},
+	)
+	tests.AssertEqual(t, "fr-FR,fr;q=0.9", c.Headers.Get("accept-language"))
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		c.SetImpersonateAcceptLanguageRotation(
+			AcceptLanguageChoice{Languages: []string{"en-US"}, Weight: 1},
+			AcceptLanguageChoice{Languages: []string{"de"}, Weight: 1},
+		)
+		seen[c.Headers.Get("accept-language")] = true
+	}
+	tests.AssertEqual(t, map[string]bool{"en-US,en;q=0.9": true, "de": true}, seen)
+}
+
+// captureClientHello returns the raw ClientHello record sent by the client to
+// a server which closes the connection right after receiving it.
+func captureClientHello(t *testing.T, c *Client) []byte {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	defer ln.Close()
+	hello := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			hello <- nil
+			return
+		}
+		defer conn.Close()
+		hdr := make([]byte, 5)
+		if _, err := io.ReadFull(conn, hdr); err != nil {
+			hello <- nil
+			return
+		}
+		body := make([]byte, int(hdr[3])<<8|int(hdr[4]))
+		io.ReadFull(conn, body)
+		hello <- append(hdr, body...)
+	}()
+	c.R().Get("https://" + ln.Addr().String())
+	return <-hello
+}
+
+func TestSetImpersonateSeed(t *testing.T) {
+	newClient := func(seed int64) *Client {
+		return tc().ImpersonateChrome().SetImpersonateSeed(seed)
+	}
+	c1, c2 := newClient(7), newClient(7)
+	tests.AssertEqual(t, c1.GetImpersonateChromeVersion(), c2.GetImpersonateChromeVersion())
+	// the extensions of the Chrome version picked by the seed are shuffled.
+	tests.AssertEqual(t, true, shufflesTLSExtensions(c1.tlsFingerprintID))
+	tests.AssertEqual(t, c1.Headers, c2.Headers)
+	// the ClientHello is the same except the key shares.
+	fingerprint := func(c *Client) string {
+		raw := captureClientHello(t, c)
+		spec, err := ParseClientHello(raw)
+		tests.AssertNoError(t, err)
+		var types []uint16
+		for _, ext := range spec.Extensions {
+			types = append(types, tlsExtensionType(ext))
+		}
+		// the client random and the session id.
+		return fmt.Sprintf("%x %v", raw[11:76], types)
+	}
+	fp := fingerprint(c1)
+	tests.AssertEqual(t, fp, fingerprint(c2))
+	// the next connection is different but still reproducible.
+	fp2 := fingerprint(c1)
+	tests.AssertEqual(t, false, fp == fp2)
+	tests.AssertEqual(t, fp2, fingerprint(c2))
+
+	identities := make(map[string]bool)
+	for seed := int64(0); seed < 20; seed++ {
+		c := newClient(seed)
+		identities[c.Headers.Get("user-agent")+c.Headers.Get("accept-language")] = true
+	}
+	tests.AssertEqual(t, true, len(identities) > 1)
+
+	// the platform of safari is not changed.
+	c := tc().ImpersonateSafari().SetImpersonateSeed(42)
+	tests.AssertEqual(t, SafariProfile().Headers["user-agent"], c.Headers.Get("user-agent"))
+	tests.AssertEqual(t, 0, c.GetImpersonateChromeVersion())
+}
+
+func TestSeededShuffleSpec(t *testing.T) {
+	types := func(seed int64) []uint16 {
+		spec, err := seededShuffleSpec(utls.HelloChrome_131, seed)
+		tests.AssertNoError(t, err)
+		var types []uint16
+		for _, ext := range spec.Extensions {
+			types = append(types, tlsExtensionType(ext))
+		}
+		return types
+	}
+	tests.AssertEqual(t, types(1), types(1))
+	tests.AssertEqual(t, true, shufflesTLSExtensions(utls.HelloChrome_131))
+	tests.AssertEqual(t, true, shufflesTLSExtensions(utls.HelloChrome_114_Padding_PSK_Shuf))
+	tests.AssertEqual(t, false, shufflesTLSExtensions(utls.HelloChrome_102))
+	tests.AssertEqual(t, false, shufflesTLSExtensions(utls.HelloFirefox_120))
+}
+
+func TestSetCommonHeaderOrderFunc(t *testing.T) {
+	c := C().
+		SetCommonHeaders(map[string]string{"a": "1", "b": "2"}).
+		SetCommonPseudoHeaderOder(":path", ":method", ":scheme", ":authority").
+		SetCommonHeaderOrderFunc(func(r *Request) []string {
+			if r.Method == http.MethodPost {
+				return []string{"b", "a", "user-agent"}
+			}
+			return []string{"a", "b", "user-agent"}
+		})
+	names := func(raw string) []string {
+		return slices.DeleteFunc(rawHeaderNames(raw), func(name string) bool {
+			return name != "a" && name != "b" && name != "user-agent"
+		})
+	}
+	raw := captureRawRequest(t, func(url string) {
+		c.R().Get(url)
+	})
+	tests.AssertEqual(t, []string{"a", "b", "user-agent"}, names(raw))
+	raw = captureRawRequest(t, func(url string) {
+		c.R().Post(url)
+	})
+	tests.AssertEqual(t, []string{"b", "a", "user-agent"}, names(raw))
+	// the order of request takes precedence.
+	raw = captureRawRequest(t, func(url string) {
+		c.R().SetHeaderOrder("user-agent", "b", "a").Get(url)
+	})
+	tests.AssertEqual(t, []string{"user-agent", "b", "a"}, names(raw))
+	// the pseudo header order is independent.
+	tests.AssertEqual(t, []string{":path", ":method", ":scheme", ":authority"}, c.Transport.pseudoHeaderOrder)
 }
 
-func TestSetCommonFormDataFromValues(t *testing.T) {
-	expectedForm := make(url.Values)
-	gotForm := make(url.Values)
-	expectedForm.Set("test", "test")
-	resp, err := tc().
-		SetCommonFormDataFromValues(expectedForm).
-		R().SetSuccessResult(&gotForm).
-		Post("/form")
-	assertSuccess(t, resp, err)
-	tests.AssertEqual(t, "test", gotForm.Get("test"))
+func TestHeaderOrderPrecedence(t *testing.T) {
+	c := C().
+		SetCommonHeaders(map[string]string{"a": "1", "b": "2"}).
+		SetCommonHeaderOrder("a", "b", "user-agent").
+		SetCommonPseudoHeaderOder(":path", ":method", ":scheme", ":authority")
+	names := func(raw string) []string {
+		return slices.DeleteFunc(rawHeaderNames(raw), func(name string) bool {
+			return name != "a" && name != "b" && name != "user-agent"
+		})
+	}
+	raw := captureRawRequest(t, func(url string) {
+		c.R().Get(url)
+	})
+	tests.AssertEqual(t, []string{"a", "b", "user-agent"}, names(raw))
+	// the order set by the request overrides the order of the client.
+	raw = captureRawRequest(t, func(url string) {
+		c.R().SetHeaderOrder("user-agent", "b", "a").Get(url)
+	})
+	tests.AssertEqual(t, []string{"user-agent", "b", "a"}, names(raw))
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	c.EnableInsecureSkipVerify()
+	pseudoNames := func(r *Request) []string {
+		var buf bytes.Buffer
+		resp, err := r.EnableDumpTo(&buf).EnableDumpWithoutResponse().Get(srv.URL)
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, 2, resp.ProtoMajor)
+		var names []string
+		for _, line := range strings.Split(buf.String(), "\r\n") {
+			if strings.HasPrefix(line, ":") {
+				names = append(names, line[:strings.Index(line[1:], ":")+1])
+			}
+		}
+		return names
+	}
+	tests.AssertEqual(t, []string{":path", ":method", ":scheme", ":authority"}, pseudoNames(c.R()))
+	tests.AssertEqual(t, []string{":method", ":authority", ":scheme", ":path"}, pseudoNames(c.R().SetPseudoHeaderOrder(":method", ":authority", ":scheme", ":path")))
 }
 
-func TestSetCommonFormData(t *testing.T) {
-	form := make(url.Values)
-	resp, err := tc().
-		SetCommonFormData(
-			map[string]string{
-				"test": "test",
-			}).R().
-		SetSuccessResult(&form).
-		Post("/form")
-	assertSuccess(t, resp, err)
-	tests.AssertEqual(t, "test", form.Get("test"))
+func TestSetHeaderOrderForOrigin(t *testing.T) {
+	c := C().
+		SetCommonHeaders(map[string]string{"a": "1", "b": "2"}).
+		SetCommonHeaderOrder("a", "b", "user-agent")
+	names := func(raw string) []string {
+		return slices.DeleteFunc(rawHeaderNames(raw), func(name string) bool {
+			return name != "a" && name != "b" && name != "user-agent"
+		})
+	}
+	raw := captureRawRequest(t, func(url string) {
+		c.SetHeaderOrderForOrigin(strings.ToUpper(url), []string{"User-Agent", "b", "a"})
+		c.R().Get(url + "/path")
+	})
+	tests.AssertEqual(t, []string{"user-agent", "b", "a"}, names(raw))
+	// the other origins fall back to the common order.
+	raw = captureRawRequest(t, func(url string) {
+		c.R().Get(url)
+	})
+	tests.AssertEqual(t, []string{"a", "b", "user-agent"}, names(raw))
+	// the order of request takes precedence.
+	raw = captureRawRequest(t, func(url string) {
+		c.SetHeaderOrderForOrigin(url, []string{"b", "a", "user-agent"})
+		c.R().SetHeaderOrder("user-agent", "a", "b").Get(url)
+	})
+	tests.AssertEqual(t, []string{"user-agent", "a", "b"}, names(raw))
+	raw = captureRawRequest(t, func(url string) {
+		c.SetHeaderOrderForOrigin(url, []string{"b", "a", "user-agent"})
+		c.SetHeaderOrderForOrigin(url, nil)
+		c.R().Get(url)
+	})
+	tests.AssertEqual(t, []string{"a", "b", "user-agent"}, names(raw))
+
+	c.SetHeaderOrderForOrigin("https://example.com:443", []string{"b", "a"})
+	order, ok := c.originHeaderOrders.Load("https://example.com")
+	tests.AssertEqual(t, true, ok)
+	tests.AssertEqual(t, []string{"b", "a"}, order)
+	order, ok = c.Clone().originHeaderOrders.Load("https://example.com")
+	tests.AssertEqual(t, true, ok)
+	tests.AssertEqual(t, []string{"b", "a"}, order)
+
+	var buf bytes.Buffer
+	c.SetLogger(NewLogger(&buf, "", 0)).SetHeaderOrderForOrigin("example.com", []string{"a"})
+	tests.AssertContains(t, buf.String(), `invalid origin "example.com"`, true)
 }
 
-func TestSetMultipartBoundaryFunc(t *testing.T) {
-	delimiter := "test-delimiter"
-	expectedContentType := fmt.Sprintf("multipart/form-data; boundary=%s", delimiter)
-	resp, err := tc().
-		SetMultipartBoundaryFunc(func() string {
-			return delimiter
-		}).R().
-		EnableForceMultipart().
-		SetFormData(
-			map[string]string{
-				"test": "test",
-			}).
-		Post("/content-type")
-	assertSuccess(t, resp, err)
-	tests.AssertEqual(t, expectedContentType, resp.String())
+func TestSetCommonPseudoHeaderOrder(t *testing.T) {
+	c := C()
+	for _, p := range []BrowserProfile{ChromeProfile(), FirefoxProfile(), SafariProfile(), OperaProfile()} {
+		tests.AssertNoError(t, c.SetCommonPseudoHeaderOrderStrict(p.PseudoHeaderOrder...))
+		tests.AssertEqual(t, p.PseudoHeaderOrder, c.Transport.pseudoHeaderOrder)
+	}
+	tests.AssertNoError(t, c.SetCommonPseudoHeaderOrderStrict(":Path", ":SCHEME", ":authority", ":method"))
+	tests.AssertEqual(t, []string{":path", ":scheme", ":authority", ":method"}, c.Transport.pseudoHeaderOrder)
+
+	tests.AssertErrorContains(t, c.SetCommonPseudoHeaderOrderStrict(":method", ":athority", ":scheme", ":path"), `unknown pseudo header ":athority"`)
+	tests.AssertErrorContains(t, c.SetCommonPseudoHeaderOrderStrict(":method", ":path", ":scheme"), `missing pseudo header ":authority"`)
+	tests.AssertErrorContains(t, c.SetCommonPseudoHeaderOrderStrict(":method", ":path", ":PATH", ":scheme", ":authority"), "duplicated pseudo headers [:path]")
+	tests.AssertEqual(t, []string{":path", ":scheme", ":authority", ":method"}, c.Transport.pseudoHeaderOrder)
+
+	var buf bytes.Buffer
+	c.SetLogger(NewLogger(&buf, "", 0)).SetCommonPseudoHeaderOder(":method", ":path")
+	tests.AssertContains(t, buf.String(), `missing pseudo header ":scheme"`, true)
+	tests.AssertEqual(t, []string{":path", ":scheme", ":authority", ":method"}, c.Transport.pseudoHeaderOrder)
+	c.SetCommonPseudoHeaderOder()
+	tests.AssertEqual(t, 0, len(c.Transport.pseudoHeaderOrder))
+
+	p := ChromeProfile()
+	p.PseudoHeaderOrder = []string{":method", ":authority", ":scheme"}
+	tests.AssertErrorContains(t, RegisterImpersonationProfile("broken", p), `missing pseudo header ":path"`)
 }
 
-func TestFirefoxMultipartBoundaryFunc(t *testing.T) {
-	r := regexp.MustCompile(`^-------------------------\d{1,10}\d{1,10}\d{1,10}$`)
-	b := firefoxMultipartBoundaryFunc()
-	tests.AssertEqual(t, true, r.MatchString(b))
+func TestSetCommonHeaderOrderNormalize(t *testing.T) {
+	var buf bytes.Buffer
+	c := C().SetLogger(NewLogger(&buf, "", 0)).
+		SetCommonHeader("a", "1").
+		SetCommonHeaderOrder("User-Agent", "A", "user-agent")
+	tests.AssertContains(t, buf.String(), "ignore duplicated headers [user-agent]", true)
+	raw := captureRawRequest(t, func(url string) {
+		c.R().Get(url)
+	})
+	names := slices.DeleteFunc(rawHeaderNames(raw), func(name string) bool {
+		return name != "a" && name != "user-agent"
+	})
+	tests.AssertEqual(t, []string{"user-agent", "a"}, names)
+
+	tests.AssertErrorContains(t, c.SetCommonHeaderOrderStrict("a", "A"), "duplicated headers [a]")
+	tests.AssertErrorContains(t, c.SetCommonHeaderOrderStrict("a", "bad header"), `invalid header name "bad header"`)
+	tests.AssertNoError(t, c.SetCommonHeaderOrderStrict("A", "User-Agent"))
+	raw = captureRawRequest(t, func(url string) {
+		c.R().Get(url)
+	})
+	names = slices.DeleteFunc(rawHeaderNames(raw), func(name string) bool {
+		return name != "a" && name != "user-agent"
+	})
+	tests.AssertEqual(t, []string{"a", "user-agent"}, names)
 }
 
-func TestWebkitMultipartBoundaryFunc(t *testing.T) {
-	r := regexp.MustCompile(`^----WebKitFormBoundary[0-9a-zA-Z]{16}$`)
-	b := webkitMultipartBoundaryFunc()
-	tests.AssertEqual(t, true, r.MatchString(b))
+func TestCookieHeaderOrder(t *testing.T) {
+	setJarCookies := func(c *Client, u string) {
+		uu, err := url.Parse(u)
+		tests.AssertNoError(t, err)
+		c.httpClient.Jar.SetCookies(uu, []*http.Cookie{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}})
+	}
+	c := C().ImpersonateChrome()
+	raw := captureRawRequest(t, func(url string) {
+		setJarCookies(c, url)
+		c.R().Get(url)
+	})
+	names := slices.DeleteFunc(rawHeaderNames(raw), func(name string) bool {
+		return name != "accept-language" && name != "cookie" && name != "priority"
+	})
+	tests.AssertEqual(t, []string{"accept-language", "cookie", "priority"}, names)
+	tests.AssertContains(t, raw, "cookie: a=1; b=2\r\n", true)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	dump := func(c *Client) string {
+		var buf bytes.Buffer
+		setJarCookies(c, srv.URL)
+		resp, err := c.EnableInsecureSkipVerify().EnableDumpAllTo(&buf).R().Get(srv.URL)
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, 2, resp.ProtoMajor)
+		return buf.String()
+	}
+	tests.AssertContains(t, dump(C().ImpersonateChrome()), "cookie: a=1; b=2\r\n", true)
+	s := dump(C().ImpersonateFirefox())
+	tests.AssertContains(t, s, "cookie: a=1\r\ncookie: b=2\r\n", true)
+	s = dump(C().ImpersonateChrome().SetHTTP2SplitCookie(true))
+	tests.AssertContains(t, s, "cookie: a=1\r\ncookie: b=2\r\n", true)
+}
+
+func TestAutoHeaderOrder(t *testing.T) {
+	post := func(c *Client) func(url string) {
+		return func(url string) {
+			c.R().SetHeader("Origin", "https://example.com").
+				SetContentType("application/json").
+				SetBody(`{"a":1}`).
+				Post(url)
+		}
+	}
+	onlyAuto := func(names []string) []string {
+		return slices.DeleteFunc(names, func(name string) bool {
+			return !slices.Contains([]string{"host", "connection", "content-length", "origin", "content-type", "user-agent"}, name)
+		})
+	}
+	c := C().ImpersonateChrome().DisableKeepAlives()
+	names := onlyAuto(rawHeaderNames(captureRawRequest(t, post(c))))
+	tests.AssertEqual(t, []string{"host", "connection", "content-length", "origin", "content-type", "user-agent"}, names)
+
+	c = C().ImpersonateFirefox().DisableKeepAlives()
+	names = onlyAuto(rawHeaderNames(captureRawRequest(t, post(c))))
+	tests.AssertEqual(t, []string{"host", "user-agent", "content-type", "content-length", "origin", "connection"}, names)
+
+	c = C().ImpersonateSafari()
+	names = onlyAuto(rawHeaderNames(captureRawRequest(t, post(c))))
+	tests.AssertEqual(t, []string{"host", "content-type", "origin", "content-length", "user-agent"}, names)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	var buf bytes.Buffer
+	c = C().ImpersonateChrome().EnableInsecureSkipVerify().EnableDumpAllTo(&buf)
+	post(c)(srv.URL)
+	var h2Names []string
+	reqHeader, _, _ := strings.Cut(buf.String(), "\r\n\r\n")
+	for _, line := range strings.Split(reqHeader, "\r\n") {
+		if i := strings.Index(line, ":"); i > 0 {
+			h2Names = append(h2Names, line[:i])
+		}
+	}
+	tests.AssertEqual(t, []string{"content-length", "origin", "content-type", "user-agent"}, onlyAuto(h2Names))
 }
 
 func TestClientClone(t *testing.T) {
@@ -645,6 +2929,45 @@ func TestEnableDumpAll(t *testing.T) {
 	}
 }
 
+func TestEnableDumpTLSAndHTTP2Frames(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	c := C().ImpersonateChrome().EnableInsecureSkipVerify().
+		EnableDumpAllTo(&buf).
+		EnableDumpTLS().
+		EnableDumpHTTP2Frames()
+	resp, err := c.R().Get(srv.URL)
+	assertSuccess(t, resp, err)
+	dump := buf.String()
+	tests.AssertContains(t, dump, "tls clienthello (", true)
+	tests.AssertContains(t, dump, "alpn: h2, http/1.1\r\n", true)
+	tests.AssertContains(t, dump, "ja3: 771,4865-4866-4867-", true)
+	tests.AssertContains(t, dump, "00000000  16 03 01 ", true)
+	tests.AssertContains(t, dump, "> settings len=24, settings: header_table_size=65536, enable_push=0, initial_window_size=6291456, max_header_list_size=262144\r\n", true)
+	tests.AssertContains(t, dump, "> window_update len=4 (conn) incr=15663105\r\n", true)
+	tests.AssertContains(t, dump, "> headers flags=end_stream|end_headers|priority stream=1", true)
+	tests.AssertContains(t, dump, "dep=0 weight=256 exclusive=true\r\n", true)
+	tests.AssertContains(t, dump, "< settings flags=ack len=0\r\n", true)
+
+	// the ClientHello is only dumped for the new connections.
+	buf.Reset()
+	resp, err = c.R().Get(srv.URL)
+	assertSuccess(t, resp, err)
+	tests.AssertContains(t, buf.String(), "tls clienthello", false)
+	tests.AssertContains(t, buf.String(), "> headers ", true)
+
+	buf.Reset()
+	c = C().EnableInsecureSkipVerify().EnableDumpAllTo(&buf)
+	resp, err = c.R().Get(srv.URL)
+	assertSuccess(t, resp, err)
+	tests.AssertContains(t, buf.String(), "tls clienthello", false)
+	tests.AssertContains(t, buf.String(), "> settings", false)
+}
+
 func TestEnableDumpAllToFile(t *testing.T) {
 	c := tc()
 	dumpFile := "tmp_test_dump_file"
@@ -720,3 +3043,789 @@ func TestCloneCookieJar(t *testing.T) {
 	tests.AssertEqual(t, true, c2.cookiejarFactory == nil)
 	tests.AssertEqual(t, true, c2.httpClient.Jar == nil)
 }
+
+func TestSendHTTP3Datagram(t *testing.T) {
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	tests.AssertNoError(t, err)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	srv := &quichttp3.Server{
+		TLSConfig:       quichttp3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+		EnableDatagrams: true,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			str := w.(quichttp3.HTTPStreamer).HTTPStream()
+			if b, err := str.ReceiveDatagram(r.Context()); err == nil {
+				str.SendDatagram(b)
+			}
+			io.Copy(io.Discard, r.Body)
+		}),
+	}
+	go srv.Serve(conn)
+	defer srv.Close()
+
+	received := make(chan []byte, 1)
+	c := tc().EnableForceHTTP3().
+		SetHTTP3Settings(&http3.Settings{Datagram: true}).
+		SetHTTP3DatagramHandler(func(stream quic.StreamID, payload []byte) {
+			received <- payload
+		})
+	defer c.CloseIdleConnections()
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	resp, err := c.R().DisableAutoReadResponse().SetBody(pr).Post("https://" + conn.LocalAddr().String())
+	tests.AssertNoError(t, err)
+	defer resp.Body.Close()
+	id, ok := resp.HTTP3StreamID()
+	tests.AssertEqual(t, true, ok)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		// the settings of the server may not be received yet.
+		err = c.SendHTTP3Datagram(id, []byte("hello"))
+		if err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	tests.AssertNoError(t, err)
+	select {
+	case b := <-received:
+		tests.AssertEqual(t, "hello", string(b))
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the echoed datagram")
+	}
+
+	resp, err = tc().R().Get("/")
+	tests.AssertNoError(t, err)
+	_, ok = resp.HTTP3StreamID()
+	tests.AssertEqual(t, false, ok)
+}
+
+func TestNegotiatedProtocol(t *testing.T) {
+	resp, err := tc().R().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "h2", resp.NegotiatedProtocol())
+
+	resp, err = tc().EnableForceHTTP1().R().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "http/1.1", resp.NegotiatedProtocol())
+
+	plain := httptest.NewServer(http.HandlerFunc(handleHTTP))
+	defer plain.Close()
+	resp, err = C().R().Get(plain.URL)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "http/1.1", resp.NegotiatedProtocol())
+
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	tests.AssertNoError(t, err)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	srv := &quichttp3.Server{
+		TLSConfig: quichttp3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+	go srv.Serve(conn)
+	defer srv.Close()
+	c := tc().EnableForceHTTP3()
+	defer c.CloseIdleConnections()
+	resp, err = c.R().Get("https://" + conn.LocalAddr().String())
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "h3", resp.NegotiatedProtocol())
+
+	tests.AssertEqual(t, "", (&Response{}).NegotiatedProtocol())
+}
+
+func TestRequestForceHTTPVersion(t *testing.T) {
+	resp, err := tc().EnableForceHTTP1().R().ForceHTTP2().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "h2", resp.NegotiatedProtocol())
+
+	h1 := httptest.NewTLSServer(http.HandlerFunc(handleHTTP))
+	defer h1.Close()
+	_, err = tc().R().ForceHTTP2().Get(h1.URL)
+	tests.AssertErrorContains(t, err, `unexpected ALPN protocol "http/1.1"`)
+
+	_, err = tc().R().ForceHTTP3().Get("/")
+	tests.AssertErrorContains(t, err, "http3 is not enabled")
+
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	tests.AssertNoError(t, err)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	srv := &quichttp3.Server{
+		TLSConfig: quichttp3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+	go srv.Serve(conn)
+	defer srv.Close()
+	c := tc().EnableHTTP3()
+	defer c.CloseIdleConnections()
+	resp, err = c.R().ForceHTTP3().Get("https://" + conn.LocalAddr().String())
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "h3", resp.NegotiatedProtocol())
+}
+
+func TestServerHTTP2Settings(t *testing.T) {
+	resp, err := tc().R().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, true, slices.Contains(resp.ServerHTTP2Settings(), http2.Setting{ID: http2.SettingMaxConcurrentStreams, Val: 250}))
+
+	resp, err = tc().EnableForceHTTP1().R().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertIsNil(t, resp.ServerHTTP2Settings())
+}
+
+func TestGoAwayRetryOnNewConnection(t *testing.T) {
+	var mu sync.Mutex
+	var remoteAddrs []string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		remoteAddrs = append(remoteAddrs, r.RemoteAddr)
+		mu.Unlock()
+		if r.URL.Path == "/close" {
+			// the http2 server sends GOAWAY for the "Connection: close".
+			w.Header().Set("Connection", "close")
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	c := tc()
+	defer c.CloseIdleConnections()
+	resp, err := c.R().Get(srv.URL + "/close")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, 2, resp.ProtoMajor)
+	for range 3 {
+		resp, err = c.R().Get(srv.URL)
+		assertSuccess(t, resp, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	tests.AssertEqual(t, 4, len(remoteAddrs))
+	tests.AssertEqual(t, true, remoteAddrs[0] != remoteAddrs[1])
+	tests.AssertEqual(t, remoteAddrs[1], remoteAddrs[3])
+}
+
+// startRawHTTP2Server starts a http2 server which advertises the settings,
+// and calls handle with the frames received except SETTINGS. A value is sent
+// to the returned channel when a connection is closed.
+func startRawHTTP2Server(t *testing.T, settings []xhttp2.Setting, handle func(fr *xhttp2.Framer, f xhttp2.Frame)) (string, chan struct{}) {
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	tests.AssertNoError(t, err)
+	ln := tests.NewLocalListener(t)
+	t.Cleanup(func() { ln.Close() })
+	closed := make(chan struct{}, 10)
+	serve := func(conn net.Conn) {
+		defer func() { closed <- struct{}{} }()
+		defer conn.Close()
+		tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2"}})
+		preface := make([]byte, len(xhttp2.ClientPreface))
+		if _, err := io.ReadFull(tlsConn, preface); err != nil {
+			return
+		}
+		fr := xhttp2.NewFramer(tlsConn, tlsConn)
+		fr.SetMaxReadFrameSize(1 << 20)
+		fr.WriteSettings(settings...)
+		for {
+			f, err := fr.ReadFrame()
+			if err != nil {
+				return
+			}
+			if f, ok := f.(*xhttp2.SettingsFrame); ok {
+				if !f.IsAck() {
+					fr.WriteSettingsAck()
+				}
+				continue
+			}
+			handle(fr, f)
+		}
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return ln.Addr().String(), closed
+}
+
+// writeRawHTTP2Response writes the empty response of the stream.
+func writeRawHTTP2Response(fr *xhttp2.Framer, streamID uint32) {
+	var hbuf bytes.Buffer
+	hpack.NewEncoder(&hbuf).WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+	fr.WriteHeaders(xhttp2.HeadersFrameParam{StreamID: streamID, BlockFragment: hbuf.Bytes(), EndHeaders: true, EndStream: true})
+}
+
+func TestSetHTTP2MaxHeaderFrameSize(t *testing.T) {
+	// the payload sizes of the HEADERS and CONTINUATION frames of each request.
+	frameSizes := make(chan []uint32, 10)
+	var pending []uint32
+	addr, _ := startRawHTTP2Server(t, []xhttp2.Setting{{ID: xhttp2.SettingMaxFrameSize, Val: 1 << 20}}, func(fr *xhttp2.Framer, f xhttp2.Frame) {
+		var endHeaders bool
+		switch f := f.(type) {
+		case *xhttp2.HeadersFrame:
+			endHeaders = f.HeadersEnded()
+		case *xhttp2.ContinuationFrame:
+			endHeaders = f.HeadersEnded()
+		default:
+			return
+		}
+		pending = append(pending, f.Header().Length)
+		if endHeaders {
+			frameSizes <- pending
+			pending = nil
+			writeRawHTTP2Response(fr, f.Header().StreamID)
+		}
+	})
+	// the random value can not be compressed by hpack.
+	b := make([]byte, 20000)
+	rand.Read(b)
+	big := base64.StdEncoding.EncodeToString(b)
+	send := func(c *Client) []uint32 {
+		defer c.CloseIdleConnections()
+		// receive the settings of the server with the first request.
+		resp, err := c.EnableInsecureSkipVerify().R().Get("https://" + addr)
+		assertSuccess(t, resp, err)
+		<-frameSizes
+		resp, err = c.R().SetHeader("x-big", big).Get("https://" + addr)
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, 2, resp.ProtoMajor)
+		return <-frameSizes
+	}
+
+	// the header block is sent in a single frame as the server allows.
+	sizes := send(C().EnableForceHTTP2())
+	tests.AssertEqual(t, 1, len(sizes))
+	tests.AssertEqual(t, true, sizes[0] > 16384)
+
+	// the browsers split the header block at 16384, which includes the
+	// priority fields of the HEADERS frame.
+	for _, c := range []*Client{C().ImpersonateChrome(), C().ImpersonateFirefox(), C().ImpersonateSafari()} {
+		sizes = send(c)
+		tests.AssertEqual(t, true, len(sizes) > 1)
+		for _, size := range sizes[:len(sizes)-1] {
+			tests.AssertEqual(t, uint32(16384), size)
+		}
+		tests.AssertEqual(t, true, sizes[len(sizes)-1] <= 16384)
+	}
+
+	sizes = send(C().EnableForceHTTP2().SetHTTP2MaxHeaderFrameSize(20000))
+	tests.AssertEqual(t, uint32(20000), sizes[0])
+	sizes = send(C().ImpersonateChrome().SetHTTP2MaxHeaderFrameSize(0))
+	tests.AssertEqual(t, 1, len(sizes))
+
+	var buf bytes.Buffer
+	c := C().SetLogger(NewLogger(&buf, "", 0)).SetHTTP2MaxHeaderFrameSize(100)
+	tests.AssertContains(t, buf.String(), "invalid http2 max header frame size 100", true)
+	tests.AssertEqual(t, uint32(0), c.t2.MaxHeaderFrameSize)
+}
+
+func TestSetHTTP2PingInterval(t *testing.T) {
+	c := C().ImpersonateFirefox()
+	tests.AssertEqual(t, 58*time.Second, c.t2.ReadIdleTimeout)
+	c.SetHTTP2PingInterval(0).ImpersonateChrome()
+	tests.AssertEqual(t, time.Duration(0), c.t2.ReadIdleTimeout)
+	// the interval of the previous profile is reset.
+	c.ImpersonateFirefox().ImpersonateChrome()
+	tests.AssertEqual(t, time.Duration(0), c.t2.ReadIdleTimeout)
+	// the interval set by the user is kept.
+	c.ImpersonateFirefox().SetHTTP2PingInterval(time.Second).ImpersonateChrome()
+	tests.AssertEqual(t, time.Second, c.t2.ReadIdleTimeout)
+
+	// startPingServer starts a server which sends the data of the PING
+	// frames to the returned channel, and acks them if ack is true.
+	startPingServer := func(ack bool) (string, chan [8]byte, chan struct{}) {
+		pings := make(chan [8]byte, 10)
+		addr, closed := startRawHTTP2Server(t, nil, func(fr *xhttp2.Framer, f xhttp2.Frame) {
+			switch f := f.(type) {
+			case *xhttp2.HeadersFrame:
+				writeRawHTTP2Response(fr, f.StreamID)
+			case *xhttp2.PingFrame:
+				if f.IsAck() {
+					return
+				}
+				pings <- f.Data
+				if ack {
+					fr.WritePing(true, f.Data)
+				}
+			}
+		})
+		return addr, pings, closed
+	}
+	get := func(c *Client, addr string) {
+		resp, err := c.EnableInsecureSkipVerify().R().Get("https://" + addr)
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, 2, resp.ProtoMajor)
+	}
+
+	// Chrome pings with the odd sequence numbers.
+	addr, pings, _ := startPingServer(true)
+	c = C().ImpersonateChrome().SetHTTP2PingInterval(20 * time.Millisecond)
+	get(c, addr)
+	for _, seq := range []uint64{1, 3, 5} {
+		p := <-pings
+		tests.AssertEqual(t, seq, binary.BigEndian.Uint64(p[:]))
+	}
+	c.CloseIdleConnections()
+
+	// Firefox pings with zeros.
+	addr, pings, _ = startPingServer(true)
+	c = C().ImpersonateFirefox().SetHTTP2PingInterval(20 * time.Millisecond)
+	get(c, addr)
+	for range 3 {
+		tests.AssertEqual(t, [8]byte{}, <-pings)
+	}
+	c.CloseIdleConnections()
+
+	// the connection is closed if the ping is not acked.
+	addr, pings, closed := startPingServer(false)
+	c = C().EnableForceHTTP2().
+		SetHTTP2PingInterval(20 * time.Millisecond).
+		SetHTTP2PingTimeout(20 * time.Millisecond)
+	get(c, addr)
+	<-pings
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the connection is not closed after the ping timeout")
+	}
+}
+
+func TestGoAwayHandler(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(handleHTTP))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	h2GoAway := make(chan http2.GoAway, 1)
+	c := tc().SetHTTP2GoAwayHandler(func(addr string, goAway http2.GoAway) {
+		tests.AssertEqual(t, srv.Listener.Addr().String(), addr)
+		h2GoAway <- goAway
+	})
+	resp, err := c.R().Get(srv.URL)
+	assertSuccess(t, resp, err)
+	go srv.Config.Shutdown(context.Background())
+	select {
+	case goAway := <-h2GoAway:
+		tests.AssertEqual(t, uint32(0), goAway.ErrCode)
+		tests.AssertEqual(t, true, goAway.LastStreamID >= 1)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the http2 goaway")
+	}
+
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	tests.AssertNoError(t, err)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	h3srv := &quichttp3.Server{
+		TLSConfig: quichttp3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}),
+	}
+	go h3srv.Serve(conn)
+	defer h3srv.Close()
+	h3GoAway := make(chan http3.GoAway, 1)
+	c = tc().EnableForceHTTP3().SetHTTP3GoAwayHandler(func(addr string, goAway http3.GoAway) {
+		h3GoAway <- goAway
+	})
+	defer c.CloseIdleConnections()
+	resp, err = c.R().Get("https://" + conn.LocalAddr().String())
+	assertSuccess(t, resp, err)
+	id, _ := resp.HTTP3StreamID()
+	go h3srv.Shutdown(context.Background())
+	select {
+	case goAway := <-h3GoAway:
+		tests.AssertEqual(t, true, goAway.StreamID > id)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the http3 goaway")
+	}
+}
+
+func TestSetHeaderCasing(t *testing.T) {
+	c := C().SetCommonHeaderCasing(map[string]string{"x-api-key": "x-api-key", "user-agent": "user-agent"})
+	raw := captureRawRequest(t, func(url string) {
+		c.R().SetHeader("X-Api-Key", "abc").
+			SetHeaderCasing(map[string]string{"X-API-KEY": "X-API-KEY", "host": "HOST"}).
+			Get(url)
+	})
+	for _, line := range []string{"\r\nHOST: ", "\r\nuser-agent: ", "\r\nX-API-KEY: abc\r\n"} {
+		if !strings.Contains(raw, line) {
+			t.Errorf("raw request does not contain %q:\n%s", line, raw)
+		}
+	}
+	tests.AssertEqual(t, false, strings.Contains(strings.ToLower(raw), "__header_casing__"))
+
+	resp, err := c.R().SetHeaderCasing(map[string]string{"x-api-key": "X-Other"}).Get("http://127.0.0.1")
+	tests.AssertErrorContains(t, err, "does not match")
+	tests.AssertEqual(t, true, resp.Err != nil)
+}
+
+func TestSetRawHeaderBlock(t *testing.T) {
+	var host string
+	raw := captureRawRequest(t, func(url string) {
+		host = strings.TrimSuffix(strings.TrimPrefix(url, "http://"), "/")
+		resp, err := tc().R().SetHeader("X-Ignored", "1").
+			SetRawHeaderBlock([]byte("host: " + host + "\r\nProxy-Connection: keep-alive\r\nuser-agent: raw\r\n\r\n")).
+			Get(url)
+		assertSuccess(t, resp, err)
+	})
+	tests.AssertEqual(t, "GET / HTTP/1.1\r\nhost: "+host+"\r\nProxy-Connection: keep-alive\r\nuser-agent: raw\r\n\r\n", raw)
+
+	for _, block := range []string{"Host: example.com\r\n", "\r\n\r\n", "Host example.com\r\n\r\n", "Host: a\r\nb\r\n\r\n"} {
+		_, err := tc().R().SetRawHeaderBlock([]byte(block)).Get("/")
+		tests.AssertNotNil(t, err)
+	}
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto + " " + r.Header.Get("X-Raw")))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+	resp, err := C().EnableInsecureSkipVerify().R().
+		SetRawHeaderBlock([]byte("Host: " + u.Host + "\r\nX-Raw: yes\r\n\r\n")).
+		Get(srv.URL)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "HTTP/1.1 yes", resp.String())
+}
+
+// startSocks5Server starts a SOCKS5 server without authentication, which
+// sends the target address requested by the client and the first TLS record
+// received through the tunnel without connecting to the target.
+func startSocks5Server(t *testing.T) (addr string, target chan string, hello chan []byte) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	target, hello = make(chan string, 1), make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		buf := make([]byte, 262)
+		// greeting: VER NMETHODS METHODS
+		if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+			return
+		}
+		if _, err := io.ReadFull(conn, buf[:buf[1]]); err != nil {
+			return
+		}
+		conn.Write([]byte{5, 0})
+		// request: VER CMD RSV ATYP DST.ADDR DST.PORT
+		if _, err := io.ReadFull(conn, buf[:4]); err != nil {
+			return
+		}
+		var host string
+		switch buf[3] {
+		case 1:
+			io.ReadFull(conn, buf[:4])
+			host = net.IP(buf[:4]).String()
+		case 3:
+			io.ReadFull(conn, buf[:1])
+			n := int(buf[0])
+			io.ReadFull(conn, buf[:n])
+			host = string(buf[:n])
+		case 4:
+			io.ReadFull(conn, buf[:16])
+			host = net.IP(buf[:16]).String()
+		}
+		io.ReadFull(conn, buf[:2])
+		target <- net.JoinHostPort(host, fmt.Sprint(int(buf[0])<<8|int(buf[1])))
+		conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		hdr := make([]byte, 5)
+		if _, err := io.ReadFull(conn, hdr); err != nil {
+			hello <- nil
+			return
+		}
+		body := make([]byte, int(hdr[3])<<8|int(hdr[4]))
+		io.ReadFull(conn, body)
+		hello <- append(hdr, body...)
+	}()
+	return ln.Addr().String(), target, hello
+}
+
+func TestSocks5ProxyImpersonation(t *testing.T) {
+	for _, scheme := range []string{"socks5", "socks5h"} {
+		addr, target, hello := startSocks5Server(t)
+		c := tc().ImpersonateChrome().SetProxyURL(scheme + "://" + addr)
+		go c.R().Get("https://example.com")
+		tests.AssertEqual(t, "example.com:443", <-target)
+		info, err := parseClientHelloInfo(<-hello)
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, "example.com", info.serverName)
+		ja4, err := c.JA4()
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, ja4, info.ja4())
+		// the ClientHello is the impersonated one rather than the one of Go.
+		tests.AssertEqual(t, true, slices.ContainsFunc(info.extensions, isGREASE))
+	}
+}
+
+// startConnectProxy starts a http proxy which sends the raw CONNECT request
+// and the first TLS record received through the tunnel without connecting to
+// the target, the CONNECT request is responded with status.
+func startConnectProxy(t *testing.T, status string) (addr string, connect chan string, hello chan []byte) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	connect, hello = make(chan string, 1), make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var sb strings.Builder
+		buf := make([]byte, 1)
+		for !strings.HasSuffix(sb.String(), "\r\n\r\n") {
+			if _, err := conn.Read(buf); err != nil {
+				break
+			}
+			sb.Write(buf)
+		}
+		connect <- sb.String()
+		conn.Write([]byte("HTTP/1.1 " + status + "\r\n\r\n"))
+		hdr := make([]byte, 5)
+		if _, err := io.ReadFull(conn, hdr); err != nil {
+			hello <- nil
+			return
+		}
+		body := make([]byte, int(hdr[3])<<8|int(hdr[4]))
+		io.ReadFull(conn, body)
+		hello <- append(hdr, body...)
+	}()
+	return ln.Addr().String(), connect, hello
+}
+
+func TestProxyConnectImpersonation(t *testing.T) {
+	addr, connect, hello := startConnectProxy(t, "200 Connection Established")
+	c := tc().ImpersonateChrome().SetProxyURL("http://" + addr).
+		SetProxyConnectHeader(http.Header{
+			"Proxy-Connection": {"keep-alive"},
+			"user-agent":       {"test-agent"},
+			HeaderOderKey:      {"proxy-connection", "host", "user-agent"},
+		})
+	go c.R().Get("https://example.com")
+	tests.AssertEqual(t, "CONNECT example.com:443 HTTP/1.1\r\nProxy-Connection: keep-alive\r\nHost: example.com:443\r\nuser-agent: test-agent\r\n\r\n", <-connect)
+	info, err := parseClientHelloInfo(<-hello)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "example.com", info.serverName)
+	ja4, err := c.JA4()
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, ja4, info.ja4())
+
+	addr, connect, _ = startConnectProxy(t, "200 OK")
+	c = tc().SetProxyURL("http://user:pass@" + addr).
+		SetProxyConnectHeaderFunc(func(ctx context.Context, proxyURL *url.URL, target string) (http.Header, error) {
+			return http.Header{"X-Target": {target}}, nil
+		})
+	go c.R().Get("https://example.com")
+	tests.AssertEqual(t, "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\nProxy-Authorization: Basic dXNlcjpwYXNz\r\nX-Target: example.com:443\r\n\r\n", <-connect)
+
+	addr, _, _ = startConnectProxy(t, "407 Proxy Authentication Required")
+	_, err = tc().SetProxyURL("http://user:secret@" + addr).R().Get("https://example.com")
+	tests.AssertEqual(t, true, errors.Is(err, ErrProxyAuthRequired))
+	var connectErr *ProxyConnectError
+	tests.AssertEqual(t, true, errors.As(err, &connectErr))
+	tests.AssertEqual(t, http.StatusProxyAuthRequired, connectErr.StatusCode)
+	tests.AssertEqual(t, "example.com:443", connectErr.Target)
+	tests.AssertEqual(t, false, strings.Contains(err.Error(), "secret"))
+
+	addr, _, _ = startConnectProxy(t, "502 Bad Gateway")
+	_, err = tc().SetProxyURL("http://" + addr).R().Get("https://example.com")
+	tests.AssertEqual(t, true, errors.As(err, &connectErr))
+	tests.AssertEqual(t, http.StatusBadGateway, connectErr.StatusCode)
+	tests.AssertEqual(t, false, errors.Is(err, ErrProxyAuthRequired))
+}
+
+// startTunnelProxy starts a http proxy which tunnels the CONNECT requests,
+// tunnels counts the tunnels established.
+func startTunnelProxy(t *testing.T) (proxyURL *url.URL, tunnels *atomic.Int32) {
+	tunnels = new(atomic.Int32)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		target, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		defer target.Close()
+		tunnels.Add(1)
+		w.WriteHeader(http.StatusOK)
+		conn, brw, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		go io.Copy(target, brw)
+		io.Copy(conn, target)
+	}))
+	t.Cleanup(srv.Close)
+	proxyURL, _ = url.Parse(srv.URL)
+	return
+}
+
+func TestSetProxySelector(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	proxyA, tunnelsA := startTunnelProxy(t)
+	proxyB, tunnelsB := startTunnelProxy(t)
+	c := C().EnableInsecureSkipVerify().ImpersonateChrome().
+		SetProxySelector(func(r *Request) *url.URL {
+			if r.GetContextData("identity") == "b" {
+				return proxyB
+			}
+			return proxyA
+		})
+	for i := 0; i < 3; i++ {
+		for _, identity := range []string{"a", "b"} {
+			resp, err := c.R().SetContextData("identity", identity).Get(srv.URL)
+			assertSuccess(t, resp, err)
+			tests.AssertEqual(t, "HTTP/2.0", resp.String())
+		}
+	}
+	// the http2 connections are reused per proxy.
+	tests.AssertEqual(t, int32(1), tunnelsA.Load())
+	tests.AssertEqual(t, int32(1), tunnelsB.Load())
+
+	// the proxy follows the profile of the request.
+	c.SetProxySelector(func(r *Request) *url.URL {
+		if r.GetImpersonateProfile() == "firefox" {
+			return proxyB
+		}
+		return nil
+	}).SetProxyURL(proxyA.String())
+	resp, err := c.R().Impersonate("firefox").Get(srv.URL)
+	assertSuccess(t, resp, err)
+	resp, err = c.R().Get(srv.URL)
+	assertSuccess(t, resp, err)
+	// firefox dials its own connection via proxy B, while the other request
+	// reuses the connection via proxy A set by SetProxyURL.
+	tests.AssertEqual(t, int32(1), tunnelsA.Load())
+	tests.AssertEqual(t, int32(2), tunnelsB.Load())
+}
+
+func TestSetProxySelectorForceHTTP2(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	proxyURL, tunnels := startTunnelProxy(t)
+	c := C().EnableInsecureSkipVerify().EnableForceHTTP2().
+		SetProxySelector(func(r *Request) *url.URL {
+			return proxyURL
+		})
+	for i := 0; i < 3; i++ {
+		resp, err := c.R().Get(srv.URL)
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, "HTTP/2.0", resp.String())
+	}
+	// the forced http2 connection is dialed through the proxy and reused.
+	tests.AssertEqual(t, int32(1), tunnels.Load())
+
+	// the server behind the proxy must negotiate http2.
+	h1srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer h1srv.Close()
+	_, err := c.R().Get(h1srv.URL)
+	tests.AssertErrorContains(t, err, "server does not support http2")
+
+	// the http2 over a proxy requires https.
+	_, err = c.R().Get("http://" + srv.Listener.Addr().String())
+	tests.AssertErrorContains(t, err, "requires https")
+}
+
+func TestResponseHeaderOrder(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				for {
+					req, err := http.ReadRequest(br)
+					if err != nil {
+						return
+					}
+					req.Body.Close()
+					conn.Write([]byte("HTTP/1.1 200 OK\r\nX-B: 1\r\nset-cookie: a=1\r\nX-A: 2\r\nSet-Cookie: b=2\r\nContent-Length: 0\r\n\r\n"))
+				}
+			}()
+		}
+	}()
+	c := tc().EnableResponseHeaderOrder()
+	resp, err := c.R().Get("http://" + ln.Addr().String())
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, []string{"X-B", "set-cookie", "X-A", "Set-Cookie", "Content-Length"}, resp.HeaderOrder())
+	tests.AssertEqual(t, []string{"a=1", "b=2"}, resp.Header.Values("Set-Cookie"))
+
+	addr, _ := startRawHTTP2Server(t, nil, func(fr *xhttp2.Framer, f xhttp2.Frame) {
+		if f, ok := f.(*xhttp2.HeadersFrame); ok {
+			var hbuf bytes.Buffer
+			enc := hpack.NewEncoder(&hbuf)
+			for _, hf := range [][2]string{{":status", "200"}, {"x-b", "1"}, {"set-cookie", "a=1"}, {"x-a", "2"}, {"set-cookie", "b=2"}} {
+				enc.WriteField(hpack.HeaderField{Name: hf[0], Value: hf[1]})
+			}
+			fr.WriteHeaders(xhttp2.HeadersFrameParam{StreamID: f.StreamID, BlockFragment: hbuf.Bytes(), EndHeaders: true, EndStream: true})
+		}
+	})
+	resp, err = c.R().Get("https://" + addr)
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "HTTP/2.0", resp.Proto)
+	tests.AssertEqual(t, []string{"x-b", "set-cookie", "x-a", "set-cookie"}, resp.HeaderOrder())
+
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	tests.AssertNoError(t, err)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	srv := &quichttp3.Server{
+		TLSConfig: quichttp3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Foo", "bar")
+			w.Write([]byte("ok"))
+		}),
+	}
+	go srv.Serve(conn)
+	defer srv.Close()
+	c3 := tc().EnableForceHTTP3().EnableResponseHeaderOrder()
+	defer c3.CloseIdleConnections()
+	resp, err = c3.R().Get("https://" + conn.LocalAddr().String())
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "HTTP/3.0", resp.Proto)
+	order := resp.HeaderOrder()
+	tests.AssertEqual(t, true, slices.Contains(order, "x-foo"))
+	tests.AssertEqual(t, len(resp.Header), len(order))
+
+	c.DisableResponseHeaderOrder()
+	resp, err = c.R().Get("http://" + ln.Addr().String())
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, true, resp.HeaderOrder() == nil)
+}
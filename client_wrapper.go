@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/imroc/req/v3/http2"
+	"github.com/imroc/req/v3/http3"
+	"github.com/quic-go/quic-go"
 	utls "github.com/refraction-networking/utls"
 )
 
@@ -63,6 +65,18 @@ func SetMultipartBoundaryFunc(fn func() string) *Client {
 	return defaultClient.SetMultipartBoundaryFunc(fn)
 }
 
+// SetMultipartBoundaryFuncE is a global wrapper methods which delegated
+// to the default client's Client.SetMultipartBoundaryFuncE.
+func SetMultipartBoundaryFuncE(fn func() (string, error)) *Client {
+	return defaultClient.SetMultipartBoundaryFuncE(fn)
+}
+
+// SetMultipartBoundaryRand is a global wrapper methods which delegated
+// to the default client's Client.SetMultipartBoundaryRand.
+func SetMultipartBoundaryRand(r io.Reader) *Client {
+	return defaultClient.SetMultipartBoundaryRand(r)
+}
+
 // SetBaseURL is a global wrapper methods which delegated
 // to the default client's Client.SetBaseURL.
 func SetBaseURL(u string) *Client {
@@ -135,6 +149,12 @@ func EnableCompression() *Client {
 	return defaultClient.EnableCompression()
 }
 
+// SetAcceptEncoding is a global wrapper methods which delegated
+// to the default client's Client.SetAcceptEncoding.
+func SetAcceptEncoding(encodings ...string) *Client {
+	return defaultClient.SetAcceptEncoding(encodings...)
+}
+
 // SetTLSClientConfig is a global wrapper methods which delegated
 // to the default client's Client.SetTLSClientConfig.
 func SetTLSClientConfig(conf *tls.Config) *Client {
@@ -309,6 +329,18 @@ func EnableDumpAllWithoutBody() *Client {
 	return defaultClient.EnableDumpAllWithoutBody()
 }
 
+// EnableDumpTLS is a global wrapper methods which delegated
+// to the default client's Client.EnableDumpTLS.
+func EnableDumpTLS() *Client {
+	return defaultClient.EnableDumpTLS()
+}
+
+// EnableDumpHTTP2Frames is a global wrapper methods which delegated
+// to the default client's Client.EnableDumpHTTP2Frames.
+func EnableDumpHTTP2Frames() *Client {
+	return defaultClient.EnableDumpHTTP2Frames()
+}
+
 // EnableDumpEachRequest is a global wrapper methods which delegated
 // to the default client's Client.EnableDumpEachRequest.
 func EnableDumpEachRequest() *Client {
@@ -423,6 +455,18 @@ func SetCommonHeaders(hdrs map[string]string) *Client {
 	return defaultClient.SetCommonHeaders(hdrs)
 }
 
+// SetPriorityHeader is a global wrapper methods which delegated
+// to the default client's Client.SetPriorityHeader.
+func SetPriorityHeader(urgency int, incremental bool) *Client {
+	return defaultClient.SetPriorityHeader(urgency, incremental)
+}
+
+// GetCommonHeaders is a global wrapper methods which delegated
+// to the default client's Client.GetCommonHeaders.
+func GetCommonHeaders() http.Header {
+	return defaultClient.GetCommonHeaders()
+}
+
 // SetCommonHeader is a global wrapper methods which delegated
 // to the default client's Client.SetCommonHeader.
 func SetCommonHeader(key, value string) *Client {
@@ -435,36 +479,216 @@ func SetCommonHeaderOrder(keys ...string) *Client {
 	return defaultClient.SetCommonHeaderOrder(keys...)
 }
 
+// SetCommonHeaderOrderFunc is a global wrapper methods which delegated
+// to the default client's Client.SetCommonHeaderOrderFunc.
+func SetCommonHeaderOrderFunc(fn func(r *Request) []string) *Client {
+	return defaultClient.SetCommonHeaderOrderFunc(fn)
+}
+
+// SetCommonHeaderCasing is a global wrapper methods which delegated
+// to the default client's Client.SetCommonHeaderCasing.
+func SetCommonHeaderCasing(casing map[string]string) *Client {
+	return defaultClient.SetCommonHeaderCasing(casing)
+}
+
+// EnableResponseHeaderOrder is a global wrapper methods which delegated
+// to the default client's Client.EnableResponseHeaderOrder.
+func EnableResponseHeaderOrder() *Client {
+	return defaultClient.EnableResponseHeaderOrder()
+}
+
+// DisableResponseHeaderOrder is a global wrapper methods which delegated
+// to the default client's Client.DisableResponseHeaderOrder.
+func DisableResponseHeaderOrder() *Client {
+	return defaultClient.DisableResponseHeaderOrder()
+}
+
+// SetHeaderOrderForOrigin is a global wrapper methods which delegated
+// to the default client's Client.SetHeaderOrderForOrigin.
+func SetHeaderOrderForOrigin(origin string, order []string) *Client {
+	return defaultClient.SetHeaderOrderForOrigin(origin, order)
+}
+
+// SetCommonHeaderOrderStrict is a global wrapper methods which delegated
+// to the default client's Client.SetCommonHeaderOrderStrict.
+func SetCommonHeaderOrderStrict(keys ...string) error {
+	return defaultClient.SetCommonHeaderOrderStrict(keys...)
+}
+
 // SetCommonPseudoHeaderOder is a global wrapper methods which delegated
 // to the default client's Client.SetCommonPseudoHeaderOder.
 func SetCommonPseudoHeaderOder(keys ...string) *Client {
 	return defaultClient.SetCommonPseudoHeaderOder(keys...)
 }
 
+// SetCommonPseudoHeaderOrderStrict is a global wrapper methods which delegated
+// to the default client's Client.SetCommonPseudoHeaderOrderStrict.
+func SetCommonPseudoHeaderOrderStrict(keys ...string) error {
+	return defaultClient.SetCommonPseudoHeaderOrderStrict(keys...)
+}
+
 // SetHTTP2SettingsFrame is a global wrapper methods which delegated
 // to the default client's Client.SetHTTP2SettingsFrame.
 func SetHTTP2SettingsFrame(settings ...http2.Setting) *Client {
 	return defaultClient.SetHTTP2SettingsFrame(settings...)
 }
 
+// GetHTTP2Settings is a global wrapper methods which delegated
+// to the default client's Client.GetHTTP2Settings.
+func GetHTTP2Settings() []http2.Setting {
+	return defaultClient.GetHTTP2Settings()
+}
+
+// SetHTTP2SettingsOrder is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP2SettingsOrder.
+func SetHTTP2SettingsOrder(order ...http2.SettingID) *Client {
+	return defaultClient.SetHTTP2SettingsOrder(order...)
+}
+
+// SetHTTP2SettingsJitter is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP2SettingsJitter.
+func SetHTTP2SettingsJitter(enable bool) *Client {
+	return defaultClient.SetHTTP2SettingsJitter(enable)
+}
+
+// SetHTTP2SettingsJitterSeed is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP2SettingsJitterSeed.
+func SetHTTP2SettingsJitterSeed(seed int64) *Client {
+	return defaultClient.SetHTTP2SettingsJitterSeed(seed)
+}
+
+// SetHTTP3Settings is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP3Settings.
+func SetHTTP3Settings(settings *http3.Settings) *Client {
+	return defaultClient.SetHTTP3Settings(settings)
+}
+
+// SetHTTP3SettingsFrame is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP3SettingsFrame.
+func SetHTTP3SettingsFrame(settings ...http3.Setting) *Client {
+	return defaultClient.SetHTTP3SettingsFrame(settings...)
+}
+
+// SetHTTP3GREASE is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP3GREASE.
+func SetHTTP3GREASE(enable bool) *Client {
+	return defaultClient.SetHTTP3GREASE(enable)
+}
+
+// SetHTTP3QPACKMaxTableCapacity is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP3QPACKMaxTableCapacity.
+func SetHTTP3QPACKMaxTableCapacity(capacity uint64) *Client {
+	return defaultClient.SetHTTP3QPACKMaxTableCapacity(capacity)
+}
+
+// SetHTTP3QPACKBlockedStreams is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP3QPACKBlockedStreams.
+func SetHTTP3QPACKBlockedStreams(streams uint64) *Client {
+	return defaultClient.SetHTTP3QPACKBlockedStreams(streams)
+}
+
+// SetMaxHTTP3FrameSize is a global wrapper methods which delegated
+// to the default client's Client.SetMaxHTTP3FrameSize.
+func SetMaxHTTP3FrameSize(size uint64) *Client {
+	return defaultClient.SetMaxHTTP3FrameSize(size)
+}
+
+// SetMaxDecompressedSize is a global wrapper methods which delegated
+// to the default client's Client.SetMaxDecompressedSize.
+func SetMaxDecompressedSize(size int64) *Client {
+	return defaultClient.SetMaxDecompressedSize(size)
+}
+
+// SetHTTP3UnknownFrameHandler is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP3UnknownFrameHandler.
+func SetHTTP3UnknownFrameHandler(fn func(frameType http3.FrameType, payload io.Reader) (processed bool, err error)) *Client {
+	return defaultClient.SetHTTP3UnknownFrameHandler(fn)
+}
+
+// SetHTTP2GoAwayHandler is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP2GoAwayHandler.
+func SetHTTP2GoAwayHandler(fn func(addr string, goAway http2.GoAway)) *Client {
+	return defaultClient.SetHTTP2GoAwayHandler(fn)
+}
+
+// SetHTTP3GoAwayHandler is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP3GoAwayHandler.
+func SetHTTP3GoAwayHandler(fn func(addr string, goAway http3.GoAway)) *Client {
+	return defaultClient.SetHTTP3GoAwayHandler(fn)
+}
+
+// SetHTTP3DatagramHandler is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP3DatagramHandler.
+func SetHTTP3DatagramHandler(fn func(stream quic.StreamID, payload []byte)) *Client {
+	return defaultClient.SetHTTP3DatagramHandler(fn)
+}
+
+// SendHTTP3Datagram is a global wrapper methods which delegated
+// to the default client's Client.SendHTTP3Datagram.
+func SendHTTP3Datagram(stream quic.StreamID, payload []byte) error {
+	return defaultClient.SendHTTP3Datagram(stream, payload)
+}
+
 // SetHTTP2ConnectionFlow is a global wrapper methods which delegated
 // to the default client's Client.SetHTTP2ConnectionFlow.
 func SetHTTP2ConnectionFlow(flow uint32) *Client {
 	return defaultClient.SetHTTP2ConnectionFlow(flow)
 }
 
+// GetHTTP2ConnectionFlow is a global wrapper methods which delegated
+// to the default client's Client.GetHTTP2ConnectionFlow.
+func GetHTTP2ConnectionFlow() uint32 {
+	return defaultClient.GetHTTP2ConnectionFlow()
+}
+
 // SetHTTP2HeaderPriority is a global wrapper methods which delegated
 // to the default client's Client.SetHTTP2HeaderPriority.
 func SetHTTP2HeaderPriority(priority http2.PriorityParam) *Client {
 	return defaultClient.SetHTTP2HeaderPriority(priority)
 }
 
+// GetHTTP2HeaderPriority is a global wrapper methods which delegated
+// to the default client's Client.GetHTTP2HeaderPriority.
+func GetHTTP2HeaderPriority() http2.PriorityParam {
+	return defaultClient.GetHTTP2HeaderPriority()
+}
+
 // SetHTTP2PriorityFrames is a global wrapper methods which delegated
 // to the default client's Client.SetHTTP2PriorityFrames.
 func SetHTTP2PriorityFrames(frames ...http2.PriorityFrame) *Client {
 	return defaultClient.SetHTTP2PriorityFrames(frames...)
 }
 
+// SetHTTP2SplitCookie is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP2SplitCookie.
+func SetHTTP2SplitCookie(split bool) *Client {
+	return defaultClient.SetHTTP2SplitCookie(split)
+}
+
+// SetHTTP2MaxHeaderFrameSize is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP2MaxHeaderFrameSize.
+func SetHTTP2MaxHeaderFrameSize(size uint32) *Client {
+	return defaultClient.SetHTTP2MaxHeaderFrameSize(size)
+}
+
+// SetHTTP2PriorityUpdate is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP2PriorityUpdate.
+func SetHTTP2PriorityUpdate(urgency int, incremental bool) *Client {
+	return defaultClient.SetHTTP2PriorityUpdate(urgency, incremental)
+}
+
+// DisableHTTP2PriorityUpdate is a global wrapper methods which delegated
+// to the default client's Client.DisableHTTP2PriorityUpdate.
+func DisableHTTP2PriorityUpdate() *Client {
+	return defaultClient.DisableHTTP2PriorityUpdate()
+}
+
+// GetHTTP2PriorityFrames is a global wrapper methods which delegated
+// to the default client's Client.GetHTTP2PriorityFrames.
+func GetHTTP2PriorityFrames() []http2.PriorityFrame {
+	return defaultClient.GetHTTP2PriorityFrames()
+}
+
 // SetHTTP2MaxHeaderListSize is a global wrapper methods which delegated
 // to the default client's Client.SetHTTP2MaxHeaderListSize.
 func SetHTTP2MaxHeaderListSize(max uint32) *Client {
@@ -489,6 +713,18 @@ func SetHTTP2PingTimeout(timeout time.Duration) *Client {
 	return defaultClient.SetHTTP2PingTimeout(timeout)
 }
 
+// SetHTTP2PingInterval is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP2PingInterval.
+func SetHTTP2PingInterval(interval time.Duration) *Client {
+	return defaultClient.SetHTTP2PingInterval(interval)
+}
+
+// SetHTTP2PingPayload is a global wrapper methods which delegated
+// to the default client's Client.SetHTTP2PingPayload.
+func SetHTTP2PingPayload(fn func(seq uint64) [8]byte) *Client {
+	return defaultClient.SetHTTP2PingPayload(fn)
+}
+
 // SetHTTP2WriteByteTimeout is a global wrapper methods which delegated
 // to the default client's Client.SetHTTP2WriteByteTimeout.
 func SetHTTP2WriteByteTimeout(timeout time.Duration) *Client {
@@ -501,18 +737,282 @@ func ImpersonateChrome() *Client {
 	return defaultClient.ImpersonateChrome()
 }
 
+// ImpersonateChrome100 is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateChrome100.
+func ImpersonateChrome100() *Client {
+	return defaultClient.ImpersonateChrome100()
+}
+
+// ImpersonateChrome102 is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateChrome102.
+func ImpersonateChrome102() *Client {
+	return defaultClient.ImpersonateChrome102()
+}
+
+// ImpersonateChrome106 is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateChrome106.
+func ImpersonateChrome106() *Client {
+	return defaultClient.ImpersonateChrome106()
+}
+
+// ImpersonateChrome112 is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateChrome112.
+func ImpersonateChrome112() *Client {
+	return defaultClient.ImpersonateChrome112()
+}
+
+// ImpersonateChrome114 is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateChrome114.
+func ImpersonateChrome114() *Client {
+	return defaultClient.ImpersonateChrome114()
+}
+
+// ImpersonateChrome115 is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateChrome115.
+func ImpersonateChrome115() *Client {
+	return defaultClient.ImpersonateChrome115()
+}
+
+// ImpersonateChrome120 is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateChrome120.
+func ImpersonateChrome120() *Client {
+	return defaultClient.ImpersonateChrome120()
+}
+
+// ImpersonateChrome131 is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateChrome131.
+func ImpersonateChrome131() *Client {
+	return defaultClient.ImpersonateChrome131()
+}
+
+// ImpersonateChromeVersion is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateChromeVersion.
+func ImpersonateChromeVersion(major int) *Client {
+	return defaultClient.ImpersonateChromeVersion(major)
+}
+
+// ImpersonateChromeAndroid is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateChromeAndroid.
+func ImpersonateChromeAndroid() *Client {
+	return defaultClient.ImpersonateChromeAndroid()
+}
+
+// ImpersonateChromeWindows is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateChromeWindows.
+func ImpersonateChromeWindows() *Client {
+	return defaultClient.ImpersonateChromeWindows()
+}
+
+// ImpersonateChromeHeadless is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateChromeHeadless.
+func ImpersonateChromeHeadless() *Client {
+	return defaultClient.ImpersonateChromeHeadless()
+}
+
+// ImpersonateEdge is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateEdge.
+func ImpersonateEdge() *Client {
+	return defaultClient.ImpersonateEdge()
+}
+
+// ImpersonateCustomEdge is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateCustomEdge.
+func ImpersonateCustomEdge(hdrs http.Header, rawClientHello []byte, headerOrder ...string) *Client {
+	return defaultClient.ImpersonateCustomEdge(hdrs, rawClientHello, headerOrder...)
+}
+
+// SetClientHintBrands is a global wrapper methods which delegated
+// to the default client's Client.SetClientHintBrands.
+func SetClientHintBrands(brands ...ClientHintBrand) *Client {
+	return defaultClient.SetClientHintBrands(brands...)
+}
+
+// ImpersonateBrave is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateBrave.
+func ImpersonateBrave() *Client {
+	return defaultClient.ImpersonateBrave()
+}
+
+// ImpersonateOpera is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateOpera.
+func ImpersonateOpera() *Client {
+	return defaultClient.ImpersonateOpera()
+}
+
+// ImpersonateCustomOpera is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateCustomOpera.
+func ImpersonateCustomOpera(hdrs http.Header, rawClientHello []byte, headerOrder ...string) *Client {
+	return defaultClient.ImpersonateCustomOpera(hdrs, rawClientHello, headerOrder...)
+}
+
 // ImpersonateChrome is a global wrapper methods which delegated
 // to the default client's Client.ImpersonateChrome.
 func ImpersonateFirefox() *Client {
 	return defaultClient.ImpersonateFirefox()
 }
 
+// ImpersonateFirefoxVersion is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateFirefoxVersion.
+func ImpersonateFirefoxVersion(major int) *Client {
+	return defaultClient.ImpersonateFirefoxVersion(major)
+}
+
+// ImpersonateFirefox133 is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateFirefox133.
+func ImpersonateFirefox133() *Client {
+	return defaultClient.ImpersonateFirefox133()
+}
+
+// ImpersonateTorBrowser is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateTorBrowser.
+func ImpersonateTorBrowser() *Client {
+	return defaultClient.ImpersonateTorBrowser()
+}
+
 // ImpersonateChrome is a global wrapper methods which delegated
 // to the default client's Client.ImpersonateChrome.
 func ImpersonateSafari() *Client {
 	return defaultClient.ImpersonateFirefox()
 }
 
+// ImpersonateSafari17 is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateSafari17.
+func ImpersonateSafari17() *Client {
+	return defaultClient.ImpersonateSafari17()
+}
+
+// ImpersonateSafari18 is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateSafari18.
+func ImpersonateSafari18() *Client {
+	return defaultClient.ImpersonateSafari18()
+}
+
+// ImpersonateCustomSafari is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateCustomSafari.
+func ImpersonateCustomSafari(hdrs http.Header, rawClientHello []byte, headerOrder ...string) *Client {
+	return defaultClient.ImpersonateCustomSafari(hdrs, rawClientHello, headerOrder...)
+}
+
+// ImpersonateSafariIOS is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateSafariIOS.
+func ImpersonateSafariIOS() *Client {
+	return defaultClient.ImpersonateSafariIOS()
+}
+
+// ImpersonateCustomSafariIOS is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateCustomSafariIOS.
+func ImpersonateCustomSafariIOS(hdrs http.Header, rawClientHello []byte, headerOrder ...string) *Client {
+	return defaultClient.ImpersonateCustomSafariIOS(hdrs, rawClientHello, headerOrder...)
+}
+
+// RequestFromHAR is a global wrapper methods which delegated
+// to the default client's Client.RequestFromHAR.
+func RequestFromHAR(entry HAREntry) (*Request, error) {
+	return defaultClient.RequestFromHAR(entry)
+}
+
+// ParseCurlCommand is a global wrapper methods which delegated
+// to the default client's Client.ParseCurlCommand.
+func ParseCurlCommand(cmd string) (*Request, error) {
+	return defaultClient.ParseCurlCommand(cmd)
+}
+
+// Impersonate is a global wrapper methods which delegated
+// to the default client's Client.Impersonate.
+func Impersonate(name string) error {
+	return defaultClient.Impersonate(name)
+}
+
+// ApplyProfile is a global wrapper methods which delegated
+// to the default client's Client.ApplyProfile.
+func ApplyProfile(p BrowserProfile) *Client {
+	return defaultClient.ApplyProfile(p)
+}
+
+// SetImpersonatePlatform is a global wrapper methods which delegated
+// to the default client's Client.SetImpersonatePlatform.
+func SetImpersonatePlatform(os string) *Client {
+	return defaultClient.SetImpersonatePlatform(os)
+}
+
+// SetImpersonateAcceptLanguage is a global wrapper methods which delegated
+// to the default client's Client.SetImpersonateAcceptLanguage.
+func SetImpersonateAcceptLanguage(langs ...string) *Client {
+	return defaultClient.SetImpersonateAcceptLanguage(langs...)
+}
+
+// SetImpersonateAcceptLanguageRotation is a global wrapper methods which delegated
+// to the default client's Client.SetImpersonateAcceptLanguageRotation.
+func SetImpersonateAcceptLanguageRotation(choices ...AcceptLanguageChoice) *Client {
+	return defaultClient.SetImpersonateAcceptLanguageRotation(choices...)
+}
+
+// SetImpersonateRotation is a global wrapper methods which delegated
+// to the default client's Client.SetImpersonateRotation.
+func SetImpersonateRotation(profiles ...string) *Client {
+	return defaultClient.SetImpersonateRotation(profiles...)
+}
+
+// SetImpersonateLogger is a global wrapper methods which delegated
+// to the default client's Client.SetImpersonateLogger.
+func SetImpersonateLogger(fn func(ImpersonateLogEntry)) *Client {
+	return defaultClient.SetImpersonateLogger(fn)
+}
+
+// SetImpersonateSeed is a global wrapper methods which delegated
+// to the default client's Client.SetImpersonateSeed.
+func SetImpersonateSeed(seed int64) *Client {
+	return defaultClient.SetImpersonateSeed(seed)
+}
+
+// SetImpersonateExtraHeader is a global wrapper methods which delegated
+// to the default client's Client.SetImpersonateExtraHeader.
+func SetImpersonateExtraHeader(name, value, afterHeader string) *Client {
+	return defaultClient.SetImpersonateExtraHeader(name, value, afterHeader)
+}
+
+// RemoveImpersonateHeader is a global wrapper methods which delegated
+// to the default client's Client.RemoveImpersonateHeader.
+func RemoveImpersonateHeader(name string) *Client {
+	return defaultClient.RemoveImpersonateHeader(name)
+}
+
+// DisableImpersonateTETrailers is a global wrapper methods which delegated
+// to the default client's Client.DisableImpersonateTETrailers.
+func DisableImpersonateTETrailers() *Client {
+	return defaultClient.DisableImpersonateTETrailers()
+}
+
+// EnableImpersonateTETrailers is a global wrapper methods which delegated
+// to the default client's Client.EnableImpersonateTETrailers.
+func EnableImpersonateTETrailers() *Client {
+	return defaultClient.EnableImpersonateTETrailers()
+}
+
+// SetImpersonateUserAgent is a global wrapper methods which delegated
+// to the default client's Client.SetImpersonateUserAgent.
+func SetImpersonateUserAgent(ua string) *Client {
+	return defaultClient.SetImpersonateUserAgent(ua)
+}
+
+// SetImpersonateClientHints is a global wrapper methods which delegated
+// to the default client's Client.SetImpersonateClientHints.
+func SetImpersonateClientHints(hints ClientHints) *Client {
+	return defaultClient.SetImpersonateClientHints(hints)
+}
+
+// SetClientHintsAuto is a global wrapper methods which delegated
+// to the default client's Client.SetClientHintsAuto.
+func SetClientHintsAuto(enable bool) *Client {
+	return defaultClient.SetClientHintsAuto(enable)
+}
+
+// ImpersonateFetchMode is a global wrapper methods which delegated
+// to the default client's Client.ImpersonateFetchMode.
+func ImpersonateFetchMode(mode string) *Client {
+	return defaultClient.ImpersonateFetchMode(mode)
+}
+
 // SetCommonContentType is a global wrapper methods which delegated
 // to the default client's Client.SetCommonContentType.
 func SetCommonContentType(ct string) *Client {
@@ -555,6 +1055,24 @@ func SetProxyURL(proxyUrl string) *Client {
 	return defaultClient.SetProxyURL(proxyUrl)
 }
 
+// SetProxySelector is a global wrapper methods which delegated
+// to the default client's Client.SetProxySelector.
+func SetProxySelector(fn func(r *Request) *url.URL) *Client {
+	return defaultClient.SetProxySelector(fn)
+}
+
+// SetProxyConnectHeader is a global wrapper methods which delegated
+// to the default client's Client.SetProxyConnectHeader.
+func SetProxyConnectHeader(hdr http.Header) *Client {
+	return defaultClient.SetProxyConnectHeader(hdr)
+}
+
+// SetProxyConnectHeaderFunc is a global wrapper methods which delegated
+// to the default client's Client.SetProxyConnectHeaderFunc.
+func SetProxyConnectHeaderFunc(fn func(ctx context.Context, proxyURL *url.URL, target string) (http.Header, error)) *Client {
+	return defaultClient.SetProxyConnectHeaderFunc(fn)
+}
+
 // DisableTraceAll is a global wrapper methods which delegated
 // to the default client's Client.DisableTraceAll.
 func DisableTraceAll() *Client {
@@ -747,6 +1265,108 @@ func SetTLSFingerprint(clientHelloID utls.ClientHelloID) *Client {
 	return defaultClient.SetTLSFingerprint(clientHelloID)
 }
 
+// SetTLSClientHelloSpec is a global wrapper methods which delegated
+// to the default client's Client.SetTLSClientHelloSpec.
+func SetTLSClientHelloSpec(spec *utls.ClientHelloSpec) *Client {
+	return defaultClient.SetTLSClientHelloSpec(spec)
+}
+
+// SetTLSFingerprintFromJA3 is a global wrapper methods which delegated
+// to the default client's Client.SetTLSFingerprintFromJA3.
+func SetTLSFingerprintFromJA3(ja3 string) error {
+	return defaultClient.SetTLSFingerprintFromJA3(ja3)
+}
+
+// SetTLSFingerprintFromJA4 is a global wrapper methods which delegated
+// to the default client's Client.SetTLSFingerprintFromJA4.
+func SetTLSFingerprintFromJA4(ja4 string) error {
+	return defaultClient.SetTLSFingerprintFromJA4(ja4)
+}
+
+// SetTLSSessionResumption is a global wrapper methods which delegated
+// to the default client's Client.SetTLSSessionResumption.
+func SetTLSSessionResumption(enable bool) *Client {
+	return defaultClient.SetTLSSessionResumption(enable)
+}
+
+// SetALPN is a global wrapper methods which delegated
+// to the default client's Client.SetALPN.
+func SetALPN(protocols ...string) *Client {
+	return defaultClient.SetALPN(protocols...)
+}
+
+// SetECH is a global wrapper methods which delegated
+// to the default client's Client.SetECH.
+func SetECH(configList []byte) *Client {
+	return defaultClient.SetECH(configList)
+}
+
+// SetGREASEECH is a global wrapper methods which delegated
+// to the default client's Client.SetGREASEECH.
+func SetGREASEECH(enable bool) *Client {
+	return defaultClient.SetGREASEECH(enable)
+}
+
+// SetGREASEDeterministic is a global wrapper methods which delegated
+// to the default client's Client.SetGREASEDeterministic.
+func SetGREASEDeterministic(seed int64) *Client {
+	return defaultClient.SetGREASEDeterministic(seed)
+}
+
+// SetCustomTLSFingerprint is a global wrapper methods which delegated
+// to the default client's Client.SetCustomTLSFingerprint.
+func SetCustomTLSFingerprint(rawClientHello []byte) *Client {
+	return defaultClient.SetCustomTLSFingerprint(rawClientHello)
+}
+
+// SetCustomTLSFingerprintBase64 is a global wrapper methods which delegated
+// to the default client's Client.SetCustomTLSFingerprintBase64.
+func SetCustomTLSFingerprintBase64(s string) error {
+	return defaultClient.SetCustomTLSFingerprintBase64(s)
+}
+
+// SetCustomTLSFingerprintHex is a global wrapper methods which delegated
+// to the default client's Client.SetCustomTLSFingerprintHex.
+func SetCustomTLSFingerprintHex(s string) error {
+	return defaultClient.SetCustomTLSFingerprintHex(s)
+}
+
+// SetClientHelloObserver is a global wrapper methods which delegated
+// to the default client's Client.SetClientHelloObserver.
+func SetClientHelloObserver(fn func(raw []byte)) *Client {
+	return defaultClient.SetClientHelloObserver(fn)
+}
+
+// SetTLSHandshakeObserver is a global wrapper methods which delegated
+// to the default client's Client.SetTLSHandshakeObserver.
+func SetTLSHandshakeObserver(fn func(state utls.ConnectionState)) *Client {
+	return defaultClient.SetTLSHandshakeObserver(fn)
+}
+
+// JA3 is a global wrapper methods which delegated
+// to the default client's Client.JA3.
+func JA3() (string, error) {
+	return defaultClient.JA3()
+}
+
+// JA3Hash is a global wrapper methods which delegated
+// to the default client's Client.JA3Hash.
+func JA3Hash() (string, error) {
+	return defaultClient.JA3Hash()
+}
+
+// JA4 is a global wrapper methods which delegated
+// to the default client's Client.JA4.
+func JA4() (string, error) {
+	return defaultClient.JA4()
+}
+
+// VerifyFingerprint is a global wrapper methods which delegated
+// to the default client's Client.VerifyFingerprint.
+func VerifyFingerprint(addr string) (FingerprintReport, error) {
+	return defaultClient.VerifyFingerprint(addr)
+}
+
 // SetTLSFingerprintRandomized is a global wrapper methods which delegated
 // to the default client's Client.SetTLSFingerprintRandomized.
 func SetTLSFingerprintRandomized() *Client {
@@ -807,6 +1427,24 @@ func GetClient() *http.Client {
 	return defaultClient.GetClient()
 }
 
+// DialWebSocket is a global wrapper methods which delegated
+// to the default client's Client.DialWebSocket.
+func DialWebSocket(url string) (*WebSocketConn, error) {
+	return defaultClient.DialWebSocket(url)
+}
+
+// ExtendedConnect is a global wrapper methods which delegated
+// to the default client's Client.ExtendedConnect.
+func ExtendedConnect(authority, protocol string) (io.ReadWriteCloser, error) {
+	return defaultClient.ExtendedConnect(authority, protocol)
+}
+
+// DialWebTransport is a global wrapper methods which delegated
+// to the default client's Client.DialWebTransport.
+func DialWebTransport(url string) (*WebTransportSession, error) {
+	return defaultClient.DialWebTransport(url)
+}
+
 // NewRequest is a global wrapper methods which delegated
 // to the default client's Client.NewRequest.
 func NewRequest() *Request {
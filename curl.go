@@ -0,0 +1,479 @@
+package req
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	urlpkg "net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/imroc/req/v3/internal/header"
+)
+
+// ParseCurlCommand parses the curl command (e.g. the one copied with "Copy as
+// cURL" from the browser devtools) into a request of the client, the headers
+// are sent in the order they appear in the command. Both the bash and the
+// cmd.exe quoting are supported, and the supported options are -X, -H, -d,
+// --data, --data-raw, --data-binary, --data-ascii, -b, -A, -e, -u, -I and the
+// options without effect on the request such as --compressed, -k, -L, -s and
+// --http2, an error is returned for the other options.
+func (c *Client) ParseCurlCommand(cmd string) (*Request, error) {
+	args, err := splitCurlCommand(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 || args[0] != "curl" && args[0] != "curl.exe" {
+		return nil, errors.New("not a curl command")
+	}
+	r := c.R()
+	r.Headers = make(http.Header)
+	var order, data []string
+	var url string
+	addHeader := func(key, value string) {
+		order = append(order, strings.ToLower(key))
+		r.Headers.Add(key, value)
+	}
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		if !strings.HasPrefix(arg, "-") {
+			url = arg
+			continue
+		}
+		if _, ok := curlNoValueOptions[arg]; ok {
+			if arg == "-I" || arg == "--head" {
+				r.Method = http.MethodHead
+			}
+			continue
+		}
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || !strings.HasPrefix(name, "--") {
+			// the value of short option or the option without "="
+			// is the next argument.
+			name = arg
+			if len(name) > 2 && !strings.HasPrefix(name, "--") {
+				name, value = arg[:2], arg[2:]
+			} else {
+				i++
+				if i >= len(args) {
+					return nil, fmt.Errorf("missing value of curl option %s", arg)
+				}
+				value = args[i]
+			}
+		}
+		switch name {
+		case "-X", "--request":
+			r.Method = strings.ToUpper(value)
+		case "-H", "--header":
+			key, val, ok := strings.Cut(value, ":")
+			if !ok {
+				return nil, fmt.Errorf("malformed header %q in curl command", value)
+			}
+			addHeader(strings.TrimSpace(key), strings.TrimSpace(val))
+		case "-d", "--data", "--data-ascii", "--data-binary":
+			if strings.HasPrefix(value, "@") {
+				return nil, fmt.Errorf("reading data from file %s is not supported", value[1:])
+			}
+			data = append(data, value)
+		case "--data-raw":
+			data = append(data, value)
+		case "-b", "--cookie":
+			addHeader("Cookie", value)
+		case "-A", "--user-agent":
+			addHeader("User-Agent", value)
+		case "-e", "--referer":
+			addHeader("Referer", value)
+		case "-u", "--user":
+			username, password, _ := strings.Cut(value, ":")
+			r.SetBasicAuth(username, password)
+		case "--url":
+			url = value
+		default:
+			return nil, fmt.Errorf("unsupported curl option %s", name)
+		}
+	}
+	if url == "" {
+		return nil, errors.New("missing url in curl command")
+	}
+	r.SetURL(url)
+	if len(data) > 0 {
+		if r.Method == "" {
+			r.Method = http.MethodPost
+		}
+		r.SetBodyString(strings.Join(data, "&"))
+		if r.Headers.Get(header.ContentType) == "" {
+			r.SetContentType(header.FormContentType)
+		}
+	} else if r.Method == "" {
+		r.Method = http.MethodGet
+	}
+	if order, _ = normalizeHeaderOrder(order); len(order) > 0 {
+		r.SetHeaderOrder(order...)
+	}
+	return r, nil
+}
+
+// curlNoValueOptions is the curl options without value which are supported.
+var curlNoValueOptions = map[string]struct{}{
+	"--compressed": {},
+	"-k":           {},
+	"--insecure":   {},
+	"-L":           {},
+	"--location":   {},
+	"-s":           {},
+	"--silent":     {},
+	"-i":           {},
+	"--include":    {},
+	"-v":           {},
+	"--verbose":    {},
+	"--http1.1":    {},
+	"--http2":      {},
+	"--http3":      {},
+	"-I":           {},
+	"--head":       {},
+}
+
+// splitCurlCommand splits the curl command into arguments, the cmd.exe quoting
+// is used if the command contains the cmd.exe escape character (^) before a
+// quote or at the end of a line, otherwise the bash quoting is used.
+func splitCurlCommand(cmd string) ([]string, error) {
+	if strings.Contains(cmd, `^"`) || strings.Contains(cmd, "^\n") || strings.Contains(cmd, "^\r\n") {
+		return splitCmdCommand(cmd)
+	}
+	return splitBashCommand(cmd)
+}
+
+// splitBashCommand splits the command with the bash quoting, which supports the
+// single quotes, the double quotes, the ANSI-C quotes ($'...'), the backslash
+// escape and the line continuation.
+func splitBashCommand(cmd string) ([]string, error) {
+	var args []string
+	var sb strings.Builder
+	inArg := false
+	for i := 0; i < len(cmd); i++ {
+		ch := cmd[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			if inArg {
+				args = append(args, sb.String())
+				sb.Reset()
+				inArg = false
+			}
+		case ch == '\\':
+			i++
+			if i < len(cmd) && cmd[i] == '\r' && i+1 < len(cmd) && cmd[i+1] == '\n' {
+				i++
+			}
+			if i < len(cmd) && cmd[i] != '\n' {
+				sb.WriteByte(cmd[i])
+				inArg = true
+			}
+		case ch == '\'':
+			end := strings.IndexByte(cmd[i+1:], '\'')
+			if end < 0 {
+				return nil, errors.New("unterminated single quote in curl command")
+			}
+			sb.WriteString(cmd[i+1 : i+1+end])
+			i += end + 1
+			inArg = true
+		case ch == '$' && i+1 < len(cmd) && cmd[i+1] == '\'':
+			n, err := readANSICQuoted(cmd[i+2:], &sb)
+			if err != nil {
+				return nil, err
+			}
+			i += n + 2
+			inArg = true
+		case ch == '"':
+			i++
+			for ; i < len(cmd) && cmd[i] != '"'; i++ {
+				if cmd[i] == '\\' && i+1 < len(cmd) && strings.IndexByte("\"\\$`\n", cmd[i+1]) >= 0 {
+					i++
+					if cmd[i] == '\n' {
+						continue
+					}
+				}
+				sb.WriteByte(cmd[i])
+			}
+			if i >= len(cmd) {
+				return nil, errors.New("unterminated double quote in curl command")
+			}
+			inArg = true
+		default:
+			sb.WriteByte(ch)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, sb.String())
+	}
+	return args, nil
+}
+
+// readANSICQuoted reads the content of the ANSI-C quotes ($'...') from s which
+// is right after the opening quote, and returns the number of bytes read
+// including the closing quote.
+func readANSICQuoted(s string, sb *strings.Builder) (int, error) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'':
+			return i + 1, nil
+		case '\\':
+			i++
+			if i >= len(s) {
+				break
+			}
+			switch s[i] {
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r':
+				sb.WriteByte('\r')
+			case 't':
+				sb.WriteByte('\t')
+			case 'x':
+				if i+2 < len(s) {
+					var b byte
+					if _, err := fmt.Sscanf(s[i+1:i+3], "%02x", &b); err == nil {
+						sb.WriteByte(b)
+						i += 2
+						continue
+					}
+				}
+				sb.WriteString(`\x`)
+			case 'u':
+				if i+4 < len(s) {
+					var r rune
+					if _, err := fmt.Sscanf(s[i+1:i+5], "%04x", &r); err == nil {
+						sb.WriteRune(r)
+						i += 4
+						continue
+					}
+				}
+				sb.WriteString(`\u`)
+			default:
+				sb.WriteByte(s[i])
+			}
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return 0, errors.New("unterminated ANSI-C quote in curl command")
+}
+
+// splitCmdCommand splits the command with the cmd.exe quoting used by the
+// browser devtools, where the ^ escapes the next character or continues the
+// line, the double quotes (escaped or not) quote the argument, and the \"
+// is a literal double quote.
+func splitCmdCommand(cmd string) ([]string, error) {
+	var args []string
+	var sb strings.Builder
+	inArg, inQuote := false, false
+	for i := 0; i < len(cmd); i++ {
+		ch := cmd[i]
+		switch {
+		case !inQuote && (ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'):
+			if inArg {
+				args = append(args, sb.String())
+				sb.Reset()
+				inArg = false
+			}
+		case ch == '\\' && strings.HasPrefix(cmd[i+1:], `^"`):
+			sb.WriteByte('"')
+			i += 2
+		case ch == '\\' && strings.HasPrefix(cmd[i+1:], `"`):
+			sb.WriteByte('"')
+			i++
+		case ch == '^':
+			i++
+			if i >= len(cmd) {
+				break
+			}
+			switch cmd[i] {
+			case '"':
+				inQuote = !inQuote
+				inArg = true
+			case '\r':
+				if i+1 < len(cmd) && cmd[i+1] == '\n' {
+					i++
+				}
+			case '\n':
+			default:
+				sb.WriteByte(cmd[i])
+				inArg = true
+			}
+		case ch == '"':
+			inQuote = !inQuote
+			inArg = true
+		default:
+			sb.WriteByte(ch)
+			inArg = true
+		}
+	}
+	if inQuote {
+		return nil, errors.New("unterminated double quote in curl command")
+	}
+	if inArg {
+		args = append(args, sb.String())
+	}
+	return args, nil
+}
+
+// ToCurl returns the curl command (in the bash quoting) equivalent to the
+// request, which reflects the headers that will actually be sent, including the
+// common headers of the client or the impersonated browser, and the headers in
+// the configured order come first. The body is written with --data-raw, and the
+// multipart fields and files are written with -F without reading the files, the
+// body which is not in memory (e.g. an io.Reader) is omitted.
+func (r *Request) ToCurl() string {
+	c := r.client
+	rr := *r
+	rr.Headers = r.Headers.Clone()
+	rr.Cookies = cloneSlice(r.Cookies)
+	rr.FormData = cloneUrlValues(r.FormData)
+	parseRequestHeader(c, &rr)
+	parseRequestCookie(c, &rr)
+	url := rr.RawURL
+	if parseRequestURL(c, &rr) == nil {
+		url = rr.URL.String()
+	}
+	method := rr.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	var forms []string
+	if rr.isMultiPart && !c.isPayloadForbid(method) {
+		if len(rr.FormData) > 0 {
+			for _, k := range sortedKeys(rr.FormData) {
+				for _, v := range rr.FormData[k] {
+					forms = append(forms, k+"="+v)
+				}
+			}
+		} else {
+			for i := 0; i+1 < len(rr.OrderedFormData); i += 2 {
+				forms = append(forms, rr.OrderedFormData[i]+"="+rr.OrderedFormData[i+1])
+			}
+		}
+		for _, f := range rr.uploadFiles {
+			form := f.ParamName + "=@" + f.FileName
+			if f.ContentType != "" {
+				form += ";type=" + f.ContentType
+			}
+			forms = append(forms, form)
+		}
+		// the content type with boundary is generated by curl.
+		if rr.Headers != nil {
+			rr.Headers.Del(header.ContentType)
+		}
+		rr.Body = nil
+	} else {
+		parseRequestBody(c, &rr)
+	}
+	if len(rr.Cookies) > 0 {
+		if rr.Headers == nil {
+			rr.Headers = make(http.Header)
+		}
+		req := &http.Request{Header: rr.Headers}
+		for _, cookie := range rr.Cookies {
+			req.AddCookie(cookie)
+		}
+	}
+
+	order := rr.Headers[HeaderOderKey]
+	if len(order) == 0 {
+		order = c.requestHeaderOrder(&rr)
+	}
+	keys := make([]string, 0, len(rr.Headers))
+	for k := range rr.Headers {
+		if k != HeaderOderKey && k != PseudoHeaderOderKey && k != HeaderCasingKey {
+			keys = append(keys, k)
+		}
+	}
+	rank := func(k string) int {
+		for i, key := range order {
+			if strings.EqualFold(key, k) {
+				return i
+			}
+		}
+		return len(order)
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		ri, rj := rank(keys[i]), rank(keys[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return keys[i] < keys[j]
+	})
+
+	args := []string{"curl " + bashQuote(url)}
+	hasBody := len(rr.Body) > 0 || len(forms) > 0
+	switch {
+	case method == http.MethodHead:
+		args = append(args, "--head")
+	case method == http.MethodGet && !hasBody, method == http.MethodPost && hasBody:
+	default:
+		args = append(args, "-X "+bashQuote(method))
+	}
+	casing := header.CasingMap(rr.Headers[HeaderCasingKey])
+	for _, k := range keys {
+		name := k
+		if cased, ok := casing[strings.ToLower(k)]; ok {
+			name = cased
+		}
+		for _, v := range rr.Headers[k] {
+			args = append(args, "-H "+bashQuote(name+": "+v))
+		}
+	}
+	for _, form := range forms {
+		args = append(args, "-F "+bashQuote(form))
+	}
+	if len(rr.Body) > 0 {
+		args = append(args, "--data-raw "+bashQuote(string(rr.Body)))
+	}
+	return strings.Join(args, " \\\n  ")
+}
+
+// sortedKeys returns the sorted keys of the url values.
+func sortedKeys(v urlpkg.Values) []string {
+	keys := make([]string, 0, len(v))
+	for k := range v {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// bashQuote quotes s for bash with the single quotes, or with the ANSI-C quotes
+// ($'...') if s contains the control characters or invalid UTF-8.
+func bashQuote(s string) string {
+	plain := utf8.ValidString(s)
+	for i := 0; plain && i < len(s); i++ {
+		if s[i] < 0x20 || s[i] == 0x7f {
+			plain = false
+		}
+	}
+	if plain {
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	}
+	var sb strings.Builder
+	sb.WriteString("$'")
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; {
+		case ch == '\\' || ch == '\'':
+			sb.WriteByte('\\')
+			sb.WriteByte(ch)
+		case ch == '\n':
+			sb.WriteString(`\n`)
+		case ch == '\r':
+			sb.WriteString(`\r`)
+		case ch == '\t':
+			sb.WriteString(`\t`)
+		case ch < 0x20 || ch >= 0x7f:
+			fmt.Fprintf(&sb, `\x%02x`, ch)
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	sb.WriteByte('\'')
+	return sb.String()
+}
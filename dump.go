@@ -1,9 +1,16 @@
 package req
 
 import (
-	"github.com/imroc/req/v3/internal/dump"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
 	"io"
+	"net"
 	"os"
+	"strings"
+
+	"github.com/imroc/req/v3/internal/dump"
 )
 
 // DumpOptions controls the dump behavior.
@@ -20,6 +27,13 @@ type DumpOptions struct {
 	ResponseHeader       bool
 	ResponseBody         bool
 	Async                bool
+	// TLS dumps the TLS ClientHello of the new connections, which is
+	// written to Output.
+	TLS bool
+	// HTTP2Frames dumps the http2 frames sent (prefixed with "> ") and
+	// received (prefixed with "< ") on the connections, which is written to
+	// Output. It only takes effect on the client-level dump.
+	HTTP2Frames bool
 }
 
 // Clone return a copy of DumpOptions
@@ -102,6 +116,14 @@ func (o dumpOptions) Async() bool {
 	return o.DumpOptions.Async
 }
 
+func (o dumpOptions) TLS() bool {
+	return o.DumpOptions.TLS
+}
+
+func (o dumpOptions) HTTP2Frames() bool {
+	return o.DumpOptions.HTTP2Frames
+}
+
 func (o dumpOptions) Clone() dump.Options {
 	return dumpOptions{o.DumpOptions.Clone()}
 }
@@ -125,3 +147,91 @@ func newDumper(opt *DumpOptions) *dump.Dumper {
 	}
 	return dump.NewDumper(dumpOptions{opt})
 }
+
+// wrapClientHelloDump wraps the conn to dump the TLS ClientHello written to
+// it if the TLS dump is enabled.
+func (t *Transport) wrapClientHelloDump(ctx context.Context, conn net.Conn) net.Conn {
+	var dumps []*dump.Dumper
+	for _, d := range dump.GetDumpers(ctx, t.Dump) {
+		if d.TLS() {
+			dumps = append(dumps, d)
+		}
+	}
+	if len(dumps) == 0 {
+		return conn
+	}
+	return &clientHelloDumpConn{Conn: conn, dumps: dumps}
+}
+
+// clientHelloDumpConn dumps the TLS ClientHello written to the conn.
+type clientHelloDumpConn struct {
+	net.Conn
+	dumps []*dump.Dumper
+	buf   []byte
+	done  bool
+}
+
+func (c *clientHelloDumpConn) Write(p []byte) (int, error) {
+	if !c.done {
+		c.buf = append(c.buf, p...)
+		if raw, msg, ok := readClientHelloRecords(c.buf); ok {
+			c.done = true
+			c.buf = nil
+			if raw != nil {
+				b := formatClientHelloDump(raw, msg)
+				for _, d := range c.dumps {
+					d.DumpDefault(b)
+				}
+			}
+		}
+	}
+	return c.Conn.Write(p)
+}
+
+// readClientHelloRecords reads the TLS records of the ClientHello from b,
+// returns the records and the ClientHello message, ok is false if more
+// data is needed. raw is nil if b does not start with a ClientHello.
+func readClientHelloRecords(b []byte) (raw, msg []byte, ok bool) {
+	off := 0
+	for {
+		if len(b) < off+5 {
+			return nil, nil, false
+		}
+		if b[off] != 0x16 { // not a handshake record
+			return nil, nil, true
+		}
+		n := int(binary.BigEndian.Uint16(b[off+3:]))
+		if len(b) < off+5+n {
+			return nil, nil, false
+		}
+		msg = append(msg, b[off+5:off+5+n]...)
+		off += 5 + n
+		if len(msg) < 4 {
+			continue
+		}
+		if msg[0] != 1 { // not a ClientHello
+			return nil, nil, true
+		}
+		if size := 4 + (int(msg[1])<<16 | int(msg[2])<<8 | int(msg[3])); len(msg) >= size {
+			return b[:off], msg[:size], true
+		}
+	}
+}
+
+// formatClientHelloDump formats the summary and the hex dump of the TLS
+// records of the ClientHello.
+func formatClientHelloDump(raw, msg []byte) []byte {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "TLS ClientHello (%d bytes)\r\n", len(raw))
+	if info, err := parseClientHelloInfo(msg); err == nil {
+		if info.serverName != "" {
+			fmt.Fprintf(&sb, "server name: %s\r\n", info.serverName)
+		}
+		fmt.Fprintf(&sb, "alpn: %s\r\n", strings.Join(info.alpnProtocols, ", "))
+		fmt.Fprintf(&sb, "ja3: %s\r\n", info.ja3())
+		fmt.Fprintf(&sb, "ja4: %s\r\n", info.ja4())
+	}
+	sb.WriteString(hex.Dump(raw))
+	sb.WriteString("\r\n")
+	return []byte(sb.String())
+}
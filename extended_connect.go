@@ -0,0 +1,126 @@
+package req
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	h2internal "github.com/imroc/req/v3/internal/http2"
+	h3internal "github.com/imroc/req/v3/internal/http3"
+)
+
+// ExtendedConnect opens a bidirectional stream to the authority ("host:port")
+// with the extended CONNECT, whose :protocol pseudo header is the protocol,
+// e.g. "websocket" or "webtransport", see RFC 8441 for http2 and RFC 9220 for
+// http3. The request is sent with the tls fingerprint and the common headers
+// of the client, on the cached http2 or http3 connection to the authority if
+// any, otherwise a new http2 connection is dialed, call EnableForceHTTP3 to
+// dial http3 instead.
+//
+// http2.ErrExtendedConnectNotSupported or http3.ErrExtendedConnectNotSupported
+// is returned if the server did not enable SETTINGS_ENABLE_CONNECT_PROTOCOL,
+// and an error is returned if the status code of the response is not 2xx.
+// Writes to the returned stream are sent as the request body, reads are from
+// the response body, and Close closes both of them. The timeout of the client
+// is not applied, as it would close the stream.
+func (c *Client) ExtendedConnect(authority, protocol string) (io.ReadWriteCloser, error) {
+	if authority == "" || protocol == "" {
+		return nil, errors.New("authority and protocol are required for extended CONNECT")
+	}
+	r := c.R().DisableAutoReadResponse()
+	r.extendedConnectProtocol = protocol
+	resp, err := r.Send(http.MethodConnect, "https://"+authority)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("extended CONNECT failed: %s", resp.Status)
+	}
+	rwc, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, errors.New("the response body of extended CONNECT is not writable")
+	}
+	return rwc, nil
+}
+
+// isExtendedConnectRequest reports whether req is an extended CONNECT request,
+// whose protocol is carried by req.Proto.
+func isExtendedConnectRequest(req *http.Request) bool {
+	return req.Method == http.MethodConnect && req.Proto != "" && req.Proto != "HTTP/1.1"
+}
+
+// roundTripExtendedConnect sends the extended CONNECT request with http2 or
+// http3, the cached connections are preferred unless the http version is
+// forced. The handshake of DialWebTransport is sent with the dedicated http3
+// transport of the session.
+func (t *Transport) roundTripExtendedConnect(req *http.Request, forceHttpVersion httpVersion) (*http.Response, error) {
+	if t3, ok := req.Context().Value(webTransportKey).(*h3internal.Transport); ok {
+		return sendExtendedConnect(t3, req)
+	}
+	var rt http.RoundTripper
+	switch forceHttpVersion {
+	case h1:
+		closeBody(req)
+		return nil, errors.New("extended CONNECT requires http2 or http3")
+	case h2:
+		rt = t.t2
+	case h3:
+		if t.t3 == nil {
+			closeBody(req)
+			return nil, errors.New("http3 is not enabled")
+		}
+		rt = t.t3
+	default:
+		rt = HttpRoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := t.t2.RoundTripOnlyCachedConn(req)
+			if err != h2internal.ErrNoCachedConn {
+				return resp, err
+			}
+			if t.t3 != nil {
+				resp, err = t.t3.RoundTripOnlyCachedConn(req)
+				if err != h3internal.ErrNoCachedConn {
+					return resp, err
+				}
+			}
+			return t.t2.RoundTrip(req)
+		})
+	}
+	return sendExtendedConnect(rt, req)
+}
+
+// sendExtendedConnect sends the extended CONNECT request with rt, the request
+// body is a pipe which is written by the response body.
+func sendExtendedConnect(rt http.RoundTripper, req *http.Request) (*http.Response, error) {
+	closeBody(req)
+	pr, pw := io.Pipe()
+	r := *req
+	r.Body = pr
+	r.GetBody = nil
+	r.ContentLength = -1
+	resp, err := rt.RoundTrip(&r)
+	if err != nil {
+		pw.Close()
+		return nil, err
+	}
+	resp.Body = &extendedConnectBody{ReadCloser: resp.Body, w: pw}
+	return resp, nil
+}
+
+// extendedConnectBody is the response body of the extended CONNECT, which
+// writes to the request body.
+type extendedConnectBody struct {
+	io.ReadCloser
+	w *io.PipeWriter
+}
+
+func (b *extendedConnectBody) Write(p []byte) (int, error) {
+	return b.w.Write(p)
+}
+
+func (b *extendedConnectBody) Close() error {
+	b.w.Close()
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,158 @@
+package req
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/imroc/req/v3/http2"
+	"github.com/imroc/req/v3/internal/testcert"
+	"github.com/imroc/req/v3/internal/tests"
+	quichttp3 "github.com/quic-go/quic-go/http3"
+	xhttp2 "golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// startExtendedConnectServer starts a http2 server which echoes the body of
+// the extended CONNECT, the :protocol of the requests are sent to the
+// returned channel. SETTINGS_ENABLE_CONNECT_PROTOCOL is sent if enable is
+// true.
+func startExtendedConnectServer(t *testing.T, enable bool) (string, chan string) {
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	tests.AssertNoError(t, err)
+	ln := tests.NewLocalListener(t)
+	t.Cleanup(func() { ln.Close() })
+	protocols := make(chan string, 10)
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2"}})
+		preface := make([]byte, len(xhttp2.ClientPreface))
+		if _, err := io.ReadFull(tlsConn, preface); err != nil {
+			return
+		}
+		fr := xhttp2.NewFramer(tlsConn, tlsConn)
+		var settings []xhttp2.Setting
+		if enable {
+			settings = append(settings, xhttp2.Setting{ID: 0x8, Val: 1})
+		}
+		fr.WriteSettings(settings...)
+		dec := hpack.NewDecoder(4096, nil)
+		for {
+			f, err := fr.ReadFrame()
+			if err != nil {
+				return
+			}
+			switch f := f.(type) {
+			case *xhttp2.SettingsFrame:
+				if !f.IsAck() {
+					fr.WriteSettingsAck()
+				}
+			case *xhttp2.HeadersFrame:
+				fields, err := dec.DecodeFull(f.HeaderBlockFragment())
+				if err != nil {
+					return
+				}
+				for _, field := range fields {
+					if field.Name == ":protocol" {
+						protocols <- field.Value
+					}
+				}
+				var hbuf bytes.Buffer
+				hpack.NewEncoder(&hbuf).WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+				fr.WriteHeaders(xhttp2.HeadersFrameParam{StreamID: f.StreamID, BlockFragment: hbuf.Bytes(), EndHeaders: true})
+			case *xhttp2.DataFrame:
+				if n := len(f.Data()); n > 0 {
+					fr.WriteData(f.StreamID, false, f.Data())
+					fr.WriteWindowUpdate(0, uint32(n))
+					fr.WriteWindowUpdate(f.StreamID, uint32(n))
+				}
+			}
+		}
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return ln.Addr().String(), protocols
+}
+
+func testExtendedConnectEcho(t *testing.T, rwc io.ReadWriteCloser) {
+	for _, msg := range []string{"hello", "world"} {
+		_, err := rwc.Write([]byte(msg))
+		tests.AssertNoError(t, err)
+		b := make([]byte, len(msg))
+		_, err = io.ReadFull(rwc, b)
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, msg, string(b))
+	}
+	tests.AssertNoError(t, rwc.Close())
+}
+
+func TestExtendedConnect(t *testing.T) {
+	addr, protocols := startExtendedConnectServer(t, true)
+	c := tc().ImpersonateChrome()
+	rwc, err := c.ExtendedConnect(addr, "echo")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "echo", <-protocols)
+	testExtendedConnectEcho(t, rwc)
+
+	_, err = c.ExtendedConnect(addr, "")
+	tests.AssertNotNil(t, err)
+	_, err = tc().EnableForceHTTP1().ExtendedConnect(addr, "echo")
+	tests.AssertErrorContains(t, err, "requires http2 or http3")
+
+	addr, _ = startExtendedConnectServer(t, false)
+	_, err = tc().ExtendedConnect(addr, "echo")
+	tests.AssertEqual(t, true, errors.Is(err, http2.ErrExtendedConnectNotSupported))
+}
+
+func TestExtendedConnectHTTP3(t *testing.T) {
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	tests.AssertNoError(t, err)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	var mu sync.Mutex
+	var protocol string
+	srv := &quichttp3.Server{
+		TLSConfig: quichttp3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			protocol = r.Proto
+			mu.Unlock()
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			b := make([]byte, 1024)
+			for {
+				n, err := r.Body.Read(b)
+				if n > 0 {
+					w.Write(b[:n])
+					w.(http.Flusher).Flush()
+				}
+				if err != nil {
+					return
+				}
+			}
+		}),
+	}
+	go srv.Serve(conn)
+	defer srv.Close()
+
+	c := tc().EnableForceHTTP3()
+	defer c.CloseIdleConnections()
+	rwc, err := c.ExtendedConnect(conn.LocalAddr().String(), "echo")
+	tests.AssertNoError(t, err)
+	testExtendedConnectEcho(t, rwc)
+	mu.Lock()
+	tests.AssertEqual(t, "echo", protocol)
+	mu.Unlock()
+}
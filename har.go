@@ -0,0 +1,177 @@
+package req
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/imroc/req/v3/internal/header"
+)
+
+// HAR is the root of a HTTP Archive (HAR 1.2), e.g. the one exported from the
+// browser devtools, which can be decoded with encoding/json. Only the fields
+// required to replay the requests are defined.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the log of a HAR.
+type HARLog struct {
+	Entries []HAREntry `json:"entries"`
+}
+
+// HAREntry is an entry of the HAR log, which is a captured request.
+type HAREntry struct {
+	StartedDateTime string     `json:"startedDateTime,omitempty"`
+	Request         HARRequest `json:"request"`
+}
+
+// HARRequest is the captured request of a HAR entry.
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion,omitempty"`
+	Cookies     []HARCookie    `json:"cookies,omitempty"`
+	Headers     []HARNameValue `json:"headers"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+}
+
+// HARNameValue is a name-value pair of a HAR request, e.g. a header.
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARCookie is a cookie of a HAR request.
+type HARCookie struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData is the body of a HAR request, the body is the Text if it's not
+// empty, otherwise it's built from the Params.
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	// Encoding is "base64" if the Text is base64 encoded, which is used by
+	// some tools for the binary body.
+	Encoding string     `json:"encoding,omitempty"`
+	Params   []HARParam `json:"params,omitempty"`
+}
+
+// HARParam is a posted parameter of a HAR request, which is a file of the
+// multipart body if the FileName is not empty.
+type HARParam struct {
+	Name        string `json:"name"`
+	Value       string `json:"value,omitempty"`
+	FileName    string `json:"fileName,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// harSkippedHeaders is the headers of a HAR request which are computed when
+// sending the request, they are kept in the header order only.
+var harSkippedHeaders = map[string]bool{
+	"host":           true,
+	"content-length": true,
+}
+
+// RequestFromHAR reconstructs the request captured in the HAR entry for replay,
+// the method, URL, headers and body are all taken from the entry, the headers
+// are sent in the captured order, and the pseudo header order is also taken if
+// the request is captured from HTTP/2. The base64 encoded body is decoded, and
+// the multipart or form body is rebuilt from the params if the text of the body
+// is not captured.
+func (c *Client) RequestFromHAR(entry HAREntry) (*Request, error) {
+	hr := entry.Request
+	if hr.Method == "" || hr.URL == "" {
+		return nil, errors.New("missing method or url in har entry")
+	}
+	r := c.R()
+	r.Method = strings.ToUpper(hr.Method)
+	r.SetURL(hr.URL)
+
+	var order, pseudoOrder []string
+	hasCookie := false
+	for _, h := range hr.Headers {
+		name := strings.ToLower(h.Name)
+		if strings.HasPrefix(name, ":") {
+			pseudoOrder = append(pseudoOrder, name)
+			continue
+		}
+		order = append(order, name)
+		if harSkippedHeaders[name] {
+			continue
+		}
+		if name == "cookie" {
+			hasCookie = true
+		}
+		if r.Headers == nil {
+			r.Headers = make(http.Header)
+		}
+		r.Headers.Add(h.Name, h.Value)
+	}
+	if !hasCookie {
+		for _, cookie := range hr.Cookies {
+			r.SetCookies(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		}
+	}
+	if order, _ = normalizeHeaderOrder(order); len(order) > 0 {
+		r.SetHeaderOrder(order...)
+	}
+	if len(pseudoOrder) > 0 {
+		r.SetPseudoHeaderOrder(pseudoOrder...)
+	}
+
+	if pd := hr.PostData; pd != nil {
+		if err := setHARPostData(r, pd); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func setHARPostData(r *Request, pd *HARPostData) error {
+	if pd.Text != "" {
+		body := []byte(pd.Text)
+		if pd.Encoding == "base64" {
+			var err error
+			body, err = base64.StdEncoding.DecodeString(pd.Text)
+			if err != nil {
+				return fmt.Errorf("failed to decode base64 post data in har entry: %w", err)
+			}
+		}
+		r.SetBodyBytes(body)
+		if pd.MimeType != "" && r.Headers.Get(header.ContentType) == "" {
+			r.SetContentType(pd.MimeType)
+		}
+		return nil
+	}
+	if len(pd.Params) == 0 {
+		return nil
+	}
+	if strings.HasPrefix(pd.MimeType, "multipart/") {
+		// the boundary of the captured content type does not match the
+		// rebuilt body.
+		r.Headers.Del(header.ContentType)
+		r.EnableForceMultipart()
+	}
+	for _, p := range pd.Params {
+		if p.FileName != "" {
+			r.SetFileUpload(FileUpload{
+				ParamName:   p.Name,
+				FileName:    p.FileName,
+				ContentType: p.ContentType,
+				FileSize:    int64(len(p.Value)),
+				GetFileContent: func() (io.ReadCloser, error) {
+					return io.NopCloser(strings.NewReader(p.Value)), nil
+				},
+			})
+			continue
+		}
+		r.SetOrderedFormData(p.Name, p.Value)
+	}
+	return nil
+}
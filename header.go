@@ -1,6 +1,7 @@
 package req
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"net/textproto"
@@ -118,3 +119,54 @@ func headerWriteSubset(h http.Header, exclude map[string]bool, writeHeader func(
 	}
 	return nil
 }
+
+// ParseRawHeaders parses the headers of a raw HTTP/1.x request block, e.g. the
+// one copied from the browser devtools, and returns the headers and the order
+// of the header names (lowercase, each name appears once at its first
+// position), which can be passed to ImpersonateCustomXXX. The request line is
+// optional, the pseudo headers (e.g. ":authority" copied from a HTTP/2 request)
+// are skipped, the values of the duplicated headers are kept in order, the
+// folded lines are joined with a space, and the parsing stops at the first empty
+// line, so the body of the request is ignored.
+func ParseRawHeaders(raw string) (http.Header, []string, error) {
+	hdrs := make(http.Header)
+	var order []string
+	var lastKey string
+	lines := strings.Split(strings.TrimLeft(raw, "\r\n"), "\n")
+	for i, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		if line == "" {
+			break
+		}
+		if i == 0 {
+			if fields := strings.Fields(line); len(fields) == 3 && strings.HasPrefix(fields[2], "HTTP/") {
+				continue
+			}
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if lastKey == "" {
+				return nil, nil, fmt.Errorf("unexpected folded line %q without header", line)
+			}
+			vs := hdrs[lastKey]
+			vs[len(vs)-1] = textproto.TrimString(vs[len(vs)-1] + " " + textproto.TrimString(line))
+			continue
+		}
+		if line[0] == ':' {
+			lastKey = ""
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, nil, fmt.Errorf("malformed header line %q", line)
+		}
+		if !httpguts.ValidHeaderFieldName(key) {
+			return nil, nil, fmt.Errorf("invalid header name %q", key)
+		}
+		lastKey = http.CanonicalHeaderKey(key)
+		if _, ok := hdrs[lastKey]; !ok {
+			order = append(order, strings.ToLower(key))
+		}
+		hdrs[lastKey] = append(hdrs[lastKey], textproto.TrimString(value))
+	}
+	return hdrs, order, nil
+}
@@ -0,0 +1,16 @@
+package http2
+
+// GoAway is the GOAWAY frame received from the server, which means the
+// server is shutting down the connection, no new request is sent on it.
+type GoAway struct {
+	// LastStreamID is the ID of the last stream which the server might
+	// have processed, the requests of the higher streams are not processed
+	// and can be retried safely on another connection.
+	LastStreamID uint32
+
+	// ErrCode is the error code, 0 (NO_ERROR) means a graceful shutdown.
+	ErrCode uint32
+
+	// DebugData is the opaque debug data sent by the server.
+	DebugData []byte
+}
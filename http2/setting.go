@@ -1,6 +1,7 @@
 package http2
 
 import (
+	"errors"
 	"fmt"
 )
 
@@ -15,17 +16,25 @@ const (
 	SettingInitialWindowSize    SettingID = 0x4
 	SettingMaxFrameSize         SettingID = 0x5
 	SettingMaxHeaderListSize    SettingID = 0x6
+	// SettingEnableConnectProtocol enables the extended CONNECT (RFC 8441),
+	// which is used to bootstrap WebSockets over HTTP/2.
+	SettingEnableConnectProtocol SettingID = 0x8
 )
 
 var settingName = map[SettingID]string{
-	SettingHeaderTableSize:      "HEADER_TABLE_SIZE",
-	SettingEnablePush:           "ENABLE_PUSH",
-	SettingMaxConcurrentStreams: "MAX_CONCURRENT_STREAMS",
-	SettingInitialWindowSize:    "INITIAL_WINDOW_SIZE",
-	SettingMaxFrameSize:         "MAX_FRAME_SIZE",
-	SettingMaxHeaderListSize:    "MAX_HEADER_LIST_SIZE",
+	SettingHeaderTableSize:       "HEADER_TABLE_SIZE",
+	SettingEnablePush:            "ENABLE_PUSH",
+	SettingMaxConcurrentStreams:  "MAX_CONCURRENT_STREAMS",
+	SettingInitialWindowSize:     "INITIAL_WINDOW_SIZE",
+	SettingMaxFrameSize:          "MAX_FRAME_SIZE",
+	SettingMaxHeaderListSize:     "MAX_HEADER_LIST_SIZE",
+	SettingEnableConnectProtocol: "ENABLE_CONNECT_PROTOCOL",
 }
 
+// ErrExtendedConnectNotSupported is returned when sending an extended CONNECT
+// request while the server did not enable SETTINGS_ENABLE_CONNECT_PROTOCOL.
+var ErrExtendedConnectNotSupported = errors.New("http2: the server did not enable the extended CONNECT")
+
 func (s SettingID) String() string {
 	if v, ok := settingName[s]; ok {
 		return v
@@ -0,0 +1,47 @@
+package http3
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/quic-go/quic-go"
+)
+
+// FrameType is the frame type of a HTTP/3 frame.
+type FrameType uint64
+
+// FrameError is returned when a frame of a type reserved for the HTTP/2
+// frame types (0x2, 0x6, 0x8 and 0x9) is received, see RFC 9114, Section
+// 7.2.8. It can be matched with errors.As.
+type FrameError struct {
+	// Type is the type of the offending frame.
+	Type FrameType
+}
+
+func (e *FrameError) Error() string {
+	return fmt.Sprintf("http3: reserved frame type: %d", uint64(e.Type))
+}
+
+// GoAway is the GOAWAY frame received from the server, which means the
+// server is shutting down the connection, no new request is sent on it.
+type GoAway struct {
+	// StreamID is the ID of the first request stream which is not processed
+	// by the server, the requests of this stream and the higher ones can be
+	// retried safely on another connection.
+	StreamID quic.StreamID
+}
+
+var (
+	// ErrDatagramNotEnabled is returned when sending a datagram while HTTP
+	// datagrams (RFC 9297) are not enabled in the settings of the client.
+	ErrDatagramNotEnabled = errors.New("http3: datagrams are not enabled in the settings")
+
+	// ErrDatagramNotSupported is returned when sending a datagram while the
+	// peer did not advertise SETTINGS_H3_DATAGRAM in its settings.
+	ErrDatagramNotSupported = errors.New("http3: the peer did not advertise datagram support")
+
+	// ErrExtendedConnectNotSupported is returned when sending an extended
+	// CONNECT request while the server did not enable
+	// SETTINGS_ENABLE_CONNECT_PROTOCOL.
+	ErrExtendedConnectNotSupported = errors.New("http3: server didn't enable Extended CONNECT")
+)
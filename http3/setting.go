@@ -0,0 +1,80 @@
+package http3
+
+import (
+	"fmt"
+	"slices"
+)
+
+// A SettingID is an HTTP/3 setting as defined in
+// https://www.iana.org/assignments/http3-parameters/http3-parameters.xhtml#settings
+type SettingID uint64
+
+const (
+	SettingQpackMaxTableCapacity SettingID = 0x1
+	SettingMaxFieldSectionSize   SettingID = 0x6
+	SettingQpackBlockedStreams   SettingID = 0x7
+	SettingEnableConnectProtocol SettingID = 0x8
+	SettingH3Datagram            SettingID = 0x33
+	// SettingEnableWebTransport is SETTINGS_ENABLE_WEBTRANSPORT of
+	// draft-ietf-webtrans-http3-02, which is still sent by browsers.
+	SettingEnableWebTransport SettingID = 0x2b603742
+)
+
+var settingName = map[SettingID]string{
+	SettingQpackMaxTableCapacity: "QPACK_MAX_TABLE_CAPACITY",
+	SettingMaxFieldSectionSize:   "MAX_FIELD_SECTION_SIZE",
+	SettingQpackBlockedStreams:   "QPACK_BLOCKED_STREAMS",
+	SettingEnableConnectProtocol: "ENABLE_CONNECT_PROTOCOL",
+	SettingH3Datagram:            "H3_DATAGRAM",
+	SettingEnableWebTransport:    "ENABLE_WEBTRANSPORT",
+}
+
+func (s SettingID) String() string {
+	if v, ok := settingName[s]; ok {
+		return v
+	}
+	return fmt.Sprintf("UNKNOWN_SETTING_%d", uint64(s))
+}
+
+// Setting is a setting parameter: which setting it is, and its value.
+type Setting struct {
+	// ID is which setting is being set.
+	ID SettingID
+
+	// Val is the value.
+	Val uint64
+}
+
+func (s Setting) String() string {
+	return fmt.Sprintf("[%v = %d]", s.ID, s.Val)
+}
+
+// Settings are the HTTP/3 settings sent in the SETTINGS frame of the
+// client's control stream.
+type Settings struct {
+	// Datagram sends SETTINGS_H3_DATAGRAM (RFC 9297).
+	Datagram bool
+
+	// ExtendedConnect sends SETTINGS_ENABLE_CONNECT_PROTOCOL (RFC 9220).
+	ExtendedConnect bool
+
+	// GREASE sends a reserved setting and a reserved frame with random
+	// identifiers (RFC 9114, Section 7.2.4.1 and 7.2.8).
+	GREASE bool
+
+	// Other is the ordered settings sent after the default ones. A
+	// setting in Other which is also sent by default (such as
+	// SettingMaxFieldSectionSize) overrides the default one and is sent
+	// at its position in Other.
+	Other []Setting
+}
+
+// Clone returns a deep copy of s.
+func (s *Settings) Clone() *Settings {
+	if s == nil {
+		return nil
+	}
+	ss := *s
+	ss.Other = slices.Clone(s.Other)
+	return &ss
+}
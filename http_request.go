@@ -97,6 +97,40 @@ var reqWriteExcludeHeader = map[string]bool{
 	"Trailer":                  true,
 	header.HeaderOderKey:       true,
 	header.PseudoHeaderOderKey: true,
+	header.HeaderCasingKey:     true,
+}
+
+// reqWriteExcludeHeaderTE is reqWriteExcludeHeader with the TE header, see
+// isOnlyHTTP2TE.
+var reqWriteExcludeHeaderTE = map[string]bool{
+	"Host":                     true,
+	"User-Agent":               true,
+	"Content-Length":           true,
+	"Transfer-Encoding":        true,
+	"Trailer":                  true,
+	"Te":                       true,
+	header.HeaderOderKey:       true,
+	header.PseudoHeaderOderKey: true,
+	header.HeaderCasingKey:     true,
+}
+
+// isOnlyHTTP2TE reports whether the TE header is "trailers" without the TE
+// connection option, which is only valid in HTTP/2 and HTTP/3 (e.g. the one
+// sent by Firefox), as TE is a hop-by-hop header in HTTP/1.1, which must be
+// listed in the Connection header.
+func isOnlyHTTP2TE(h http.Header) bool {
+	te := h["Te"]
+	if len(te) != 1 || !ascii.EqualFold(te[0], "trailers") {
+		return false
+	}
+	for _, v := range h["Connection"] {
+		for _, opt := range strings.Split(v, ",") {
+			if ascii.EqualFold(strings.TrimSpace(opt), "te") {
+				return false
+			}
+		}
+	}
+	return true
 }
 
 // requestMethodUsuallyLacksBody reports whether the given request
@@ -1,3 +1,5 @@
+//go:build !req_nobrotli
+
 package compress
 
 import (
@@ -6,6 +8,12 @@ import (
 	"github.com/andybalholm/brotli"
 )
 
+// init registers the brotli decoder, build with the req_nobrotli tag to exclude it
+// and its dependency, then the encoding is no longer advertised.
+func init() {
+	decoders["br"] = func(body io.ReadCloser) CompressReader { return NewBrotliReader(body) }
+}
+
 type BrotliReader struct {
 	Body io.ReadCloser // underlying Response.Body
 	br   io.Reader     // lazily-initialized brotli reader
@@ -1,7 +1,9 @@
 package compress
 
 import (
+	"bufio"
 	"compress/flate"
+	"compress/zlib"
 	"io"
 )
 
@@ -20,14 +22,30 @@ func (df *DeflateReader) Read(p []byte) (n int, err error) {
 		return 0, df.derr
 	}
 	if df.dr == nil {
-		df.dr = flate.NewReader(df.Body)
+		// "deflate" is the zlib format (RFC 9110), but some servers send
+		// the raw deflate stream, which is also accepted by browsers.
+		br := bufio.NewReader(df.Body)
+		if h, err := br.Peek(2); err == nil && isZlibHeader(h) {
+			df.dr, df.derr = zlib.NewReader(br)
+			if df.derr != nil {
+				return 0, df.derr
+			}
+		} else {
+			df.dr = flate.NewReader(br)
+		}
 	}
 	return df.dr.Read(p)
 }
 
+// isZlibHeader reports whether h is the CMF and FLG bytes of a zlib stream
+// with the deflate compression method.
+func isZlibHeader(h []byte) bool {
+	return h[0]&0x0f == 8 && h[0]>>4 <= 7 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0
+}
+
 func (df *DeflateReader) Close() error {
 	if df.dr != nil {
-		return df.dr.Close()
+		df.dr.Close()
 	}
 	return df.Body.Close()
 }
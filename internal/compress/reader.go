@@ -1,6 +1,10 @@
 package compress
 
-import "io"
+import (
+	"io"
+	"slices"
+	"strings"
+)
 
 type CompressReader interface {
 	io.ReadCloser
@@ -8,16 +12,45 @@ type CompressReader interface {
 	SetUnderlyingBody(body io.ReadCloser)
 }
 
+// encodings is the content codings in the order they are advertised by
+// browsers, the decoders of br and zstd can be excluded with the
+// req_nobrotli and req_nozstd build tags.
+var encodings = []string{"gzip", "deflate", "br", "zstd"}
+
+var decoders = map[string]func(body io.ReadCloser) CompressReader{
+	"gzip":    func(body io.ReadCloser) CompressReader { return NewGzipReader(body) },
+	"deflate": func(body io.ReadCloser) CompressReader { return NewDeflateReader(body) },
+}
+
+// SupportedEncodings returns the content codings which can be decoded, in
+// the order they are advertised by browsers.
+func SupportedEncodings() []string {
+	var supported []string
+	for _, encoding := range encodings {
+		if IsSupported(encoding) {
+			supported = append(supported, encoding)
+		}
+	}
+	return supported
+}
+
+// IsKnown reports whether the content coding is one of gzip, deflate, br and
+// zstd, whether or not its decoder is compiled in.
+func IsKnown(contentEncoding string) bool {
+	return slices.Contains(encodings, strings.ToLower(strings.TrimSpace(contentEncoding)))
+}
+
+// IsSupported reports whether the content coding can be decoded.
+func IsSupported(contentEncoding string) bool {
+	_, ok := decoders[strings.ToLower(strings.TrimSpace(contentEncoding))]
+	return ok
+}
+
+// NewCompressReader returns the reader which decodes the body with the
+// content coding, or nil if the content coding is not supported.
 func NewCompressReader(body io.ReadCloser, contentEncoding string) CompressReader {
-	switch contentEncoding {
-	case "gzip":
-		return NewGzipReader(body)
-	case "deflate":
-		return NewDeflateReader(body)
-	case "br":
-		return NewBrotliReader(body)
-	case "zstd":
-		return NewZstdReader(body)
+	if newReader, ok := decoders[strings.ToLower(strings.TrimSpace(contentEncoding))]; ok {
+		return newReader(body)
 	}
 	return nil
 }
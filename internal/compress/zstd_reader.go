@@ -1,3 +1,5 @@
+//go:build !req_nozstd
+
 package compress
 
 import (
@@ -6,6 +8,16 @@ import (
 	"github.com/klauspost/compress/zstd"
 )
 
+// init registers the zstd decoder, build with the req_nozstd tag to exclude it
+// and its dependency, then the encoding is no longer advertised.
+func init() {
+	decoders["zstd"] = func(body io.ReadCloser) CompressReader { return NewZstdReader(body) }
+}
+
+// zstdMaxWindow is the maximum window size of the "zstd" content coding, see
+// RFC 9659.
+const zstdMaxWindow = 8 << 20
+
 type ZstdReader struct {
 	Body io.ReadCloser // underlying Response.Body
 	zr   *zstd.Decoder // lazily-initialized zstd reader
@@ -21,7 +33,12 @@ func (zr *ZstdReader) Read(p []byte) (n int, err error) {
 		return 0, zr.zerr
 	}
 	if zr.zr == nil {
-		zr.zr, err = zstd.NewReader(zr.Body)
+		// decode synchronously so the body is streamed without background
+		// goroutines, and limit the window to 8 MB like browsers (RFC 9659).
+		zr.zr, err = zstd.NewReader(zr.Body,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxWindow(zstdMaxWindow),
+		)
 		if err != nil {
 			zr.zerr = err
 			return 0, err
@@ -18,6 +18,8 @@ type Options interface {
 	ResponseHeader() bool
 	ResponseBody() bool
 	Async() bool
+	TLS() bool
+	HTTP2Frames() bool
 	Clone() Options
 }
 
@@ -15,6 +15,7 @@ const (
 	Authorization        = "Authorization"
 	HeaderOderKey        = "__header_order__"
 	PseudoHeaderOderKey  = "__pseudo_header_order__"
+	HeaderCasingKey      = "__header_casing__"
 )
 
 var reqWriteExcludeHeader = map[string]bool{
@@ -31,9 +32,10 @@ var reqWriteExcludeHeader = map[string]bool{
 	"transfer-encoding": true,
 	"upgrade":           true,
 	"keep-alive":        true,
-	// Ignore header order keys which is only used internally.
+	// Ignore header order and casing keys which is only used internally.
 	HeaderOderKey:       true,
 	PseudoHeaderOderKey: true,
+	HeaderCasingKey:     true,
 }
 
 func IsExcluded(key string) bool {
@@ -42,3 +44,16 @@ func IsExcluded(key string) bool {
 	}
 	return false
 }
+
+// CasingMap returns the header names of the casing list set with
+// HeaderCasingKey, keyed by the lowercase names, the later one wins.
+func CasingMap(names []string) map[string]string {
+	if len(names) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(names))
+	for _, name := range names {
+		m[strings.ToLower(name)] = name
+	}
+	return m
+}
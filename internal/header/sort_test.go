@@ -0,0 +1,25 @@
+package header
+
+import (
+	"testing"
+
+	"github.com/imroc/req/v3/internal/tests"
+)
+
+func TestSortKeyValues(t *testing.T) {
+	keys := func(kvs []KeyValues) []string {
+		var ks []string
+		for _, kv := range kvs {
+			ks = append(ks, kv.Key)
+		}
+		return ks
+	}
+	kvs := []KeyValues{{Key: "x-b"}, {Key: "user-agent"}, {Key: "X-A"}}
+	SortKeyValues(kvs, []string{"x-a", "User-Agent"})
+	tests.AssertEqual(t, []string{"x-b", "X-A", "user-agent"}, keys(kvs))
+
+	// the keys which are not ordered keep their position.
+	kvs = []KeyValues{{Key: "x-b"}, {Key: "user-agent"}, {Key: "x-a"}}
+	SortKeyValues(kvs, []string{"user-agent", "x-a"})
+	tests.AssertEqual(t, []string{"x-b", "user-agent", "x-a"}, keys(kvs))
+}
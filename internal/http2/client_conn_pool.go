@@ -10,6 +10,8 @@ import (
 	"net"
 	"net/http"
 	"sync"
+
+	"github.com/imroc/req/v3/internal/transport"
 )
 
 // ClientConnPool manages a pool of HTTP/2 client connections.
@@ -40,6 +42,12 @@ type clientConnPool struct {
 }
 
 func (p *clientConnPool) GetClientConn(req *http.Request, addr string, dialOnMiss bool) (*ClientConn, error) {
+	key := transport.ConnPoolKey(req.Context(), addr)
+	if key != addr {
+		// the connections via the proxy are dialed through the proxy by the
+		// http1 Transport, and added with AddConnIfNeeded.
+		dialOnMiss = false
+	}
 	// TODO(dneil): Dial a new connection when t.DisableKeepAlives is set?
 	if isConnectionCloseRequest(req) && dialOnMiss {
 		// It gets its own connection.
@@ -52,8 +60,12 @@ func (p *clientConnPool) GetClientConn(req *http.Request, addr string, dialOnMis
 		return cc, nil
 	}
 	for {
+		fingerprintKey := p.t.fingerprintKey()
 		p.mu.Lock()
-		for _, cc := range p.conns[addr] {
+		for _, cc := range p.conns[key] {
+			if cc.fingerprintKey != fingerprintKey {
+				continue
+			}
 			if cc.ReserveNewRequest() {
 				// When a connection is presented to us by the net/http package,
 				// the GetConn hook has already been called.
@@ -71,7 +83,7 @@ func (p *clientConnPool) GetClientConn(req *http.Request, addr string, dialOnMis
 			return nil, ErrNoCachedConn
 		}
 		traceGetConn(req, addr)
-		call := p.getStartDialLocked(req.Context(), addr)
+		call := p.getStartDialLocked(req.Context(), key, fingerprintKey, addr)
 		p.mu.Unlock()
 		<-call.done
 		if shouldRetryDial(call, req) {
@@ -94,22 +106,28 @@ type dialCall struct {
 	// the context associated with the request
 	// that created this dialCall
 	ctx  context.Context
+	key  string        // the key of the conn in the pool
 	done chan struct{} // closed when done
 	res  *ClientConn   // valid after done is closed
 	err  error         // valid after done is closed
+	// dialKey is the key of the in-flight dial, which includes the
+	// fingerprint key, so the requests are never given a conn dialed
+	// with other tls fingerprint or http2 settings.
+	dialKey string
 }
 
 // requires p.mu is held.
-func (p *clientConnPool) getStartDialLocked(ctx context.Context, addr string) *dialCall {
-	if call, ok := p.dialing[addr]; ok {
+func (p *clientConnPool) getStartDialLocked(ctx context.Context, key, fingerprintKey, addr string) *dialCall {
+	dialKey := key + "|" + fingerprintKey
+	if call, ok := p.dialing[dialKey]; ok {
 		// A dial is already in-flight. Don't start another.
 		return call
 	}
-	call := &dialCall{p: p, done: make(chan struct{}), ctx: ctx}
+	call := &dialCall{p: p, done: make(chan struct{}), ctx: ctx, key: key, dialKey: dialKey}
 	if p.dialing == nil {
 		p.dialing = make(map[string]*dialCall)
 	}
-	p.dialing[addr] = call
+	p.dialing[dialKey] = call
 	go call.dial(call.ctx, addr)
 	return call
 }
@@ -120,9 +138,9 @@ func (c *dialCall) dial(ctx context.Context, addr string) {
 	c.res, c.err = c.p.t.dialClientConn(ctx, addr, singleUse)
 
 	c.p.mu.Lock()
-	delete(c.p.dialing, addr)
+	delete(c.p.dialing, c.dialKey)
 	if c.err == nil {
-		c.p.addConnLocked(addr, c.res)
+		c.p.addConnLocked(c.key, c.res)
 	}
 	c.p.mu.Unlock()
 
@@ -138,9 +156,10 @@ func (c *dialCall) dial(ctx context.Context, addr string) {
 // The return value used is whether c was used.
 // c is never closed.
 func (p *clientConnPool) AddConnIfNeeded(key string, t *Transport, c net.Conn) (used bool, err error) {
+	fingerprintKey := t.fingerprintKey()
 	p.mu.Lock()
 	for _, cc := range p.conns[key] {
-		if cc.CanTakeNewRequest() {
+		if cc.fingerprintKey == fingerprintKey && cc.CanTakeNewRequest() {
 			p.mu.Unlock()
 			return false, nil
 		}
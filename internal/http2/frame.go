@@ -41,6 +41,10 @@ const (
 	FrameGoAway       FrameType = 0x7
 	FrameWindowUpdate FrameType = 0x8
 	FrameContinuation FrameType = 0x9
+
+	// FramePriorityUpdate is the PRIORITY_UPDATE frame defined in
+	// https://www.rfc-editor.org/rfc/rfc9218.html#section-7.1
+	FramePriorityUpdate FrameType = 0x10
 )
 
 var frameName = map[FrameType]string{
@@ -54,6 +58,8 @@ var frameName = map[FrameType]string{
 	FrameGoAway:       "GOAWAY",
 	FrameWindowUpdate: "WINDOW_UPDATE",
 	FrameContinuation: "CONTINUATION",
+
+	FramePriorityUpdate: "PRIORITY_UPDATE",
 }
 
 func (t FrameType) String() string {
@@ -369,7 +375,7 @@ func (h2f *Framer) endWrite() error {
 		byte(length>>16),
 		byte(length>>8),
 		byte(length))
-	if h2f.logWrites {
+	if h2f.logWrites || h2f.frameDumper() != nil {
 		h2f.logWrite()
 	}
 
@@ -392,10 +398,29 @@ func (h2f *Framer) logWrite() {
 	h2f.debugFramerBuf.Write(h2f.wbuf)
 	fr, err := h2f.debugFramer.ReadFrame()
 	if err != nil {
-		h2f.debugWriteLoggerf("http2: Framer %p: failed to decode just-written frame", h2f)
+		if h2f.logWrites {
+			h2f.debugWriteLoggerf("http2: Framer %p: failed to decode just-written frame", h2f)
+		}
 		return
 	}
-	h2f.debugWriteLoggerf("http2: Framer %p: wrote %v", h2f, summarizeFrame(fr))
+	if h2f.logWrites {
+		h2f.debugWriteLoggerf("http2: Framer %p: wrote %v", h2f, summarizeFrame(fr))
+	}
+	if d := h2f.frameDumper(); d != nil {
+		d.DumpDefault([]byte("> " + summarizeFrame(fr) + "\r\n"))
+	}
+}
+
+// frameDumper returns the dumper of the client connection if the http2
+// frame dump is enabled.
+func (h2f *Framer) frameDumper() *dump.Dumper {
+	if h2f.cc == nil {
+		return nil
+	}
+	if d := h2f.cc.t.Dump; d != nil && d.HTTP2Frames() {
+		return d
+	}
+	return nil
 }
 
 func (h2f *Framer) writeByte(v byte) { h2f.wbuf = append(h2f.wbuf, v) }
@@ -552,6 +577,9 @@ func (h2f *Framer) ReadFrame() (Frame, error) {
 	if h2f.logReads {
 		h2f.debugReadLoggerf("http2: Framer %p: read %v", h2f, summarizeFrame(f))
 	}
+	if d := h2f.frameDumper(); d != nil {
+		d.DumpDefault([]byte("< " + summarizeFrame(f) + "\r\n"))
+	}
 	if fh.Type == FrameHeaders && h2f.ReadMetaHeaders != nil {
 		hf := f.(*HeadersFrame)
 		req := h2f.currentRequest(hf.StreamID)
@@ -1238,6 +1266,21 @@ func (h2f *Framer) WritePriority(streamID uint32, p http2.PriorityParam) error {
 	return h2f.endWrite()
 }
 
+// WritePriorityUpdate writes a PRIORITY_UPDATE frame on the stream 0, which
+// carries the priority field value (e.g. "u=0, i") of the prioritized stream.
+//
+// It will perform exactly one Write to the underlying Writer.
+// It is the caller's responsibility to not call other Write methods concurrently.
+func (h2f *Framer) WritePriorityUpdate(streamID uint32, priority string) error {
+	if !validStreamID(streamID) && !h2f.AllowIllegalWrites {
+		return errStreamID
+	}
+	h2f.startWrite(FramePriorityUpdate, 0, 0)
+	h2f.writeUint32(streamID)
+	h2f.writeBytes([]byte(priority))
+	return h2f.endWrite()
+}
+
 // A RSTStreamFrame allows for abnormal termination of a stream.
 // See https://httpwg.org/specs/rfc7540.html#rfc.section.6.4
 type RSTStreamFrame struct {
@@ -1692,6 +1735,10 @@ func (h2f *Framer) readMetaFrame(hf *HeadersFrame, dumps []*dump.Dumper) (Frame,
 	return mh, nil
 }
 
+func writePriorityDebug(buf *bytes.Buffer, p http2.PriorityParam) {
+	fmt.Fprintf(buf, " dep=%d weight=%d exclusive=%v", p.StreamDep, int(p.Weight)+1, p.Exclusive)
+}
+
 func summarizeFrame(f Frame) string {
 	var buf bytes.Buffer
 	f.Header().writeDebug(&buf)
@@ -1724,6 +1771,16 @@ func summarizeFrame(f Frame) string {
 			buf.WriteString(" (conn)")
 		}
 		fmt.Fprintf(&buf, " incr=%v", f.Increment)
+	case *HeadersFrame:
+		if f.HasPriority() {
+			writePriorityDebug(&buf, f.Priority)
+		}
+	case *PriorityFrame:
+		writePriorityDebug(&buf, f.PriorityParam)
+	case *UnknownFrame:
+		if p := f.Payload(); f.Type == FramePriorityUpdate && len(p) >= 4 {
+			fmt.Fprintf(&buf, " prioritized=%d priority=%q", binary.BigEndian.Uint32(p), p[4:])
+		}
 	case *PingFrame:
 		fmt.Fprintf(&buf, " ping=%q", f.Data[:])
 	case *GoAwayFrame:
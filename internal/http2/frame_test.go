@@ -0,0 +1,30 @@
+package http2
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWritePriorityUpdate(t *testing.T) {
+	buf := new(bytes.Buffer)
+	fr := NewFramer(buf, nil)
+	if err := fr.WritePriorityUpdate(1, "u=0, i"); err != nil {
+		t.Fatal(err)
+	}
+	// the PRIORITY_UPDATE frame sent by Chrome for the first request.
+	want := []byte{
+		0x00, 0x00, 0x0a, // length
+		0x10,                   // type
+		0x00,                   // flags
+		0x00, 0x00, 0x00, 0x00, // stream 0
+		0x00, 0x00, 0x00, 0x01, // prioritized stream
+		'u', '=', '0', ',', ' ', 'i',
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("PRIORITY_UPDATE frame is %x; want %x", buf.Bytes(), want)
+	}
+
+	if err := fr.WritePriorityUpdate(0, "u=0"); err != errStreamID {
+		t.Fatalf("expected errStreamID for stream 0, got %v", err)
+	}
+}
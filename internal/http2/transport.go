@@ -24,6 +24,7 @@ import (
 	"net/http/httptrace"
 	"net/textproto"
 	"os"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -128,6 +129,11 @@ type Transport struct {
 	// Defaults to 15s.
 	PingTimeout time.Duration
 
+	// PingPayload, if non-nil, returns the opaque data of the seq-th (from
+	// 0) PING frame sent on the connection, the data is random if nil.
+	// The pings with the same data in flight share the ack.
+	PingPayload func(seq uint64) [8]byte
+
 	// WriteByteTimeout is the timeout after which the connection will be
 	// closed no data can be written to it. The timeout begins when data is
 	// available to write, and is extended whenever any bytes are written.
@@ -141,12 +147,36 @@ type Transport struct {
 
 	Settings []http2.Setting
 
+	// JitterSettings, if non-nil, returns the perturbed values of the
+	// Settings, which are sent in the SETTINGS frame instead.
+	JitterSettings func(settings []http2.Setting) []http2.Setting
+
 	ConnectionFlow uint32
 	HeaderPriority http2.PriorityParam
 	PriorityFrames []http2.PriorityFrame
 
+	// PriorityUpdate, if non-empty, is the priority field value of the
+	// PRIORITY_UPDATE frame sent right before the HEADERS frame of each
+	// request.
+	PriorityUpdate string
+
+	// DisableCookieSplit, if true, sends the Cookie header as a single
+	// header field like Chrome, instead of splitting it into separate
+	// header fields of each cookie-pair (RFC 9113, Section 8.2.3).
+	DisableCookieSplit bool
+
+	// MaxHeaderFrameSize, if non-zero, is the maximum payload size of the
+	// HEADERS and CONTINUATION frames of the header blocks, which is capped
+	// by the SETTINGS_MAX_FRAME_SIZE of the peer. The browsers split the
+	// header blocks at 16384 bytes even if the peer allows larger frames.
+	MaxHeaderFrameSize uint32
+
 	connPoolOnce  sync.Once
 	connPoolOrDef ClientConnPool // non-nil version of ConnPool
+
+	// cachedFingerprintKey is built by fingerprintKey on first use, and is
+	// reset by ResetFingerprintKey.
+	cachedFingerprintKey atomic.Pointer[string]
 }
 
 // newTimer creates a new time.Timer, or a synthetic timer in tests.
@@ -202,6 +232,10 @@ type ClientConn struct {
 	reused        uint32               // whether conn is being reused; atomic
 	singleUse     bool                 // whether being used for a single http.Request
 	getConnCalled bool                 // used by clientConnPool
+	// fingerprintKey is the key of the tls fingerprint and http2 settings
+	// used to create the conn, the conn is only reused by the requests
+	// with the same key.
+	fingerprintKey string
 
 	// readLoop goroutine fields:
 	readerDone chan struct{} // closed on error
@@ -210,30 +244,37 @@ type ClientConn struct {
 	idleTimeout time.Duration // or 0 for never
 	idleTimer   timer
 
-	mu              sync.Mutex // guards following
-	cond            *sync.Cond // hold mu; broadcast on flow/closed changes
-	flow            outflow    // our conn-level flow control quota (cs.outflow is per stream)
-	inflow          inflow     // peer's conn-level flow control
-	doNotReuse      bool       // whether conn is marked to not be reused for any future requests
-	closing         bool
-	closed          bool
-	seenSettings    bool                     // true if we've seen a settings frame, false otherwise
-	wantSettingsAck bool                     // we sent a SETTINGS frame and haven't heard back
-	goAway          *GoAwayFrame             // if non-nil, the GoAwayFrame we received
-	goAwayDebug     string                   // goAway frame's debug data, retained as a string
-	streams         map[uint32]*clientStream // client-initiated
-	streamsReserved int                      // incr by ReserveNewRequest; decr on RoundTrip
-	nextStreamID    uint32
-	pendingRequests int                       // requests blocked and waiting to be sent because len(streams) == maxConcurrentStreams
-	pings           map[[8]byte]chan struct{} // in flight ping data to notification channel
-	br              *bufio.Reader
-	lastActive      time.Time
-	lastIdle        time.Time // time last idle
+	mu                     sync.Mutex // guards following
+	cond                   *sync.Cond // hold mu; broadcast on flow/closed changes
+	flow                   outflow    // our conn-level flow control quota (cs.outflow is per stream)
+	inflow                 inflow     // peer's conn-level flow control
+	doNotReuse             bool       // whether conn is marked to not be reused for any future requests
+	closing                bool
+	closed                 bool
+	seenSettings           bool                     // true if we've seen a settings frame, false otherwise
+	seenSettingsChan       chan struct{}            // closed when seenSettings is true
+	extendedConnectAllowed bool                     // whether the peer enabled the extended CONNECT (RFC 8441)
+	wantSettingsAck        bool                     // we sent a SETTINGS frame and haven't heard back
+	goAway                 *GoAwayFrame             // if non-nil, the GoAwayFrame we received
+	goAwayDebug            string                   // goAway frame's debug data, retained as a string
+	streams                map[uint32]*clientStream // client-initiated
+	streamsReserved        int                      // incr by ReserveNewRequest; decr on RoundTrip
+	nextStreamID           uint32
+	firstStreamID          uint32                    // after the IDs taken by the PriorityFrames
+	pendingRequests        int                       // requests blocked and waiting to be sent because len(streams) == maxConcurrentStreams
+	pings                  map[[8]byte]chan struct{} // in flight ping data to notification channel
+	pingSeq                uint64                    // number of pings sent, guarded by mu
+	br                     *bufio.Reader
+	lastActive             time.Time
+	lastIdle               time.Time // time last idle
 	// Settings from peer: (also guarded by wmu)
 	maxFrameSize          uint32
 	maxConcurrentStreams  uint32
 	peerMaxHeaderListSize uint64
 	initialWindowSize     uint32
+	// peerSettings is all the settings received from the peer in order,
+	// the later value of a setting replaces the former one in place.
+	peerSettings []http2.Setting
 
 	// reqHeaderMu is a 1-element semaphore channel controlling access to sending new requests.
 	// Write to reqHeaderMu to lock it, read from it to unlock.
@@ -412,7 +453,12 @@ type RoundTripOpt struct {
 	// OnlyCachedConn controls whether RoundTripOpt may
 	// create a new TCP connection. If set true and
 	// no cached connection is available, RoundTripOpt
-	// will return ErrNoCachedConn.
+	// will return ErrNoCachedConn. The retryable requests,
+	// e.g. the ones not processed by the server before it
+	// sent GOAWAY, are retried on the other cached
+	// connections, and ErrNoCachedConn is returned if none
+	// of them can take the request, so the caller can retry
+	// it on a new connection dialed by itself.
 	OnlyCachedConn bool
 }
 
@@ -424,6 +470,26 @@ func (t *Transport) RoundTripOnlyCachedConn(req *http.Request) (*http.Response,
 	return t.RoundTripOpt(req, RoundTripOpt{OnlyCachedConn: true})
 }
 
+// fingerprintKey returns the key of the tls fingerprint and the http2
+// settings of the new connections, the connections created with different
+// settings are not shared. The key is cached, so ResetFingerprintKey must be
+// called after the TLSFingerprintKey, Settings, ConnectionFlow, HeaderPriority
+// or PriorityFrames are changed.
+func (t *Transport) fingerprintKey() string {
+	if key := t.cachedFingerprintKey.Load(); key != nil {
+		return *key
+	}
+	key := fmt.Sprintf("%s|%v|%d|%v|%v", t.TLSFingerprintKey, t.Settings, t.ConnectionFlow, t.HeaderPriority, t.PriorityFrames)
+	t.cachedFingerprintKey.Store(&key)
+	return key
+}
+
+// ResetFingerprintKey resets the cached key of the tls fingerprint and the
+// http2 settings, it's rebuilt on next use.
+func (t *Transport) ResetFingerprintKey() {
+	t.cachedFingerprintKey.Store(nil)
+}
+
 // authorityAddr returns a given authority (a host/IP, or host:port / ip:port)
 // and returns a host:port. The port 443 is added if needed.
 func authorityAddr(scheme string, authority string) (addr string) {
@@ -462,18 +528,12 @@ func (t *Transport) RoundTripOpt(req *http.Request, opt RoundTripOpt) (*http.Res
 	addr := netutil.AuthorityAddr(req.URL.Scheme, req.URL.Host)
 	var cc *ClientConn
 	var err error
-	if opt.OnlyCachedConn {
-		cc, err = t.connPool().GetClientConn(req, addr, false)
-		if err != nil {
-			return nil, err
-		}
-		traceGotConn(req, cc, true)
-		return cc.RoundTrip(req)
-	}
 	for retry := 0; ; retry++ {
-		cc, err = t.connPool().GetClientConn(req, addr, true)
+		cc, err = t.connPool().GetClientConn(req, addr, !opt.OnlyCachedConn)
 		if err != nil {
-			t.vlogf("http2: Transport failed to get client conn for %s: %v", addr, err)
+			if err != ErrNoCachedConn {
+				t.vlogf("http2: Transport failed to get client conn for %s: %v", addr, err)
+			}
 			return nil, err
 		}
 		reused := !atomic.CompareAndSwapUint32(&cc.reused, 0, 1)
@@ -600,12 +660,6 @@ func (t *Transport) newTLSConfig(host string) *tls.Config {
 
 var zeroDialer net.Dialer
 
-type tlsHandshakeTimeoutError struct{}
-
-func (tlsHandshakeTimeoutError) Timeout() bool   { return true }
-func (tlsHandshakeTimeoutError) Temporary() bool { return true }
-func (tlsHandshakeTimeoutError) Error() string   { return "net/http: TLS handshake timeout" }
-
 // dialTLSWithContext uses tls.Dialer, added in Go 1.15, to open a TLS
 // connection.
 func (t *Transport) dialTLSWithContext(ctx context.Context, network, addr string, cfg *tls.Config) (reqtls.Conn, error) {
@@ -621,9 +675,9 @@ func (t *Transport) dialTLSWithContext(ctx context.Context, network, addr string
 		trace := httptrace.ContextClientTrace(ctx)
 		errc := make(chan error, 2)
 		var timer *time.Timer // for canceling TLS handshake
-		if d := t.TLSHandshakeTimeout; d != 0 {
+		if d := t.TLSHandshakeTimeoutFor(ctx); d != 0 {
 			timer = time.AfterFunc(d, func() {
-				errc <- tlsHandshakeTimeoutError{}
+				errc <- transport.TLSHandshakeTimeoutError{}
 			})
 		}
 		go func() {
@@ -700,6 +754,7 @@ func (t *Transport) newClientConn(c net.Conn, singleUse bool) (*ClientConn, erro
 		t:                     t,
 		tconn:                 c,
 		readerDone:            make(chan struct{}),
+		seenSettingsChan:      make(chan struct{}),
 		nextStreamID:          1,
 		maxFrameSize:          16 << 10,                    // spec default
 		initialWindowSize:     65535,                       // spec default
@@ -710,6 +765,7 @@ func (t *Transport) newClientConn(c net.Conn, singleUse bool) (*ClientConn, erro
 		wantSettingsAck:       true,
 		pings:                 make(map[[8]byte]chan struct{}),
 		reqHeaderMu:           make(chan struct{}, 1),
+		fingerprintKey:        t.fingerprintKey(),
 	}
 	if VerboseLogs {
 		t.vlogf("http2: Transport creating client conn %p to %v", cc, c.RemoteAddr())
@@ -717,8 +773,12 @@ func (t *Transport) newClientConn(c net.Conn, singleUse bool) (*ClientConn, erro
 
 	cc.cond = sync.NewCond(&cc.mu)
 
+	settings := t.Settings
+	if t.JitterSettings != nil && len(settings) > 0 {
+		settings = t.JitterSettings(settings)
+	}
 	var headerTableSize uint32 = initialHeaderTableSize
-	for _, setting := range t.Settings {
+	for _, setting := range settings {
 		switch setting.ID {
 		case http2.SettingMaxFrameSize:
 			cc.maxFrameSize = setting.Val
@@ -757,8 +817,8 @@ func (t *Transport) newClientConn(c net.Conn, singleUse bool) (*ClientConn, erro
 	}
 
 	var initialSettings []http2.Setting
-	if len(t.Settings) > 0 {
-		initialSettings = t.Settings
+	if len(settings) > 0 {
+		initialSettings = settings
 	} else {
 		initialSettings = []http2.Setting{
 			{ID: http2.SettingEnablePush, Val: 0},
@@ -781,6 +841,7 @@ func (t *Transport) newClientConn(c net.Conn, singleUse bool) (*ClientConn, erro
 		cc.fr.WritePriority(p.StreamID, p.PriorityParam)
 		cc.nextStreamID = p.StreamID + 2
 	}
+	cc.firstStreamID = cc.nextStreamID
 
 	cc.inflow.init(int32(connFlow) + initialWindowSize)
 	cc.bw.Flush()
@@ -823,6 +884,18 @@ func (cc *ClientConn) SetDoNotReuse() {
 	cc.doNotReuse = true
 }
 
+// ServerSettingsHookKey is the context key of a func([]http2.Setting) which
+// is called with the settings received from the server once the response
+// headers are received.
+type ServerSettingsHookKey struct{}
+
+// serverSettings returns a copy of the settings received from the server.
+func (cc *ClientConn) serverSettings() []http2.Setting {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return slices.Clone(cc.peerSettings)
+}
+
 func (cc *ClientConn) setGoAway(f *GoAwayFrame) {
 	cc.mu.Lock()
 	defer cc.mu.Unlock()
@@ -928,7 +1001,7 @@ func (cc *ClientConn) idleState() clientConnIdleState {
 }
 
 func (cc *ClientConn) idleStateLocked() (st clientConnIdleState) {
-	if cc.singleUse && cc.nextStreamID > 1 {
+	if cc.singleUse && cc.nextStreamID > cc.firstStreamID {
 		return
 	}
 	var maxConcurrentOkay bool
@@ -1244,6 +1317,9 @@ func (cc *ClientConn) roundTrip(req *http.Request, streamf func(*clientStream))
 		}
 		res.Request = req
 		res.TLS = cc.tlsState
+		if hook, ok := req.Context().Value(ServerSettingsHookKey{}).(func([]http2.Setting)); ok {
+			hook(cc.serverSettings())
+		}
 		if res.Body == noBody && actualContentLength(req) == 0 {
 			// If there isn't a request or response body still being
 			// written, then wait for the stream to be closed before
@@ -1328,6 +1404,26 @@ func (cs *clientStream) writeRequest(req *http.Request, streamf func(*clientStre
 		return err
 	}
 
+	// The extended CONNECT can only be sent after the SETTINGS of the server
+	// is received, see section 3 of RFC 8441.
+	if isExtendedConnectRequest(req) {
+		select {
+		case <-cc.seenSettingsChan:
+		case <-cc.readerDone:
+			return errClientConnClosed
+		case <-cs.reqCancel:
+			return common.ErrRequestCanceled
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		cc.mu.Lock()
+		allowed := cc.extendedConnectAllowed
+		cc.mu.Unlock()
+		if !allowed {
+			return http2.ErrExtendedConnectNotSupported
+		}
+	}
+
 	// Acquire the new-request lock by writing to reqHeaderMu.
 	// This lock guards the critical section covering allocating a new stream ID
 	// (requires mu) and creating the stream (requires wmu).
@@ -1606,10 +1702,21 @@ func (cc *ClientConn) awaitOpenSlotForStreamLocked(cs *clientStream) error {
 // requires cc.wmu be held
 func (cc *ClientConn) writeHeaders(streamID uint32, endStream bool, maxFrameSize int, hdrs []byte) error {
 	first := true // first frame written (HEADERS is first, then CONTINUATION)
+	if cc.t.PriorityUpdate != "" {
+		cc.fr.WritePriorityUpdate(streamID, cc.t.PriorityUpdate)
+	}
+	if n := int(cc.t.MaxHeaderFrameSize); n > 0 && n < maxFrameSize {
+		maxFrameSize = n
+	}
 	for len(hdrs) > 0 && cc.werr == nil {
 		chunk := hdrs
-		if len(chunk) > maxFrameSize {
-			chunk = chunk[:maxFrameSize]
+		size := maxFrameSize
+		if first && !cc.t.HeaderPriority.IsZero() {
+			// the priority fields are in the payload of the HEADERS frame.
+			size -= 5
+		}
+		if len(chunk) > size {
+			chunk = chunk[:size]
 		}
 		hdrs = hdrs[len(chunk):]
 		endHeaders := len(hdrs) == 0
@@ -1906,8 +2013,9 @@ func (cc *ClientConn) encodeHeaders(req *http.Request, addGzipHeader bool, trail
 		return nil, errors.New("http2: invalid Host header")
 	}
 
+	isExtendedConnect := isExtendedConnectRequest(req)
 	var path string
-	if req.Method != "CONNECT" {
+	if req.Method != "CONNECT" || isExtendedConnect {
 		path = req.URL.RequestURI()
 		if !validPseudoPath(path) {
 			orig := path
@@ -1963,10 +2071,13 @@ func (cc *ClientConn) encodeHeaders(req *http.Request, addGzipHeader bool, trail
 			m = http.MethodGet
 		}
 		writeHeader(":method", m)
-		if req.Method != "CONNECT" {
+		if req.Method != "CONNECT" || isExtendedConnect {
 			writeHeader(":path", path)
 			writeHeader(":scheme", req.URL.Scheme)
 		}
+		if isExtendedConnect {
+			writeHeader(":protocol", req.Proto)
+		}
 		if sort {
 			header.SortKeyValues(kvs, req.Header[header.PseudoHeaderOderKey])
 			for _, kv := range kvs {
@@ -2015,6 +2126,9 @@ func (cc *ClientConn) encodeHeaders(req *http.Request, addGzipHeader bool, trail
 				if vv[0] == "" {
 					continue
 				}
+			} else if ascii.EqualFold(k, "cookie") && cc.t.DisableCookieSplit {
+				writeHeader("cookie", strings.Join(vv, "; "))
+				continue
 			} else if ascii.EqualFold(k, "cookie") {
 				var vals []string
 				// Per 8.1.2.5 To allow for better compression efficiency, the
@@ -2518,6 +2632,13 @@ func (rl *clientConnReadLoop) handleResponse(cs *clientStream, f *MetaHeadersFra
 		StatusCode: statusCode,
 		Status:     status + " " + http.StatusText(statusCode),
 	}
+	if hook := transport.ResponseHeaderOrderHook(cs.ctx); hook != nil {
+		names := make([]string, len(regularFields))
+		for i, hf := range regularFields {
+			names[i] = hf.Name
+		}
+		hook(names)
+	}
 	for _, hf := range regularFields {
 		key := canonicalHeader(hf.Name)
 		if key == "Trailer" {
@@ -2610,13 +2731,12 @@ func (rl *clientConnReadLoop) handleResponse(cs *clientStream, f *MetaHeadersFra
 		res.Body = compress.NewGzipReader(res.Body)
 		res.Uncompressed = true
 	} else if cs.cc.t.AutoDecompression {
-		contentEncoding := res.Header.Get("Content-Encoding")
-		if contentEncoding != "" {
+		if body := compress.NewCompressReader(res.Body, res.Header.Get("Content-Encoding")); body != nil {
 			res.Header.Del("Content-Encoding")
 			res.Header.Del("Content-Length")
 			res.ContentLength = -1
 			res.Uncompressed = true
-			res.Body = compress.NewCompressReader(res.Body, contentEncoding)
+			res.Body = body
 		}
 	}
 
@@ -2917,6 +3037,14 @@ func (rl *clientConnReadLoop) processGoAway(f *GoAwayFrame) error {
 		}
 	}
 	cc.setGoAway(f)
+	if fn := cc.t.HTTP2GoAwayHandler; fn != nil {
+		goAway := http2.GoAway{
+			LastStreamID: f.LastStreamID,
+			ErrCode:      uint32(f.ErrCode),
+			DebugData:    bytes.Clone(f.DebugData()),
+		}
+		go fn(cc.tconn.RemoteAddr().String(), goAway)
+	}
 	return nil
 }
 
@@ -2952,6 +3080,11 @@ func (rl *clientConnReadLoop) processSettingsNoWrite(f *SettingsFrame) error {
 
 	var seenMaxConcurrentStreams bool
 	err := f.ForeachSetting(func(s http2.Setting) error {
+		if i := slices.IndexFunc(cc.peerSettings, func(ps http2.Setting) bool { return ps.ID == s.ID }); i >= 0 {
+			cc.peerSettings[i].Val = s.Val
+		} else {
+			cc.peerSettings = append(cc.peerSettings, s)
+		}
 		switch s.ID {
 		case http2.SettingMaxFrameSize:
 			cc.maxFrameSize = s.Val
@@ -2960,6 +3093,14 @@ func (rl *clientConnReadLoop) processSettingsNoWrite(f *SettingsFrame) error {
 			seenMaxConcurrentStreams = true
 		case http2.SettingMaxHeaderListSize:
 			cc.peerMaxHeaderListSize = uint64(s.Val)
+		case http2.SettingEnableConnectProtocol:
+			if s.Val > 1 {
+				return ConnectionError(ErrCodeProtocol)
+			}
+			// the setting can not be disabled once it's enabled.
+			if !cc.seenSettings {
+				cc.extendedConnectAllowed = s.Val == 1
+			}
 		case http2.SettingInitialWindowSize:
 			// Values above the maximum flow-control
 			// window size of 2^31-1 MUST be treated as a
@@ -2998,6 +3139,7 @@ func (rl *clientConnReadLoop) processSettingsNoWrite(f *SettingsFrame) error {
 			cc.maxConcurrentStreams = defaultMaxConcurrentStreams
 		}
 		cc.seenSettings = true
+		close(cc.seenSettingsChan)
 	}
 
 	return nil
@@ -3056,20 +3198,33 @@ func (rl *clientConnReadLoop) processResetStream(f *RSTStreamFrame) error {
 // Ping sends a PING frame to the server and waits for the ack.
 func (cc *ClientConn) Ping(ctx context.Context) error {
 	c := make(chan struct{})
-	// Generate a random payload
 	var p [8]byte
-	for {
-		if _, err := rand.Read(p[:]); err != nil {
-			return err
-		}
+	if payload := cc.t.PingPayload; payload != nil {
 		cc.mu.Lock()
-		// check for dup before insert
-		if _, found := cc.pings[p]; !found {
+		p = payload(cc.pingSeq)
+		cc.pingSeq++
+		if inflight, found := cc.pings[p]; found {
+			// the ack of the ping in flight is for this one as well.
+			c = inflight
+		} else {
 			cc.pings[p] = c
-			cc.mu.Unlock()
-			break
 		}
 		cc.mu.Unlock()
+	} else {
+		// Generate a random payload
+		for {
+			if _, err := rand.Read(p[:]); err != nil {
+				return err
+			}
+			cc.mu.Lock()
+			// check for dup before insert
+			if _, found := cc.pings[p]; !found {
+				cc.pings[p] = c
+				cc.mu.Unlock()
+				break
+			}
+			cc.mu.Unlock()
+		}
 	}
 	var pingError error
 	errc := make(chan struct{})
@@ -3196,6 +3351,12 @@ func (rt erringRoundTripper) RoundTrip(*http.Request) (*http.Response, error) {
 
 // isConnectionCloseRequest reports whether req should use its own
 // connection for a single request and then close the connection.
+// isExtendedConnectRequest reports whether req is an extended CONNECT request
+// (RFC 8441), whose protocol is carried by req.Proto, e.g. "websocket".
+func isExtendedConnectRequest(req *http.Request) bool {
+	return req.Method == http.MethodConnect && req.Proto != "" && req.Proto != "HTTP/1.1"
+}
+
 func isConnectionCloseRequest(req *http.Request) bool {
 	return req.Close || httpguts.HeaderValuesContainsToken(req.Header["Connection"], "close")
 }
@@ -108,6 +108,12 @@ func (r *hijackableBody) Read(b []byte) (int, error) {
 	return n, maybeReplaceError(err)
 }
 
+func (r *hijackableBody) StreamID() quic.StreamID { return r.body.StreamID() }
+
+// Connection returns the connection of the response stream, which is used by
+// WebTransport to create streams on the connection of the session.
+func (r *hijackableBody) Connection() *Conn { return r.body.str.conn }
+
 func (r *hijackableBody) requestDone() {
 	if r.reqDone != nil {
 		r.reqDoneOnce.Do(func() {
@@ -6,12 +6,13 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
-	"maps"
+	"math/rand"
 	"net/http"
 	"net/http/httptrace"
 	"net/textproto"
 	"time"
 
+	"github.com/imroc/req/v3/http3"
 	"github.com/imroc/req/v3/internal/dump"
 	"github.com/imroc/req/v3/internal/transport"
 	"github.com/quic-go/quic-go"
@@ -33,6 +34,7 @@ const (
 const (
 	defaultUserAgent              = "quic-go HTTP/3"
 	defaultMaxResponseHeaderBytes = 10 * 1 << 20 // 10 MB
+	defaultMaxFrameSize           = 16 * 1 << 20 // 16 MB
 )
 
 type errConnUnusable struct{ e error }
@@ -56,9 +58,15 @@ type ClientConn struct {
 	// If a QUICConfig is set, datagram support also needs to be enabled on the QUIC layer by setting enableDatagrams.
 	enableDatagrams bool
 
+	// Enable sending SETTINGS_ENABLE_CONNECT_PROTOCOL (RFC 9220).
+	enableExtendedConnect bool
+
+	// Enable sending a GREASE setting and a GREASE frame on the control stream.
+	enableGREASE bool
+
 	// Additional HTTP/3 settings.
 	// It is invalid to specify any settings defined by RFC 9114 (HTTP/3) and RFC 9297 (HTTP Datagrams).
-	additionalSettings map[uint64]uint64
+	additionalSettings []http3.Setting
 
 	// maxResponseHeaderBytes specifies a limit on how many response bytes are
 	// allowed in the server's response header.
@@ -83,19 +91,26 @@ func newClientConn(
 	opts *transport.Options,
 	conn *quic.Conn,
 	enableDatagrams bool,
-	additionalSettings map[uint64]uint64,
+	enableExtendedConnect bool,
+	enableGREASE bool,
+	additionalSettings []http3.Setting,
 	streamHijacker func(FrameType, quic.ConnectionTracingID, *quic.Stream, error) (hijacked bool, err error),
 	uniStreamHijacker func(StreamType, quic.ConnectionTracingID, *quic.ReceiveStream, error) (hijacked bool),
 	maxResponseHeaderBytes int,
+	maxFrameSize uint64,
+	frameHandler func(FrameType, io.Reader) (processed bool, err error),
+	datagramHandler func(quic.StreamID, []byte),
 	disableCompression bool,
 	logger *slog.Logger,
 ) *ClientConn {
 	c := &ClientConn{
-		Options:            opts,
-		enableDatagrams:    enableDatagrams,
-		additionalSettings: additionalSettings,
-		disableCompression: disableCompression,
-		logger:             logger,
+		Options:               opts,
+		enableDatagrams:       enableDatagrams,
+		enableExtendedConnect: enableExtendedConnect,
+		enableGREASE:          enableGREASE,
+		additionalSettings:    additionalSettings,
+		disableCompression:    disableCompression,
+		logger:                logger,
 	}
 	if maxResponseHeaderBytes <= 0 {
 		c.maxResponseHeaderBytes = defaultMaxResponseHeaderBytes
@@ -113,6 +128,9 @@ func newClientConn(
 		0,
 		opts,
 	)
+	c.conn.maxFrameSize = maxFrameSize
+	c.conn.frameHandler = frameHandler
+	c.conn.datagramHandler = datagramHandler
 	// send the SETTINGs frame, using 0-RTT data, if possible
 	go func() {
 		if err := c.setupConn(); err != nil {
@@ -143,18 +161,24 @@ func (c *ClientConn) setupConn() error {
 	b := make([]byte, 0, 64)
 	b = quicvarint.Append(b, streamTypeControlStream)
 	// send the SETTINGS frame
-	b = (&settingsFrame{
-		Datagram:            c.enableDatagrams,
-		Other:               c.additionalSettings,
-		MaxFieldSectionSize: int64(c.maxResponseHeaderBytes),
-	}).Append(b)
+	settings := c.settings()
+	b = settings.Append(b)
 	if c.conn.qlogger != nil {
-		sf := qlog.SettingsFrame{
-			MaxFieldSectionSize: int64(c.maxResponseHeaderBytes),
-			Other:               maps.Clone(c.additionalSettings),
-		}
-		if c.enableDatagrams {
-			sf.Datagram = pointer(true)
+		sf := qlog.SettingsFrame{MaxFieldSectionSize: -1}
+		for _, setting := range settings {
+			switch setting.ID {
+			case settingMaxFieldSectionSize:
+				sf.MaxFieldSectionSize = int64(setting.Val)
+			case settingDatagram:
+				sf.Datagram = pointer(setting.Val == 1)
+			case settingExtendedConnect:
+				sf.ExtendedConnect = pointer(setting.Val == 1)
+			default:
+				if sf.Other == nil {
+					sf.Other = make(map[uint64]uint64)
+				}
+				sf.Other[uint64(setting.ID)] = setting.Val
+			}
 		}
 		c.conn.qlogger.RecordEvent(qlog.FrameCreated{
 			StreamID: str.StreamID(),
@@ -162,10 +186,35 @@ func (c *ClientConn) setupConn() error {
 			Frame:    qlog.Frame{Frame: sf},
 		})
 	}
+	if c.enableGREASE {
+		b = appendGreaseFrame(b)
+	}
 	_, err = str.Write(b)
 	return err
 }
 
+// settings returns the ordered settings sent in the SETTINGS frame, the
+// default settings are sent first unless they are overridden in the
+// additional settings, and the GREASE setting is sent last.
+func (c *ClientConn) settings() settings {
+	s := make(settings, 0, len(c.additionalSettings)+3)
+	add := settings(c.additionalSettings)
+	if !add.has(settingMaxFieldSectionSize) {
+		s = append(s, http3.Setting{ID: settingMaxFieldSectionSize, Val: uint64(c.maxResponseHeaderBytes)})
+	}
+	if c.enableDatagrams && !add.has(settingDatagram) {
+		s = append(s, http3.Setting{ID: settingDatagram, Val: 1})
+	}
+	if c.enableExtendedConnect && !add.has(settingExtendedConnect) {
+		s = append(s, http3.Setting{ID: settingExtendedConnect, Val: 1})
+	}
+	s = append(s, add...)
+	if c.enableGREASE {
+		s = append(s, http3.Setting{ID: http3.SettingID(greaseID()), Val: uint64(rand.Uint32())})
+	}
+	return s
+}
+
 func (c *ClientConn) handleBidirectionalStreams(streamHijacker func(FrameType, quic.ConnectionTracingID, *quic.Stream, error) (hijacked bool, err error)) {
 	for {
 		str, err := c.conn.conn.AcceptStream(context.Background())
@@ -176,8 +225,10 @@ func (c *ClientConn) handleBidirectionalStreams(streamHijacker func(FrameType, q
 			return
 		}
 		fp := &frameParser{
-			r:         str,
-			closeConn: c.conn.CloseWithError,
+			r:            str,
+			closeConn:    c.conn.CloseWithError,
+			maxFrameSize: c.conn.maxFrameSize,
+			frameHandler: c.conn.frameHandler,
 			unknownFrameHandler: func(ft FrameType, e error) (processed bool, err error) {
 				id := c.conn.Context().Value(quic.ConnectionTracingKey).(quic.ConnectionTracingID)
 				return streamHijacker(ft, id, str, e)
@@ -240,7 +291,7 @@ func (c *ClientConn) roundTrip(req *http.Request) (*http.Response, error) {
 			return nil, context.Cause(connCtx)
 		}
 		if !c.conn.Settings().EnableExtendedConnect {
-			return nil, errors.New("http3: server didn't enable Extended CONNECT")
+			return nil, http3.ErrExtendedConnectNotSupported
 		}
 	}
 
@@ -435,3 +486,7 @@ func (c *ClientConn) doRequest(req *http.Request, str *RequestStream) (*http.Res
 func (c *ClientConn) Conn() *Conn {
 	return c.conn
 }
+
+func (c *ClientConn) goingAway() bool {
+	return c.conn.goingAway()
+}
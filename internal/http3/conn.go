@@ -13,6 +13,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/imroc/req/v3/http3"
 	"github.com/imroc/req/v3/internal/transport"
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3/qlog"
@@ -26,6 +27,10 @@ const maxQuarterStreamID = 1<<60 - 1
 
 var errGoAway = errors.New("connection in graceful shutdown")
 
+// StreamIDHookKey is the context key of a func(quic.StreamID) which is
+// called with the ID of the request stream once it's opened.
+type StreamIDHookKey struct{}
+
 // invalidStreamID is a stream ID that is invalid. The first valid stream ID in QUIC is 0.
 const invalidStreamID = quic.StreamID(-1)
 
@@ -43,6 +48,17 @@ type Conn struct {
 
 	enableDatagrams bool
 
+	// maxFrameSize is the maximum payload size of the received frames
+	// which are not SETTINGS frames, zero means defaultMaxFrameSize.
+	maxFrameSize uint64
+
+	// frameHandler is called with the payload of the received unknown frames.
+	frameHandler func(FrameType, io.Reader) (processed bool, err error)
+
+	// datagramHandler is called with the received datagrams instead of
+	// queuing them on the streams.
+	datagramHandler func(quic.StreamID, []byte)
+
 	decoder *qpack.Decoder
 
 	streamMx     sync.Mutex
@@ -146,6 +162,13 @@ func (c *Conn) clearStream(id quic.StreamID) {
 	}
 }
 
+// goingAway reports whether the server has sent GOAWAY on the connection.
+func (c *Conn) goingAway() bool {
+	c.streamMx.Lock()
+	defer c.streamMx.Unlock()
+	return c.maxStreamID != invalidStreamID
+}
+
 func (c *Conn) openRequestStream(
 	ctx context.Context,
 	requestWriter *requestWriter,
@@ -177,6 +200,9 @@ func (c *Conn) openRequestStream(
 	c.streams[str.StreamID()] = hstr
 	c.lastStreamID = str.StreamID()
 	c.streamMx.Unlock()
+	if hook, ok := ctx.Value(StreamIDHookKey{}).(func(quic.StreamID)); ok {
+		hook(str.StreamID())
+	}
 	rsp := &http.Response{}
 	trace := httptrace.ContextClientTrace(ctx)
 	return newRequestStream(
@@ -309,7 +335,7 @@ func (c *Conn) handleUnidirectionalStreams(hijack func(StreamType, quic.Connecti
 }
 
 func (c *Conn) handleControlStream(str *quic.ReceiveStream) {
-	fp := &frameParser{closeConn: c.conn.CloseWithError, r: str, streamID: str.StreamID()}
+	fp := &frameParser{closeConn: c.conn.CloseWithError, r: str, streamID: str.StreamID(), maxFrameSize: c.maxFrameSize, frameHandler: c.frameHandler}
 	f, err := fp.ParseNext(c.qlogger)
 	if err != nil {
 		var serr *quic.StreamError
@@ -385,6 +411,9 @@ func (c *Conn) handleControlStream(str *quic.ReceiveStream) {
 		c.maxStreamID = goaway.StreamID
 		hasActiveStreams := len(c.streams) > 0
 		c.streamMx.Unlock()
+		if c.Options != nil && c.HTTP3GoAwayHandler != nil {
+			go c.HTTP3GoAwayHandler(c.conn.RemoteAddr().String(), http3.GoAway{StreamID: goaway.StreamID})
+		}
 
 		// immediately close the connection if there are currently no active requests
 		if !hasActiveStreams {
@@ -412,6 +441,31 @@ func (c *Conn) sendDatagram(streamID quic.StreamID, b []byte) error {
 	return c.conn.SendDatagram(data)
 }
 
+// sendStreamDatagram sends a datagram associated with the active stream,
+// it returns an error if datagrams are not negotiated with the peer.
+func (c *Conn) sendStreamDatagram(streamID quic.StreamID, b []byte) error {
+	if !c.enableDatagrams {
+		return http3.ErrDatagramNotEnabled
+	}
+	select {
+	case <-c.receivedSettings:
+	default:
+		return errors.New("http3: the settings of the peer are not received yet")
+	}
+	if !c.settings.EnableDatagrams {
+		return http3.ErrDatagramNotSupported
+	}
+	return c.sendDatagram(streamID, b)
+}
+
+// hasStream reports whether the stream with streamID is active.
+func (c *Conn) hasStream(streamID quic.StreamID) bool {
+	c.streamMx.Lock()
+	defer c.streamMx.Unlock()
+	_, ok := c.streams[streamID]
+	return ok
+}
+
 func (c *Conn) receiveDatagrams() error {
 	for {
 		b, err := c.conn.ReceiveDatagram(context.Background())
@@ -437,6 +491,10 @@ func (c *Conn) receiveDatagrams() error {
 			return fmt.Errorf("invalid quarter stream id: %w", err)
 		}
 		streamID := quic.StreamID(4 * quarterStreamID)
+		if c.datagramHandler != nil {
+			c.datagramHandler(streamID, b[n:])
+			continue
+		}
 		c.streamMx.Lock()
 		dg, ok := c.streams[streamID]
 		c.streamMx.Unlock()
@@ -0,0 +1,130 @@
+package http3
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/imroc/req/v3/http3"
+	"github.com/imroc/req/v3/internal/testcert"
+	"github.com/imroc/req/v3/internal/transport"
+	"github.com/quic-go/quic-go"
+	quichttp3 "github.com/quic-go/quic-go/http3"
+)
+
+// startDatagramEchoServer starts a http3 server which echoes the datagrams
+// received on the request stream.
+func startDatagramEchoServer(t *testing.T, enableDatagrams bool) string {
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &quichttp3.Server{
+		TLSConfig:       quichttp3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+		EnableDatagrams: enableDatagrams,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+			str := w.(quichttp3.HTTPStreamer).HTTPStream()
+			if b, err := str.ReceiveDatagram(r.Context()); err == nil {
+				str.SendDatagram(b)
+			}
+			io.Copy(io.Discard, r.Body)
+		}),
+	}
+	go srv.Serve(conn)
+	t.Cleanup(func() { srv.Close() })
+	return conn.LocalAddr().String()
+}
+
+func newDatagramTransport(handler func(quic.StreamID, []byte)) *Transport {
+	return &Transport{
+		Options:         &transport.Options{},
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		EnableDatagrams: true,
+		DatagramHandler: handler,
+	}
+}
+
+// openStream sends a request whose body is kept open, and returns the stream
+// ID of the request.
+func openStream(t *testing.T, tr *Transport, addr string) quic.StreamID {
+	pr, pw := io.Pipe()
+	t.Cleanup(func() { pw.Close() })
+	req, _ := http.NewRequest(http.MethodPost, "https://"+addr, pr)
+	resp, err := tr.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp.Body.(interface{ StreamID() quic.StreamID }).StreamID()
+}
+
+func TestSendDatagram(t *testing.T) {
+	addr := startDatagramEchoServer(t, true)
+	received := make(chan []byte, 1)
+	tr := newDatagramTransport(func(id quic.StreamID, b []byte) {
+		received <- b
+	})
+	defer tr.Close()
+	id := openStream(t, tr, addr)
+	if err := tr.SendDatagram(id+4, []byte("hello")); err == nil {
+		t.Fatal("expected an error for inactive stream")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		// the settings of the server may not be received yet.
+		err := tr.SendDatagram(id, []byte("hello"))
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case b := <-received:
+		if string(b) != "hello" {
+			t.Fatalf("unexpected datagram %q", b)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for the echoed datagram")
+	}
+}
+
+func TestSendDatagramNotSupported(t *testing.T) {
+	addr := startDatagramEchoServer(t, false)
+	tr := newDatagramTransport(nil)
+	defer tr.Close()
+	id := openStream(t, tr, addr)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		err := tr.SendDatagram(id, []byte("hello"))
+		if errors.Is(err, http3.ErrDatagramNotSupported) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected ErrDatagramNotSupported, got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	tr = newDatagramTransport(nil)
+	tr.EnableDatagrams = false
+	defer tr.Close()
+	id = openStream(t, tr, addr)
+	if err := tr.SendDatagram(id, []byte("hello")); !errors.Is(err, http3.ErrDatagramNotEnabled) {
+		t.Fatalf("expected ErrDatagramNotEnabled, got %v", err)
+	}
+}
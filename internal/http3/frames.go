@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"io"
 	"maps"
+	"math/rand"
+	"slices"
 
+	"github.com/imroc/req/v3/http3"
 	"github.com/quic-go/quic-go"
 	"github.com/quic-go/quic-go/http3/qlog"
 	"github.com/quic-go/quic-go/qlogwriter"
@@ -14,7 +17,7 @@ import (
 )
 
 // FrameType is the frame type of a HTTP/3 frame
-type FrameType uint64
+type FrameType = http3.FrameType
 
 type unknownFrameHandlerFunc func(FrameType, error) (processed bool, err error)
 
@@ -50,6 +53,12 @@ type frameParser struct {
 	streamID            quic.StreamID
 	closeConn           func(quic.ApplicationErrorCode, string) error
 	unknownFrameHandler unknownFrameHandlerFunc
+	// maxFrameSize is the maximum payload size of the frames other than
+	// SETTINGS, zero means defaultMaxFrameSize.
+	maxFrameSize uint64
+	// frameHandler is called with the payload of unknown frames, the payload
+	// is not skipped if it returns processed.
+	frameHandler func(FrameType, io.Reader) (processed bool, err error)
 }
 
 func (p *frameParser) ParseNext(qlogger qlogwriter.Recorder) (frame, error) {
@@ -83,6 +92,10 @@ func (p *frameParser) ParseNext(qlogger qlogwriter.Recorder) (frame, error) {
 		if err != nil {
 			return nil, err
 		}
+		if max := p.frameSizeLimit(); t != 0x4 && l > max {
+			p.closeConn(quic.ApplicationErrorCode(ErrCodeExcessiveLoad), "")
+			return nil, fmt.Errorf("http3: frame of type %d too large: %d bytes (max: %d)", t, l, max)
+		}
 
 		switch t {
 		case 0x0: // DATA
@@ -122,14 +135,8 @@ func (p *frameParser) ParseNext(qlogger qlogwriter.Recorder) (frame, error) {
 			}
 		case 0x7: // GOAWAY
 			return parseGoAwayFrame(r, l, p.streamID, qlogger)
-		case 0xd: // unsupported: MAX_PUSH_ID
-			if qlogger != nil {
-				qlogger.RecordEvent(qlog.FrameParsed{
-					StreamID: p.streamID,
-					Raw:      qlog.RawInfo{Length: r.NumRead, PayloadLength: int(l)},
-					Frame:    qlog.Frame{Frame: qlog.MaxPushIDFrame{}},
-				})
-			}
+		case 0xd: // MAX_PUSH_ID
+			return parseMaxPushIDFrame(r, l, p.streamID, qlogger)
 		case 0x2, 0x6, 0x8, 0x9: // reserved frame types
 			if qlogger != nil {
 				qlogger.RecordEvent(qlog.FrameParsed{
@@ -139,7 +146,7 @@ func (p *frameParser) ParseNext(qlogger qlogwriter.Recorder) (frame, error) {
 				})
 			}
 			p.closeConn(quic.ApplicationErrorCode(ErrCodeFrameUnexpected), "")
-			return nil, fmt.Errorf("http3: reserved frame type: %d", t)
+			return nil, &http3.FrameError{Type: FrameType(t)}
 		default:
 			// unknown frame types
 			if qlogger != nil {
@@ -149,6 +156,20 @@ func (p *frameParser) ParseNext(qlogger qlogwriter.Recorder) (frame, error) {
 					Frame:    qlog.Frame{Frame: qlog.UnknownFrame{Type: t}},
 				})
 			}
+			if p.frameHandler != nil {
+				payload := &io.LimitedReader{R: r, N: int64(l)}
+				processed, err := p.frameHandler(FrameType(t), payload)
+				if err != nil {
+					return nil, err
+				}
+				if processed {
+					// the handler is responsible for consuming the payload
+					r.Reset()
+					continue
+				}
+				// only skip over the payload which is not consumed by the handler
+				l = uint64(payload.N)
+			}
 		}
 
 		// skip over the payload
@@ -159,6 +180,13 @@ func (p *frameParser) ParseNext(qlogger qlogwriter.Recorder) (frame, error) {
 	}
 }
 
+func (p *frameParser) frameSizeLimit() uint64 {
+	if p.maxFrameSize > 0 {
+		return p.maxFrameSize
+	}
+	return defaultMaxFrameSize
+}
+
 type dataFrame struct {
 	Length uint64
 }
@@ -281,37 +309,77 @@ func parseSettingsFrame(r *countingByteReader, l uint64, streamID quic.StreamID,
 	return frame, nil
 }
 
-func (f *settingsFrame) Append(b []byte) []byte {
+// settings is the send-side representation of the SETTINGS frame, the
+// settings are sent in order.
+type settings []http3.Setting
+
+func (s settings) Append(b []byte) []byte {
 	b = quicvarint.Append(b, 0x4)
 	var l int
-	if f.MaxFieldSectionSize >= 0 {
-		l += quicvarint.Len(settingMaxFieldSectionSize) + quicvarint.Len(uint64(f.MaxFieldSectionSize))
-	}
-	for id, val := range f.Other {
-		l += quicvarint.Len(id) + quicvarint.Len(val)
-	}
-	if f.Datagram {
-		l += quicvarint.Len(settingDatagram) + quicvarint.Len(1)
-	}
-	if f.ExtendedConnect {
-		l += quicvarint.Len(settingExtendedConnect) + quicvarint.Len(1)
+	for _, setting := range s {
+		l += quicvarint.Len(uint64(setting.ID)) + quicvarint.Len(setting.Val)
 	}
 	b = quicvarint.Append(b, uint64(l))
-	if f.MaxFieldSectionSize >= 0 {
-		b = quicvarint.Append(b, settingMaxFieldSectionSize)
-		b = quicvarint.Append(b, uint64(f.MaxFieldSectionSize))
+	for _, setting := range s {
+		b = quicvarint.Append(b, uint64(setting.ID))
+		b = quicvarint.Append(b, setting.Val)
 	}
-	if f.Datagram {
-		b = quicvarint.Append(b, settingDatagram)
-		b = quicvarint.Append(b, 1)
+	return b
+}
+
+// has reports whether the setting with id is set.
+func (s settings) has(id http3.SettingID) bool {
+	return slices.ContainsFunc(s, func(setting http3.Setting) bool {
+		return setting.ID == id
+	})
+}
+
+type maxPushIDFrame struct {
+	PushID uint64
+}
+
+func parseMaxPushIDFrame(r *countingByteReader, l uint64, streamID quic.StreamID, qlogger qlogwriter.Recorder) (*maxPushIDFrame, error) {
+	frame := &maxPushIDFrame{}
+	startLen := r.NumRead
+	id, err := quicvarint.Read(r)
+	if err != nil {
+		return nil, err
+	}
+	if r.NumRead-startLen != int(l) {
+		return nil, errors.New("MAX_PUSH_ID frame: inconsistent length")
 	}
-	if f.ExtendedConnect {
-		b = quicvarint.Append(b, settingExtendedConnect)
-		b = quicvarint.Append(b, 1)
+	frame.PushID = id
+	if qlogger != nil {
+		qlogger.RecordEvent(qlog.FrameParsed{
+			StreamID: streamID,
+			Raw:      qlog.RawInfo{Length: r.NumRead, PayloadLength: int(l)},
+			Frame:    qlog.Frame{Frame: qlog.MaxPushIDFrame{}},
+		})
 	}
-	for id, val := range f.Other {
-		b = quicvarint.Append(b, id)
-		b = quicvarint.Append(b, val)
+	return frame, nil
+}
+
+func (f *maxPushIDFrame) Append(b []byte) []byte {
+	b = quicvarint.Append(b, 0xd)
+	b = quicvarint.Append(b, uint64(quicvarint.Len(f.PushID)))
+	return quicvarint.Append(b, f.PushID)
+}
+
+// greaseID returns a random reserved identifier of the form 0x1f * N + 0x21,
+// which is used by GREASE settings and frame types (RFC 9114, Section 7.2.4.1
+// and 7.2.8).
+func greaseID() uint64 {
+	return 0x1f*uint64(rand.Uint32()) + 0x21
+}
+
+// appendGreaseFrame appends a reserved frame with a random type and a random
+// payload of up to 16 bytes.
+func appendGreaseFrame(b []byte) []byte {
+	b = quicvarint.Append(b, greaseID())
+	l := rand.Intn(17)
+	b = quicvarint.Append(b, uint64(l))
+	for range l {
+		b = append(b, byte(rand.Intn(256)))
 	}
 	return b
 }
@@ -0,0 +1,174 @@
+package http3
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/imroc/req/v3/http3"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+func TestSettingsAppendOrder(t *testing.T) {
+	c := &ClientConn{
+		enableDatagrams:        true,
+		maxResponseHeaderBytes: 0x40,
+		additionalSettings: []http3.Setting{
+			{ID: 0x7, Val: 0x14},
+			{ID: 0x1, Val: 0x10},
+			{ID: settingDatagram, Val: 1},
+		},
+	}
+	b := c.settings().Append(nil)
+	want := []byte{
+		0x04, 0x09, // type and length
+		0x06, 0x40, 0x40, // max field section size sent by default
+		0x07, 0x14,
+		0x01, 0x10,
+		0x33, 0x01, // overrides the default datagram setting
+	}
+	if !bytes.Equal(b, want) {
+		t.Fatalf("settings frame is %x; want %x", b, want)
+	}
+
+	r := &countingByteReader{Reader: bytes.NewReader(b[2:])}
+	f, err := parseSettingsFrame(r, uint64(len(b)-2), 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.MaxFieldSectionSize != 0x40 || !f.Datagram || f.Other[0x7] != 0x14 || f.Other[0x1] != 0x10 {
+		t.Fatalf("unexpected settings frame %+v", f)
+	}
+}
+
+func TestGreaseFrame(t *testing.T) {
+	c := &ClientConn{enableGREASE: true}
+	s := c.settings()
+	grease := s[len(s)-1]
+	if (uint64(grease.ID)-0x21)%0x1f != 0 {
+		t.Fatalf("setting %v is not a GREASE setting", grease)
+	}
+
+	b := appendGreaseFrame(nil)
+	r := &countingByteReader{Reader: bytes.NewReader(b)}
+	typ, err := quicvarint.Read(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if (typ-0x21)%0x1f != 0 {
+		t.Fatalf("frame type 0x%x is not a GREASE frame type", typ)
+	}
+	l, err := quicvarint.Read(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l > 16 || int(l) != len(b)-r.NumRead {
+		t.Fatalf("unexpected GREASE frame payload length %d", l)
+	}
+}
+
+func TestParseMaxPushIDFrame(t *testing.T) {
+	b := (&maxPushIDFrame{PushID: 1000}).Append(nil)
+	fp := frameParser{r: bytes.NewReader(b)}
+	f, err := fp.ParseNext(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mf, ok := f.(*maxPushIDFrame)
+	if !ok || mf.PushID != 1000 {
+		t.Fatalf("unexpected frame %#v", f)
+	}
+
+	// the length of the frame does not match the varint.
+	b = []byte{0xd, 0x3, 0x40, 0x10, 0x0}
+	fp = frameParser{r: bytes.NewReader(b)}
+	if _, err := fp.ParseNext(nil); err == nil {
+		t.Fatal("expected an error for inconsistent length")
+	}
+}
+
+func TestParseReservedFrame(t *testing.T) {
+	var code quic.ApplicationErrorCode
+	fp := frameParser{
+		r: bytes.NewReader([]byte{0x6, 0x0}),
+		closeConn: func(c quic.ApplicationErrorCode, _ string) error {
+			code = c
+			return nil
+		},
+	}
+	_, err := fp.ParseNext(nil)
+	var fe *http3.FrameError
+	if !errors.As(fmt.Errorf("wrapped: %w", err), &fe) {
+		t.Fatalf("expected a FrameError, got %v", err)
+	}
+	if fe.Type != 0x6 {
+		t.Fatalf("unexpected frame type %v", fe.Type)
+	}
+	if code != quic.ApplicationErrorCode(ErrCodeFrameUnexpected) {
+		t.Fatalf("unexpected error code %v", code)
+	}
+}
+
+func TestParseFrameTooLarge(t *testing.T) {
+	var code quic.ApplicationErrorCode
+	closeConn := func(c quic.ApplicationErrorCode, _ string) error {
+		code = c
+		return nil
+	}
+	// an unknown frame announcing a payload larger than the limit.
+	b := quicvarint.Append([]byte{0x21}, 1025)
+	fp := frameParser{r: bytes.NewReader(b), closeConn: closeConn, maxFrameSize: 1024}
+	if _, err := fp.ParseNext(nil); err == nil {
+		t.Fatal("expected an error for too large frame")
+	}
+	if code != quic.ApplicationErrorCode(ErrCodeExcessiveLoad) {
+		t.Fatalf("unexpected error code %v", code)
+	}
+
+	b = quicvarint.Append([]byte{0x0}, 1024)
+	fp = frameParser{r: bytes.NewReader(b), closeConn: closeConn, maxFrameSize: 1024}
+	f, err := fp.ParseNext(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if df, ok := f.(*dataFrame); !ok || df.Length != 1024 {
+		t.Fatalf("unexpected frame %#v", f)
+	}
+}
+
+func TestParseUnknownFrameHandler(t *testing.T) {
+	var b []byte
+	b = append(quicvarint.Append(b, 0x21), 0x3, 'f', 'o', 'o')
+	b = append(quicvarint.Append(b, 0x40), 0x3, 'b', 'a', 'r')
+	b = (&dataFrame{Length: 0}).Append(b)
+	var payloads []string
+	fp := frameParser{
+		r: bytes.NewReader(b),
+		frameHandler: func(ft FrameType, r io.Reader) (bool, error) {
+			if ft == 0x21 {
+				// consume the whole payload.
+				p, err := io.ReadAll(r)
+				payloads = append(payloads, string(p))
+				return true, err
+			}
+			// consume part of the payload, the rest is skipped.
+			p := make([]byte, 1)
+			_, err := io.ReadFull(r, p)
+			payloads = append(payloads, string(p))
+			return false, err
+		},
+	}
+	f, err := fp.ParseNext(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := f.(*dataFrame); !ok {
+		t.Fatalf("unexpected frame %#v", f)
+	}
+	if len(payloads) != 2 || payloads[0] != "foo" || payloads[1] != "b" {
+		t.Fatalf("unexpected payloads %q", payloads)
+	}
+}
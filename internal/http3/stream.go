@@ -66,9 +66,11 @@ func newStream(
 		qlogger:        qlogger,
 		parseTrailer:   parseTrailer,
 		frameParser: &frameParser{
-			r:         &tracingReader{Reader: str, trace: trace},
-			streamID:  str.StreamID(),
-			closeConn: conn.CloseWithError,
+			r:            &tracingReader{Reader: str, trace: trace},
+			streamID:     str.StreamID(),
+			closeConn:    conn.CloseWithError,
+			maxFrameSize: conn.maxFrameSize,
+			frameHandler: conn.frameHandler,
 		},
 	}
 }
@@ -357,7 +359,8 @@ func (s *RequestStream) ReadResponse() (*http.Response, error) {
 	}
 	decodeFn := s.decoder.Decode(headerBlock)
 	var hfs []qpack.HeaderField
-	if s.str.qlogger != nil {
+	hook := transport.ResponseHeaderOrderHook(s.ctx)
+	if s.str.qlogger != nil || hook != nil {
 		hfs = make([]qpack.HeaderField, 0, 16)
 	}
 	res := s.response
@@ -376,6 +379,15 @@ func (s *RequestStream) ReadResponse() (*http.Response, error) {
 		s.str.CancelWrite(quic.StreamErrorCode(errCode))
 		return nil, fmt.Errorf("http3: invalid response: %w", err)
 	}
+	if hook != nil {
+		names := make([]string, 0, len(hfs))
+		for _, hf := range hfs {
+			if !hf.IsPseudo() {
+				names = append(names, hf.Name)
+			}
+		}
+		hook(names)
+	}
 
 	// Check that the server doesn't send more data in DATA frames than indicated by the Content-Length header (if set).
 	// See section 4.1.2 of RFC 9114.
@@ -394,15 +406,12 @@ func (s *RequestStream) ReadResponse() (*http.Response, error) {
 		res.ContentLength = -1
 		s.responseBody = compress.NewGzipReader(respBody)
 		res.Uncompressed = true
-	} else if s.AutoDecompression {
-		contentEncoding := res.Header.Get("Content-Encoding")
-		if contentEncoding != "" {
-			res.Header.Del("Content-Encoding")
-			res.Header.Del("Content-Length")
-			res.ContentLength = -1
-			res.Uncompressed = true
-			res.Body = compress.NewCompressReader(respBody, contentEncoding)
-		}
+	} else if body := s.autoDecompress(res, respBody); body != nil {
+		res.Header.Del("Content-Encoding")
+		res.Header.Del("Content-Length")
+		res.ContentLength = -1
+		res.Uncompressed = true
+		s.responseBody = body
 	} else {
 		s.responseBody = respBody
 	}
@@ -410,6 +419,18 @@ func (s *RequestStream) ReadResponse() (*http.Response, error) {
 	return res, nil
 }
 
+// autoDecompress returns the reader which decodes the response body if the
+// automatic decompression is enabled and the content coding is supported.
+func (s *RequestStream) autoDecompress(res *http.Response, body io.ReadCloser) io.ReadCloser {
+	if !s.AutoDecompression {
+		return nil
+	}
+	if r := compress.NewCompressReader(body, res.Header.Get("Content-Encoding")); r != nil {
+		return r
+	}
+	return nil
+}
+
 type tracingReader struct {
 	io.Reader
 	readFirst bool
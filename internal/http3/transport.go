@@ -17,6 +17,7 @@ import (
 
 	"golang.org/x/net/http/httpguts"
 
+	"github.com/imroc/req/v3/http3"
 	"github.com/imroc/req/v3/internal/transport"
 	"github.com/quic-go/quic-go"
 )
@@ -62,6 +63,18 @@ func (r *roundTripperWithCount) Close() error {
 	return nil
 }
 
+// goingAway reports whether the server has sent GOAWAY on the connection, no
+// new request stream can be opened on it.
+func (r *roundTripperWithCount) goingAway() bool {
+	select {
+	case <-r.dialing:
+	default:
+		return false
+	}
+	ga, ok := r.clientConn.(interface{ goingAway() bool })
+	return ok && ga.goingAway()
+}
+
 // Transport implements the http.RoundTripper interface
 type Transport struct {
 	*transport.Options
@@ -83,15 +96,35 @@ type Transport struct {
 	// If a QUICConfig is set, datagram support also needs to be enabled on the QUIC layer by setting EnableDatagrams.
 	EnableDatagrams bool
 
-	// Additional HTTP/3 settings.
-	// It is invalid to specify any settings defined by RFC 9114 (HTTP/3) and RFC 9297 (HTTP Datagrams).
-	AdditionalSettings map[uint64]uint64
+	// Enable sending SETTINGS_ENABLE_CONNECT_PROTOCOL (RFC 9220).
+	EnableExtendedConnect bool
+
+	// Enable sending a GREASE setting and a GREASE frame on the control stream.
+	EnableGREASE bool
+
+	// Additional HTTP/3 settings, which are sent in order after the default settings.
+	// A setting defined by RFC 9114 (HTTP/3) and RFC 9297 (HTTP Datagrams) overrides the default one.
+	AdditionalSettings []http3.Setting
 
 	// MaxResponseHeaderBytes specifies a limit on how many response bytes are
 	// allowed in the server's response header.
 	// Zero means to use a default limit.
 	MaxResponseHeaderBytes int
 
+	// MaxFrameSize specifies a limit on the payload size of the received
+	// DATA, HEADERS and unknown frames, a larger frame is treated as a
+	// connection error instead of being read or skipped.
+	// Zero means to use a default limit.
+	MaxFrameSize uint64
+
+	// UnknownFrameHandler is called with the payload of the received frames of
+	// unknown types, the payload is skipped unless it returns processed.
+	UnknownFrameHandler func(FrameType, io.Reader) (processed bool, err error)
+
+	// DatagramHandler is called with the received HTTP datagrams (RFC 9297)
+	// and the ID of the stream they are associated with.
+	DatagramHandler func(quic.StreamID, []byte)
+
 	// DisableCompression, if true, prevents the Transport from requesting compression with an
 	// "Accept-Encoding: gzip" request header when the Request contains no existing Accept-Encoding value.
 	// If the Transport requests gzip on its own and gets a gzipped response, it's transparently
@@ -135,10 +168,15 @@ func (t *Transport) init() error {
 				t.Options,
 				conn,
 				t.EnableDatagrams,
+				t.EnableExtendedConnect,
+				t.EnableGREASE,
 				t.AdditionalSettings,
 				t.StreamHijacker,
 				t.UniStreamHijacker,
 				t.MaxResponseHeaderBytes,
+				t.MaxFrameSize,
+				t.UnknownFrameHandler,
+				t.DatagramHandler,
 				t.DisableCompression,
 				t.Logger,
 			)
@@ -328,6 +366,12 @@ func (t *Transport) getClient(ctx context.Context, hostname string, onlyCached b
 	}
 
 	cl, ok := t.clients[hostname]
+	if ok && cl.goingAway() {
+		// the connection is closed by itself once the in-flight requests are
+		// done, the subsequent requests are sent on a new connection.
+		delete(t.clients, hostname)
+		ok = false
+	}
 	if !ok {
 		if onlyCached {
 			return nil, false, ErrNoCachedConn
@@ -369,10 +413,14 @@ func (t *Transport) getClient(ctx context.Context, hostname string, onlyCached b
 
 func (t *Transport) dial(ctx context.Context, hostname string) (*quic.Conn, clientConn, error) {
 	var tlsConf *tls.Config
-	if t.TLSClientConfig == nil {
-		tlsConf = &tls.Config{}
-	} else {
+	switch {
+	case t.TLSClientConfig != nil:
 		tlsConf = t.TLSClientConfig.Clone()
+	case t.Options != nil && t.Options.TLSClientConfig != nil:
+		// fall back to the tls config shared with http1 and http2
+		tlsConf = t.Options.TLSClientConfig.Clone()
+	default:
+		tlsConf = &tls.Config{}
 	}
 	if tlsConf.ServerName == "" {
 		sni, _, err := net.SplitHostPort(hostname)
@@ -452,15 +500,50 @@ func (t *Transport) NewClientConn(conn *quic.Conn) *ClientConn {
 		t.Options,
 		conn,
 		t.EnableDatagrams,
+		t.EnableExtendedConnect,
+		t.EnableGREASE,
 		t.AdditionalSettings,
 		t.StreamHijacker,
 		t.UniStreamHijacker,
 		t.MaxResponseHeaderBytes,
+		t.MaxFrameSize,
+		t.UnknownFrameHandler,
+		t.DatagramHandler,
 		t.DisableCompression,
 		t.Logger,
 	)
 }
 
+// SendDatagram sends an HTTP datagram (RFC 9297) associated with the active
+// request stream with streamID. It returns an error if the stream is not
+// found on exactly one connection, or datagrams are not negotiated with the
+// peer of the connection.
+func (t *Transport) SendDatagram(streamID quic.StreamID, b []byte) error {
+	var conn *Conn
+	t.mutex.Lock()
+	for _, cl := range t.clients {
+		select {
+		case <-cl.dialing:
+		default:
+			continue
+		}
+		cc, ok := cl.clientConn.(*ClientConn)
+		if cl.dialErr != nil || !ok || !cc.conn.hasStream(streamID) {
+			continue
+		}
+		if conn != nil {
+			t.mutex.Unlock()
+			return fmt.Errorf("http3: stream %d is active on multiple connections", streamID)
+		}
+		conn = cc.conn
+	}
+	t.mutex.Unlock()
+	if conn == nil {
+		return fmt.Errorf("http3: no active stream %d", streamID)
+	}
+	return conn.sendStreamDatagram(streamID, b)
+}
+
 // Close closes the QUIC connections that this Transport has used.
 // A Transport cannot be used after it has been closed.
 func (t *Transport) Close() error {
@@ -8,6 +8,8 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/imroc/req/v3/http2"
+	"github.com/imroc/req/v3/http3"
 	"github.com/imroc/req/v3/internal/dump"
 )
 
@@ -58,6 +60,11 @@ type Options struct {
 	// it works even if a proxy is set, can be used to customize the tls fingerprint.
 	TLSHandshakeContext func(ctx context.Context, addr string, plainConn net.Conn) (conn net.Conn, tlsState *tls.ConnectionState, err error)
 
+	// TLSFingerprintKey identifies the tls fingerprint of TLSHandshakeContext,
+	// the idle connections are only reused by the requests with the same key,
+	// so the connections of different fingerprints are never mixed.
+	TLSFingerprintKey string
+
 	// TLSClientConfig specifies the TLS configuration to use with
 	// tls.Client.
 	// If nil, the default configuration is used.
@@ -165,6 +172,14 @@ type Options struct {
 	// Debugf is the optional debug function.
 	Debugf func(format string, v ...any)
 
+	// HTTP2GoAwayHandler is called with the remote address of the
+	// connection and the GOAWAY frame received from the HTTP2 server.
+	HTTP2GoAwayHandler func(addr string, goAway http2.GoAway)
+
+	// HTTP3GoAwayHandler is called with the remote address of the
+	// connection and the GOAWAY frame received from the HTTP3 server.
+	HTTP3GoAwayHandler func(addr string, goAway http3.GoAway)
+
 	Dump *dump.Dumper
 }
 
@@ -179,3 +194,83 @@ func (o Options) Clone() Options {
 	}
 	return oo
 }
+
+// TLSHandshakeTimeoutError is returned when the TLS handshake times out.
+type TLSHandshakeTimeoutError struct{}
+
+func (TLSHandshakeTimeoutError) Timeout() bool   { return true }
+func (TLSHandshakeTimeoutError) Temporary() bool { return true }
+func (TLSHandshakeTimeoutError) Error() string   { return "net/http: TLS handshake timeout" }
+
+type tlsHandshakeTimeoutKey struct{}
+
+// WithTLSHandshakeTimeout returns a copy of ctx which carries the TLS
+// handshake timeout of a single request, which overrides TLSHandshakeTimeout
+// for the connections dialed by the request.
+func WithTLSHandshakeTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, tlsHandshakeTimeoutKey{}, timeout)
+}
+
+// TLSHandshakeTimeoutFor returns the TLS handshake timeout of the connection
+// dialed with ctx, which is the one carried by ctx if any, otherwise
+// TLSHandshakeTimeout.
+func (o *Options) TLSHandshakeTimeoutFor(ctx context.Context) time.Duration {
+	if timeout, ok := ctx.Value(tlsHandshakeTimeoutKey{}).(time.Duration); ok {
+		return timeout
+	}
+	return o.TLSHandshakeTimeout
+}
+
+type http1OnlyKey struct{}
+
+// WithHTTP1Only returns a copy of ctx which tells the TLS handshake of the
+// connection to offer http/1.1 only in the ALPN, e.g. the connection of the
+// websocket.
+func WithHTTP1Only(ctx context.Context) context.Context {
+	return context.WithValue(ctx, http1OnlyKey{}, true)
+}
+
+// IsHTTP1Only reports whether the connection dialed with ctx offers http/1.1
+// only in the ALPN.
+func IsHTTP1Only(ctx context.Context) bool {
+	only, _ := ctx.Value(http1OnlyKey{}).(bool)
+	return only
+}
+
+type proxyKey struct{}
+
+// WithProxy returns a copy of ctx which carries the proxy of the request
+// (nil means no proxy), which overrides the Proxy of the transport, so the
+// proxy is resolved only once for the request.
+func WithProxy(ctx context.Context, proxyURL *url.URL) context.Context {
+	return context.WithValue(ctx, proxyKey{}, proxyURL)
+}
+
+// ProxyFrom returns the proxy carried by ctx, ok is false if there is none.
+func ProxyFrom(ctx context.Context) (proxyURL *url.URL, ok bool) {
+	proxyURL, ok = ctx.Value(proxyKey{}).(*url.URL)
+	return
+}
+
+// ConnPoolKey returns the key of the pooled connections to addr via the proxy
+// carried by ctx, the connections via different proxies are not shared.
+func ConnPoolKey(ctx context.Context, addr string) string {
+	if proxyURL, _ := ProxyFrom(ctx); proxyURL != nil {
+		return addr + "|" + proxyURL.String()
+	}
+	return addr
+}
+
+type responseHeaderOrderHookKey struct{}
+
+// WithResponseHeaderOrderHook returns a copy of ctx which carries the hook
+// called with the names of the response header fields in the received order.
+func WithResponseHeaderOrderHook(ctx context.Context, hook func(names []string)) context.Context {
+	return context.WithValue(ctx, responseHeaderOrderHookKey{}, hook)
+}
+
+// ResponseHeaderOrderHook returns the hook carried by ctx, nil if none.
+func ResponseHeaderOrderHook(ctx context.Context) func(names []string) {
+	hook, _ := ctx.Value(responseHeaderOrderHookKey{}).(func(names []string))
+	return hook
+}
@@ -3,6 +3,7 @@ package req
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"strings"
 	"time"
 
@@ -59,72 +61,110 @@ func closeq(v any) {
 	}
 }
 
-func writeMultipartFormFile(w *multipart.Writer, file *FileUpload, r *Request) error {
+// multipartFile is an opened file of the multipart upload whose content type
+// is detected from the head of the content.
+type multipartFile struct {
+	*FileUpload
+	content     io.ReadCloser
+	head        []byte
+	seeEOF      bool
+	contentType string
+}
+
+func openMultipartFile(file *FileUpload, r *Request) (*multipartFile, error) {
 	content, err := file.GetFileContent()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer content.Close()
 	if r.RetryAttempt > 0 { // reset file reader when retry a multipart file upload
 		if rs, ok := content.(io.ReadSeeker); ok {
 			_, err = rs.Seek(0, io.SeekStart)
 			if err != nil {
-				return err
+				content.Close()
+				return nil, err
 			}
 		}
 	}
 	// Auto detect actual multipart content type
+	f := &multipartFile{FileUpload: file, content: content}
 	cbuf := make([]byte, 512)
-	seeEOF := false
-	lastTime := time.Now()
 	size, err := content.Read(cbuf)
 	if err != nil {
 		if err == io.EOF {
-			seeEOF = true
+			f.seeEOF = true
 		} else {
-			return err
+			content.Close()
+			return nil, err
 		}
 	}
+	f.head = cbuf[:size]
+	f.contentType = file.ContentType
+	if f.contentType == "" {
+		f.contentType = http.DetectContentType(cbuf)
+	}
+	return f, nil
+}
 
-	ct := file.ContentType
-	if ct == "" {
-		ct = http.DetectContentType(cbuf)
+// size returns the size of the file content, or -1 if it's unknown.
+func (f *multipartFile) size() int64 {
+	if f.seeEOF {
+		return int64(len(f.head))
+	}
+	if f.FileSize > 0 {
+		return f.FileSize
 	}
-	pw, err := w.CreatePart(createMultipartHeader(file, ct))
+	return -1
+}
+
+func (f *multipartFile) writeTo(w *multipart.Writer, r *Request) error {
+	defer f.content.Close()
+	lastTime := time.Now()
+	pw, err := w.CreatePart(createMultipartHeader(f.FileUpload, f.contentType))
 	if err != nil {
 		return err
 	}
 
-	if r.forceChunkedEncoding && r.uploadCallback != nil {
+	if (r.forceChunkedEncoding || r.streamMultipart) && r.uploadCallback != nil {
 		pw = &callbackWriter{
 			Writer:    pw,
 			lastTime:  lastTime,
 			interval:  r.uploadCallbackInterval,
-			totalSize: file.FileSize,
+			totalSize: f.FileSize,
 			callback: func(written int64) {
 				r.uploadCallback(UploadInfo{
-					ParamName:    file.ParamName,
-					FileName:     file.FileName,
-					FileSize:     file.FileSize,
+					ParamName:    f.ParamName,
+					FileName:     f.FileName,
+					FileSize:     f.FileSize,
 					UploadedSize: written,
 				})
 			},
 		}
 	}
 
-	if _, err = pw.Write(cbuf[:size]); err != nil {
+	if _, err = pw.Write(f.head); err != nil {
 		return err
 	}
-	if seeEOF {
+	if f.seeEOF {
 		return nil
 	}
 
-	_, err = io.Copy(pw, content)
+	n, err := io.Copy(pw, f.content)
+	if err == nil && r.streamMultipart && f.FileSize > 0 && int64(len(f.head))+n != f.FileSize {
+		// the Content-Length computed from the FileSize is wrong.
+		return fmt.Errorf("the size of file %s is %d, but the FileSize is %d", f.FileName, int64(len(f.head))+n, f.FileSize)
+	}
 	return err
 }
 
-func writeMultiPart(r *Request, w *multipart.Writer) {
-	defer w.Close() // close multipart to write tailer boundary
+func writeMultipartFormFile(w *multipart.Writer, file *FileUpload, r *Request) error {
+	f, err := openMultipartFile(file, r)
+	if err != nil {
+		return err
+	}
+	return f.writeTo(w, r)
+}
+
+func writeMultipartFields(r *Request, w *multipart.Writer) {
 	if len(r.FormData) > 0 {
 		for k, vs := range r.FormData {
 			for _, v := range vs {
@@ -143,6 +183,11 @@ func writeMultiPart(r *Request, w *multipart.Writer) {
 			w.WriteField(key, value)
 		}
 	}
+}
+
+func writeMultiPart(r *Request, w *multipart.Writer) {
+	defer w.Close() // close multipart to write tailer boundary
+	writeMultipartFields(r, w)
 	for _, file := range r.uploadFiles {
 		writeMultipartFormFile(w, file, r)
 	}
@@ -151,8 +196,14 @@ func writeMultiPart(r *Request, w *multipart.Writer) {
 func handleMultiPart(c *Client, r *Request) (err error) {
 	var b string
 	if c.multipartBoundaryFunc != nil {
-		b = c.multipartBoundaryFunc()
+		b, err = c.multipartBoundaryFunc()
+	} else {
+		b, err = c.newMultipartBoundary()
 	}
+	if err != nil {
+		return fmt.Errorf("failed to generate multipart boundary: %w", err)
+	}
+	r.bodyLength = 0
 
 	if r.forceChunkedEncoding {
 		pr, pw := io.Pipe()
@@ -168,6 +219,8 @@ func handleMultiPart(c *Client, r *Request) (err error) {
 			writeMultiPart(r, w)
 			pw.Close() // close pipe writer so that pipe reader could get EOF, and stop upload
 		}()
+	} else if r.streamMultipart {
+		return streamMultiPart(r, b)
 	} else {
 		buf := new(bytes.Buffer)
 		w := multipart.NewWriter(buf)
@@ -184,6 +237,84 @@ func handleMultiPart(c *Client, r *Request) (err error) {
 	return
 }
 
+// streamMultiPart streams the multipart body while sending it like the forced
+// chunked encoding, but the files are opened beforehand to compute the length
+// of the body, which is sent as the Content-Length like the browsers do, the
+// body is sent with chunked encoding only if the size of any file is unknown.
+func streamMultiPart(r *Request, boundary string) error {
+	if len(r.FormData) == 0 && len(r.OrderedFormData)%2 != 0 {
+		return errBadOrderedFormData
+	}
+	files := make([]*multipartFile, 0, len(r.uploadFiles))
+	known := true
+	for _, file := range r.uploadFiles {
+		f, err := openMultipartFile(file, r)
+		if err != nil {
+			for _, f := range files {
+				f.content.Close()
+			}
+			return err
+		}
+		files = append(files, f)
+		if f.size() < 0 {
+			known = false
+		}
+	}
+	newWriter := func(w io.Writer) *multipart.Writer {
+		mw := multipart.NewWriter(w)
+		if len(boundary) > 0 {
+			mw.SetBoundary(boundary)
+		}
+		return mw
+	}
+
+	if known {
+		cw := &countWriter{}
+		w := newWriter(cw)
+		writeMultipartFields(r, w)
+		for _, f := range files {
+			w.CreatePart(createMultipartHeader(f.FileUpload, f.contentType))
+			cw.n += f.size()
+		}
+		w.Close()
+		r.bodyLength = cw.n
+	}
+
+	pr, pw := io.Pipe()
+	r.GetBody = func() (io.ReadCloser, error) {
+		return pr, nil
+	}
+	w := newWriter(pw)
+	r.SetContentType(w.FormDataContentType())
+	go func() {
+		writeMultipartFields(r, w)
+		var err error
+		for i, f := range files {
+			if err = f.writeTo(w, r); err != nil {
+				for _, f := range files[i+1:] {
+					f.content.Close()
+				}
+				break
+			}
+		}
+		if err == nil {
+			err = w.Close()
+		}
+		pw.CloseWithError(err)
+	}()
+	return nil
+}
+
+// countWriter counts the bytes written to it.
+type countWriter struct {
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
 func handleFormData(r *Request) {
 	r.SetContentType(header.FormContentType)
 	r.SetBodyBytes([]byte(r.FormData.Encode()))
@@ -407,6 +538,20 @@ func (r *callbackReader) Read(p []byte) (n int, err error) {
 	return
 }
 
+// parseResponseAcceptCH remembers the client hints requested by the Accept-CH
+// of the https origin, see SetClientHintsAuto.
+func parseResponseAcceptCH(c *Client, r *Response) error {
+	if !c.clientHintsAuto || r.Response == nil || r.Response.Request == nil {
+		return nil
+	}
+	values, ok := r.Header["Accept-Ch"]
+	if !ok || r.Response.Request.URL.Scheme != "https" {
+		return nil
+	}
+	c.acceptCH.Store(urlOrigin(r.Response.Request.URL), parseAcceptCH(values))
+	return nil
+}
+
 func handleDownload(c *Client, r *Response) (err error) {
 	if r.Response == nil || !r.Request.isSaveResponse {
 		return nil
@@ -526,20 +671,85 @@ func parseRequestURL(c *Client, r *Request) error {
 }
 
 func parseRequestHeader(c *Client, r *Request) error {
-	if c.Headers == nil {
+	hdrs := c.Headers
+	if r.impersonateClient != nil {
+		hdrs = r.impersonateClient.Headers
+	}
+	if hdrs == nil {
 		return nil
 	}
 	if r.Headers == nil {
 		r.Headers = make(http.Header)
 	}
-	for k, vs := range c.Headers {
+	for k, vs := range hdrs {
+		if (r.isWebSocket || r.webTransport != nil) && isWebSocketSkippedHeader(k) {
+			continue
+		}
+		if k == HeaderCasingKey {
+			// the casing of the request takes precedence.
+			r.Headers[k] = append(slices.Clone(vs), r.Headers[k]...)
+			continue
+		}
 		if len(r.Headers[k]) == 0 {
 			r.Headers[k] = vs
+			r.mergedHeaderKeys = append(r.mergedHeaderKeys, k)
 		}
 	}
 	return nil
 }
 
+// parseRequestClientHints adds the high entropy client hints requested by the
+// Accept-CH of the origin, see SetClientHintsAuto.
+func parseRequestClientHints(c *Client, r *Request) error {
+	if !c.clientHintsAuto || len(c.clientHintHeaders) == 0 || r.URL == nil {
+		return nil
+	}
+	names, ok := c.acceptCH.Load(urlOrigin(r.URL))
+	if !ok {
+		return nil
+	}
+	for _, name := range names.([]string) {
+		value, ok := c.clientHintHeaders[name]
+		if !ok {
+			continue
+		}
+		if r.Headers == nil {
+			r.Headers = make(http.Header)
+		}
+		if r.Headers.Get(name) == "" {
+			r.Headers.Set(name, value)
+		}
+	}
+	return nil
+}
+
+// parseRequestFetchOrigin sets the origin header of the fetch requests, see
+// ImpersonateFetchMode. Like browsers, it's only sent by the cross-origin
+// requests and the ones whose method is not GET or HEAD. The page is of the
+// origin of the referer if it's set, or of the same origin as the request.
+func parseRequestFetchOrigin(c *Client, r *Request) error {
+	if c.impersonateFetchMode != "cors" || r.URL == nil || r.Headers.Get("origin") != "" {
+		return nil
+	}
+	origin := urlOrigin(r.URL)
+	if referer := r.Headers.Get("referer"); referer != "" {
+		if u, err := url.Parse(referer); err == nil && u.Scheme != "" && u.Host != "" {
+			origin = urlOrigin(u)
+		}
+	}
+	switch r.Method {
+	case "", http.MethodGet, http.MethodHead:
+		if origin == urlOrigin(r.URL) {
+			return nil
+		}
+	}
+	if r.Headers == nil {
+		r.Headers = make(http.Header)
+	}
+	r.Headers.Set("origin", origin)
+	return nil
+}
+
 func parseRequestCookie(c *Client, r *Request) error {
 	if len(c.Cookies) > 0 || r.RetryAttempt <= 0 {
 		r.Cookies = append(r.Cookies, c.Cookies...)
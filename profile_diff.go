@@ -0,0 +1,183 @@
+package req
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/imroc/req/v3/http2"
+	"github.com/imroc/req/v3/http3"
+)
+
+// ProfileDifference is a field which differs between two BrowserProfiles.
+type ProfileDifference struct {
+	// Field is the name of the field, e.g. "HTTP2Settings", "TLS.JA4" or
+	// "Headers[user-agent]".
+	Field string
+	// A is the formatted value of the field in the first profile, it's
+	// "<none>" if the field is not set.
+	A string
+	// B is the formatted value of the field in the second profile, it's
+	// "<none>" if the field is not set.
+	B string
+}
+
+// ProfileDiff is the differences between two BrowserProfiles reported by
+// DiffProfiles.
+type ProfileDiff struct {
+	Differences []ProfileDifference
+}
+
+// Equal reports whether there is no difference.
+func (d ProfileDiff) Equal() bool {
+	return len(d.Differences) == 0
+}
+
+// String returns the report of the differences, one difference per line like
+// `Headers[user-agent]: "Mozilla/5.0 ..." != "Mozilla/5.0 ..."`.
+func (d ProfileDiff) String() string {
+	var sb strings.Builder
+	for _, diff := range d.Differences {
+		fmt.Fprintf(&sb, "%s: %s != %s\n", diff.Field, diff.A, diff.B)
+	}
+	return sb.String()
+}
+
+const profileValueNone = "<none>"
+
+func (d *ProfileDiff) add(field, a, b string) {
+	if a == "" {
+		a = profileValueNone
+	}
+	if b == "" {
+		b = profileValueNone
+	}
+	if a != b {
+		d.Differences = append(d.Differences, ProfileDifference{Field: field, A: a, B: b})
+	}
+}
+
+// DiffProfiles compares the fingerprints of the two profiles field by field,
+// which is useful to find out how a custom profile differs from a built-in one,
+// e.g. DiffProfiles(ChromeProfile(), myProfile). The differences are reported
+// in a stable order: the TLS ClientHello (the ClientHelloID, JA4, cipher
+// suites, extensions, supported groups, signature algorithms and ALPN), the
+// HTTP2 fingerprint, the header order, the headers sorted by name, and the
+// HTTP3 settings. The extensions are sorted as some browsers shuffle them, and
+// GREASE values are excluded. The ClientHello details are not compared if any
+// of them can not be built, e.g. the ClientHelloID is randomized.
+func DiffProfiles(a, b BrowserProfile) ProfileDiff {
+	var d ProfileDiff
+	d.add("ClientHelloID", a.ClientHelloID.Str(), b.ClientHelloID.Str())
+	ha, errA := profileClientHelloInfo(a)
+	hb, errB := profileClientHelloInfo(b)
+	if errA == nil && errB == nil {
+		d.add("TLS.JA4", ha.ja4(), hb.ja4())
+		d.add("TLS.CipherSuites", joinUint16s(ha.cipherSuites, "-", formatDecimal), joinUint16s(hb.cipherSuites, "-", formatDecimal))
+		d.add("TLS.Extensions", joinUint16s(slices.Sorted(slices.Values(ha.extensions)), "-", formatDecimal), joinUint16s(slices.Sorted(slices.Values(hb.extensions)), "-", formatDecimal))
+		d.add("TLS.SupportedGroups", joinUint16s(ha.supportedGroups, "-", formatDecimal), joinUint16s(hb.supportedGroups, "-", formatDecimal))
+		d.add("TLS.SignatureAlgorithms", joinUint16s(ha.signatureAlgorithms, ",", formatHex), joinUint16s(hb.signatureAlgorithms, ",", formatHex))
+		d.add("TLS.ALPN", strings.Join(ha.alpnProtocols, ","), strings.Join(hb.alpnProtocols, ","))
+	}
+	d.add("HTTP2Settings", formatHTTP2Settings(a.HTTP2Settings), formatHTTP2Settings(b.HTTP2Settings))
+	d.add("HTTP2ConnectionFlow", formatUint32(a.HTTP2ConnectionFlow), formatUint32(b.HTTP2ConnectionFlow))
+	d.add("HTTP2PriorityFrames", formatPriorityFrames(a.HTTP2PriorityFrames), formatPriorityFrames(b.HTTP2PriorityFrames))
+	d.add("HTTP2PriorityUpdate", quoteProfileValue(a.HTTP2PriorityUpdate), quoteProfileValue(b.HTTP2PriorityUpdate))
+	d.add("HeaderPriority", formatPriorityParam(a.HeaderPriority), formatPriorityParam(b.HeaderPriority))
+	d.add("PseudoHeaderOrder", strings.Join(a.PseudoHeaderOrder, ","), strings.Join(b.PseudoHeaderOrder, ","))
+	d.add("HeaderOrder", strings.Join(a.HeaderOrder, ","), strings.Join(b.HeaderOrder, ","))
+	keys := make(map[string]bool)
+	for k := range a.Headers {
+		keys[strings.ToLower(k)] = true
+	}
+	for k := range b.Headers {
+		keys[strings.ToLower(k)] = true
+	}
+	for _, k := range slices.Sorted(maps.Keys(keys)) {
+		d.add("Headers["+k+"]", formatProfileHeader(a.Headers, k), formatProfileHeader(b.Headers, k))
+	}
+	d.add("HTTP3Settings", formatHTTP3Settings(a.HTTP3Settings), formatHTTP3Settings(b.HTTP3Settings))
+	return d
+}
+
+// profileClientHelloInfo builds the ClientHello of the profile.
+func profileClientHelloInfo(p BrowserProfile) (*clientHelloInfo, error) {
+	raw, err := marshalClientHello(p.ClientHelloID, p.clientHelloSpec, "example.com", nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseClientHelloInfo(raw)
+}
+
+func formatUint32(v uint32) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.FormatUint(uint64(v), 10)
+}
+
+// formatHTTP2Settings formats the settings like the akamai fingerprint, e.g.
+// "1:65536;2:0;4:6291456".
+func formatHTTP2Settings(settings []http2.Setting) string {
+	ss := make([]string, len(settings))
+	for i, s := range settings {
+		ss[i] = fmt.Sprintf("%d:%d", s.ID, s.Val)
+	}
+	return strings.Join(ss, ";")
+}
+
+// formatPriorityParam formats the priority param as
+// "exclusive:stream_dep:weight", the weight is between 1 and 256.
+func formatPriorityParam(p http2.PriorityParam) string {
+	if p == (http2.PriorityParam{}) {
+		return ""
+	}
+	return formatPriority(p)
+}
+
+func formatPriority(p http2.PriorityParam) string {
+	exclusive := 0
+	if p.Exclusive {
+		exclusive = 1
+	}
+	return fmt.Sprintf("%d:%d:%d", exclusive, p.StreamDep, int(p.Weight)+1)
+}
+
+// formatPriorityFrames formats the frames like the akamai fingerprint, e.g.
+// "3:0:0:201,5:0:0:101".
+func formatPriorityFrames(frames []http2.PriorityFrame) string {
+	ss := make([]string, len(frames))
+	for i, f := range frames {
+		ss[i] = fmt.Sprintf("%d:%s", f.StreamID, formatPriority(f.PriorityParam))
+	}
+	return strings.Join(ss, ",")
+}
+
+func quoteProfileValue(v string) string {
+	if v == "" {
+		return ""
+	}
+	return strconv.Quote(v)
+}
+
+func formatProfileHeader(hdrs map[string]string, key string) string {
+	for k, v := range hdrs {
+		if strings.EqualFold(k, key) {
+			return strconv.Quote(v)
+		}
+	}
+	return ""
+}
+
+func formatHTTP3Settings(s *http3.Settings) string {
+	if s == nil {
+		return ""
+	}
+	ss := []string{fmt.Sprintf("datagram=%t", s.Datagram), fmt.Sprintf("extended_connect=%t", s.ExtendedConnect), fmt.Sprintf("grease=%t", s.GREASE)}
+	for _, setting := range s.Other {
+		ss = append(ss, fmt.Sprintf("%d:%d", uint64(setting.ID), setting.Val))
+	}
+	return strings.Join(ss, ";")
+}
@@ -11,13 +11,16 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/google/go-querystring/query"
 	"github.com/imroc/req/v3/internal/dump"
 	"github.com/imroc/req/v3/internal/header"
+	h3internal "github.com/imroc/req/v3/internal/http3"
 	"github.com/imroc/req/v3/internal/util"
+	"golang.org/x/net/http/httpguts"
 )
 
 // Request struct is used to compose and fire individual request from
@@ -46,6 +49,10 @@ type Request struct {
 	isMultiPart              bool
 	disableAutoReadResponse  bool
 	forceChunkedEncoding     bool
+	streamMultipart          bool
+	isWebSocket              bool
+	extendedConnectProtocol  string
+	webTransport             *h3internal.Transport
 	isSaveResponse           bool
 	close                    bool
 	error                    error
@@ -55,6 +62,7 @@ type Request struct {
 	downloadCallback         DownloadCallback
 	downloadCallbackInterval time.Duration
 	unReplayableBody         io.ReadCloser
+	bodyLength               int64 // the length of the streamed body if it's known
 	retryOption              *retryOption
 	bodyReadCloser           io.ReadCloser
 	dumpOptions              *DumpOptions
@@ -68,6 +76,13 @@ type Request struct {
 	dumpBuffer               *bytes.Buffer
 	responseReturnTime       time.Time
 	afterResponse            []ResponseMiddleware
+	impersonateClient        *Client
+	impersonateProfile       string
+	mergedHeaderKeys         []string // the keys of the headers copied from the client
+	triedProfiles            []string
+	forceHttpVersion         httpVersion
+	tlsHandshakeTimeout      time.Duration
+	rawHeaderBlock           []byte
 }
 
 type GetContentFunc func() (io.ReadCloser, error)
@@ -271,6 +286,7 @@ func (r *Request) SetFileReader(paramName, filename string, reader io.Reader) *R
 			}
 			return io.NopCloser(reader), nil
 		},
+		FileSize: readerLength(reader),
 	})
 	return r
 }
@@ -283,6 +299,7 @@ func (r *Request) SetFileBytes(paramName, filename string, content []byte) *Requ
 		GetFileContent: func() (io.ReadCloser, error) {
 			return io.NopCloser(bytes.NewReader(content)), nil
 		},
+		FileSize: int64(len(content)),
 	})
 	return r
 }
@@ -513,6 +530,9 @@ const (
 	// PseudoHeaderOderKey is the key of pseudo header order, which specifies
 	// the order of the http2 and http3 pseudo header.
 	PseudoHeaderOderKey = "__pseudo_header_order__"
+	// HeaderCasingKey is the key of header casing, which specifies the case
+	// of the http1 header names.
+	HeaderCasingKey = "__header_casing__"
 )
 
 // SetHeaderOrder set the order of the http header (case-insensitive).
@@ -532,6 +552,67 @@ func (r *Request) SetHeaderOrder(keys ...string) *Request {
 	return r
 }
 
+// SetHeaderCasing set the case of the header names sent over HTTP/1.1, which
+// maps the header name (case-insensitive) to the exact name to be sent, e.g.
+// {"sec-ch-ua": "sec-ch-ua", "x-api-key": "X-API-KEY"}, including the headers
+// added automatically such as Host and User-Agent. It overrides the casing set
+// by Client.SetCommonHeaderCasing, the header names are lowercased in HTTP/2 and
+// HTTP/3 regardless.
+func (r *Request) SetHeaderCasing(casing map[string]string) *Request {
+	names, err := headerCasingNames(casing)
+	if err != nil {
+		r.appendError(err)
+		return r
+	}
+	if r.Headers == nil {
+		r.Headers = make(http.Header)
+	}
+	r.Headers[HeaderCasingKey] = append(r.Headers[HeaderCasingKey], names...)
+	return r
+}
+
+// headerCasingNames returns the cased names of casing, which must be the
+// same as the header names case-insensitively.
+func headerCasingNames(casing map[string]string) ([]string, error) {
+	names := make([]string, 0, len(casing))
+	for key, name := range casing {
+		if !strings.EqualFold(key, name) {
+			return nil, fmt.Errorf("header casing %q does not match the header %q", name, key)
+		}
+		if !httpguts.ValidHeaderFieldName(name) {
+			return nil, fmt.Errorf("invalid header name %q", name)
+		}
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// Impersonate impersonates the browser of the named profile (case-insensitive)
+// for this request only, see ImpersonationProfiles for all supported names. The
+// tls fingerprint, http2 settings, header order and the common headers of the
+// profile override the client's ones, and the request is sent with a separate
+// connection pool of the profile, which is created from the client on first
+// use, and recreated when the common headers, proxy or tls settings of the
+// client are changed with its setters.
+func (r *Request) Impersonate(name string) *Request {
+	cc, err := r.client.impersonateClient(name)
+	if err != nil {
+		r.appendError(err)
+		return r
+	}
+	r.impersonateClient = cc
+	r.impersonateProfile = strings.ToLower(name)
+	return r
+}
+
+// GetImpersonateProfile returns the name (lowercase) of the profile
+// impersonated by the request with Impersonate or RetryWithProfileRotation,
+// or empty if the request uses the impersonation of the client.
+func (r *Request) GetImpersonateProfile() string {
+	return r.impersonateProfile
+}
+
 // SetPseudoHeaderOrder set the order of the pseudo http header (case-insensitive).
 // Note this is only valid for http2 and http3.
 // For example:
@@ -673,6 +754,7 @@ func (r *Request) do() (resp *Response, err error) {
 		}
 	}()
 
+	r.rotateImpersonation()
 	for {
 		if r.Headers == nil {
 			r.Headers = make(http.Header)
@@ -866,6 +948,7 @@ func (r *Request) SetBody(body any) *Request {
 	if body == nil {
 		return r
 	}
+	r.bodyLength = 0
 	switch b := body.(type) {
 	case io.ReadCloser:
 		r.unReplayableBody = b
@@ -897,6 +980,43 @@ func (r *Request) SetBody(body any) *Request {
 	return r
 }
 
+// SetBodyReader set the request Body as a stream, which is read while sending
+// the request and never buffered in memory, e.g. to upload a large file. The
+// Content-Length is sent like the browsers do if the size of the body is known
+// without reading it, which is the case for the readers with a Len() int method
+// (e.g. bytes.Reader, strings.Reader and bytes.Buffer) and the regular files,
+// otherwise the body is sent with chunked encoding over HTTP/1.1, or in DATA
+// frames without content-length over HTTP/2 and HTTP/3. Like SetBody with an
+// io.Reader, the request can not be retried.
+func (r *Request) SetBodyReader(body io.Reader) *Request {
+	if body == nil {
+		return r
+	}
+	r.SetBody(body)
+	r.bodyLength = readerLength(body)
+	return r
+}
+
+// readerLength returns the remaining length of the reader if it's known
+// without reading it, or 0 if it's unknown.
+func readerLength(body io.Reader) int64 {
+	switch b := body.(type) {
+	case interface{ Len() int }:
+		return int64(b.Len())
+	case *os.File:
+		fi, err := b.Stat()
+		if err != nil || !fi.Mode().IsRegular() {
+			return 0
+		}
+		offset, err := b.Seek(0, io.SeekCurrent)
+		if err != nil || offset > fi.Size() {
+			return 0
+		}
+		return fi.Size() - offset
+	}
+	return 0
+}
+
 // SetBodyBytes set the request Body as []byte.
 func (r *Request) SetBodyBytes(body []byte) *Request {
 	r.Body = body
@@ -1143,6 +1263,26 @@ func (r *Request) DisableForceChunkedEncoding() *Request {
 	return r
 }
 
+// EnableStreamMultipart enables streaming the multipart body while sending it
+// like EnableForceChunkedEncoding, so the files are never buffered in memory,
+// but the Content-Length is still sent like the browsers do if the sizes of
+// all the files are known (the FileSize of FileUpload, which is set by SetFile,
+// SetFileBytes, and SetFileReader with a reader whose size is known), the
+// multipart boundary is generated like the non-streaming one. Note the body is
+// sent with chunked encoding if the size of any file is unknown, and the
+// request fails if the size of a file does not match its FileSize.
+func (r *Request) EnableStreamMultipart() *Request {
+	r.streamMultipart = true
+	return r
+}
+
+// DisableStreamMultipart disables streaming the multipart body, see
+// EnableStreamMultipart.
+func (r *Request) DisableStreamMultipart() *Request {
+	r.streamMultipart = false
+	return r
+}
+
 // EnableForceMultipart enables force using multipart to upload form data.
 func (r *Request) EnableForceMultipart() *Request {
 	r.isMultiPart = true
@@ -1155,6 +1295,85 @@ func (r *Request) DisableForceMultipart() *Request {
 	return r
 }
 
+// ForceHTTP2 forces the request to be sent over HTTP2, which overrides the
+// http version forced by the client and the negotiation of the protocol, e.g.
+// the alt-svc of the server is ignored. The request fails rather than falls
+// back to HTTP1 if the server does not support HTTP2, e.g. the error is like
+// `http2: unexpected ALPN protocol "http/1.1"; want "h2"` if the server does
+// not negotiate h2 in the tls handshake, and the tls fingerprint must offer
+// h2 in its ALPN extension if impersonation is used.
+func (r *Request) ForceHTTP2() *Request {
+	r.forceHttpVersion = h2
+	return r
+}
+
+// ForceHTTP3 forces the request to be sent over HTTP3, which overrides the
+// http version forced by the client and the negotiation of the protocol, e.g.
+// the alt-svc of the server is not required. HTTP3 must be enabled with
+// Client.EnableHTTP3, otherwise the request fails with "http3 is not enabled".
+// The request fails rather than falls back to HTTP2 or HTTP1 if the server
+// does not support HTTP3, e.g. the QUIC handshake times out if the server
+// does not listen on UDP, which could take a while, consider setting a
+// timeout in the context of the request.
+func (r *Request) ForceHTTP3() *Request {
+	r.forceHttpVersion = h3
+	return r
+}
+
+// SetTLSHandshakeTimeout set the TLS handshake timeout of the connection
+// dialed by the request, which overrides the one set by
+// Client.SetTLSHandshakeTimeout, so a slow handshake can fail fast while the
+// request itself, e.g. a large download, is allowed to take longer. The
+// request fails with an error matching ErrTLSHandshakeTimeout with errors.Is
+// if the handshake times out. It does not apply to the reused connections or
+// HTTP3, and zero means to use the timeout of the client.
+func (r *Request) SetTLSHandshakeTimeout(timeout time.Duration) *Request {
+	r.tlsHandshakeTimeout = timeout
+	return r
+}
+
+// SetRawHeaderBlock set the raw header block of the request, which is written
+// as is after the request line over HTTP/1.1 instead of the headers of the
+// request, e.g. to send the headers which are normally rewritten or rejected,
+// so the request is forced to be sent over HTTP/1.1. The block consists of the
+// "Name: value" lines and must end with "\r\n\r\n". Nothing is added or
+// checked, e.g. the Host, Content-Length and Transfer-Encoding headers must be
+// consistent with the request and its body, otherwise the connection may be
+// broken. Use it with caution, and pass nil to remove it.
+func (r *Request) SetRawHeaderBlock(block []byte) *Request {
+	if block == nil {
+		r.rawHeaderBlock = nil
+		return r
+	}
+	if err := validateRawHeaderBlock(block); err != nil {
+		r.appendError(err)
+		return r
+	}
+	r.rawHeaderBlock = slices.Clone(block)
+	r.forceHttpVersion = h1
+	return r
+}
+
+func validateRawHeaderBlock(block []byte) error {
+	lines, ok := strings.CutSuffix(string(block), "\r\n\r\n")
+	if !ok {
+		return errors.New("raw header block must end with \"\\r\\n\\r\\n\"")
+	}
+	if lines == "" {
+		return errors.New("raw header block is empty")
+	}
+	for _, line := range strings.Split(lines, "\r\n") {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || !httpguts.ValidHeaderFieldName(name) {
+			return fmt.Errorf("invalid header line %q in raw header block", line)
+		}
+		if !httpguts.ValidHeaderFieldValue(value) {
+			return fmt.Errorf("invalid header value of %q in raw header block", name)
+		}
+	}
+	return nil
+}
+
 func (r *Request) getRetryOption() *retryOption {
 	if r.retryOption == nil {
 		r.retryOption = newDefaultRetryOption()
@@ -6,7 +6,10 @@ import (
 	"encoding/xml"
 	"fmt"
 	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"strconv"
@@ -516,6 +519,128 @@ func TestSetBearerAuthToken(t *testing.T) {
 	tests.AssertEqual(t, "Bearer "+token, headers.Get("Authorization"))
 }
 
+func TestRequestImpersonate(t *testing.T) {
+	c := tc().ImpersonateChrome()
+	resp, err := c.R().Impersonate("firefox").Get("/user-agent")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, FirefoxProfile().Headers["user-agent"], resp.String())
+
+	// the client's profile is not changed.
+	resp, err = c.R().Get("/user-agent")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, ChromeProfile().Headers["user-agent"], resp.String())
+
+	// the request's header still takes precedence.
+	resp, err = c.R().Impersonate("safari").SetHeader(header.UserAgent, "custom").Get("/user-agent")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "custom", resp.String())
+
+	// the connection pool is separated by profile.
+	cc, err := c.impersonateClient("FIREFOX")
+	tests.AssertNoError(t, err)
+	firefox, _ := c.impersonateClients.Load("firefox")
+	tests.AssertEqual(t, true, firefox == cc)
+	tests.AssertEqual(t, false, cc.Transport == c.Transport)
+
+	_, err = c.R().Impersonate("netscape").Get("/user-agent")
+	tests.AssertErrorContains(t, err, "unknown impersonation profile")
+}
+
+func TestImpersonateRotation(t *testing.T) {
+	c := tc().SetImpersonateRotation("chrome", "FireFox")
+	uas := map[string]bool{
+		ChromeProfile().Headers["user-agent"]:  false,
+		FirefoxProfile().Headers["user-agent"]: false,
+	}
+	for i := 0; i < 50; i++ {
+		resp, err := c.R().Get("/user-agent")
+		assertSuccess(t, resp, err)
+		_, ok := uas[resp.String()]
+		tests.AssertEqual(t, true, ok)
+		uas[resp.String()] = true
+		tests.AssertNotNil(t, resp.Request.impersonateClient)
+	}
+	for ua, seen := range uas {
+		if !seen {
+			t.Errorf("profile with user-agent %q is never picked", ua)
+		}
+	}
+	chrome, _ := c.impersonateClients.Load("chrome")
+	firefox, _ := c.impersonateClients.Load("firefox")
+	tests.AssertEqual(t, false, chrome.(*Client).Transport == firefox.(*Client).Transport)
+
+	// the request's impersonation takes precedence.
+	resp, err := c.R().Impersonate("safari").Get("/user-agent")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, SafariProfile().Headers["user-agent"], resp.String())
+
+	// skip unknown profile.
+	c.SetImpersonateRotation("chrome", "netscape")
+	tests.AssertEqual(t, []string{"chrome"}, c.impersonateRotation)
+
+	c.SetImpersonateRotation()
+	resp, err = c.R().Get("/user-agent")
+	assertSuccess(t, resp, err)
+	tests.AssertIsNil(t, resp.Request.impersonateClient)
+}
+
+func TestImpersonateLogger(t *testing.T) {
+	var entries []ImpersonateLogEntry
+	c := tc().ImpersonateFirefox().SetImpersonateLogger(func(entry ImpersonateLogEntry) {
+		entries = append(entries, entry)
+	})
+	resp, err := c.R().Impersonate("Chrome").Get("/user-agent")
+	assertSuccess(t, resp, err)
+	resp, err = c.R().Get("/user-agent")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, 2, len(entries))
+
+	chrome := entries[0]
+	tests.AssertEqual(t, http.MethodGet, chrome.Method)
+	tests.AssertEqual(t, resp.Request.RawRequest.URL.String(), chrome.URL)
+	tests.AssertEqual(t, "chrome", chrome.Profile)
+	tests.AssertEqual(t, ChromeProfile().Headers["user-agent"], chrome.UserAgent)
+	tests.AssertEqual(t, "h2", chrome.Protocol)
+	tests.AssertEqual(t, true, len(chrome.HeaderOrder) > 0)
+	cc, _ := c.impersonateClients.Load("chrome")
+	// the server is an IP, so the ClientHello has no SNI.
+	info, err := cc.(*Client).clientHelloInfo(resp.Request.URL.Hostname())
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, info.ja4(), chrome.JA4)
+	tests.AssertEqual(t, true, strings.HasPrefix(chrome.JA4, "t13i"))
+
+	firefox := entries[1]
+	tests.AssertEqual(t, "", firefox.Profile)
+	tests.AssertEqual(t, FirefoxProfile().Headers["user-agent"], firefox.UserAgent)
+	tests.AssertEqual(t, c.tlsFingerprintID.Str(), firefox.ClientHelloID)
+	tests.AssertEqual(t, true, firefox.JA3 != "" && firefox.JA4 != chrome.JA4)
+
+	c.SetImpersonateLogger(nil)
+	resp, err = c.R().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, 2, len(entries))
+}
+
+func TestImpersonateRotationClientChanges(t *testing.T) {
+	c := tc().SetImpersonateRotation("chrome")
+	resp, err := c.R().Get("/user-agent")
+	assertSuccess(t, resp, err)
+
+	// the client changed after the rotation is enabled applies to the
+	// rotated requests.
+	proxyURL, tunnels := startTunnelProxy(t)
+	c.SetProxyURL(proxyURL.String()).SetCommonHeader("x-client", "changed")
+	resp, err = c.R().Get("/header")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, "chrome", resp.Request.GetImpersonateProfile())
+	tests.AssertEqual(t, int32(1), tunnels.Load())
+	tests.AssertEqual(t, "changed", resp.Request.Headers.Get("x-client"))
+
+	c.SetTimeout(time.Nanosecond)
+	_, err = c.R().Get("/user-agent")
+	tests.AssertNotNil(t, err)
+}
+
 func TestHeader(t *testing.T) {
 	testWithAllTransport(t, testHeader)
 }
@@ -923,6 +1048,98 @@ func TestUploadMultipart(t *testing.T) {
 	tests.AssertContains(t, resp.String(), "value2", true)
 }
 
+// startBodyEchoServer starts a server which echoes the protocol, the
+// content-length, the content-type and the body of the request.
+func startBodyEchoServer(t *testing.T) string {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		fmt.Fprintf(w, "%s %d %s\n%s", r.Proto, r.ContentLength, r.Header.Get(header.ContentType), b)
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestSetBodyReader(t *testing.T) {
+	srvURL := startBodyEchoServer(t)
+	content := getTestFileContent(t, "sample-file.txt")
+	for _, c := range []*Client{C().EnableForceHTTP1(), C()} {
+		c.EnableInsecureSkipVerify()
+		proto := "HTTP/2.0"
+		if c.Transport.forceHttpVersion == h1 {
+			proto = "HTTP/1.1"
+		}
+		resp, err := c.R().SetBodyReader(strings.NewReader("hello")).Post(srvURL)
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, proto+" 5 \nhello", resp.String())
+
+		// the length is unknown.
+		resp, err = c.R().SetBodyReader(io.MultiReader(strings.NewReader("hello"))).Post(srvURL)
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, proto+" -1 \nhello", resp.String())
+
+		// the file is closed once it's sent.
+		file, err := os.Open(tests.GetTestFilePath("sample-file.txt"))
+		tests.AssertNoError(t, err)
+		resp, err = c.R().SetBodyReader(file).Post(srvURL)
+		assertSuccess(t, resp, err)
+		tests.AssertEqual(t, fmt.Sprintf("%s %d \n%s", proto, len(content), content), resp.String())
+	}
+}
+
+func TestStreamMultipart(t *testing.T) {
+	srvURL := startBodyEchoServer(t)
+	c := tc().ImpersonateChrome()
+	parse := func(resp *Response) (contentLength int, contentType, body string) {
+		firstLine, body, _ := strings.Cut(resp.String(), "\n")
+		fields := strings.SplitN(firstLine, " ", 3)
+		tests.AssertEqual(t, "HTTP/2.0", fields[0])
+		contentLength, err := strconv.Atoi(fields[1])
+		tests.AssertNoError(t, err)
+		return contentLength, fields[2], body
+	}
+
+	resp, err := c.R().EnableStreamMultipart().
+		SetFormData(map[string]string{"param": "value"}).
+		SetFileReader("file", "file.txt", strings.NewReader("hello")).
+		SetFile("sample", tests.GetTestFilePath("sample-file.txt")).
+		Post(srvURL)
+	assertSuccess(t, resp, err)
+	contentLength, contentType, body := parse(resp)
+	tests.AssertEqual(t, len(body), contentLength)
+	tests.AssertEqual(t, true, strings.HasPrefix(contentType, "multipart/form-data; boundary=----WebKitFormBoundary"))
+	_, params, err := mime.ParseMediaType(contentType)
+	tests.AssertNoError(t, err)
+	form, err := multipart.NewReader(strings.NewReader(body), params["boundary"]).ReadForm(1 << 20)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, []string{"value"}, form.Value["param"])
+	tests.AssertEqual(t, "file.txt", form.File["file"][0].Filename)
+	tests.AssertEqual(t, int64(len(getTestFileContent(t, "sample-file.txt"))), form.File["sample"][0].Size)
+
+	// the size of the file is unknown.
+	resp, err = c.R().EnableStreamMultipart().
+		SetFileReader("file", "file.txt", io.MultiReader(strings.NewReader(strings.Repeat("a", 1024)))).
+		Post(srvURL)
+	assertSuccess(t, resp, err)
+	contentLength, _, body = parse(resp)
+	tests.AssertEqual(t, -1, contentLength)
+	tests.AssertContains(t, body, strings.Repeat("a", 1024), true)
+
+	// the size of the file does not match.
+	_, err = c.R().EnableStreamMultipart().
+		SetFileUpload(FileUpload{
+			ParamName: "file",
+			FileName:  "file.txt",
+			FileSize:  1024,
+			GetFileContent: func() (io.ReadCloser, error) {
+				return io.NopCloser(io.MultiReader(strings.NewReader(strings.Repeat("a", 1000)))), nil
+			},
+		}).
+		Post(srvURL)
+	tests.AssertErrorContains(t, err, "the size of file file.txt is 1000, but the FileSize is 1024")
+}
+
 func TestFixPragmaCache(t *testing.T) {
 	resp, err := tc().EnableForceHTTP1().R().Get("/pragma")
 	assertSuccess(t, resp, err)
@@ -6,8 +6,10 @@ import (
 	"strings"
 	"time"
 
+	"github.com/imroc/req/v3/http2"
 	"github.com/imroc/req/v3/internal/header"
 	"github.com/imroc/req/v3/internal/util"
+	"github.com/quic-go/quic-go"
 )
 
 // Response is the http response.
@@ -24,6 +26,67 @@ type Response struct {
 	receivedAt time.Time
 	error      any
 	result     any
+	// http3StreamID is the ID of the http3 request stream, nil if the
+	// request is not sent over http3.
+	http3StreamID *quic.StreamID
+	// serverHTTP2Settings is the settings received from the http2 server,
+	// nil if the request is not sent over http2.
+	serverHTTP2Settings []http2.Setting
+	// headerOrder is the names of the response header fields in the
+	// received order, nil unless the order is recorded.
+	headerOrder []string
+}
+
+// HTTP3StreamID returns the ID of the http3 request stream, which can be
+// used to send datagrams with Client.SendHTTP3Datagram while the stream is
+// active, ok is false if the request is not sent over http3.
+func (r *Response) HTTP3StreamID() (id quic.StreamID, ok bool) {
+	if r.http3StreamID == nil {
+		return 0, false
+	}
+	return *r.http3StreamID, true
+}
+
+// ServerHTTP2Settings returns the settings received from the server in the
+// HTTP2 SETTINGS frames of the connection when the response headers are
+// received, in the order they are first received, with the latest value of
+// each setting. It returns nil if the request is not sent over HTTP2.
+func (r *Response) ServerHTTP2Settings() []http2.Setting {
+	return r.serverHTTP2Settings
+}
+
+// HeaderOrder returns the names of the response header fields in the order
+// they are received, which is recorded if Client.EnableResponseHeaderOrder is
+// called, e.g. to relay the response with the same header order. Each field
+// line is listed once, so a name repeats if the header is received several
+// times. The names are in the case they are received, which is lowercase over
+// HTTP/2 and HTTP/3, and the pseudo headers are excluded. It returns nil if
+// the order is not recorded or there is no response.
+func (r *Response) HeaderOrder() []string {
+	return r.headerOrder
+}
+
+// NegotiatedProtocol returns the protocol which actually carried the request,
+// which is "http/1.1", "h2" or "h3". It's the ALPN protocol negotiated in the
+// tls handshake if any, e.g. the server may choose "http/1.1" even if "h2" is
+// offered, otherwise it's derived from the protocol version of the response,
+// e.g. for the plain text requests. An empty string is returned if there is
+// no response.
+func (r *Response) NegotiatedProtocol() string {
+	if r.Response == nil {
+		return ""
+	}
+	if r.TLS != nil && r.TLS.NegotiatedProtocol != "" {
+		return r.TLS.NegotiatedProtocol
+	}
+	switch r.ProtoMajor {
+	case 3:
+		return "h3"
+	case 2:
+		return "h2"
+	default:
+		return "http/1.1"
+	}
 }
 
 // IsSuccess method returns true if no error occurs and HTTP status `code >= 200 and <= 299`
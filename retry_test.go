@@ -2,9 +2,13 @@ package req
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"math"
 	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -196,3 +200,60 @@ func TestRetryTurnedOffWhenRetryCountEqZero(t *testing.T) {
 	tests.AssertIsNil(t, resp.Response)
 	tests.AssertEqual(t, 0, resp.Request.RetryAttempt)
 }
+
+func TestRetryWithProfileRotation(t *testing.T) {
+	var uas, addrs []string
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uas = append(uas, r.UserAgent())
+		addrs = append(addrs, r.RemoteAddr)
+		if !strings.Contains(r.UserAgent(), "Firefox") || r.URL.Path == "/blocked" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(r.UserAgent()))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	c := tc().SetBaseURL(srv.URL).ImpersonateChrome().
+		SetCommonRetryCount(5).
+		SetCommonRetryCondition(RetryWithProfileRotation("safari", "FireFox", "chrome"))
+	resp, err := c.R().Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, 2, resp.Request.RetryAttempt)
+	tests.AssertEqual(t, FirefoxProfile().Headers["user-agent"], resp.String())
+	tests.AssertEqual(t, []string{
+		ChromeProfile().Headers["user-agent"],
+		SafariProfile().Headers["user-agent"],
+		FirefoxProfile().Headers["user-agent"],
+	}, uas)
+	// each profile is sent on its own connection.
+	tests.AssertEqual(t, false, addrs[0] == addrs[1] || addrs[1] == addrs[2])
+	// only the headers merged from the last profile are recorded.
+	tests.AssertEqual(t, true, slices.Contains(resp.Request.mergedHeaderKeys, "User-Agent"))
+
+	// each profile is tried once, the profile of the request is skipped.
+	uas = nil
+	resp, err = c.R().Impersonate("chrome").SetHeader("X-Test", "1").Get("/blocked")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, http.StatusForbidden, resp.StatusCode)
+	tests.AssertEqual(t, 2, resp.Request.RetryAttempt)
+	tests.AssertEqual(t, 3, len(uas))
+	tests.AssertEqual(t, "1", resp.Request.Headers.Get("X-Test"))
+
+	// the request's header is kept.
+	resp, err = c.R().SetHeader("User-Agent", "custom Firefox").Get("/")
+	assertSuccess(t, resp, err)
+	tests.AssertEqual(t, 0, resp.Request.RetryAttempt)
+	tests.AssertEqual(t, "custom Firefox", resp.String())
+	tests.AssertEqual(t, false, slices.Contains(resp.Request.mergedHeaderKeys, "User-Agent"))
+
+	// no retry if the context is done.
+	ctx, cancel := context.WithCancel(context.Background())
+	resp, err = c.R().SetRetryHook(func(resp *Response, err error) {
+		cancel()
+	}).SetContext(ctx).Get("/")
+	tests.AssertNotNil(t, err)
+	tests.AssertEqual(t, 1, resp.Request.RetryAttempt)
+}
@@ -18,6 +18,7 @@ import (
 // Like the RoundTripper interface, the error types returned
 // by RoundTrip are unspecified.
 func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	t.setupHeaderOrder(req)
 	if t.wrappedRoundTrip != nil {
 		resp, err = t.wrappedRoundTrip.RoundTrip(req)
 	} else {
@@ -31,6 +31,8 @@ type textprotoReader struct {
 	R        *bufio.Reader
 	buf      []byte // a reusable buffer for readContinuedLineSlice
 	readLine func() (line []byte, isPrefix bool, err error)
+	// keyOrder records the header names as received if non-nil.
+	keyOrder *[]string
 }
 
 // NewReader returns a new textprotoReader reading from r.
@@ -270,6 +272,10 @@ func (r *textprotoReader) readMIMEHeader(maxMemory, maxHeaders int64) (textproto
 		if !ok {
 			return m, protocolError("malformed MIME header line: " + string(kv))
 		}
+		if r.keyOrder != nil {
+			// copy the name before it's canonicalized in place.
+			*r.keyOrder = append(*r.keyOrder, string(k))
+		}
 		key, ok := canonicalMIMEHeaderKey(k)
 		if !ok {
 			return m, protocolError("malformed MIME header line: " + string(kv))
@@ -0,0 +1,1194 @@
+package req
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/imroc/req/v3/http2"
+	utls "github.com/refraction-networking/utls"
+)
+
+// TLS extension types used to compute the tls fingerprint.
+const (
+	extensionServerName          uint16 = 0
+	extensionSupportedGroups     uint16 = 10
+	extensionECPointFormats      uint16 = 11
+	extensionSignatureAlgorithms uint16 = 13
+	extensionALPN                uint16 = 16
+	extensionSupportedVersions   uint16 = 43
+)
+
+var errTLSFingerprintNotSet = errors.New("tls fingerprint is not set, call SetTLSFingerprint, SetCustomTLSFingerprint or ImpersonateXXX first")
+
+// clientHelloInfo is the fields of a ClientHello which are used to compute the
+// tls fingerprint.
+type clientHelloInfo struct {
+	version             uint16
+	cipherSuites        []uint16
+	extensions          []uint16
+	supportedGroups     []uint16
+	ecPointFormats      []uint8
+	signatureAlgorithms []uint16
+	supportedVersions   []uint16
+	alpnProtocols       []string
+	serverName          string
+}
+
+// clientHelloReader reads the ClientHello and reports the offset of the
+// truncated field.
+type clientHelloReader struct {
+	data []byte
+	off  int
+}
+
+func (r *clientHelloReader) next(n int, field string) ([]byte, error) {
+	if n < 0 || len(r.data)-r.off < n {
+		return nil, fmt.Errorf("client hello truncated at offset %d: %s needs %d bytes, only %d bytes left", r.off, field, n, len(r.data)-r.off)
+	}
+	b := r.data[r.off : r.off+n]
+	r.off += n
+	return b, nil
+}
+
+func (r *clientHelloReader) uint8(field string) (uint8, error) {
+	b, err := r.next(1, field)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (r *clientHelloReader) uint16(field string) (uint16, error) {
+	b, err := r.next(2, field)
+	if err != nil {
+		return 0, err
+	}
+	return uint16(b[0])<<8 | uint16(b[1]), nil
+}
+
+func (r *clientHelloReader) uint24(field string) (int, error) {
+	b, err := r.next(3, field)
+	if err != nil {
+		return 0, err
+	}
+	return int(b[0])<<16 | int(b[1])<<8 | int(b[2]), nil
+}
+
+// vector reads a variable-length vector whose length is prefixed with
+// lenBytes bytes, and returns a reader of the vector content.
+func (r *clientHelloReader) vector(lenBytes int, field string) (*clientHelloReader, error) {
+	var n int
+	switch lenBytes {
+	case 1:
+		l, err := r.uint8(field + " length")
+		if err != nil {
+			return nil, err
+		}
+		n = int(l)
+	default:
+		l, err := r.uint16(field + " length")
+		if err != nil {
+			return nil, err
+		}
+		n = int(l)
+	}
+	start := r.off
+	if _, err := r.next(n, field); err != nil {
+		return nil, err
+	}
+	return &clientHelloReader{data: r.data[:start+n], off: start}, nil
+}
+
+func (r *clientHelloReader) empty() bool {
+	return r.off >= len(r.data)
+}
+
+func (r *clientHelloReader) uint16s(field string) ([]uint16, error) {
+	var vals []uint16
+	for !r.empty() {
+		v, err := r.uint16(field)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, v)
+	}
+	return vals, nil
+}
+
+// parseClientHelloInfo parses the ClientHello, which can be either a TLS
+// record or a handshake message.
+func parseClientHelloInfo(raw []byte) (*clientHelloInfo, error) {
+	r := &clientHelloReader{data: raw}
+	if len(raw) > 0 && raw[0] == 0x16 { // handshake record
+		if _, err := r.next(3, "record header"); err != nil {
+			return nil, err
+		}
+		n, err := r.uint16("record length")
+		if err != nil {
+			return nil, err
+		}
+		start := r.off
+		if _, err = r.next(int(n), "record"); err != nil {
+			return nil, err
+		}
+		r = &clientHelloReader{data: raw[:start+int(n)], off: start}
+	}
+	typ, err := r.uint8("handshake type")
+	if err != nil {
+		return nil, err
+	}
+	if typ != 1 {
+		return nil, fmt.Errorf("not a client hello at offset %d: handshake type is %d", r.off-1, typ)
+	}
+	n, err := r.uint24("handshake length")
+	if err != nil {
+		return nil, err
+	}
+	start := r.off
+	if _, err = r.next(n, "client hello"); err != nil {
+		return nil, err
+	}
+	r = &clientHelloReader{data: r.data[:start+n], off: start}
+
+	info := &clientHelloInfo{}
+	if info.version, err = r.uint16("version"); err != nil {
+		return nil, err
+	}
+	if _, err = r.next(32, "random"); err != nil {
+		return nil, err
+	}
+	if _, err = r.vector(1, "session id"); err != nil {
+		return nil, err
+	}
+	ciphers, err := r.vector(2, "cipher suites")
+	if err != nil {
+		return nil, err
+	}
+	if info.cipherSuites, err = ciphers.uint16s("cipher suite"); err != nil {
+		return nil, err
+	}
+	if _, err = r.vector(1, "compression methods"); err != nil {
+		return nil, err
+	}
+	if r.empty() { // no extensions
+		return info, nil
+	}
+	exts, err := r.vector(2, "extensions")
+	if err != nil {
+		return nil, err
+	}
+	for !exts.empty() {
+		typ, err := exts.uint16("extension type")
+		if err != nil {
+			return nil, err
+		}
+		info.extensions = append(info.extensions, typ)
+		data, err := exts.vector(2, "extension "+strconv.Itoa(int(typ)))
+		if err != nil {
+			return nil, err
+		}
+		if err = info.parseExtension(typ, data); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+func (info *clientHelloInfo) parseExtension(typ uint16, data *clientHelloReader) error {
+	switch typ {
+	case extensionServerName:
+		list, err := data.vector(2, "server name list")
+		if err != nil {
+			return err
+		}
+		for !list.empty() {
+			nameType, err := list.uint8("server name type")
+			if err != nil {
+				return err
+			}
+			name, err := list.vector(2, "server name")
+			if err != nil {
+				return err
+			}
+			if nameType == 0 {
+				info.serverName = string(name.data[name.off:])
+			}
+		}
+	case extensionSupportedGroups:
+		list, err := data.vector(2, "supported groups")
+		if err != nil {
+			return err
+		}
+		info.supportedGroups, err = list.uint16s("supported group")
+		return err
+	case extensionECPointFormats:
+		list, err := data.vector(1, "ec point formats")
+		if err != nil {
+			return err
+		}
+		info.ecPointFormats = list.data[list.off:]
+	case extensionSignatureAlgorithms:
+		list, err := data.vector(2, "signature algorithms")
+		if err != nil {
+			return err
+		}
+		info.signatureAlgorithms, err = list.uint16s("signature algorithm")
+		return err
+	case extensionALPN:
+		list, err := data.vector(2, "alpn protocols")
+		if err != nil {
+			return err
+		}
+		for !list.empty() {
+			proto, err := list.vector(1, "alpn protocol")
+			if err != nil {
+				return err
+			}
+			info.alpnProtocols = append(info.alpnProtocols, string(proto.data[proto.off:]))
+		}
+	case extensionSupportedVersions:
+		list, err := data.vector(1, "supported versions")
+		if err != nil {
+			return err
+		}
+		info.supportedVersions, err = list.uint16s("supported version")
+		return err
+	}
+	return nil
+}
+
+// isGREASE reports whether v is a GREASE value (RFC 8701).
+func isGREASE(v uint16) bool {
+	return v&0x0f0f == 0x0a0a && v>>8 == v&0xff
+}
+
+func joinUint16s(vals []uint16, sep string, format func(uint16) string) string {
+	var sb strings.Builder
+	for _, v := range vals {
+		if isGREASE(v) {
+			continue
+		}
+		if sb.Len() > 0 {
+			sb.WriteString(sep)
+		}
+		sb.WriteString(format(v))
+	}
+	return sb.String()
+}
+
+func formatDecimal(v uint16) string {
+	return strconv.Itoa(int(v))
+}
+
+// ja3 returns the JA3 string of the ClientHello, GREASE values are excluded.
+func (info *clientHelloInfo) ja3() string {
+	formats := make([]uint16, len(info.ecPointFormats))
+	for i, f := range info.ecPointFormats {
+		formats[i] = uint16(f)
+	}
+	return strings.Join([]string{
+		strconv.Itoa(int(info.version)),
+		joinUint16s(info.cipherSuites, "-", formatDecimal),
+		joinUint16s(info.extensions, "-", formatDecimal),
+		joinUint16s(info.supportedGroups, "-", formatDecimal),
+		joinUint16s(formats, "-", formatDecimal),
+	}, ",")
+}
+
+// ja4 returns the JA4 fingerprint (JA4_a, JA4_b and JA4_c joined by "_") of the
+// ClientHello sent over TCP, GREASE values are excluded.
+// See https://github.com/FoxIO-LLC/ja4/blob/main/technical_details/JA4.md
+func (info *clientHelloInfo) ja4() string {
+	version := info.version
+	for _, v := range info.supportedVersions {
+		if !isGREASE(v) && v > version {
+			version = v
+		}
+	}
+	var tlsVersion string
+	switch version {
+	case utls.VersionTLS13:
+		tlsVersion = "13"
+	case utls.VersionTLS12:
+		tlsVersion = "12"
+	case utls.VersionTLS11:
+		tlsVersion = "11"
+	case utls.VersionTLS10:
+		tlsVersion = "10"
+	default:
+		tlsVersion = "00"
+	}
+	sni := "i"
+	if info.serverName != "" {
+		sni = "d"
+	}
+	ciphers := slices.DeleteFunc(slices.Clone(info.cipherSuites), isGREASE)
+	extensions := slices.DeleteFunc(slices.Clone(info.extensions), isGREASE)
+	alpn := "00"
+	if len(info.alpnProtocols) > 0 && info.alpnProtocols[0] != "" {
+		p := info.alpnProtocols[0]
+		alpn = string(p[0]) + string(p[len(p)-1])
+	}
+	a := fmt.Sprintf("t%s%s%02d%02d%s", tlsVersion, sni, min(len(ciphers), 99), min(len(extensions), 99), alpn)
+
+	slices.Sort(ciphers)
+	b := ja4Hash(joinUint16s(ciphers, ",", formatHex))
+
+	// SNI and ALPN are excluded from the sorted extensions.
+	extensions = slices.DeleteFunc(extensions, func(v uint16) bool {
+		return v == extensionServerName || v == extensionALPN
+	})
+	slices.Sort(extensions)
+	c := joinUint16s(extensions, ",", formatHex)
+	if sigs := joinUint16s(info.signatureAlgorithms, ",", formatHex); sigs != "" {
+		c += "_" + sigs
+	}
+	return a + "_" + b + "_" + ja4Hash(c)
+}
+
+func formatHex(v uint16) string {
+	return fmt.Sprintf("%04x", v)
+}
+
+// ja4Hash returns the first 12 characters of the sha256 hash of s, or
+// "000000000000" if s is empty.
+func ja4Hash(s string) string {
+	if s == "" {
+		return "000000000000"
+	}
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// buildClientHello builds the ClientHello handshake message which the client
+// would send to serverName with the current tls fingerprint.
+func (c *Client) buildClientHello(serverName string) ([]byte, error) {
+	if c.tlsFingerprintID.Client == "" {
+		return nil, errTLSFingerprintNotSet
+	}
+	return marshalClientHello(c.tlsFingerprintID, c.tlsFingerprintSpec, serverName, c.GetTLSClientConfig().NextProtos)
+}
+
+// marshalClientHello builds the ClientHello handshake message of the tls
+// fingerprint, the spec is applied if specFunc is not nil.
+func marshalClientHello(clientHelloID utls.ClientHelloID, specFunc func() (*utls.ClientHelloSpec, error), serverName string, nextProtos []string) ([]byte, error) {
+	config := &utls.Config{
+		ServerName:   serverName,
+		NextProtos:   nextProtos,
+		OmitEmptyPsk: true,
+	}
+	id := clientHelloID
+	if specFunc != nil {
+		// the ID may be unknown to utls, e.g. the one of Safari 17.
+		id = utls.HelloCustom
+	}
+	uconn := utls.UClient(nil, config, id)
+	if specFunc != nil {
+		spec, err := specFunc()
+		if err != nil {
+			return nil, err
+		}
+		if err = uconn.ApplyPreset(spec); err != nil {
+			return nil, err
+		}
+	}
+	if err := uconn.BuildHandshakeState(); err != nil {
+		return nil, err
+	}
+	return uconn.HandshakeState.Hello.Raw, nil
+}
+
+// tlsFingerprintKeys caches the keys of the ClientHelloIDs which always build
+// the same ClientHello, see tlsFingerprintKey.
+var tlsFingerprintKeys sync.Map
+
+// tlsFingerprintKey returns the key which identifies the connections of the
+// tls fingerprint in the connection pool. The ClientHelloID is not enough as
+// different specs may share it, e.g. the ones imported from JA3, so the JA4
+// and the cipher suites in order are added if the ClientHello can be built.
+// The keys of the predefined ClientHelloIDs are built once and cached, while
+// the custom and randomized ones are built each time as their specs vary.
+func tlsFingerprintKey(clientHelloID utls.ClientHelloID, specFunc func() (*utls.ClientHelloSpec, error)) string {
+	cacheable := clientHelloID.Client != utls.HelloCustom.Client && clientHelloID.Seed == nil &&
+		!strings.HasPrefix(clientHelloID.Client, utls.HelloRandomized.Client)
+	if cacheable {
+		if key, ok := tlsFingerprintKeys.Load(clientHelloID.Str()); ok {
+			return key.(string)
+		}
+	}
+	key := clientHelloID.Str()
+	raw, err := marshalClientHello(clientHelloID, specFunc, "example.com", nil)
+	if err != nil {
+		return key
+	}
+	info, err := parseClientHelloInfo(raw)
+	if err != nil {
+		return key
+	}
+	// the GREASE values are random for each ClientHello.
+	ciphers := slices.DeleteFunc(slices.Clone(info.cipherSuites), isGREASE)
+	key += "|" + info.ja4() + "|" + joinUint16s(ciphers, "-", formatDecimal)
+	if cacheable {
+		tlsFingerprintKeys.Store(clientHelloID.Str(), key)
+	}
+	return key
+}
+
+func (c *Client) clientHelloInfo(serverName string) (*clientHelloInfo, error) {
+	raw, err := c.buildClientHello(serverName)
+	if err != nil {
+		return nil, err
+	}
+	return parseClientHelloInfo(raw)
+}
+
+// JA3 returns the JA3 string (SSLVersion,Ciphers,Extensions,EllipticCurves,
+// EllipticCurvePointFormats) of the ClientHello which is built with the tls
+// fingerprint set by SetTLSFingerprint, SetCustomTLSFingerprint or ImpersonateXXX,
+// GREASE values are excluded. Note the JA3 may vary between calls if the
+// fingerprint shuffles the extensions, e.g. Chrome 106+.
+func (c *Client) JA3() (string, error) {
+	info, err := c.clientHelloInfo("example.com")
+	if err != nil {
+		return "", err
+	}
+	return info.ja3(), nil
+}
+
+// JA3Hash returns the MD5 hash of the JA3 string, see JA3 for details.
+func (c *Client) JA3Hash() (string, error) {
+	ja3, err := c.JA3()
+	if err != nil {
+		return "", err
+	}
+	return md5Hash(ja3), nil
+}
+
+// JA4 returns the JA4 fingerprint (e.g. "t13d1516h2_8daaf6152771_02713d6af862")
+// of the ClientHello which is built with the tls fingerprint set by
+// SetTLSFingerprint, SetCustomTLSFingerprint or ImpersonateXXX. GREASE values
+// are excluded and the cipher suites and extensions are sorted, so unlike JA3,
+// it's stable even if the fingerprint shuffles the extensions.
+func (c *Client) JA4() (string, error) {
+	info, err := c.clientHelloInfo("example.com")
+	if err != nil {
+		return "", err
+	}
+	return info.ja4(), nil
+}
+
+// MatchesFingerprint reports whether the ClientHello of the profile matches
+// the JA3, which can be either the JA3 string or its MD5 hash (e.g. from a list
+// of the known fingerprints), which is useful to detect the fingerprint drift
+// of the built-in profiles after upgrading utls. As some browsers shuffle the
+// extensions (e.g. Chrome 106+), the JA3 string is compared with the
+// extensions sorted, and the hash matches either the JA3 in the order of the
+// profile or the one with the extensions sorted (JA3N), so the hash of a JA3
+// with the extensions in a shuffled order may not match, use MatchesJA4 for
+// such profiles instead. It returns false if the ClientHello can not be built.
+func (p BrowserProfile) MatchesFingerprint(ja3 string) bool {
+	info, err := profileClientHelloInfo(p)
+	if err != nil {
+		return false
+	}
+	ja3 = strings.TrimSpace(ja3)
+	actual := info.ja3()
+	if isMD5Hash(ja3) {
+		ja3 = strings.ToLower(ja3)
+		return ja3 == md5Hash(actual) || ja3 == md5Hash(normalizeJA3(actual))
+	}
+	return normalizeJA3(ja3) == normalizeJA3(actual)
+}
+
+// MatchesJA4 reports whether the JA4 fingerprint of the ClientHello of the
+// profile is ja4, the ClientHello is built with a server name, so the JA4
+// starts with "t13d" for TLS 1.3 like the one of the browsers. Unlike JA3, the
+// JA4 is stable even if the profile shuffles the extensions. It returns false
+// if the ClientHello can not be built.
+func (p BrowserProfile) MatchesJA4(ja4 string) bool {
+	info, err := profileClientHelloInfo(p)
+	if err != nil {
+		return false
+	}
+	return strings.TrimSpace(ja4) == info.ja4()
+}
+
+// normalizeJA3 sorts the extensions of the JA3 string numerically, the JA3 is
+// returned as is if it's malformed.
+func normalizeJA3(ja3 string) string {
+	fields := strings.Split(ja3, ",")
+	if len(fields) != 5 {
+		return ja3
+	}
+	extensions, err := parseUint16s(fields[2], "-")
+	if err != nil {
+		return ja3
+	}
+	slices.Sort(extensions)
+	fields[2] = joinUint16s(extensions, "-", formatDecimal)
+	return strings.Join(fields, ",")
+}
+
+func isMD5Hash(s string) bool {
+	if len(s) != 2*md5.Size {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil
+}
+
+func md5Hash(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseClientHello parses the raw ClientHello, which can be either a TLS record
+// or a handshake message without the record header, into a utls ClientHelloSpec,
+// which is useful to verify the cipher suites and extensions before applying it
+// with SetCustomTLSFingerprint. It returns an error with the offset if the
+// ClientHello is truncated.
+func ParseClientHello(raw []byte) (*utls.ClientHelloSpec, error) {
+	if _, err := parseClientHelloInfo(raw); err != nil {
+		return nil, err
+	}
+	if raw[0] != 0x16 {
+		record := make([]byte, 0, len(raw)+5)
+		record = append(record, 0x16, 0x03, 0x01, byte(len(raw)>>8), byte(len(raw)))
+		raw = append(record, raw...)
+	}
+	fingerprinter := &utls.Fingerprinter{AllowBluntMimicry: true}
+	return fingerprinter.FingerprintClientHello(raw)
+}
+
+// FingerprintReport is the result of Client.VerifyFingerprint, which lists the
+// expected and actual values observed by the echo server.
+type FingerprintReport struct {
+	ExpectedCipherSuites  []uint16
+	ActualCipherSuites    []uint16
+	ExpectedExtensions    []uint16
+	ActualExtensions      []uint16
+	ExpectedHTTP2Settings []http2.Setting
+	ActualHTTP2Settings   []http2.Setting
+	// Mismatches describes the differences between the expected and actual
+	// values, it's empty if the fingerprint matches.
+	Mismatches []string
+}
+
+// OK reports whether the fingerprint observed by the echo server matches the
+// expected one.
+func (r FingerprintReport) OK() bool {
+	return len(r.Mismatches) == 0
+}
+
+// fingerprintEcho is the response of the echo server, which is compatible with
+// the /api/all endpoint of TrackMe (https://github.com/pagpeter/TrackMe).
+type fingerprintEcho struct {
+	TLS struct {
+		JA3 string `json:"ja3"`
+	} `json:"tls"`
+	HTTP2 struct {
+		AkamaiFingerprint string `json:"akamai_fingerprint"`
+	} `json:"http2"`
+}
+
+// VerifyFingerprint sends a request to the tls echo server at addr (host:port
+// or URL), which reflects the observed ClientHello and HTTP2 SETTINGS as JSON
+// like {"tls":{"ja3":"..."},"http2":{"akamai_fingerprint":"..."}}, then compares
+// them with the values of the tls fingerprint and HTTP2 settings of the client,
+// and reports the mismatches. GREASE values are ignored, and the extension order
+// is ignored if the fingerprint shuffles the extensions.
+func (c *Client) VerifyFingerprint(addr string) (report FingerprintReport, err error) {
+	if !strings.Contains(addr, "://") {
+		addr = "https://" + addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return report, err
+	}
+	expected, err := c.clientHelloInfo(u.Hostname())
+	if err != nil {
+		return report, err
+	}
+	// build again to find out whether the extensions are shuffled.
+	another, err := c.clientHelloInfo(u.Hostname())
+	if err != nil {
+		return report, err
+	}
+	var echo fingerprintEcho
+	resp, err := c.R().SetSuccessResult(&echo).Get(addr)
+	if err != nil {
+		return report, err
+	}
+	if !resp.IsSuccessState() {
+		return report, fmt.Errorf("bad response from echo server: %s", resp.Status)
+	}
+	ja3 := strings.Split(echo.TLS.JA3, ",")
+	if len(ja3) != 5 {
+		return report, fmt.Errorf("bad ja3 from echo server: %q", echo.TLS.JA3)
+	}
+
+	report = FingerprintReport{
+		ExpectedCipherSuites:  slices.DeleteFunc(expected.cipherSuites, isGREASE),
+		ExpectedExtensions:    slices.DeleteFunc(expected.extensions, isGREASE),
+		ExpectedHTTP2Settings: cloneSlice(c.Transport.t2.Settings),
+	}
+	if report.ActualCipherSuites, err = parseUint16s(ja3[1], "-"); err != nil {
+		return report, fmt.Errorf("bad ja3 from echo server: %q", echo.TLS.JA3)
+	}
+	if report.ActualExtensions, err = parseUint16s(ja3[2], "-"); err != nil {
+		return report, fmt.Errorf("bad ja3 from echo server: %q", echo.TLS.JA3)
+	}
+	if !slices.Equal(report.ExpectedCipherSuites, report.ActualCipherSuites) {
+		report.Mismatches = append(report.Mismatches, fmt.Sprintf("cipher suites: expected %v, actual %v", report.ExpectedCipherSuites, report.ActualCipherSuites))
+	}
+	expectedExtensions, actualExtensions := report.ExpectedExtensions, report.ActualExtensions
+	if !slices.Equal(expectedExtensions, slices.DeleteFunc(another.extensions, isGREASE)) { // shuffled
+		expectedExtensions = slices.Sorted(slices.Values(expectedExtensions))
+		actualExtensions = slices.Sorted(slices.Values(actualExtensions))
+	}
+	if !slices.Equal(expectedExtensions, actualExtensions) {
+		report.Mismatches = append(report.Mismatches, fmt.Sprintf("extensions: expected %v, actual %v", report.ExpectedExtensions, report.ActualExtensions))
+	}
+
+	if len(report.ExpectedHTTP2Settings) == 0 { // not customized
+		return report, nil
+	}
+	if echo.HTTP2.AkamaiFingerprint == "" {
+		report.Mismatches = append(report.Mismatches, "http2 settings: not reported by echo server, the request may not be sent over http2")
+		return report, nil
+	}
+	settings, _, _ := strings.Cut(echo.HTTP2.AkamaiFingerprint, "|")
+	for _, setting := range strings.Split(settings, ";") {
+		id, val, ok := strings.Cut(setting, ":")
+		if !ok {
+			return report, fmt.Errorf("bad akamai fingerprint from echo server: %q", echo.HTTP2.AkamaiFingerprint)
+		}
+		i, err1 := strconv.ParseUint(id, 10, 16)
+		v, err2 := strconv.ParseUint(val, 10, 32)
+		if err1 != nil || err2 != nil {
+			return report, fmt.Errorf("bad akamai fingerprint from echo server: %q", echo.HTTP2.AkamaiFingerprint)
+		}
+		report.ActualHTTP2Settings = append(report.ActualHTTP2Settings, http2.Setting{ID: http2.SettingID(i), Val: uint32(v)})
+	}
+	if !slices.Equal(report.ExpectedHTTP2Settings, report.ActualHTTP2Settings) {
+		report.Mismatches = append(report.Mismatches, fmt.Sprintf("http2 settings: expected %v, actual %v", report.ExpectedHTTP2Settings, report.ActualHTTP2Settings))
+	}
+	return report, nil
+}
+
+func parseUint16s(s, sep string) ([]uint16, error) {
+	if s == "" {
+		return nil, nil
+	}
+	var vals []uint16
+	for _, v := range strings.Split(s, sep) {
+		n, err := strconv.ParseUint(v, 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		vals = append(vals, uint16(n))
+	}
+	return vals, nil
+}
+
+// ja3SignatureAlgorithms is the signature algorithms sent when the tls
+// fingerprint is built from a JA3 string, which does not include them.
+var ja3SignatureAlgorithms = []utls.SignatureScheme{
+	utls.ECDSAWithP256AndSHA256,
+	utls.PSSWithSHA256,
+	utls.PKCS1WithSHA256,
+	utls.ECDSAWithP384AndSHA384,
+	utls.PSSWithSHA384,
+	utls.PKCS1WithSHA384,
+	utls.PSSWithSHA512,
+	utls.PKCS1WithSHA512,
+}
+
+// SetTLSFingerprintFromJA3 set the tls fingerprint from the JA3 string, e.g.
+// "771,4865-4866-4867-49195,0-23-65281-10-11-35-16-5-13-18-51-45-43,29-23-24,0".
+// The cipher suites, extensions and their order, supported groups and point
+// formats are taken from the JA3, the content of the extensions which is not
+// included in the JA3 (e.g. signature algorithms and ALPN) is filled with the
+// values sent by Chrome, and unknown extensions are sent with empty data. JA3
+// excludes GREASE values, so no GREASE is sent unless the JA3 keeps them, in
+// which case they are sent as random GREASE values at the same positions.
+// Note this is valid for HTTP1 and HTTP2, not HTTP3.
+func (c *Client) SetTLSFingerprintFromJA3(ja3 string) error {
+	if _, err := parseJA3(ja3); err != nil {
+		return err
+	}
+	c.setUTLSHandshake(utls.HelloCustom, func() (*utls.ClientHelloSpec, error) {
+		// extensions are stateful, so a fresh spec is required for each handshake.
+		return parseJA3(ja3)
+	})
+	return nil
+}
+
+// parseJA3 builds the utls ClientHelloSpec from the JA3 string.
+func parseJA3(ja3 string) (*utls.ClientHelloSpec, error) {
+	fields := strings.Split(ja3, ",")
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("bad ja3 %q: expected 5 fields, got %d", ja3, len(fields))
+	}
+	version, err := strconv.ParseUint(fields[0], 10, 16)
+	if err != nil || version < utls.VersionTLS10 || version > utls.VersionTLS13 {
+		return nil, fmt.Errorf("bad ja3 %q: invalid tls version %q", ja3, fields[0])
+	}
+	cipherSuites, err := parseUint16s(fields[1], "-")
+	if err != nil || len(cipherSuites) == 0 {
+		return nil, fmt.Errorf("bad ja3 %q: invalid cipher suites %q", ja3, fields[1])
+	}
+	extensions, err := parseUint16s(fields[2], "-")
+	if err != nil {
+		return nil, fmt.Errorf("bad ja3 %q: invalid extensions %q", ja3, fields[2])
+	}
+	groups, err := parseUint16s(fields[3], "-")
+	if err != nil {
+		return nil, fmt.Errorf("bad ja3 %q: invalid supported groups %q", ja3, fields[3])
+	}
+	formats, err := parseUint16s(fields[4], "-")
+	if err != nil || slices.ContainsFunc(formats, func(v uint16) bool { return v > 0xff }) {
+		return nil, fmt.Errorf("bad ja3 %q: invalid ec point formats %q", ja3, fields[4])
+	}
+
+	spec := &utls.ClientHelloSpec{
+		TLSVersMin:         utls.VersionTLS10,
+		TLSVersMax:         uint16(version),
+		CompressionMethods: []uint8{0},
+	}
+	for _, cs := range cipherSuites {
+		if isGREASE(cs) {
+			cs = utls.GREASE_PLACEHOLDER
+		}
+		spec.CipherSuites = append(spec.CipherSuites, cs)
+	}
+	curves := make([]utls.CurveID, len(groups))
+	for i, g := range groups {
+		if isGREASE(g) {
+			g = utls.GREASE_PLACEHOLDER
+		}
+		curves[i] = utls.CurveID(g)
+	}
+	points := make([]uint8, len(formats))
+	for i, f := range formats {
+		points[i] = uint8(f)
+	}
+	grease := slices.ContainsFunc(extensions, isGREASE)
+	for _, typ := range extensions {
+		ext, err := ja3Extension(typ, curves, points, grease)
+		if err != nil {
+			return nil, fmt.Errorf("bad ja3 %q: %w", ja3, err)
+		}
+		if _, ok := ext.(*utls.SupportedVersionsExtension); ok {
+			spec.TLSVersMax = utls.VersionTLS13
+		}
+		spec.Extensions = append(spec.Extensions, ext)
+	}
+	return spec, nil
+}
+
+// ja3Extension reconstructs the extension of the type from the JA3, the
+// curves and points are the supported groups and point formats of the JA3,
+// grease reports whether the JA3 keeps the GREASE values.
+func ja3Extension(typ uint16, curves []utls.CurveID, points []uint8, grease bool) (utls.TLSExtension, error) {
+	if isGREASE(typ) {
+		return &utls.UtlsGREASEExtension{}, nil
+	}
+	switch typ {
+	case extensionServerName:
+		return &utls.SNIExtension{}, nil
+	case 5:
+		return &utls.StatusRequestExtension{}, nil
+	case extensionSupportedGroups:
+		if len(curves) == 0 {
+			return nil, errors.New("supported groups extension without supported groups")
+		}
+		return &utls.SupportedCurvesExtension{Curves: curves}, nil
+	case extensionECPointFormats:
+		if len(points) == 0 {
+			return nil, errors.New("ec point formats extension without point formats")
+		}
+		return &utls.SupportedPointsExtension{SupportedPoints: points}, nil
+	case extensionSignatureAlgorithms:
+		return &utls.SignatureAlgorithmsExtension{SupportedSignatureAlgorithms: ja3SignatureAlgorithms}, nil
+	case extensionALPN:
+		return &utls.ALPNExtension{AlpnProtocols: []string{"h2", "http/1.1"}}, nil
+	case 17:
+		return &utls.StatusRequestV2Extension{}, nil
+	case 18:
+		return &utls.SCTExtension{}, nil
+	case 21:
+		// always padded, otherwise the extension is omitted and the JA3 differs.
+		return &utls.UtlsPaddingExtension{GetPaddingLen: func(unpaddedLen int) (int, bool) {
+			n, _ := utls.BoringPaddingStyle(unpaddedLen)
+			return n, true
+		}}, nil
+	case 22:
+		return &utls.GenericExtension{Id: 22}, nil // encrypt_then_mac
+	case 23:
+		return &utls.ExtendedMasterSecretExtension{}, nil
+	case 27:
+		return &utls.UtlsCompressCertExtension{Algorithms: []utls.CertCompressionAlgo{utls.CertCompressionBrotli}}, nil
+	case 28:
+		return &utls.FakeRecordSizeLimitExtension{Limit: 0x4001}, nil
+	case 34:
+		return &utls.FakeDelegatedCredentialsExtension{SupportedSignatureAlgorithms: []utls.SignatureScheme{
+			utls.ECDSAWithP256AndSHA256,
+			utls.ECDSAWithP384AndSHA384,
+			utls.ECDSAWithP521AndSHA512,
+			utls.ECDSAWithSHA1,
+		}}, nil
+	case 35:
+		return &utls.SessionTicketExtension{}, nil
+	case 41:
+		return &utls.UtlsPreSharedKeyExtension{}, nil
+	case extensionSupportedVersions:
+		versions := []uint16{utls.VersionTLS13, utls.VersionTLS12}
+		if grease {
+			versions = append([]uint16{utls.GREASE_PLACEHOLDER}, versions...)
+		}
+		return &utls.SupportedVersionsExtension{Versions: versions}, nil
+	case 45:
+		return &utls.PSKKeyExchangeModesExtension{Modes: []uint8{utls.PskModeDHE}}, nil
+	case 51:
+		return &utls.KeyShareExtension{KeyShares: ja3KeyShares(curves)}, nil
+	case 13172:
+		return &utls.NPNExtension{}, nil
+	case 17513:
+		return &utls.ApplicationSettingsExtension{SupportedProtocols: []string{"h2"}}, nil
+	case 17613:
+		return &utls.ApplicationSettingsExtensionNew{SupportedProtocols: []string{"h2"}}, nil
+	case 30031, 30032:
+		return &utls.FakeChannelIDExtension{OldExtensionID: typ == 30031}, nil
+	case 0xfe0d:
+		return utls.BoringGREASEECH(), nil
+	case 0xff01:
+		return &utls.RenegotiationInfoExtension{Renegotiation: utls.RenegotiateOnceAsClient}, nil
+	}
+	return &utls.GenericExtension{Id: typ}, nil
+}
+
+// ja3KeyShares returns the key shares sent like browsers: a GREASE key share
+// if GREASE is kept, the hybrid post-quantum key share with the X25519 one if
+// supported, otherwise the first supported group.
+func ja3KeyShares(curves []utls.CurveID) []utls.KeyShare {
+	var keyShares []utls.KeyShare
+	var first utls.CurveID
+	for _, curve := range curves {
+		if curve == utls.GREASE_PLACEHOLDER {
+			keyShares = append(keyShares, utls.KeyShare{Group: curve, Data: []byte{0}})
+		} else if first == 0 {
+			first = curve
+		}
+	}
+	if slices.Contains(curves, utls.X25519MLKEM768) && slices.Contains(curves, utls.X25519) {
+		return append(keyShares, utls.KeyShare{Group: utls.X25519MLKEM768}, utls.KeyShare{Group: utls.X25519})
+	}
+	if first != 0 {
+		keyShares = append(keyShares, utls.KeyShare{Group: first})
+	}
+	return keyShares
+}
+
+// ja4KnownFingerprints is the fingerprints whose cipher suites or extensions
+// are reused if their JA4 hashes match when building the tls fingerprint from
+// a JA4 string.
+var ja4KnownFingerprints = []utls.ClientHelloID{
+	utls.HelloChrome_133,
+	utls.HelloChrome_131,
+	utls.HelloChrome_120,
+	utls.HelloChrome_120_PQ,
+	utls.HelloChrome_115_PQ,
+	utls.HelloChrome_114_Padding_PSK_Shuf,
+	utls.HelloChrome_112_PSK_Shuf,
+	utls.HelloChrome_106_Shuffle,
+	utls.HelloChrome_102,
+	utls.HelloChrome_100,
+	utls.HelloChrome_96,
+	utls.HelloChrome_87,
+	utls.HelloChrome_83,
+	utls.HelloChrome_72,
+	utls.HelloFirefox_120,
+	utls.HelloFirefox_105,
+	utls.HelloFirefox_102,
+	utls.HelloFirefox_99,
+	utls.HelloFirefox_65,
+	utls.HelloSafari_16_0,
+	utls.HelloIOS_14,
+	utls.HelloIOS_13,
+	utls.HelloIOS_12_1,
+	utls.HelloEdge_106,
+	utls.HelloEdge_85,
+	utls.Hello360_11_0,
+	utls.Hello360_7_5,
+	utls.HelloQQ_11_1,
+	utls.HelloAndroid_11_OkHttp,
+}
+
+// ja4CipherSuites is the cipher suites sent in order when the cipher suites
+// of the JA4 string do not match a known fingerprint, the first ones are sent
+// according to the number of cipher suites in the JA4.
+var ja4CipherSuites = []uint16{
+	utls.TLS_AES_128_GCM_SHA256,
+	utls.TLS_AES_256_GCM_SHA384,
+	utls.TLS_CHACHA20_POLY1305_SHA256,
+	utls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	utls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	utls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	utls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	utls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305,
+	utls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305,
+	utls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+	utls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA,
+	utls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	utls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+	utls.TLS_RSA_WITH_AES_128_CBC_SHA,
+	utls.TLS_RSA_WITH_AES_256_CBC_SHA,
+	utls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA,
+	utls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA,
+	utls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256,
+	utls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256,
+	utls.TLS_RSA_WITH_AES_128_CBC_SHA256,
+	utls.TLS_RSA_WITH_3DES_EDE_CBC_SHA,
+	utls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA,
+}
+
+// ja4Extensions is the extensions (except SNI and ALPN) sent when the
+// extensions of the JA4 string do not match a known fingerprint, the first
+// ones are sent according to the number of extensions in the JA4, so the 4
+// ones required by TLS 1.3 come first.
+var ja4Extensions = []uint16{
+	extensionSupportedVersions,
+	extensionSupportedGroups,
+	extensionSignatureAlgorithms,
+	51, // key_share
+	45, // psk_key_exchange_modes
+	extensionECPointFormats,
+	23,     // extended_master_secret
+	0xff01, // renegotiation_info
+	35,     // session_ticket
+	5,      // status_request
+	18,     // signed_certificate_timestamp
+	27,     // compress_certificate
+	17513,  // application_settings
+	21,     // padding
+	28,     // record_size_limit
+	34,     // delegated_credentials
+	0xfe0d, // encrypted_client_hello
+	22,     // encrypt_then_mac
+}
+
+// tls13OnlyExtensions is the extensions which are not sent with TLS 1.2.
+var tls13OnlyExtensions = []uint16{extensionSupportedVersions, 51, 45, 27, 17513, 34, 0xfe0d}
+
+// ja4Spec is the parsed JA4 string, the cipher suites and extensions are taken
+// from the known fingerprints if not nil.
+type ja4Spec struct {
+	version      uint16
+	sni          bool
+	alpn         []string
+	numCiphers   int
+	numExts      int
+	cipherSource *utls.ClientHelloID
+	extSource    *utls.ClientHelloID
+}
+
+// SetTLSFingerprintFromJA4 set the tls fingerprint from the JA4 string, e.g.
+// "t13d1516h2_8daaf6152771_e5627efa2ab1". JA4 only contains the hashes of the
+// sorted cipher suites and extensions, so the fingerprint can be rebuilt only
+// in best effort:
+//
+//   - The TLS version, the presence of SNI, the first and last characters of
+//     the first ALPN protocol ("h2" and "h1" are supported), and the number of
+//     cipher suites and extensions are always reproduced.
+//   - If the cipher suite hash or the extension hash matches one of the
+//     browser fingerprints built in utls, the cipher suites or extensions
+//     (with signature algorithms) of that fingerprint are used, and the JA4
+//     part matches exactly.
+//   - Otherwise the cipher suites and extensions are the first ones of a list
+//     of commonly used values, so the hash does not match, and the order of
+//     them is not reproduced as it's not contained in JA4.
+//
+// The protocol (the first character) is ignored as the fingerprint is used for
+// TCP. Note this is valid for HTTP1 and HTTP2, not HTTP3.
+func (c *Client) SetTLSFingerprintFromJA4(ja4 string) error {
+	s, err := parseJA4(ja4)
+	if err != nil {
+		return err
+	}
+	if _, err = s.clientHelloSpec(); err != nil {
+		return fmt.Errorf("bad ja4 %q: %w", ja4, err)
+	}
+	c.setUTLSHandshake(utls.HelloCustom, s.clientHelloSpec)
+	return nil
+}
+
+// parseJA4 parses the JA4 string, and finds the known fingerprints whose
+// cipher suites or extensions match the hashes.
+func parseJA4(ja4 string) (*ja4Spec, error) {
+	parts := strings.Split(ja4, "_")
+	if len(parts) != 3 || len(parts[0]) != 10 || len(parts[1]) != 12 || len(parts[2]) != 12 {
+		return nil, fmt.Errorf("bad ja4 %q: expected format like t13d1516h2_8daaf6152771_e5627efa2ab1", ja4)
+	}
+	for _, h := range parts[1:] {
+		if _, err := hex.DecodeString(h); err != nil {
+			return nil, fmt.Errorf("bad ja4 %q: invalid hash %q", ja4, h)
+		}
+	}
+	a := parts[0]
+	s := &ja4Spec{}
+	if a[0] != 't' && a[0] != 'q' {
+		return nil, fmt.Errorf("bad ja4 %q: unsupported protocol %q", ja4, a[0])
+	}
+	switch a[1:3] {
+	case "13":
+		s.version = utls.VersionTLS13
+	case "12":
+		s.version = utls.VersionTLS12
+	case "11":
+		s.version = utls.VersionTLS11
+	case "10":
+		s.version = utls.VersionTLS10
+	default:
+		return nil, fmt.Errorf("bad ja4 %q: unsupported tls version %q", ja4, a[1:3])
+	}
+	switch a[3] {
+	case 'd':
+		s.sni = true
+	case 'i':
+	default:
+		return nil, fmt.Errorf("bad ja4 %q: invalid sni %q", ja4, a[3])
+	}
+	numCiphers, err1 := strconv.Atoi(a[4:6])
+	numExts, err2 := strconv.Atoi(a[6:8])
+	if err1 != nil || err2 != nil || numCiphers == 0 {
+		return nil, fmt.Errorf("bad ja4 %q: invalid number of cipher suites or extensions", ja4)
+	}
+	s.numCiphers, s.numExts = numCiphers, numExts
+	switch a[8:] {
+	case "h2":
+		s.alpn = []string{"h2", "http/1.1"}
+	case "h1":
+		s.alpn = []string{"http/1.1"}
+	case "00":
+	default:
+		return nil, fmt.Errorf("bad ja4 %q: unsupported alpn %q", ja4, a[8:])
+	}
+
+	for _, id := range ja4KnownFingerprints {
+		spec, err := utls.UTLSIdToSpec(id)
+		if err != nil {
+			continue
+		}
+		raw, err := marshalClientHelloSpec(&spec)
+		if err != nil {
+			continue
+		}
+		info, err := parseClientHelloInfo(raw)
+		if err != nil {
+			continue
+		}
+		known := strings.Split(info.ja4(), "_")
+		if s.cipherSource == nil && known[1] == parts[1] {
+			s.cipherSource = &id
+		}
+		if s.extSource == nil && known[2] == parts[2] {
+			s.extSource = &id
+		}
+	}
+	return s, nil
+}
+
+// clientHelloSpec builds the ClientHelloSpec of the JA4, a fresh one is
+// required for each handshake as the extensions are stateful.
+func (s *ja4Spec) clientHelloSpec() (*utls.ClientHelloSpec, error) {
+	spec := &utls.ClientHelloSpec{
+		TLSVersMin:         utls.VersionTLS10,
+		TLSVersMax:         s.version,
+		CompressionMethods: []uint8{0},
+	}
+	if s.cipherSource != nil {
+		known, err := utls.UTLSIdToSpec(*s.cipherSource)
+		if err != nil {
+			return nil, err
+		}
+		spec.CipherSuites = known.CipherSuites
+	} else {
+		ciphers := ja4CipherSuites
+		if s.version < utls.VersionTLS13 {
+			// TLS 1.3 cipher suites are not sent if TLS 1.3 is not supported.
+			ciphers = ciphers[3:]
+		}
+		if s.numCiphers > len(ciphers) {
+			return nil, fmt.Errorf("unsupported number of cipher suites: %d", s.numCiphers)
+		}
+		spec.CipherSuites = slices.Clone(ciphers[:s.numCiphers])
+	}
+
+	if s.extSource != nil {
+		known, err := utls.UTLSIdToSpec(*s.extSource)
+		if err != nil {
+			return nil, err
+		}
+		for _, ext := range known.Extensions {
+			switch ext.(type) {
+			case *utls.SNIExtension:
+				if !s.sni {
+					continue
+				}
+			case *utls.ALPNExtension:
+				if s.alpn == nil {
+					continue
+				}
+				ext = &utls.ALPNExtension{AlpnProtocols: s.alpn}
+			}
+			spec.Extensions = append(spec.Extensions, ext)
+		}
+	} else {
+		n := s.numExts
+		if s.sni {
+			n--
+		}
+		if s.alpn != nil {
+			n--
+		}
+		candidates := ja4Extensions
+		if s.version < utls.VersionTLS13 {
+			candidates = slices.DeleteFunc(slices.Clone(ja4Extensions), func(typ uint16) bool {
+				return slices.Contains(tls13OnlyExtensions, typ)
+			})
+		}
+		if n < 0 || n > len(candidates) || (s.version == utls.VersionTLS13 && n < 4) {
+			return nil, fmt.Errorf("unsupported number of extensions: %d", s.numExts)
+		}
+		curves := []utls.CurveID{utls.X25519, utls.CurveP256, utls.CurveP384}
+		for _, typ := range candidates[:n] {
+			ext, err := ja3Extension(typ, curves, []uint8{0}, false)
+			if err != nil {
+				return nil, err
+			}
+			spec.Extensions = append(spec.Extensions, ext)
+		}
+	}
+	// SNI and ALPN are excluded from the extension hash, add them if missing.
+	if s.alpn != nil && !slices.ContainsFunc(spec.Extensions, isExtension[*utls.ALPNExtension]) {
+		spec.Extensions = append([]utls.TLSExtension{&utls.ALPNExtension{AlpnProtocols: s.alpn}}, spec.Extensions...)
+	}
+	if s.sni && !slices.ContainsFunc(spec.Extensions, isExtension[*utls.SNIExtension]) {
+		spec.Extensions = append([]utls.TLSExtension{&utls.SNIExtension{}}, spec.Extensions...)
+	}
+	return spec, nil
+}
+
+func isExtension[T utls.TLSExtension](ext utls.TLSExtension) bool {
+	_, ok := ext.(T)
+	return ok
+}
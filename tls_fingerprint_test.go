@@ -0,0 +1,304 @@
+package req
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/imroc/req/v3/internal/testcert"
+	"github.com/imroc/req/v3/internal/tests"
+	utls "github.com/refraction-networking/utls"
+	xhttp2 "golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+func TestJA3(t *testing.T) {
+	c := tc()
+	_, err := c.JA3()
+	tests.AssertEqual(t, errTLSFingerprintNotSet, err)
+
+	c.SetTLSFingerprint(utls.HelloSafari_16_0)
+	ja3, err := c.JA3()
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "771,4865-4866-4867-49196-49195-52393-49200-49199-52392-49162-49161-49172-49171-157-156-53-47-49160-49170-10,0-23-65281-10-11-16-5-13-18-51-45-43-27-21,29-23-24-25,0", ja3)
+	hash, err := c.JA3Hash()
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "773906b0efdefa24a7f2b8eb6985bf37", hash)
+
+	// GREASE values are excluded.
+	ja3, err = tc().ImpersonateChrome().JA3()
+	tests.AssertNoError(t, err)
+	for _, field := range strings.Split(ja3, ",")[1:] {
+		for _, v := range strings.Split(field, "-") {
+			n, err := strconv.Atoi(v)
+			tests.AssertNoError(t, err)
+			tests.AssertEqual(t, false, isGREASE(uint16(n)))
+		}
+	}
+
+	// the same JA3 is reconstructed from the raw ClientHello.
+	expected, err := tc().ImpersonateFirefox().JA3()
+	tests.AssertNoError(t, err)
+	ja3, err = tc().SetCustomTLSFingerprint(buildRawClientHello(t, utls.HelloFirefox_120)).JA3()
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, expected, ja3)
+}
+
+func TestParseClientHello(t *testing.T) {
+	raw := buildRawClientHello(t, utls.HelloFirefox_120)
+	spec, err := ParseClientHello(raw)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, uint16(utls.TLS_AES_128_GCM_SHA256), spec.CipherSuites[0])
+	// without the record header.
+	spec, err = ParseClientHello(raw[5:])
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, uint16(utls.TLS_AES_128_GCM_SHA256), spec.CipherSuites[0])
+
+	_, err = ParseClientHello(nil)
+	tests.AssertErrorContains(t, err, "client hello truncated at offset 0")
+	_, err = ParseClientHello(raw[:20])
+	tests.AssertErrorContains(t, err, "client hello truncated at offset 5")
+	_, err = ParseClientHello(raw[5:50])
+	tests.AssertErrorContains(t, err, "client hello truncated at offset 4")
+	_, err = ParseClientHello([]byte{0x02, 0x00, 0x00, 0x00})
+	tests.AssertErrorContains(t, err, "not a client hello at offset 0")
+}
+
+func TestJA4(t *testing.T) {
+	_, err := tc().JA4()
+	tests.AssertEqual(t, errTLSFingerprintNotSet, err)
+
+	// the extensions of Chrome are shuffled, but the JA4 is stable.
+	for i := 0; i < 3; i++ {
+		ja4, err := tc().ImpersonateChrome().JA4()
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, "t13d1516h2_8daaf6152771_02713d6af862", ja4)
+	}
+	ja4, err := tc().ImpersonateFirefox().JA4()
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "t13d1715h2_5b57614c22b0_5c2c66f702b0", ja4)
+	ja4, err = tc().SetCustomTLSFingerprint(buildRawClientHello(t, utls.HelloFirefox_120)).JA4()
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "t13d1715h2_5b57614c22b0_5c2c66f702b0", ja4)
+}
+
+func TestProfileMatchesFingerprint(t *testing.T) {
+	safari := SafariProfile()
+	safari.ClientHelloID = utls.HelloSafari_16_0
+	const ja3 = "771,4865-4866-4867-49196-49195-52393-49200-49199-52392-49162-49161-49172-49171-157-156-53-47-49160-49170-10,0-23-65281-10-11-16-5-13-18-51-45-43-27-21,29-23-24-25,0"
+	tests.AssertEqual(t, true, safari.MatchesFingerprint(ja3))
+	tests.AssertEqual(t, true, safari.MatchesFingerprint("773906B0EFDEFA24A7F2B8EB6985BF37"))
+	tests.AssertEqual(t, true, safari.MatchesFingerprint(md5Hash(normalizeJA3(ja3))))
+	tests.AssertEqual(t, false, safari.MatchesFingerprint(strings.Replace(ja3, "4865-", "", 1)))
+	tests.AssertEqual(t, false, safari.MatchesFingerprint("00000000000000000000000000000000"))
+	tests.AssertEqual(t, false, safari.MatchesFingerprint("bad ja3"))
+
+	// the extensions of Chrome are shuffled.
+	chrome := ChromeProfile()
+	chromeJA3, err := tc().ImpersonateChrome().JA3()
+	tests.AssertNoError(t, err)
+	for i := 0; i < 3; i++ {
+		tests.AssertEqual(t, true, chrome.MatchesFingerprint(chromeJA3))
+		tests.AssertEqual(t, true, chrome.MatchesFingerprint(md5Hash(normalizeJA3(chromeJA3))))
+	}
+	tests.AssertEqual(t, false, chrome.MatchesFingerprint(chromeJA3[:len(chromeJA3)-1]+"1"))
+
+	tests.AssertEqual(t, true, chrome.MatchesJA4("t13d1516h2_8daaf6152771_02713d6af862"))
+	tests.AssertEqual(t, true, FirefoxProfile().MatchesJA4("t13d1715h2_5b57614c22b0_5c2c66f702b0"))
+	tests.AssertEqual(t, false, FirefoxProfile().MatchesJA4("t13d1516h2_8daaf6152771_02713d6af862"))
+
+	// the ClientHello can not be built.
+	tests.AssertEqual(t, false, BrowserProfile{}.MatchesJA4("t13d1516h2_8daaf6152771_02713d6af862"))
+}
+
+// recordConn records the bytes read from the connection.
+type recordConn struct {
+	net.Conn
+	buf bytes.Buffer
+}
+
+func (c *recordConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.buf.Write(p[:n])
+	return n, err
+}
+
+// startFingerprintEchoServer starts a tls echo server which reflects the JA3
+// and the HTTP2 SETTINGS of the request, the first cipher suite is dropped from
+// the JA3 if tamper is true.
+func startFingerprintEchoServer(t *testing.T, tamper bool) string {
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	tests.AssertNoError(t, err)
+	ln := tests.NewLocalListener(t)
+	t.Cleanup(func() { ln.Close() })
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		rc := &recordConn{Conn: conn}
+		tlsConn := tls.Server(rc, &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"h2"}})
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		hello, err := parseClientHelloInfo(rc.buf.Bytes())
+		if err != nil {
+			return
+		}
+		if tamper {
+			hello.cipherSuites = hello.cipherSuites[1:]
+		}
+		preface := make([]byte, len(xhttp2.ClientPreface))
+		if _, err = io.ReadFull(tlsConn, preface); err != nil {
+			return
+		}
+		fr := xhttp2.NewFramer(tlsConn, tlsConn)
+		var settings []string
+		var streamID uint32
+		for streamID == 0 {
+			f, err := fr.ReadFrame()
+			if err != nil {
+				return
+			}
+			switch f := f.(type) {
+			case *xhttp2.SettingsFrame:
+				if !f.IsAck() && settings == nil {
+					f.ForeachSetting(func(s xhttp2.Setting) error {
+						settings = append(settings, fmt.Sprintf("%d:%d", s.ID, s.Val))
+						return nil
+					})
+				}
+			case *xhttp2.HeadersFrame:
+				streamID = f.StreamID
+			}
+		}
+		body, _ := json.Marshal(map[string]any{
+			"tls":   map[string]string{"ja3": hello.ja3()},
+			"http2": map[string]string{"akamai_fingerprint": strings.Join(settings, ";") + "|0|0|m,a,s,p"},
+		})
+		var hbuf bytes.Buffer
+		enc := hpack.NewEncoder(&hbuf)
+		enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+		enc.WriteField(hpack.HeaderField{Name: "content-type", Value: "application/json"})
+		fr.WriteSettings()
+		fr.WriteSettingsAck()
+		fr.WriteHeaders(xhttp2.HeadersFrameParam{StreamID: streamID, BlockFragment: hbuf.Bytes(), EndHeaders: true})
+		fr.WriteData(streamID, true, body)
+		for {
+			if _, err := fr.ReadFrame(); err != nil {
+				return
+			}
+		}
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestVerifyFingerprint(t *testing.T) {
+	addr := startFingerprintEchoServer(t, false)
+	for _, c := range []*Client{C().ImpersonateChrome(), C().ImpersonateFirefox(), C().ImpersonateSafari()} {
+		report, err := c.EnableInsecureSkipVerify().VerifyFingerprint(addr)
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, true, report.OK())
+		tests.AssertEqual(t, report.ExpectedHTTP2Settings, report.ActualHTTP2Settings)
+	}
+
+	report, err := C().EnableInsecureSkipVerify().ImpersonateFirefox().VerifyFingerprint(startFingerprintEchoServer(t, true))
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, false, report.OK())
+	tests.AssertEqual(t, 1, len(report.Mismatches))
+	tests.AssertContains(t, report.Mismatches[0], "cipher suites", true)
+}
+
+func TestSetTLSFingerprintFromJA3(t *testing.T) {
+	for _, id := range []utls.ClientHelloID{utls.HelloChrome_100, utls.HelloFirefox_120, utls.HelloSafari_16_0} {
+		expected, err := tc().SetTLSFingerprint(id).JA3()
+		tests.AssertNoError(t, err)
+		c := tc()
+		tests.AssertNoError(t, c.SetTLSFingerprintFromJA3(expected))
+		ja3, err := c.JA3()
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, expected, ja3)
+		resp, err := c.R().Get("/")
+		assertSuccess(t, resp, err)
+	}
+
+	// GREASE values kept in the JA3 are sent as GREASE.
+	c := tc()
+	tests.AssertNoError(t, c.SetTLSFingerprintFromJA3("771,2570-4865-4866-4867,2570-0-10-11-13-16-43-45-51,2570-29-23,0"))
+	parsed, err := ParseClientHello(captureClientHello(t, c))
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, true, isGREASE(parsed.CipherSuites[0]))
+	_, ok := parsed.Extensions[0].(*utls.UtlsGREASEExtension)
+	tests.AssertEqual(t, true, ok)
+	ja3, _ := c.JA3()
+	tests.AssertEqual(t, "771,4865-4866-4867,0-10-11-13-16-43-45-51,29-23,0", ja3)
+	resp, err := c.R().Get("/")
+	assertSuccess(t, resp, err)
+
+	for _, ja3 := range []string{
+		"771,4865,0",
+		"foo,4865,0,29,0",
+		"771,,0,29,0",
+		"771,4865,0-bar,29,0",
+		"771,4865,0-10,,0",
+		"771,4865,0,29,256",
+	} {
+		tests.AssertErrorContains(t, tc().SetTLSFingerprintFromJA3(ja3), "bad ja3")
+	}
+}
+
+func TestSetTLSFingerprintFromJA4(t *testing.T) {
+	for _, id := range []utls.ClientHelloID{utls.HelloChrome_120, utls.HelloFirefox_120, utls.HelloSafari_16_0} {
+		expected, err := tc().SetTLSFingerprint(id).JA4()
+		tests.AssertNoError(t, err)
+		c := tc()
+		tests.AssertNoError(t, c.SetTLSFingerprintFromJA4(expected))
+		ja4, err := c.JA4()
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, expected, ja4)
+		resp, err := c.R().Get("/")
+		assertSuccess(t, resp, err)
+	}
+
+	// only the first part is reproduced if the hashes are unknown.
+	for _, ja4 := range []string{
+		"t13d1209h2_aaaaaaaaaaaa_bbbbbbbbbbbb",
+		"t12i0806h1_aaaaaaaaaaaa_bbbbbbbbbbbb",
+		"t13d0506h2_aaaaaaaaaaaa_bbbbbbbbbbbb",
+	} {
+		c := tc()
+		tests.AssertNoError(t, c.SetTLSFingerprintFromJA4(ja4))
+		actual, err := c.JA4()
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, ja4[:10], actual[:10])
+		resp, err := c.R().Get("/")
+		assertSuccess(t, resp, err)
+	}
+
+	for _, ja4 := range []string{
+		"t13d1516h2_8daaf6152771",
+		"d13d1516h2_8daaf6152771_e5627efa2ab1",
+		"t14d1516h2_8daaf6152771_e5627efa2ab1",
+		"t13x1516h2_8daaf6152771_e5627efa2ab1",
+		"t13d15xxh2_8daaf6152771_e5627efa2ab1",
+		"t13d1516h3_8daaf6152771_e5627efa2ab1",
+		"t13d1516h2_8daaf615277z_e5627efa2ab1",
+		"t13d9916h2_aaaaaaaaaaaa_bbbbbbbbbbbb",
+		"t13d1599h2_aaaaaaaaaaaa_bbbbbbbbbbbb",
+		"t13d1505h2_aaaaaaaaaaaa_bbbbbbbbbbbb",
+	} {
+		tests.AssertErrorContains(t, tc().SetTLSFingerprintFromJA4(ja4), "bad ja4")
+	}
+}
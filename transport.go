@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
 	"mime"
 	"net"
 	"net/http"
@@ -26,6 +27,7 @@ import (
 	"net/textproto"
 	"net/url"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -33,6 +35,7 @@ import (
 	_ "unsafe"
 
 	"github.com/imroc/req/v3/http2"
+	"github.com/imroc/req/v3/http3"
 	"github.com/imroc/req/v3/internal/altsvcutil"
 	"github.com/imroc/req/v3/internal/ascii"
 	"github.com/imroc/req/v3/internal/common"
@@ -40,13 +43,14 @@ import (
 	"github.com/imroc/req/v3/internal/dump"
 	"github.com/imroc/req/v3/internal/header"
 	h2internal "github.com/imroc/req/v3/internal/http2"
-	"github.com/imroc/req/v3/internal/http3"
+	h3internal "github.com/imroc/req/v3/internal/http3"
 	"github.com/imroc/req/v3/internal/netutil"
 	"github.com/imroc/req/v3/internal/socks"
 	"github.com/imroc/req/v3/internal/transport"
 	"github.com/imroc/req/v3/internal/util"
 	"github.com/imroc/req/v3/pkg/altsvc"
 	reqtls "github.com/imroc/req/v3/pkg/tls"
+	"github.com/quic-go/quic-go"
 	htmlcharset "golang.org/x/net/html/charset"
 	"golang.org/x/text/encoding/ianaindex"
 
@@ -132,7 +136,21 @@ type Transport struct {
 	transport.Options
 
 	t2 *h2internal.Transport // non-nil if http2 wired up
-	t3 *http3.Transport
+	t3 *h3internal.Transport
+
+	// http3Settings is the http3 settings frame sent once http3 is enabled.
+	http3Settings *http3.Settings
+	// http2SettingsJitterSeed is the seed of the http2 settings jitter.
+	http2SettingsJitterSeed *int64
+	// maxHTTP3FrameSize is the maximum payload size of received http3 frames.
+	maxHTTP3FrameSize uint64
+	// maxDecompressedSize is the maximum size of the decompressed response
+	// body, zero means no limit.
+	maxDecompressedSize int64
+	// http3UnknownFrameHandler is called with the payload of unknown http3 frames.
+	http3UnknownFrameHandler func(http3.FrameType, io.Reader) (processed bool, err error)
+	// http3DatagramHandler is called with the received http3 datagrams.
+	http3DatagramHandler func(stream quic.StreamID, payload []byte)
 
 	// disableAutoDecode, if true, prevents auto detect response
 	// body's charset and decode it to utf-8
@@ -144,6 +162,11 @@ type Transport struct {
 	autoDecodeContentType func(contentType string) bool
 	wrappedRoundTrip      http.RoundTripper
 	httpRoundTripWrappers []HttpRoundTripWrapper
+
+	// headerOrder and pseudoHeaderOrder are the default header order of
+	// requests, only used if the order is not specified in the request.
+	headerOrder       []string
+	pseudoHeaderOrder []string
 }
 
 // NewTransport is an alias of T
@@ -329,6 +352,9 @@ func (t *Transport) SetGetProxyConnectHeader(fn func(ctx context.Context, proxyU
 // SetProxyConnectHeader set the ProxyConnectHeader, which optionally specifies headers to
 // send to proxies during CONNECT requests.
 // To set the header dynamically, see SetGetProxyConnectHeader.
+// The header names are sent as is after the Host header, in the order of the
+// values of HeaderOderKey if present (the Host header can be ordered as well),
+// and no User-Agent is added if the header has none.
 func (t *Transport) SetProxyConnectHeader(header http.Header) *Transport {
 	t.ProxyConnectHeader = header
 	return t
@@ -398,6 +424,14 @@ func (t *Transport) SetHTTP2ReadIdleTimeout(timeout time.Duration) *Transport {
 	return t
 }
 
+// SetHTTP2PingPayload set the function which returns the opaque data of the
+// seq-th (from 0) http2 PING frame sent on each connection, the data is random
+// if fn is nil.
+func (t *Transport) SetHTTP2PingPayload(fn func(seq uint64) [8]byte) *Transport {
+	t.t2.PingPayload = fn
+	return t
+}
+
 // SetHTTP2PingTimeout set the http2 PingTimeout, which is the timeout
 // after which the connection will be closed if a response to Ping is
 // not received.
@@ -419,6 +453,7 @@ func (t *Transport) SetHTTP2WriteByteTimeout(timeout time.Duration) *Transport {
 // SetHTTP2SettingsFrame set the ordered http2 settings frame.
 func (t *Transport) SetHTTP2SettingsFrame(settings ...http2.Setting) *Transport {
 	t.t2.Settings = settings
+	t.t2.ResetFingerprintKey()
 	return t
 }
 
@@ -426,21 +461,139 @@ func (t *Transport) SetHTTP2SettingsFrame(settings ...http2.Setting) *Transport
 // value of initial WINDOW_UPDATE frame.
 func (t *Transport) SetHTTP2ConnectionFlow(flow uint32) *Transport {
 	t.t2.ConnectionFlow = flow
+	t.t2.ResetFingerprintKey()
 	return t
 }
 
+// SetHTTP2SettingsJitter set whether to perturb the values of the http2
+// settings within browser-plausible ranges, the IDs and the order of the
+// settings are kept. The values are deterministic for the seed set by
+// SetHTTP2SettingsJitterSeed, or a random seed chosen once otherwise.
+func (t *Transport) SetHTTP2SettingsJitter(enable bool) *Transport {
+	if !enable {
+		t.t2.JitterSettings = nil
+		return t
+	}
+	if t.http2SettingsJitterSeed == nil {
+		seed := rand.Int63()
+		t.http2SettingsJitterSeed = &seed
+	}
+	t.t2.JitterSettings = jitterHTTP2Settings(*t.http2SettingsJitterSeed)
+	return t
+}
+
+// SetHTTP2SettingsJitterSeed set the seed of the http2 settings jitter and
+// enable it, the same seed always produces the same values.
+func (t *Transport) SetHTTP2SettingsJitterSeed(seed int64) *Transport {
+	t.http2SettingsJitterSeed = &seed
+	return t.SetHTTP2SettingsJitter(true)
+}
+
+// jitterHTTP2Settings returns a func which perturbs the size related values
+// of the http2 settings by up to 1/8, the values are rounded to a step and
+// kept within the valid range, other settings are not changed.
+func jitterHTTP2Settings(seed int64) func(settings []http2.Setting) []http2.Setting {
+	return func(settings []http2.Setting) []http2.Setting {
+		r := rand.New(rand.NewSource(seed))
+		jittered := cloneSlice(settings)
+		for i, setting := range jittered {
+			switch setting.ID {
+			case http2.SettingHeaderTableSize:
+				jittered[i].Val = jitterUint32(r, setting.Val, 4096, 4096, 1<<16)
+			case http2.SettingMaxConcurrentStreams:
+				jittered[i].Val = jitterUint32(r, setting.Val, 100, 100, 1<<16)
+			case http2.SettingInitialWindowSize:
+				jittered[i].Val = jitterUint32(r, setting.Val, 1<<16, 1<<16, 1<<31-1)
+			case http2.SettingMaxFrameSize:
+				jittered[i].Val = jitterUint32(r, setting.Val, 1024, 1<<14, 1<<24-1)
+			case http2.SettingMaxHeaderListSize:
+				jittered[i].Val = jitterUint32(r, setting.Val, 1024, 1<<14, 1<<30)
+			}
+		}
+		return jittered
+	}
+}
+
+// jitterUint32 perturbs v by up to 1/8 and rounds it down to a multiple of
+// step within [lo, hi], v is not changed if it's out of the range.
+func jitterUint32(r *rand.Rand, v, step, lo, hi uint32) uint32 {
+	if v < lo || v > hi {
+		return v
+	}
+	d := int64(v) / 8
+	n := int64(v) + r.Int63n(2*d+1) - d
+	n -= n % int64(step)
+	return uint32(min(max(n, int64(lo)), int64(hi)))
+}
+
 // SetHTTP2HeaderPriority set the header priority param.
 func (t *Transport) SetHTTP2HeaderPriority(priority http2.PriorityParam) *Transport {
 	t.t2.HeaderPriority = priority
+	t.t2.ResetFingerprintKey()
+	return t
+}
+
+// SetHTTP2PriorityUpdate set the priority field value (e.g. "u=0, i") of the
+// http2 PRIORITY_UPDATE frame sent before the HEADERS frame of each request,
+// no PRIORITY_UPDATE frame is sent if priority is empty.
+func (t *Transport) SetHTTP2PriorityUpdate(priority string) *Transport {
+	t.t2.PriorityUpdate = priority
+	return t
+}
+
+// SetHTTP2SplitCookie set whether the Cookie header is split into separate
+// http2 header fields of each cookie-pair (enabled by default), which is what
+// Firefox does, Chrome and Safari send a single cookie header field instead.
+func (t *Transport) SetHTTP2SplitCookie(split bool) *Transport {
+	t.t2.DisableCookieSplit = !split
+	return t
+}
+
+// SetHTTP2MaxHeaderFrameSize set the maximum payload size of the http2 HEADERS
+// and CONTINUATION frames of the header blocks, 0 means the SETTINGS_MAX_FRAME_SIZE
+// of the server is used.
+func (t *Transport) SetHTTP2MaxHeaderFrameSize(size uint32) *Transport {
+	t.t2.MaxHeaderFrameSize = size
 	return t
 }
 
 // SetHTTP2PriorityFrames set the ordered http2 priority frames.
 func (t *Transport) SetHTTP2PriorityFrames(frames ...http2.PriorityFrame) *Transport {
 	t.t2.PriorityFrames = frames
+	t.t2.ResetFingerprintKey()
 	return t
 }
 
+// SetHeaderOrder set the default order of the http header (case-insensitive),
+// which is used if the order is not specified in the request.
+func (t *Transport) SetHeaderOrder(keys ...string) *Transport {
+	t.headerOrder = keys
+	return t
+}
+
+// SetPseudoHeaderOrder set the default order of the pseudo http header
+// (case-insensitive), which is used if the order is not specified in the
+// request. Note this is only valid for http2 and http3.
+func (t *Transport) SetPseudoHeaderOrder(keys ...string) *Transport {
+	t.pseudoHeaderOrder = keys
+	return t
+}
+
+func (t *Transport) setupHeaderOrder(req *http.Request) {
+	if len(t.headerOrder) == 0 && len(t.pseudoHeaderOrder) == 0 {
+		return
+	}
+	if req.Header == nil {
+		req.Header = make(http.Header)
+	}
+	if len(t.headerOrder) > 0 && len(req.Header[header.HeaderOderKey]) == 0 {
+		req.Header[header.HeaderOderKey] = t.headerOrder
+	}
+	if len(t.pseudoHeaderOrder) > 0 && len(req.Header[header.PseudoHeaderOderKey]) == 0 {
+		req.Header[header.PseudoHeaderOderKey] = t.pseudoHeaderOrder
+	}
+}
+
 // SetTLSClientConfig set the custom TLSClientConfig, which specifies the TLS configuration to
 // use with tls.Client.
 // If nil, the default configuration is used.
@@ -586,22 +739,166 @@ func (t *Transport) EnableHTTP3() {
 	if t.pendingAltSvcs == nil {
 		t.pendingAltSvcs = make(map[string]*pendingAltSvc)
 	}
-	t3 := &http3.Transport{
-		Options: &t.Options,
+	t3 := &h3internal.Transport{
+		Options:             &t.Options,
+		MaxFrameSize:        t.maxHTTP3FrameSize,
+		UnknownFrameHandler: t.http3UnknownFrameHandler,
+		DatagramHandler:     t.http3DatagramHandler,
 	}
 	t.t3 = t3
+	t.applyHTTP3Settings()
+}
+
+// SetHTTP3Settings set the http3 settings frame, it takes effect
+// once http3 is enabled.
+func (t *Transport) SetHTTP3Settings(settings *http3.Settings) *Transport {
+	t.http3Settings = settings.Clone()
+	t.applyHTTP3Settings()
+	return t
+}
+
+// SetMaxDecompressedSize set the maximum size of the decompressed response
+// body, which guards against the decompression bombs sent by hostile servers
+// when gzip, deflate, br or zstd is advertised. Reading the body returns a
+// *DecompressedSizeError once more bytes are decoded. Zero means no limit,
+// which is the default.
+func (t *Transport) SetMaxDecompressedSize(size int64) *Transport {
+	t.maxDecompressedSize = size
+	return t
+}
+
+// SetMaxHTTP3FrameSize set the maximum payload size of the received http3
+// DATA, HEADERS and unknown frames, the connection is closed with an error
+// if a larger frame is received. Zero means to use the default limit (16 MB).
+func (t *Transport) SetMaxHTTP3FrameSize(size uint64) *Transport {
+	t.maxHTTP3FrameSize = size
+	if t.t3 != nil {
+		t.t3.MaxFrameSize = size
+	}
+	return t
+}
+
+// SetHTTP3UnknownFrameHandler set the handler which is called with the type
+// and the payload of the received http3 frames of unknown types, such as
+// extension frames. The payload is skipped after fn returns unless it
+// returns processed, in which case fn must consume the whole payload.
+func (t *Transport) SetHTTP3UnknownFrameHandler(fn func(frameType http3.FrameType, payload io.Reader) (processed bool, err error)) *Transport {
+	t.http3UnknownFrameHandler = fn
+	if t.t3 != nil {
+		t.t3.UnknownFrameHandler = fn
+	}
+	return t
+}
+
+// SetHTTP3DatagramHandler set the handler which is called with the received
+// http3 datagrams (RFC 9297) and the ID of the stream they are associated
+// with. Datagrams must be enabled with SetHTTP3Settings.
+func (t *Transport) SetHTTP3DatagramHandler(fn func(stream quic.StreamID, payload []byte)) *Transport {
+	t.http3DatagramHandler = fn
+	if t.t3 != nil {
+		t.t3.DatagramHandler = fn
+	}
+	return t
+}
+
+// SendHTTP3Datagram sends a http3 datagram (RFC 9297) associated with the
+// active request stream. It returns http3.ErrDatagramNotEnabled if datagrams
+// are not enabled with SetHTTP3Settings, or http3.ErrDatagramNotSupported if
+// the server did not advertise datagram support in its settings.
+func (t *Transport) SendHTTP3Datagram(stream quic.StreamID, payload []byte) error {
+	if t.t3 == nil {
+		return errors.New("http3 is not enabled")
+	}
+	return t.t3.SendDatagram(stream, payload)
+}
+
+func (t *Transport) applyHTTP3Settings() {
+	if t.t3 == nil {
+		return
+	}
+	s := t.http3Settings
+	if s == nil {
+		s = &http3.Settings{}
+	}
+	t.t3.EnableDatagrams = s.Datagram
+	t.t3.EnableExtendedConnect = s.ExtendedConnect
+	t.t3.EnableGREASE = s.GREASE
+	t.t3.AdditionalSettings = s.Other
+}
+
+// DecompressedSizeError is returned when reading the decompressed response
+// body which exceeds the limit set by SetMaxDecompressedSize.
+type DecompressedSizeError struct {
+	// Limit is the maximum size of the decompressed response body.
+	Limit int64
+}
+
+func (e *DecompressedSizeError) Error() string {
+	return fmt.Sprintf("decompressed response body exceeds the limit of %d bytes", e.Limit)
+}
+
+// decompressedSizeLimitReader returns a *DecompressedSizeError once more
+// than limit bytes are read from the decompressed body.
+type decompressedSizeLimitReader struct {
+	io.ReadCloser
+	remaining int64
+	limit     int64
+}
+
+func (r *decompressedSizeLimitReader) Read(p []byte) (int, error) {
+	if r.remaining < 0 {
+		return 0, &DecompressedSizeError{Limit: r.limit}
+	}
+	// read one more byte to detect whether the limit is exceeded.
+	if int64(len(p)) > r.remaining+1 {
+		p = p[:r.remaining+1]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.remaining -= int64(n)
+	if r.remaining < 0 {
+		return n + int(r.remaining), &DecompressedSizeError{Limit: r.limit}
+	}
+	return n, err
 }
 
 type wrapResponseBodyKeyType int
 
 const wrapResponseBodyKey wrapResponseBodyKeyType = iota
 
+type forceHttpVersionKeyType int
+
+// forceHttpVersionKey is the context key of the http version forced for a
+// single request, which overrides the forced http version of the transport.
+const forceHttpVersionKey forceHttpVersionKeyType = iota
+
+// forcedHttpVersion returns the http version forced by the request of ctx, or
+// the one forced by the transport if the request does not force any.
+func (t *Transport) forcedHttpVersion(ctx context.Context) httpVersion {
+	if v, ok := ctx.Value(forceHttpVersionKey).(httpVersion); ok {
+		return v
+	}
+	return t.forceHttpVersion
+}
+
+type rawHeaderBlockKeyType int
+
+// rawHeaderBlockKey is the context key of the raw header block set by
+// Request.SetRawHeaderBlock, which replaces the http1 header lines.
+const rawHeaderBlockKey rawHeaderBlockKeyType = iota
+
 type wrapResponseBodyFunc func(rc io.ReadCloser) io.ReadCloser
 
 func (t *Transport) handleResponseBody(res *http.Response, req *http.Request) {
+	if _, ok := res.Body.(io.Writer); ok {
+		// the body of the upgraded connection is written to as well.
+		return
+	}
 	if wrap, ok := req.Context().Value(wrapResponseBodyKey).(wrapResponseBodyFunc); ok {
 		t.wrapResponseBody(res, wrap)
 	}
+	if res.Uncompressed && t.maxDecompressedSize > 0 {
+		res.Body = &decompressedSizeLimitReader{ReadCloser: res.Body, remaining: t.maxDecompressedSize, limit: t.maxDecompressedSize}
+	}
 	t.autoDecodeResponseBody(res)
 	dump.WrapResponseBodyIfNeeded(res, req, t.Dump)
 }
@@ -740,13 +1037,21 @@ func (t *Transport) readBufferSize() int {
 // Clone returns a deep copy of t's exported fields.
 func (t *Transport) Clone() *Transport {
 	tt := &Transport{
-		Headers:               t.Headers.Clone(),
-		Cookies:               cloneSlice(t.Cookies),
-		Options:               t.Options.Clone(),
-		disableAutoDecode:     t.disableAutoDecode,
-		autoDecodeContentType: t.autoDecodeContentType,
-		forceHttpVersion:      t.forceHttpVersion,
-		httpRoundTripWrappers: t.httpRoundTripWrappers,
+		Headers:                  t.Headers.Clone(),
+		Cookies:                  cloneSlice(t.Cookies),
+		Options:                  t.Options.Clone(),
+		disableAutoDecode:        t.disableAutoDecode,
+		autoDecodeContentType:    t.autoDecodeContentType,
+		forceHttpVersion:         t.forceHttpVersion,
+		httpRoundTripWrappers:    t.httpRoundTripWrappers,
+		headerOrder:              cloneSlice(t.headerOrder),
+		pseudoHeaderOrder:        cloneSlice(t.pseudoHeaderOrder),
+		http3Settings:            t.http3Settings.Clone(),
+		maxHTTP3FrameSize:        t.maxHTTP3FrameSize,
+		http2SettingsJitterSeed:  t.http2SettingsJitterSeed,
+		http3UnknownFrameHandler: t.http3UnknownFrameHandler,
+		http3DatagramHandler:     t.http3DatagramHandler,
+		maxDecompressedSize:      t.maxDecompressedSize,
 	}
 	if len(tt.httpRoundTripWrappers) > 0 { // clone transport middleware
 		fn := func(req *http.Request) (*http.Response, error) {
@@ -764,11 +1069,16 @@ func (t *Transport) Clone() *Transport {
 			StrictMaxConcurrentStreams: t.t2.StrictMaxConcurrentStreams,
 			ReadIdleTimeout:            t.t2.ReadIdleTimeout,
 			PingTimeout:                t.t2.PingTimeout,
+			PingPayload:                t.t2.PingPayload,
 			WriteByteTimeout:           t.t2.WriteByteTimeout,
 			ConnectionFlow:             t.t2.ConnectionFlow,
 			Settings:                   cloneSlice(t.t2.Settings),
 			HeaderPriority:             t.t2.HeaderPriority,
 			PriorityFrames:             cloneSlice(t.t2.PriorityFrames),
+			JitterSettings:             t.t2.JitterSettings,
+			PriorityUpdate:             t.t2.PriorityUpdate,
+			DisableCookieSplit:         t.t2.DisableCookieSplit,
+			MaxHeaderFrameSize:         t.t2.MaxHeaderFrameSize,
 		}
 	}
 	if t.t3 != nil {
@@ -904,9 +1214,19 @@ func (t *Transport) roundTrip(req *http.Request) (resp *http.Response, err error
 		return nil, errors.New("http: nil Request.URL")
 	}
 
-	resp, err = t.checkAltSvc(req)
-	if err != nil || resp != nil {
-		return
+	forceHttpVersion, forcedByRequest := ctx.Value(forceHttpVersionKey).(httpVersion)
+	if isExtendedConnectRequest(req) {
+		if !forcedByRequest {
+			forceHttpVersion = t.forceHttpVersion
+		}
+		return t.roundTripExtendedConnect(req, forceHttpVersion)
+	}
+	if !forcedByRequest {
+		forceHttpVersion = t.forceHttpVersion
+		resp, err = t.checkAltSvc(req)
+		if err != nil || resp != nil {
+			return
+		}
 	}
 
 	scheme := req.URL.Scheme
@@ -930,19 +1250,56 @@ func (t *Transport) roundTrip(req *http.Request) (resp *http.Response, err error
 		req.Header = make(http.Header)
 	}
 
-	if t.forceHttpVersion != "" {
-		switch t.forceHttpVersion {
-		case h3:
-			return t.t3.RoundTrip(req)
-		case h2:
+	isWebSocket := ctx.Value(webSocketKey) != nil && requestRequiresHTTP1(req)
+	if isWebSocket && forceHttpVersion != "" && forceHttpVersion != h1 {
+		return t.roundTripExtendedConnect(webSocketConnectRequest(req), forceHttpVersion)
+	}
+	if forceHttpVersion == h3 {
+		if t.t3 == nil {
+			closeBody(req)
+			return nil, errors.New("http3 is not enabled")
+		}
+		return t.t3.RoundTrip(req)
+	}
+
+	// resolve the proxy once, so the cached http2 connections are looked up
+	// with the proxy which the new connection is dialed through.
+	if _, ok := transport.ProxyFrom(ctx); !ok && isHTTP && t.Proxy != nil {
+		proxyURL, err := t.Proxy(req)
+		if err != nil {
+			closeBody(req)
+			return nil, err
+		}
+		ctx = transport.WithProxy(ctx, proxyURL)
+		req = req.WithContext(ctx)
+	}
+
+	if forceHttpVersion == h2 {
+		proxyURL, _ := transport.ProxyFrom(ctx)
+		if proxyURL == nil {
 			return t.t2.RoundTrip(req)
 		}
+		if scheme != "https" {
+			closeBody(req)
+			return nil, errors.New("http2 over a proxy requires https")
+		}
+		// the http2 Transport dials directly, so the connection is dialed
+		// through the proxy below, which only negotiates http2 as it's forced.
 	}
 
 	origReq := req
 	req = setupRewindBody(req)
 
-	if scheme == "https" && t.forceHttpVersion != h1 {
+	if scheme == "https" && forceHttpVersion != h1 && isWebSocket {
+		// like browsers, the websocket is bootstrapped with the extended
+		// CONNECT only if there is a http2 connection to the server already.
+		resp, err := sendExtendedConnect(HttpRoundTripFunc(t.t2.RoundTripOnlyCachedConn), webSocketConnectRequest(req))
+		if err != h2internal.ErrNoCachedConn && !errors.Is(err, http2.ErrExtendedConnectNotSupported) {
+			return resp, err
+		}
+	}
+
+	if scheme == "https" && forceHttpVersion != h1 && !requestRequiresHTTP1(req) {
 		resp, err := t.t2.RoundTripOnlyCachedConn(req)
 		if err != h2internal.ErrNoCachedConn {
 			return resp, err
@@ -953,7 +1310,7 @@ func (t *Transport) roundTrip(req *http.Request) (resp *http.Response, err error
 		}
 		if t.t3 != nil {
 			resp, err = t.t3.RoundTripOnlyCachedConn(req)
-			if err != http3.ErrNoCachedConn {
+			if err != h3internal.ErrNoCachedConn {
 				return resp, err
 			}
 			req, err = rewindBody(req)
@@ -1269,10 +1626,13 @@ func resetProxyConfig() {
 func (t *Transport) connectMethodForRequest(treq *transportRequest) (cm connectMethod, err error) {
 	cm.targetScheme = treq.URL.Scheme
 	cm.targetAddr = canonicalAddr(treq.URL)
-	if t.Proxy != nil {
+	if u, ok := transport.ProxyFrom(treq.Context()); ok {
+		cm.proxyURL = u
+	} else if t.Proxy != nil {
 		cm.proxyURL, err = t.Proxy(treq.Request)
 	}
-	cm.onlyH1 = t.forceHttpVersion == h1 || requestRequiresHTTP1(treq.Request)
+	cm.onlyH1 = t.forcedHttpVersion(treq.Context()) == h1 || requestRequiresHTTP1(treq.Request)
+	cm.fingerprint = t.TLSFingerprintKey
 	return cm, err
 }
 
@@ -1972,13 +2332,13 @@ func (pc *persistConn) addTLS(ctx context.Context, name string, trace *httptrace
 	if pc.cacheKey.onlyH1 {
 		cfg.NextProtos = nil
 	}
-	plainConn := pc.conn
+	plainConn := pc.t.wrapClientHelloDump(ctx, pc.conn)
 	tlsConn := tls.Client(plainConn, cfg)
 	errc := make(chan error, 2)
 	var timer *time.Timer // for canceling TLS handshake
-	if d := pc.t.TLSHandshakeTimeout; d != 0 {
+	if d := pc.t.TLSHandshakeTimeoutFor(ctx); d != 0 {
 		timer = time.AfterFunc(d, func() {
-			errc <- tlsHandshakeTimeoutError{}
+			errc <- ErrTLSHandshakeTimeout
 		})
 	}
 	go func() {
@@ -1993,7 +2353,7 @@ func (pc *persistConn) addTLS(ctx context.Context, name string, trace *httptrace
 	}()
 	if err := <-errc; err != nil {
 		plainConn.Close()
-		if err == (tlsHandshakeTimeoutError{}) {
+		if err == ErrTLSHandshakeTimeout {
 			// Now that we have closed the connection,
 			// wait for the call to HandshakeContext to return.
 			<-errc
@@ -2009,12 +2369,25 @@ func (pc *persistConn) addTLS(ctx context.Context, name string, trace *httptrace
 	}
 	pc.tlsState = &cs
 	pc.conn = tlsConn
-	if !forProxy && pc.t.forceHttpVersion == h2 && cs.NegotiatedProtocol != h2internal.NextProtoTLS {
+	if !forProxy && pc.t.forcedHttpVersion(ctx) == h2 && cs.NegotiatedProtocol != h2internal.NextProtoTLS {
 		return newHttp2NotSupportedError(cs.NegotiatedProtocol)
 	}
 	return nil
 }
 
+// http2NoDialRoundTripper sends the requests over the cached http2
+// connections only, h2internal.ErrNoCachedConn is returned if none of them
+// can take the request, e.g. the connection is shut down by the server with
+// GOAWAY, then the request is retried by Transport on a new connection, which
+// is dialed through the proxy and with the tls fingerprint like the others.
+type http2NoDialRoundTripper struct {
+	t2 *h2internal.Transport
+}
+
+func (rt http2NoDialRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return rt.t2.RoundTripOnlyCachedConn(req)
+}
+
 func newHttp2NotSupportedError(negotiatedProtocol string) error {
 	errMsg := "server does not support http2"
 	if negotiatedProtocol != "" {
@@ -2024,18 +2397,21 @@ func newHttp2NotSupportedError(negotiatedProtocol string) error {
 }
 
 func (t *Transport) customTlsHandshake(ctx context.Context, trace *httptrace.ClientTrace, addr string, pconn *persistConn) error {
+	if pconn.cacheKey.onlyH1 {
+		ctx = transport.WithHTTP1Only(ctx)
+	}
 	errc := make(chan error, 2)
 	var timer *time.Timer // for canceling TLS handshake
-	if d := t.TLSHandshakeTimeout; d != 0 {
+	if d := t.TLSHandshakeTimeoutFor(ctx); d != 0 {
 		timer = time.AfterFunc(d, func() {
-			errc <- tlsHandshakeTimeoutError{}
+			errc <- ErrTLSHandshakeTimeout
 		})
 	}
 	go func() {
 		if trace != nil && trace.TLSHandshakeStart != nil {
 			trace.TLSHandshakeStart()
 		}
-		conn, tlsState, err := t.TLSHandshakeContext(ctx, addr, pconn.conn)
+		conn, tlsState, err := t.TLSHandshakeContext(ctx, addr, t.wrapClientHelloDump(ctx, pconn.conn))
 		if err != nil {
 			if timer != nil {
 				timer.Stop()
@@ -2103,7 +2479,7 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (pconn *pers
 				trace.TLSHandshakeDone(cs, nil)
 			}
 			pconn.tlsState = &cs
-			if cm.proxyURL == nil && pconn.t.forceHttpVersion == h2 && cs.NegotiatedProtocol != h2internal.NextProtoTLS {
+			if cm.proxyURL == nil && t.forcedHttpVersion(ctx) == h2 && cs.NegotiatedProtocol != h2internal.NextProtoTLS {
 				return nil, newHttp2NotSupportedError(cs.NegotiatedProtocol)
 			}
 		}
@@ -2205,7 +2581,7 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (pconn *pers
 		// Write the CONNECT request & read the response.
 		go func() {
 			defer close(didReadResponse)
-			err = connectReq.Write(conn)
+			err = writeProxyConnectRequest(conn, connectReq)
 			if err != nil {
 				return
 			}
@@ -2236,12 +2612,13 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (pconn *pers
 		}
 
 		if resp.StatusCode != 200 {
-			_, text, ok := util.CutString(resp.Status, " ")
 			conn.Close()
-			if !ok {
-				return nil, errors.New("unknown status code")
+			return nil, &ProxyConnectError{
+				Proxy:      cm.proxyURL.Redacted(),
+				Target:     cm.targetAddr,
+				StatusCode: resp.StatusCode,
+				Status:     resp.Status,
 			}
-			return nil, errors.New(text)
 		}
 	}
 
@@ -2258,15 +2635,15 @@ func (t *Transport) dialConn(ctx context.Context, cm connectMethod) (pconn *pers
 		}
 	}
 
-	if s := pconn.tlsState; t.forceHttpVersion != h1 && s != nil && s.NegotiatedProtocolIsMutual && s.NegotiatedProtocol != "" {
+	if s := pconn.tlsState; t.forceHttpVersion != h1 && !cm.onlyH1 && s != nil && s.NegotiatedProtocolIsMutual && s.NegotiatedProtocol != "" {
 		if s.NegotiatedProtocol == h2internal.NextProtoTLS {
-			if used, err := t.t2.AddConn(pconn.conn, cm.targetAddr); err != nil {
+			if used, err := t.t2.AddConn(pconn.conn, transport.ConnPoolKey(ctx, cm.targetAddr)); err != nil {
 				go pconn.conn.Close()
 				return nil, err
 			} else if !used {
 				go pconn.conn.Close()
 			}
-			return &persistConn{t: t, cacheKey: pconn.cacheKey, alt: t.t2}, nil
+			return &persistConn{t: t, cacheKey: pconn.cacheKey, alt: http2NoDialRoundTripper{t.t2}}, nil
 		}
 	}
 
@@ -2330,6 +2707,9 @@ type connectMethod struct {
 	// be reused for different targetAddr values.
 	targetAddr string
 	onlyH1     bool // whether to disable HTTP/2 and force HTTP/1
+	// fingerprint is the key of the tls fingerprint, the connections of
+	// different fingerprints are not shared.
+	fingerprint string
 }
 
 func (cm *connectMethod) key() connectMethodKey {
@@ -2342,10 +2722,11 @@ func (cm *connectMethod) key() connectMethodKey {
 		}
 	}
 	return connectMethodKey{
-		proxy:  proxyStr,
-		scheme: cm.targetScheme,
-		addr:   targetAddr,
-		onlyH1: cm.onlyH1,
+		proxy:       proxyStr,
+		scheme:      cm.targetScheme,
+		addr:        targetAddr,
+		onlyH1:      cm.onlyH1,
+		fingerprint: cm.fingerprint,
 	}
 }
 
@@ -2381,6 +2762,7 @@ func (cm *connectMethod) tlsHost() string {
 type connectMethodKey struct {
 	proxy, scheme, addr string
 	onlyH1              bool
+	fingerprint         string
 }
 
 func (k connectMethodKey) String() string {
@@ -2490,6 +2872,11 @@ func (pc *persistConn) _readResponse(req *http.Request) (*http.Response, error)
 	}
 
 	// Parse the response headers.
+	hook := transport.ResponseHeaderOrderHook(req.Context())
+	var keyOrder []string
+	if hook != nil {
+		tp.keyOrder = &keyOrder
+	}
 	mimeHeader, err := tp.ReadMIMEHeader()
 	if err != nil {
 		if err == io.EOF {
@@ -2498,6 +2885,9 @@ func (pc *persistConn) _readResponse(req *http.Request) (*http.Response, error)
 		return nil, err
 	}
 	resp.Header = http.Header(mimeHeader)
+	if hook != nil {
+		hook(keyOrder)
+	}
 
 	fixPragmaCacheControl(resp.Header)
 
@@ -2785,13 +3175,12 @@ func (pc *persistConn) readLoop() {
 			resp.ContentLength = -1
 			resp.Uncompressed = true
 		} else if pc.t.AutoDecompression {
-			contentEncoding := resp.Header.Get("Content-Encoding")
-			if contentEncoding != "" {
+			if body := compress.NewCompressReader(resp.Body, resp.Header.Get("Content-Encoding")); body != nil {
 				resp.Header.Del("Content-Encoding")
 				resp.Header.Del("Content-Length")
 				resp.ContentLength = -1
 				resp.Uncompressed = true
-				resp.Body = compress.NewCompressReader(resp.Body, contentEncoding)
+				resp.Body = body
 			}
 		}
 
@@ -3141,86 +3530,112 @@ func (pc *persistConn) writeRequest(r *http.Request, w io.Writer, usingProxy boo
 		return err
 	}
 
-	_writeHeader := func(key string, values ...string) error {
-		for _, value := range values {
-			_, err := fmt.Fprintf(w, "%s: %s\r\n", key, value)
-			if err != nil {
-				return err
-			}
-		}
-		if trace != nil && trace.WroteHeaderField != nil {
-			trace.WroteHeaderField(key, values)
-		}
-		return nil
+	// Process Body,ContentLength,Close,Trailer
+	tw, err := newTransferWriter(r)
+	if err != nil {
+		return err
 	}
 
-	var writeHeader func(key string, values ...string) error
-	var kvs []header.KeyValues
-	sort := false
-
-	if r.Header != nil && len(r.Header[header.HeaderOderKey]) > 0 {
-		writeHeader = func(key string, values ...string) error {
-			kvs = append(kvs, header.KeyValues{
-				Key:    key,
-				Values: values,
-			})
-			return nil
+	// The raw header block set by Request.SetRawHeaderBlock is written as is,
+	// which ends with the blank line already.
+	if raw, ok := r.Context().Value(rawHeaderBlockKey).([]byte); ok {
+		_, err = w.Write(raw)
+		if err != nil {
+			return err
 		}
-		sort = true
 	} else {
-		writeHeader = _writeHeader
-	}
-	// Header lines
-	err = writeHeader("Host", host)
-	if err != nil {
-		return err
-	}
+		casing := header.CasingMap(r.Header[header.HeaderCasingKey])
+		_writeHeader := func(key string, values ...string) error {
+			if name, ok := casing[strings.ToLower(key)]; ok {
+				key = name
+			}
+			for _, value := range values {
+				_, err := fmt.Fprintf(w, "%s: %s\r\n", key, value)
+				if err != nil {
+					return err
+				}
+			}
+			if trace != nil && trace.WroteHeaderField != nil {
+				trace.WroteHeaderField(key, values)
+			}
+			return nil
+		}
 
-	// Use the defaultUserAgent unless the Header contains one, which
-	// may be blank to not send the header.
-	userAgent := header.DefaultUserAgent
-	if headerHas(r.Header, "User-Agent") {
-		userAgent = r.Header.Get("User-Agent")
-	}
-	if userAgent != "" {
-		err = writeHeader("User-Agent", userAgent)
+		var writeHeader func(key string, values ...string) error
+		var kvs []header.KeyValues
+		sort := false
+
+		if r.Header != nil && len(r.Header[header.HeaderOderKey]) > 0 {
+			writeHeader = func(key string, values ...string) error {
+				kvs = append(kvs, header.KeyValues{
+					Key:    key,
+					Values: values,
+				})
+				return nil
+			}
+			sort = true
+		} else {
+			writeHeader = _writeHeader
+		}
+		// Header lines, the Host header is sent first like the browsers unless
+		// it's in the header order.
+		if sort && slices.ContainsFunc(r.Header[header.HeaderOderKey], func(key string) bool {
+			return ascii.EqualFold(key, "host")
+		}) {
+			err = writeHeader("Host", host)
+		} else {
+			err = _writeHeader("Host", host)
+		}
 		if err != nil {
 			return err
 		}
-	}
 
-	// Process Body,ContentLength,Close,Trailer
-	tw, err := newTransferWriter(r)
-	if err != nil {
-		return err
-	}
-	err = tw.writeHeader(writeHeader)
-	if err != nil {
-		return err
-	}
+		// Use the defaultUserAgent unless the Header contains one, which
+		// may be blank to not send the header.
+		userAgent := header.DefaultUserAgent
+		if headerHas(r.Header, "User-Agent") {
+			userAgent = r.Header.Get("User-Agent")
+		}
+		if userAgent != "" {
+			err = writeHeader("User-Agent", userAgent)
+			if err != nil {
+				return err
+			}
+		}
 
-	err = headerWriteSubset(r.Header, reqWriteExcludeHeader, writeHeader, sort)
-	if err != nil {
-		return err
-	}
+		// Process Body,ContentLength,Close,Trailer
+		err = tw.writeHeader(writeHeader)
+		if err != nil {
+			return err
+		}
 
-	if extraHeaders != nil {
-		err = headerWrite(extraHeaders, writeHeader, sort)
+		exclude := reqWriteExcludeHeader
+		if isOnlyHTTP2TE(r.Header) {
+			exclude = reqWriteExcludeHeaderTE
+		}
+		err = headerWriteSubset(r.Header, exclude, writeHeader, sort)
 		if err != nil {
 			return err
 		}
-	}
 
-	if sort { // sort and write headers
-		header.SortKeyValues(kvs, r.Header[header.HeaderOderKey])
-		for _, kv := range kvs {
-			_writeHeader(kv.Key, kv.Values...)
+		if extraHeaders != nil {
+			err = headerWrite(extraHeaders, writeHeader, sort)
+			if err != nil {
+				return err
+			}
 		}
-	}
 
-	_, err = io.WriteString(w, "\r\n")
-	if err != nil {
-		return err
+		if sort { // sort and write headers
+			header.SortKeyValues(kvs, r.Header[header.HeaderOderKey])
+			for _, kv := range kvs {
+				_writeHeader(kv.Key, kv.Values...)
+			}
+		}
+
+		_, err = io.WriteString(w, "\r\n")
+		if err != nil {
+			return err
+		}
 	}
 
 	if trace != nil && trace.WroteHeaders != nil {
@@ -3696,11 +4111,88 @@ func (gz *gzipReader) Close() error {
 	return gz.body.Close()
 }
 
-type tlsHandshakeTimeoutError struct{}
+// ErrProxyAuthRequired is matched with errors.Is by the *ProxyConnectError if
+// the proxy responds the CONNECT request with 407 Proxy Authentication Required,
+// e.g. the credentials in the proxy URL are missing or wrong.
+var ErrProxyAuthRequired = errors.New("proxy authentication required")
+
+// ProxyConnectError is returned when the proxy responds the CONNECT request
+// with a status other than 200, the tunnel to the target is not established.
+type ProxyConnectError struct {
+	// Proxy is the URL of the proxy with the password redacted.
+	Proxy string
+	// Target is the address (host:port) of the CONNECT request.
+	Target string
+	// StatusCode is the status code of the CONNECT response, e.g. 407.
+	StatusCode int
+	// Status is the status of the CONNECT response, e.g.
+	// "407 Proxy Authentication Required".
+	Status string
+}
+
+func (e *ProxyConnectError) Error() string {
+	return fmt.Sprintf("proxy %s failed to connect to %s: %s", e.Proxy, e.Target, e.Status)
+}
+
+// Is reports whether the error matches ErrProxyAuthRequired.
+func (e *ProxyConnectError) Is(target error) bool {
+	return target == ErrProxyAuthRequired && e.StatusCode == http.StatusProxyAuthRequired
+}
+
+// writeProxyConnectRequest writes the CONNECT request to the proxy, unlike
+// http.Request.Write, the header names are written as is in the order of
+// HeaderOderKey, and no User-Agent is added.
+func writeProxyConnectRequest(w io.Writer, req *http.Request) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "CONNECT %s HTTP/1.1\r\n", req.Host)
+	order := req.Header[header.HeaderOderKey]
+	kvs := []header.KeyValues{{Key: "Host", Values: []string{req.Host}}}
+	for key, values := range req.Header {
+		switch key {
+		case header.HeaderOderKey, header.PseudoHeaderOderKey, header.HeaderCasingKey:
+			continue
+		}
+		if ascii.EqualFold(key, "Host") {
+			continue
+		}
+		if !httpguts.ValidHeaderFieldName(key) {
+			return fmt.Errorf("net/http: invalid proxy connect header name %q", key)
+		}
+		for _, v := range values {
+			if !httpguts.ValidHeaderFieldValue(v) {
+				return fmt.Errorf("net/http: invalid proxy connect header value for %q", key)
+			}
+		}
+		kvs = append(kvs, header.KeyValues{Key: key, Values: values})
+	}
+	// sort by name first so the keys which are not ordered are written in a
+	// stable order rather than the random order of the map.
+	slices.SortFunc(kvs[1:], func(a, b header.KeyValues) int { return strings.Compare(a.Key, b.Key) })
+	// the Host header is sent first unless it's ordered.
+	if slices.ContainsFunc(order, func(key string) bool { return ascii.EqualFold(key, "Host") }) {
+		header.SortKeyValues(kvs, order)
+	} else {
+		header.SortKeyValues(kvs[1:], order)
+	}
+	casing := header.CasingMap(req.Header[header.HeaderCasingKey])
+	for _, kv := range kvs {
+		key := kv.Key
+		if name, ok := casing[strings.ToLower(key)]; ok {
+			key = name
+		}
+		for _, v := range kv.Values {
+			fmt.Fprintf(bw, "%s: %s\r\n", key, textproto.TrimString(v))
+		}
+	}
+	bw.WriteString("\r\n")
+	return bw.Flush()
+}
 
-func (tlsHandshakeTimeoutError) Timeout() bool   { return true }
-func (tlsHandshakeTimeoutError) Temporary() bool { return true }
-func (tlsHandshakeTimeoutError) Error() string   { return "net/http: TLS handshake timeout" }
+// ErrTLSHandshakeTimeout is returned when the tls handshake times out, see
+// Client.SetTLSHandshakeTimeout and Request.SetTLSHandshakeTimeout. It can be
+// matched with errors.Is to tell it from the timeout of the overall request,
+// and it's a net.Error whose Timeout returns true.
+var ErrTLSHandshakeTimeout error = transport.TLSHandshakeTimeoutError{}
 
 // fakeLocker is a sync.Locker which does nothing. It's used to guard
 // test-only fields when not under test, to avoid runtime atomic
@@ -0,0 +1,487 @@
+package req
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	urlpkg "net/url"
+	"strings"
+	"sync"
+
+	"github.com/imroc/req/v3/internal/header"
+)
+
+// WebSocketMessageType is the type of a websocket message, see RFC 6455.
+type WebSocketMessageType int
+
+const (
+	WebSocketTextMessage   WebSocketMessageType = 1
+	WebSocketBinaryMessage WebSocketMessageType = 2
+	WebSocketCloseMessage  WebSocketMessageType = 8
+	WebSocketPingMessage   WebSocketMessageType = 9
+	WebSocketPongMessage   WebSocketMessageType = 10
+
+	webSocketContinuation WebSocketMessageType = 0
+)
+
+// WebSocketCloseError is returned by ReadMessage when the close message is
+// received from the server.
+type WebSocketCloseError struct {
+	// Code is the status code of the close message, it's 1005 if the close
+	// message has no status code.
+	Code int
+	// Text is the reason of the close message.
+	Text string
+}
+
+func (e *WebSocketCloseError) Error() string {
+	return fmt.Sprintf("websocket: close %d %s", e.Code, e.Text)
+}
+
+var errWebSocketCloseSent = errors.New("websocket: close sent")
+
+// webSocketKey is the context key which marks the handshake of DialWebSocket.
+type webSocketKeyType int
+
+const webSocketKey webSocketKeyType = iota
+
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// webSocketHandshake is the headers of the websocket handshake sent by a
+// browser, besides the common headers of the client.
+type webSocketHandshake struct {
+	headers [][2]string
+	order   []string
+}
+
+var chromeWebSocketHandshake = webSocketHandshake{
+	headers: [][2]string{
+		{"Connection", "Upgrade"},
+		{"Pragma", "no-cache"},
+		{"Cache-Control", "no-cache"},
+		{"Upgrade", "websocket"},
+		{"Sec-WebSocket-Version", "13"},
+		{"Sec-WebSocket-Extensions", "permessage-deflate; client_max_window_bits"},
+	},
+	order: []string{
+		"host",
+		"connection",
+		"pragma",
+		"cache-control",
+		"user-agent",
+		"upgrade",
+		"origin",
+		"sec-websocket-version",
+		"accept-encoding",
+		"accept-language",
+		"cookie",
+		"sec-websocket-key",
+		"sec-websocket-extensions",
+	},
+}
+
+var firefoxWebSocketHandshake = webSocketHandshake{
+	headers: [][2]string{
+		{"Accept", "*/*"},
+		{"Sec-WebSocket-Version", "13"},
+		{"Sec-WebSocket-Extensions", "permessage-deflate"},
+		{"Connection", "keep-alive, Upgrade"},
+		{"Sec-Fetch-Dest", "empty"},
+		{"Sec-Fetch-Mode", "websocket"},
+		{"Sec-Fetch-Site", "same-origin"},
+		{"Pragma", "no-cache"},
+		{"Cache-Control", "no-cache"},
+		{"Upgrade", "websocket"},
+	},
+	order: []string{
+		"host",
+		"user-agent",
+		"accept",
+		"accept-language",
+		"accept-encoding",
+		"sec-websocket-version",
+		"origin",
+		"sec-websocket-extensions",
+		"sec-websocket-key",
+		"connection",
+		"cookie",
+		"sec-fetch-dest",
+		"sec-fetch-mode",
+		"sec-fetch-site",
+		"pragma",
+		"cache-control",
+		"upgrade",
+	},
+}
+
+// webSocketHandshakeFor returns the handshake of the browser of the
+// user-agent, which is the one of Chrome unless it's Firefox.
+func webSocketHandshakeFor(ua string) webSocketHandshake {
+	if strings.Contains(ua, "Firefox/") {
+		return firefoxWebSocketHandshake
+	}
+	return chromeWebSocketHandshake
+}
+
+// isWebSocketSkippedHeader reports whether the common header is one of the
+// navigation headers which are not sent with the websocket handshake.
+func isWebSocketSkippedHeader(key string) bool {
+	key = strings.ToLower(key)
+	switch key {
+	case "accept", "priority", "te", "upgrade-insecure-requests":
+		return true
+	}
+	return strings.HasPrefix(key, "sec-fetch-") || strings.HasPrefix(key, "sec-ch-ua")
+}
+
+// webSocketUpgradeHeaders is the headers of the HTTP/1.1 upgrade, which are
+// not sent with the extended CONNECT.
+var webSocketUpgradeHeaders = map[string]bool{
+	"connection":        true,
+	"upgrade":           true,
+	"sec-websocket-key": true,
+}
+
+// DialWebSocket opens a websocket connection to the url, whose scheme is one
+// of "ws", "wss", "http" and "https". The handshake is sent with the tls
+// fingerprint, the cookies and the common headers of the client, except the
+// navigation headers like accept and sec-fetch-*, and the handshake headers
+// and the header order are the ones of the impersonated browser, which is
+// Firefox if the user-agent is Firefox's, otherwise Chrome.
+//
+// Like browsers, the websocket is bootstrapped with the extended CONNECT
+// (RFC 8441) if there is a http2 connection to the server already and the
+// server enabled SETTINGS_ENABLE_CONNECT_PROTOCOL, otherwise a new connection
+// is dialed with the HTTP/1.1 upgrade, which offers http/1.1 only in the ALPN.
+// Call EnableForceHTTP2 or EnableForceHTTP3 to always use the extended CONNECT
+// over http2 or http3 (RFC 9220).
+//
+// The compressed messages are decompressed if permessage-deflate is
+// negotiated, the messages sent are never compressed. The timeout of the client
+// is not applied, as it would close the connection.
+func (c *Client) DialWebSocket(url string) (*WebSocketConn, error) {
+	u, err := urlpkg.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	case "http", "https":
+	default:
+		return nil, fmt.Errorf("websocket: unsupported scheme %q", u.Scheme)
+	}
+	key, err := newWebSocketKey()
+	if err != nil {
+		return nil, err
+	}
+
+	hs := webSocketHandshakeFor(c.Headers.Get(header.UserAgent))
+	r := c.R().DisableAutoReadResponse()
+	r.isWebSocket = true
+	for _, kv := range hs.headers {
+		r.SetHeaderNonCanonical(kv[0], kv[1])
+	}
+	r.SetHeaderNonCanonical("Sec-WebSocket-Key", key)
+	if c.Headers.Get("Origin") == "" {
+		r.SetHeader("Origin", u.Scheme+"://"+u.Host)
+	}
+	r.SetHeaderOrder(hs.order...)
+	resp, err := r.Send(http.MethodGet, u.String())
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusSwitchingProtocols:
+		if accept := resp.Header.Get("Sec-WebSocket-Accept"); accept != webSocketAccept(key) {
+			resp.Body.Close()
+			return nil, fmt.Errorf("websocket: bad Sec-WebSocket-Accept %q", accept)
+		}
+	case resp.StatusCode == http.StatusOK && resp.ProtoMajor >= 2:
+		// bootstrapped with the extended CONNECT.
+	default:
+		resp.Body.Close()
+		return nil, fmt.Errorf("websocket: bad handshake: %s", resp.Status)
+	}
+	rwc, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		resp.Body.Close()
+		return nil, errors.New("websocket: the response body is not writable")
+	}
+	conn := &WebSocketConn{
+		resp: resp,
+		rwc:  rwc,
+		br:   bufio.NewReader(rwc),
+	}
+	for _, ext := range strings.Split(resp.Header.Get("Sec-WebSocket-Extensions"), ",") {
+		params := strings.Split(ext, ";")
+		if strings.TrimSpace(params[0]) != "permessage-deflate" {
+			continue
+		}
+		conn.compression = true
+		for _, param := range params[1:] {
+			if strings.TrimSpace(param) == "server_no_context_takeover" {
+				conn.serverNoContextTakeover = true
+			}
+		}
+	}
+	return conn, nil
+}
+
+func newWebSocketKey() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b[:]), nil
+}
+
+func webSocketAccept(key string) string {
+	h := sha1.Sum([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// webSocketConnectRequest returns the extended CONNECT request which
+// bootstraps the websocket of the HTTP/1.1 upgrade request.
+func webSocketConnectRequest(req *http.Request) *http.Request {
+	r := req.Clone(req.Context())
+	r.Method = http.MethodConnect
+	r.Proto = "websocket"
+	for k := range r.Header {
+		if webSocketUpgradeHeaders[strings.ToLower(k)] {
+			delete(r.Header, k)
+		}
+	}
+	return r
+}
+
+// WebSocketConn is a websocket connection opened by DialWebSocket.
+// ReadMessage should be called from a single goroutine, and the other methods
+// are safe for concurrent use.
+type WebSocketConn struct {
+	resp *Response
+	rwc  io.ReadWriteCloser
+	br   *bufio.Reader
+
+	wmu       sync.Mutex
+	closeSent bool
+
+	compression             bool // permessage-deflate is negotiated
+	serverNoContextTakeover bool
+	flateReader             io.ReadCloser
+	dict                    []byte // the sliding window of the decompressor
+}
+
+// Response returns the response of the handshake.
+func (c *WebSocketConn) Response() *Response {
+	return c.resp
+}
+
+// ReadMessage reads the next text or binary message, the ping messages are
+// answered automatically, and a *WebSocketCloseError is returned once the
+// close message is received.
+func (c *WebSocketConn) ReadMessage() (WebSocketMessageType, []byte, error) {
+	var (
+		typ        WebSocketMessageType
+		msg        []byte
+		compressed bool
+	)
+	for {
+		f, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch f.opcode {
+		case WebSocketPingMessage:
+			if err := c.writeFrame(WebSocketPongMessage, f.payload); err != nil && err != errWebSocketCloseSent {
+				return 0, nil, err
+			}
+			continue
+		case WebSocketPongMessage:
+			continue
+		case WebSocketCloseMessage:
+			ce := &WebSocketCloseError{Code: 1005}
+			var payload []byte
+			if len(f.payload) >= 2 {
+				ce.Code = int(binary.BigEndian.Uint16(f.payload))
+				ce.Text = string(f.payload[2:])
+				payload = f.payload[:2]
+			}
+			// echo the status code like browsers.
+			c.writeFrame(WebSocketCloseMessage, payload)
+			return 0, nil, ce
+		case webSocketContinuation:
+			if typ == 0 {
+				return 0, nil, errors.New("websocket: unexpected continuation frame")
+			}
+		case WebSocketTextMessage, WebSocketBinaryMessage:
+			if typ != 0 {
+				return 0, nil, errors.New("websocket: expected continuation frame")
+			}
+			typ = f.opcode
+			compressed = f.rsv1
+			if compressed && !c.compression {
+				return 0, nil, errors.New("websocket: unexpected compressed message")
+			}
+		default:
+			return 0, nil, fmt.Errorf("websocket: unknown opcode %d", f.opcode)
+		}
+		msg = append(msg, f.payload...)
+		if f.fin {
+			break
+		}
+	}
+	if compressed {
+		var err error
+		if msg, err = c.decompress(msg); err != nil {
+			return 0, nil, err
+		}
+	}
+	return typ, msg, nil
+}
+
+type webSocketFrame struct {
+	fin     bool
+	rsv1    bool
+	opcode  WebSocketMessageType
+	payload []byte
+}
+
+func (c *WebSocketConn) readFrame() (*webSocketFrame, error) {
+	var h [8]byte
+	if _, err := io.ReadFull(c.br, h[:2]); err != nil {
+		return nil, err
+	}
+	f := &webSocketFrame{
+		fin:    h[0]&0x80 != 0,
+		rsv1:   h[0]&0x40 != 0,
+		opcode: WebSocketMessageType(h[0] & 0x0f),
+	}
+	if h[1]&0x80 != 0 {
+		return nil, errors.New("websocket: the frame of the server is masked")
+	}
+	n := uint64(h[1] & 0x7f)
+	switch n {
+	case 126:
+		if _, err := io.ReadFull(c.br, h[:2]); err != nil {
+			return nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(h[:2]))
+	case 127:
+		if _, err := io.ReadFull(c.br, h[:]); err != nil {
+			return nil, err
+		}
+		n = binary.BigEndian.Uint64(h[:])
+		if n > 1<<63-1 {
+			return nil, errors.New("websocket: invalid frame length")
+		}
+	}
+	if f.opcode >= WebSocketCloseMessage && (n > 125 || !f.fin) {
+		return nil, errors.New("websocket: invalid control frame")
+	}
+	// the buffer grows while reading, rather than trusting the length.
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, c.br, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	f.payload = buf.Bytes()
+	return f, nil
+}
+
+// webSocketDeflateTail is appended to the compressed message, which is the
+// tail removed by the server, and an empty final block to end the stream.
+const webSocketDeflateTail = "\x00\x00\xff\xff\x01\x00\x00\xff\xff"
+
+const webSocketDeflateWindow = 32 << 10
+
+func (c *WebSocketConn) decompress(p []byte) ([]byte, error) {
+	r := io.MultiReader(bytes.NewReader(p), strings.NewReader(webSocketDeflateTail))
+	if c.flateReader == nil {
+		c.flateReader = flate.NewReaderDict(r, c.dict)
+	} else if err := c.flateReader.(flate.Resetter).Reset(r, c.dict); err != nil {
+		return nil, err
+	}
+	b, err := io.ReadAll(c.flateReader)
+	if err != nil {
+		return nil, fmt.Errorf("websocket: failed to decompress message: %w", err)
+	}
+	if !c.serverNoContextTakeover {
+		c.dict = append(c.dict, b...)
+		if len(c.dict) > webSocketDeflateWindow {
+			c.dict = bytes.Clone(c.dict[len(c.dict)-webSocketDeflateWindow:])
+		}
+	}
+	return b, nil
+}
+
+// WriteMessage sends the message in a single masked frame, the payload of the
+// control messages (close, ping and pong) must not be longer than 125 bytes.
+func (c *WebSocketConn) WriteMessage(typ WebSocketMessageType, data []byte) error {
+	switch typ {
+	case WebSocketTextMessage, WebSocketBinaryMessage:
+	case WebSocketCloseMessage, WebSocketPingMessage, WebSocketPongMessage:
+		if len(data) > 125 {
+			return errors.New("websocket: the payload of the control message is too long")
+		}
+	default:
+		return fmt.Errorf("websocket: unknown message type %d", typ)
+	}
+	return c.writeFrame(typ, data)
+}
+
+func (c *WebSocketConn) writeFrame(opcode WebSocketMessageType, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	if c.closeSent {
+		return errWebSocketCloseSent
+	}
+	if opcode == WebSocketCloseMessage {
+		c.closeSent = true
+	}
+
+	b := make([]byte, 0, 14+len(payload))
+	b = append(b, 0x80|byte(opcode))
+	switch n := len(payload); {
+	case n <= 125:
+		b = append(b, 0x80|byte(n))
+	case n <= 0xffff:
+		b = append(b, 0x80|126)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, 0x80|127)
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+	var mask [4]byte
+	if _, err := rand.Read(mask[:]); err != nil {
+		return err
+	}
+	b = append(b, mask[:]...)
+	start := len(b)
+	b = append(b, payload...)
+	for i := range payload {
+		b[start+i] ^= mask[i%4]
+	}
+	_, err := c.rwc.Write(b)
+	return err
+}
+
+// Close sends the close message with the normal closure status code (1000)
+// if it's not sent yet, and closes the connection.
+func (c *WebSocketConn) Close() error {
+	c.writeFrame(WebSocketCloseMessage, []byte{0x03, 0xe8})
+	return c.rwc.Close()
+}
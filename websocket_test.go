@@ -0,0 +1,364 @@
+package req
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/imroc/req/v3/internal/testcert"
+	"github.com/imroc/req/v3/internal/tests"
+	xhttp2 "golang.org/x/net/http2"
+	"golang.org/x/net/http2/hpack"
+)
+
+// webSocketHandshakeInfo is the websocket handshake received by the server.
+type webSocketHandshakeInfo struct {
+	proto   string   // "http/1.1" or "h2"
+	alpn    []string // the ALPN offered by the client
+	names   []string // the header names in order, including the pseudo ones
+	headers map[string]string
+}
+
+// startWebSocketServer starts a tls websocket echo server which supports the
+// HTTP/1.1 upgrade and the extended CONNECT over http2, the handshakes are
+// sent to the returned channel.
+func startWebSocketServer(t *testing.T) (string, chan *webSocketHandshakeInfo) {
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	tests.AssertNoError(t, err)
+	ln := tests.NewLocalListener(t)
+	t.Cleanup(func() { ln.Close() })
+	handshakes := make(chan *webSocketHandshakeInfo, 10)
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		var alpn []string
+		tlsConn := tls.Server(conn, &tls.Config{
+			GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+				alpn = hello.SupportedProtos
+				return nil, nil
+			},
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{"h2", "http/1.1"},
+		})
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+		info := &webSocketHandshakeInfo{alpn: alpn, headers: make(map[string]string)}
+		if tlsConn.ConnectionState().NegotiatedProtocol == "h2" {
+			serveWebSocketH2(tlsConn, info, handshakes)
+			return
+		}
+		info.proto = "http/1.1"
+		br := bufio.NewReader(tlsConn)
+		if _, err := br.ReadString('\n'); err != nil {
+			return
+		}
+		for {
+			line, err := br.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if line == "" {
+				break
+			}
+			name, value, _ := strings.Cut(line, ": ")
+			info.names = append(info.names, name)
+			info.headers[strings.ToLower(name)] = value
+		}
+		handshakes <- info
+		io.WriteString(tlsConn, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n"+
+			"Sec-WebSocket-Accept: "+webSocketAccept(info.headers["sec-websocket-key"])+"\r\n"+
+			"Sec-WebSocket-Extensions: permessage-deflate\r\n\r\n")
+		serveWebSocketEcho(struct {
+			io.Reader
+			io.Writer
+		}{br, tlsConn})
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn)
+		}
+	}()
+	return ln.Addr().String(), handshakes
+}
+
+func serveWebSocketH2(conn net.Conn, info *webSocketHandshakeInfo, handshakes chan *webSocketHandshakeInfo) {
+	info.proto = "h2"
+	preface := make([]byte, len(xhttp2.ClientPreface))
+	if _, err := io.ReadFull(conn, preface); err != nil {
+		return
+	}
+	fr := xhttp2.NewFramer(conn, conn)
+	var mu sync.Mutex // guards the writes of fr
+	fr.WriteSettings(xhttp2.Setting{ID: 0x8, Val: 1})
+	dec := hpack.NewDecoder(4096, nil)
+	var wsStreamID uint32
+	var pw *io.PipeWriter
+	for {
+		f, err := fr.ReadFrame()
+		if err != nil {
+			if pw != nil {
+				pw.CloseWithError(err)
+			}
+			return
+		}
+		switch f := f.(type) {
+		case *xhttp2.SettingsFrame:
+			if !f.IsAck() {
+				mu.Lock()
+				fr.WriteSettingsAck()
+				mu.Unlock()
+			}
+		case *xhttp2.HeadersFrame:
+			fields, err := dec.DecodeFull(f.HeaderBlockFragment())
+			if err != nil {
+				return
+			}
+			var isWebSocket bool
+			for _, field := range fields {
+				if field.Name == ":protocol" && field.Value == "websocket" {
+					isWebSocket = true
+				}
+			}
+			var hbuf bytes.Buffer
+			enc := hpack.NewEncoder(&hbuf)
+			enc.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+			if isWebSocket {
+				enc.WriteField(hpack.HeaderField{Name: "sec-websocket-extensions", Value: "permessage-deflate"})
+			}
+			mu.Lock()
+			fr.WriteHeaders(xhttp2.HeadersFrameParam{StreamID: f.StreamID, BlockFragment: hbuf.Bytes(), EndHeaders: true, EndStream: !isWebSocket})
+			mu.Unlock()
+			if !isWebSocket {
+				continue
+			}
+			wh := &webSocketHandshakeInfo{proto: info.proto, alpn: info.alpn, headers: make(map[string]string)}
+			for _, field := range fields {
+				wh.names = append(wh.names, field.Name)
+				wh.headers[field.Name] = field.Value
+			}
+			handshakes <- wh
+			wsStreamID = f.StreamID
+			var pr *io.PipeReader
+			pr, pw = io.Pipe()
+			id := f.StreamID
+			go serveWebSocketEcho(struct {
+				io.Reader
+				io.Writer
+			}{pr, writerFunc(func(p []byte) (int, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(p), fr.WriteData(id, false, p)
+			})})
+		case *xhttp2.DataFrame:
+			if f.StreamID != wsStreamID {
+				continue
+			}
+			n := len(f.Data())
+			pw.Write(f.Data())
+			if n > 0 {
+				mu.Lock()
+				fr.WriteWindowUpdate(0, uint32(n))
+				fr.WriteWindowUpdate(f.StreamID, uint32(n))
+				mu.Unlock()
+			}
+		}
+	}
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (fn writerFunc) Write(p []byte) (int, error) {
+	return fn(p)
+}
+
+func writeServerWebSocketFrame(w io.Writer, b0 byte, payload []byte) error {
+	b := []byte{b0}
+	switch n := len(payload); {
+	case n <= 125:
+		b = append(b, byte(n))
+	case n <= 0xffff:
+		b = append(b, 126)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, 127)
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+	_, err := w.Write(append(b, payload...))
+	return err
+}
+
+// serveWebSocketEcho sends two compressed messages, which share the sliding
+// window, and a ping, then echoes the messages of the client, the pong is
+// echoed as the text message "pong:<payload>", and the text message "bye" is
+// answered with the close message.
+func serveWebSocketEcho(rw io.ReadWriter) {
+	var buf bytes.Buffer
+	fw, _ := flate.NewWriter(&buf, flate.BestSpeed)
+	for range 2 {
+		buf.Reset()
+		fw.Write([]byte("hello websocket"))
+		fw.Flush()
+		if writeServerWebSocketFrame(rw, 0xc1, buf.Bytes()[:buf.Len()-4]) != nil {
+			return
+		}
+	}
+	if writeServerWebSocketFrame(rw, 0x89, []byte("ping")) != nil {
+		return
+	}
+	for {
+		var h [2]byte
+		if _, err := io.ReadFull(rw, h[:]); err != nil {
+			return
+		}
+		n := uint64(h[1] & 0x7f)
+		switch n {
+		case 126:
+			var b [2]byte
+			io.ReadFull(rw, b[:])
+			n = uint64(binary.BigEndian.Uint16(b[:]))
+		case 127:
+			var b [8]byte
+			io.ReadFull(rw, b[:])
+			n = binary.BigEndian.Uint64(b[:])
+		}
+		var mask [4]byte
+		if h[1]&0x80 == 0 {
+			// the frames of the client must be masked.
+			return
+		}
+		io.ReadFull(rw, mask[:])
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(rw, payload); err != nil {
+			return
+		}
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+		switch {
+		case h[0]&0x0f == 0xa:
+			writeServerWebSocketFrame(rw, 0x81, append([]byte("pong:"), payload...))
+		case h[0]&0x0f == 0x1 && string(payload) == "bye":
+			writeServerWebSocketFrame(rw, 0x88, append([]byte{0x03, 0xe8}, "bye"...))
+		default:
+			writeServerWebSocketFrame(rw, h[0], payload)
+			if h[0]&0x0f == 0x8 {
+				return
+			}
+		}
+	}
+}
+
+func testWebSocketEcho(t *testing.T, conn *WebSocketConn, large bool) {
+	for range 2 {
+		typ, msg, err := conn.ReadMessage()
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, WebSocketTextMessage, typ)
+		tests.AssertEqual(t, "hello websocket", string(msg))
+	}
+	// the ping is answered automatically.
+	_, msg, err := conn.ReadMessage()
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "pong:ping", string(msg))
+
+	payloads := [][]byte{[]byte("hello"), bytes.Repeat([]byte("a"), 1000)}
+	if large {
+		payloads = append(payloads, bytes.Repeat([]byte("b"), 70000))
+	}
+	for _, payload := range payloads {
+		tests.AssertNoError(t, conn.WriteMessage(WebSocketBinaryMessage, payload))
+		typ, msg, err := conn.ReadMessage()
+		tests.AssertNoError(t, err)
+		tests.AssertEqual(t, WebSocketBinaryMessage, typ)
+		tests.AssertEqual(t, true, bytes.Equal(payload, msg))
+	}
+
+	tests.AssertNoError(t, conn.WriteMessage(WebSocketTextMessage, []byte("bye")))
+	_, _, err = conn.ReadMessage()
+	var ce *WebSocketCloseError
+	tests.AssertEqual(t, true, errors.As(err, &ce))
+	tests.AssertEqual(t, 1000, ce.Code)
+	tests.AssertEqual(t, "bye", ce.Text)
+	tests.AssertNoError(t, conn.Close())
+}
+
+func TestDialWebSocket(t *testing.T) {
+	addr, handshakes := startWebSocketServer(t)
+	c := tc().ImpersonateChrome().EnableInsecureSkipVerify()
+	c.SetCommonHeader("Authorization", "Bearer token")
+	conn, err := c.DialWebSocket("wss://" + addr + "/chat")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 101, conn.Response().StatusCode)
+
+	hs := <-handshakes
+	tests.AssertEqual(t, "http/1.1", hs.proto)
+	tests.AssertEqual(t, []string{"http/1.1"}, hs.alpn)
+	tests.AssertEqual(t, "websocket", hs.headers["upgrade"])
+	tests.AssertEqual(t, "https://"+addr, hs.headers["origin"])
+	tests.AssertEqual(t, "Bearer token", hs.headers["authorization"])
+	tests.AssertEqual(t, "permessage-deflate; client_max_window_bits", hs.headers["sec-websocket-extensions"])
+	// the navigation headers are not sent.
+	for _, name := range []string{"accept", "sec-fetch-mode", "sec-ch-ua", "priority"} {
+		_, ok := hs.headers[name]
+		tests.AssertEqual(t, false, ok)
+	}
+	var names []string
+	for _, name := range hs.names {
+		if name != "Authorization" {
+			names = append(names, name)
+		}
+	}
+	tests.AssertEqual(t, []string{
+		"Host", "Connection", "Pragma", "Cache-Control", "User-Agent", "Upgrade", "Origin",
+		"Sec-WebSocket-Version", "Accept-Encoding", "Accept-Language", "Sec-WebSocket-Key", "Sec-WebSocket-Extensions",
+	}, names)
+	testWebSocketEcho(t, conn, true)
+
+	conn, err = tc().ImpersonateFirefox().EnableInsecureSkipVerify().DialWebSocket("wss://" + addr)
+	tests.AssertNoError(t, err)
+	hs = <-handshakes
+	tests.AssertEqual(t, "websocket", hs.headers["sec-fetch-mode"])
+	tests.AssertEqual(t, "keep-alive, Upgrade", hs.headers["connection"])
+	tests.AssertEqual(t, "Sec-WebSocket-Key", hs.names[len(hs.names)-8])
+	tests.AssertEqual(t, "Upgrade", hs.names[len(hs.names)-1])
+	testWebSocketEcho(t, conn, false)
+
+	_, err = tc().DialWebSocket("ftp://" + addr)
+	tests.AssertNotNil(t, err)
+}
+
+func TestDialWebSocketOverExtendedConnect(t *testing.T) {
+	addr, handshakes := startWebSocketServer(t)
+	c := tc().ImpersonateChrome().EnableInsecureSkipVerify()
+	// the websocket is bootstrapped on the existing http2 connection.
+	resp, err := c.R().Get("https://" + addr)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 2, resp.ProtoMajor)
+
+	conn, err := c.DialWebSocket("wss://" + addr + "/chat?a=1")
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, 200, conn.Response().StatusCode)
+	hs := <-handshakes
+	tests.AssertEqual(t, "h2", hs.proto)
+	tests.AssertEqual(t, []string{":method", ":authority", ":scheme", ":path", ":protocol"}, hs.names[:5])
+	tests.AssertEqual(t, "CONNECT", hs.headers[":method"])
+	tests.AssertEqual(t, "/chat?a=1", hs.headers[":path"])
+	for _, name := range []string{"sec-websocket-key", "upgrade", "connection"} {
+		_, ok := hs.headers[name]
+		tests.AssertEqual(t, false, ok)
+	}
+	tests.AssertEqual(t, "13", hs.headers["sec-websocket-version"])
+	testWebSocketEcho(t, conn, false)
+}
@@ -0,0 +1,408 @@
+package req
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	urlpkg "net/url"
+	"sync"
+	"time"
+
+	"github.com/imroc/req/v3/http3"
+	h3internal "github.com/imroc/req/v3/internal/http3"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+// The stream and capsule types of WebTransport over HTTP/3, see
+// draft-ietf-webtrans-http3.
+const (
+	webTransportFrameType       = 0x41
+	webTransportUniStreamType   = 0x54
+	closeWebTransportSessionCap = 0x2843
+
+	// webTransportStreamQueueLen is the number of the incoming streams and
+	// datagrams which are buffered until they are received, the streams
+	// exceeding it are rejected and the datagrams are dropped.
+	webTransportStreamQueueLen = 32
+)
+
+// webTransportKey is the context key of the dedicated http3 transport of the
+// session dialed by DialWebTransport.
+type webTransportKeyType int
+
+const webTransportKey webTransportKeyType = iota
+
+var errWebTransportSessionClosed = errors.New("webtransport: session closed")
+
+// WebTransportCloseError is the error of the session once the server closed
+// it with the CLOSE_WEBTRANSPORT_SESSION capsule.
+type WebTransportCloseError struct {
+	Code    uint32
+	Message string
+}
+
+func (e *WebTransportCloseError) Error() string {
+	return fmt.Sprintf("webtransport: session closed by the server: %d %s", e.Code, e.Message)
+}
+
+// WebTransportSession is a WebTransport session over HTTP/3, which is dialed
+// by DialWebTransport.
+type WebTransportSession struct {
+	resp *Response
+	t3   *h3internal.Transport
+	conn *h3internal.Conn
+	str  io.ReadWriteCloser // the CONNECT stream
+	id   quic.StreamID
+
+	// ready is closed once the session is established or failed, the
+	// incoming streams are held until then.
+	ready chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	streams    chan *quic.Stream
+	uniStreams chan *quic.ReceiveStream
+	datagrams  chan []byte
+
+	closeOnce sync.Once
+}
+
+// DialWebTransport establishes a WebTransport session with the https url. The
+// session is negotiated with the extended CONNECT whose :protocol is
+// "webtransport", on a dedicated http3 connection like browsers, which is
+// dialed with the tls fingerprint and the http3 settings of the client, the
+// settings of HTTP datagrams and SETTINGS_ENABLE_WEBTRANSPORT are added if
+// they are not set. The handshake is sent with the cookies and the common
+// headers of the client, except the navigation headers like accept and
+// sec-fetch-*.
+//
+// http3.ErrExtendedConnectNotSupported or http3.ErrDatagramNotSupported is
+// returned if the server did not enable the extended CONNECT or datagrams in
+// its settings, and an error is returned if the status code of the response
+// is not 2xx.
+func (c *Client) DialWebTransport(url string) (*WebTransportSession, error) {
+	u, err := urlpkg.Parse(url)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "https" {
+		return nil, fmt.Errorf("webtransport: unsupported scheme %q", u.Scheme)
+	}
+
+	s := &WebTransportSession{
+		ready:      make(chan struct{}),
+		streams:    make(chan *quic.Stream, webTransportStreamQueueLen),
+		uniStreams: make(chan *quic.ReceiveStream, webTransportStreamQueueLen),
+		datagrams:  make(chan []byte, webTransportStreamQueueLen),
+	}
+	s.ctx, s.cancel = context.WithCancelCause(context.Background())
+	s.t3 = c.Transport.newWebTransportTransport(s)
+
+	r := c.R().DisableAutoReadResponse()
+	r.extendedConnectProtocol = "webtransport"
+	r.webTransport = s.t3
+	r.SetHeader("Sec-Webtransport-Http3-Draft02", "1")
+	if c.Headers.Get("Origin") == "" {
+		r.SetHeader("Origin", u.Scheme+"://"+u.Host)
+	}
+	resp, err := r.Send(http.MethodConnect, u.String())
+	if err != nil {
+		s.fail(err)
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		err = fmt.Errorf("webtransport: bad handshake: %s", resp.Status)
+		s.fail(err)
+		return nil, err
+	}
+
+	body, ok := resp.Body.(*extendedConnectBody)
+	if !ok {
+		resp.Body.Close()
+		err = errors.New("webtransport: the response body is not a http3 stream")
+		s.fail(err)
+		return nil, err
+	}
+	str, ok := body.ReadCloser.(interface {
+		StreamID() quic.StreamID
+		Connection() *h3internal.Conn
+	})
+	if !ok {
+		resp.Body.Close()
+		err = errors.New("webtransport: the response body is not a http3 stream")
+		s.fail(err)
+		return nil, err
+	}
+	if settings := str.Connection().Settings(); settings == nil || !settings.EnableDatagrams {
+		resp.Body.Close()
+		s.fail(http3.ErrDatagramNotSupported)
+		return nil, http3.ErrDatagramNotSupported
+	}
+	s.resp = resp
+	s.str = body
+	s.conn = str.Connection()
+	s.id = str.StreamID()
+	close(s.ready)
+	go s.readCapsules()
+	return s, nil
+}
+
+// newWebTransportTransport returns the dedicated http3 transport of the
+// session, which shares the options of the transport and sends its http3
+// settings.
+func (t *Transport) newWebTransportTransport(s *WebTransportSession) *h3internal.Transport {
+	settings := webTransportSettings(t.http3Settings)
+	return &h3internal.Transport{
+		Options: &t.Options,
+		QUICConfig: &quic.Config{
+			KeepAlivePeriod:       10 * time.Second,
+			MaxIncomingStreams:    100,
+			MaxIncomingUniStreams: 100,
+			EnableDatagrams:       true,
+		},
+		EnableDatagrams:       settings.Datagram,
+		EnableExtendedConnect: settings.ExtendedConnect,
+		EnableGREASE:          settings.GREASE,
+		AdditionalSettings:    settings.Other,
+		MaxFrameSize:          t.maxHTTP3FrameSize,
+		UnknownFrameHandler:   t.http3UnknownFrameHandler,
+		// the connection is dedicated to the session, so all the
+		// datagrams belong to it.
+		DatagramHandler: func(_ quic.StreamID, b []byte) {
+			select {
+			case s.datagrams <- b:
+			default:
+			}
+		},
+		StreamHijacker:    s.hijackStream,
+		UniStreamHijacker: s.hijackUniStream,
+	}
+}
+
+// webTransportSettings returns the http3 settings of the WebTransport
+// connection, which are the configured settings with HTTP datagrams and
+// SETTINGS_ENABLE_WEBTRANSPORT enabled.
+func webTransportSettings(configured *http3.Settings) *http3.Settings {
+	s := configured.Clone()
+	if s == nil {
+		s = &http3.Settings{}
+	}
+	s.Datagram = true
+	hasWebTransport := false
+	for i, setting := range s.Other {
+		switch setting.ID {
+		case http3.SettingH3Datagram:
+			s.Other[i].Val = 1
+		case http3.SettingEnableWebTransport:
+			hasWebTransport = true
+		}
+	}
+	if !hasWebTransport {
+		s.Other = append(s.Other, http3.Setting{ID: http3.SettingEnableWebTransport, Val: 1})
+	}
+	return s
+}
+
+// established waits until the session is established, and reports whether
+// the stream of the session id belongs to it.
+func (s *WebTransportSession) established(r io.Reader) bool {
+	id, err := quicvarint.Read(quicvarint.NewReader(r))
+	if err != nil {
+		return false
+	}
+	<-s.ready
+	return s.conn != nil && quic.StreamID(id) == s.id
+}
+
+func (s *WebTransportSession) hijackStream(ft http3.FrameType, _ quic.ConnectionTracingID, str *quic.Stream, err error) (bool, error) {
+	if err != nil || ft != webTransportFrameType {
+		return false, nil
+	}
+	if !s.established(str) {
+		str.CancelRead(quic.StreamErrorCode(h3internal.ErrCodeStreamCreationError))
+		str.CancelWrite(quic.StreamErrorCode(h3internal.ErrCodeStreamCreationError))
+		return true, nil
+	}
+	select {
+	case s.streams <- str:
+	default:
+		str.CancelRead(quic.StreamErrorCode(h3internal.ErrCodeStreamCreationError))
+		str.CancelWrite(quic.StreamErrorCode(h3internal.ErrCodeStreamCreationError))
+	}
+	return true, nil
+}
+
+func (s *WebTransportSession) hijackUniStream(st h3internal.StreamType, _ quic.ConnectionTracingID, str *quic.ReceiveStream, err error) bool {
+	if err != nil || st != webTransportUniStreamType {
+		return false
+	}
+	if !s.established(str) {
+		return false
+	}
+	select {
+	case s.uniStreams <- str:
+		return true
+	default:
+		return false
+	}
+}
+
+// readCapsules reads the capsules of the CONNECT stream until the session is
+// closed by the server.
+func (s *WebTransportSession) readCapsules() {
+	r := quicvarint.NewReader(s.str)
+	for {
+		typ, err := quicvarint.Read(r)
+		if err != nil {
+			s.cancel(errWebTransportSessionClosed)
+			return
+		}
+		length, err := quicvarint.Read(r)
+		if err != nil {
+			s.cancel(errWebTransportSessionClosed)
+			return
+		}
+		if typ != closeWebTransportSessionCap {
+			if _, err := io.CopyN(io.Discard, r, int64(length)); err != nil {
+				s.cancel(errWebTransportSessionClosed)
+				return
+			}
+			continue
+		}
+		payload := make([]byte, length)
+		if length < 4 {
+			s.cancel(errors.New("webtransport: bad CLOSE_WEBTRANSPORT_SESSION capsule"))
+			return
+		}
+		if _, err := io.ReadFull(r, payload); err != nil {
+			s.cancel(errWebTransportSessionClosed)
+			return
+		}
+		s.cancel(&WebTransportCloseError{
+			Code:    binary.BigEndian.Uint32(payload),
+			Message: string(payload[4:]),
+		})
+		return
+	}
+}
+
+// fail releases the dedicated transport once the handshake failed.
+func (s *WebTransportSession) fail(err error) {
+	s.cancel(err)
+	close(s.ready)
+	s.t3.Close()
+}
+
+// err returns the error of the closed session.
+func (s *WebTransportSession) err() error {
+	return context.Cause(s.ctx)
+}
+
+// Response returns the response of the handshake.
+func (s *WebTransportSession) Response() *Response {
+	return s.resp
+}
+
+// CreateStream opens a bidirectional stream of the session.
+func (s *WebTransportSession) CreateStream(ctx context.Context) (*quic.Stream, error) {
+	if err := s.err(); err != nil {
+		return nil, err
+	}
+	str, err := s.conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b := quicvarint.Append(nil, webTransportFrameType)
+	b = quicvarint.Append(b, uint64(s.id))
+	if _, err := str.Write(b); err != nil {
+		str.CancelRead(quic.StreamErrorCode(h3internal.ErrCodeRequestCanceled))
+		return nil, err
+	}
+	return str, nil
+}
+
+// CreateUniStream opens a unidirectional stream of the session.
+func (s *WebTransportSession) CreateUniStream(ctx context.Context) (*quic.SendStream, error) {
+	if err := s.err(); err != nil {
+		return nil, err
+	}
+	str, err := s.conn.OpenUniStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b := quicvarint.Append(nil, webTransportUniStreamType)
+	b = quicvarint.Append(b, uint64(s.id))
+	if _, err := str.Write(b); err != nil {
+		return nil, err
+	}
+	return str, nil
+}
+
+// ReceiveStream returns the next bidirectional stream opened by the server.
+func (s *WebTransportSession) ReceiveStream(ctx context.Context) (*quic.Stream, error) {
+	select {
+	case str := <-s.streams:
+		return str, nil
+	case <-s.ctx.Done():
+		return nil, s.err()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ReceiveUniStream returns the next unidirectional stream opened by the
+// server.
+func (s *WebTransportSession) ReceiveUniStream(ctx context.Context) (*quic.ReceiveStream, error) {
+	select {
+	case str := <-s.uniStreams:
+		return str, nil
+	case <-s.ctx.Done():
+		return nil, s.err()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// SendDatagram sends a datagram of the session.
+func (s *WebTransportSession) SendDatagram(b []byte) error {
+	if err := s.err(); err != nil {
+		return err
+	}
+	return s.t3.SendDatagram(s.id, b)
+}
+
+// ReceiveDatagram returns the next datagram of the session.
+func (s *WebTransportSession) ReceiveDatagram(ctx context.Context) ([]byte, error) {
+	select {
+	case b := <-s.datagrams:
+		return b, nil
+	case <-s.ctx.Done():
+		return nil, s.err()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close closes the session with the CLOSE_WEBTRANSPORT_SESSION capsule, and
+// closes the dedicated connection of the session.
+func (s *WebTransportSession) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		b := quicvarint.Append(nil, closeWebTransportSessionCap)
+		b = quicvarint.Append(b, 4)
+		b = append(b, 0, 0, 0, 0)
+		if _, werr := s.str.Write(b); werr != nil {
+			err = werr
+		}
+		s.str.Close()
+		s.cancel(errWebTransportSessionClosed)
+		s.t3.Close()
+	})
+	return err
+}
@@ -0,0 +1,149 @@
+package req
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/imroc/req/v3/http3"
+	"github.com/imroc/req/v3/internal/testcert"
+	"github.com/imroc/req/v3/internal/tests"
+	"github.com/quic-go/quic-go"
+	quichttp3 "github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/quic-go/quicvarint"
+)
+
+type webTransportHandshake struct {
+	req      *http.Request
+	settings *quichttp3.Settings
+}
+
+// startWebTransportServer starts a http3 server which echoes the client
+// initiated bidirectional streams and the datagrams of the sessions, opens
+// an unidirectional stream with "uni", and closes the session with code 7
+// once "close" is received. The handshakes are sent to the returned channel.
+func startWebTransportServer(t *testing.T, enableDatagrams bool) (string, chan *webTransportHandshake) {
+	cert, err := tls.X509KeyPair(testcert.LocalhostCert, testcert.LocalhostKey)
+	tests.AssertNoError(t, err)
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	tests.AssertNoError(t, err)
+	handshakes := make(chan *webTransportHandshake, 1)
+	srv := &quichttp3.Server{
+		TLSConfig:          quichttp3.ConfigureTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert}}),
+		EnableDatagrams:    enableDatagrams,
+		AdditionalSettings: map[uint64]uint64{uint64(http3.SettingEnableWebTransport): 1},
+		StreamHijacker: func(ft quichttp3.FrameType, _ quic.ConnectionTracingID, str *quic.Stream, err error) (bool, error) {
+			if err != nil || ft != webTransportFrameType {
+				return false, nil
+			}
+			if _, err := quicvarint.Read(quicvarint.NewReader(str)); err != nil {
+				return false, err
+			}
+			go func() {
+				io.Copy(str, str)
+				str.Close()
+			}()
+			return true, nil
+		},
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn := w.(quichttp3.Hijacker).Connection()
+			<-conn.ReceivedSettings()
+			handshakes <- &webTransportHandshake{req: r, settings: conn.Settings()}
+			w.WriteHeader(http.StatusOK)
+			str := w.(quichttp3.HTTPStreamer).HTTPStream()
+
+			ustr, err := conn.OpenUniStreamSync(r.Context())
+			if err != nil {
+				return
+			}
+			b := quicvarint.Append(nil, webTransportUniStreamType)
+			b = quicvarint.Append(b, uint64(str.StreamID()))
+			ustr.Write(append(b, "uni"...))
+			ustr.Close()
+
+			for {
+				d, err := str.ReceiveDatagram(r.Context())
+				if err != nil {
+					return
+				}
+				if string(d) == "close" {
+					b := quicvarint.Append(nil, closeWebTransportSessionCap)
+					b = quicvarint.Append(b, 7)
+					b = binary.BigEndian.AppendUint32(b, 7)
+					str.Write(append(b, "bye"...))
+					str.Close()
+					return
+				}
+				str.SendDatagram(d)
+			}
+		}),
+	}
+	go srv.Serve(conn)
+	t.Cleanup(func() { srv.Close() })
+	return conn.LocalAddr().String(), handshakes
+}
+
+func TestDialWebTransport(t *testing.T) {
+	addr, handshakes := startWebTransportServer(t, true)
+	c := tc().SetHTTP3Settings(&http3.Settings{
+		GREASE: true,
+		Other:  []http3.Setting{{ID: 0xc671706a, Val: 1}},
+	})
+	s, err := c.DialWebTransport("https://" + addr + "/wt")
+	tests.AssertNoError(t, err)
+	defer s.Close()
+
+	hs := <-handshakes
+	tests.AssertEqual(t, "webtransport", hs.req.Proto)
+	tests.AssertEqual(t, "/wt", hs.req.URL.Path)
+	tests.AssertEqual(t, "1", hs.req.Header.Get("Sec-Webtransport-Http3-Draft02"))
+	tests.AssertEqual(t, "https://"+addr, hs.req.Header.Get("Origin"))
+	tests.AssertEqual(t, true, hs.settings.EnableDatagrams)
+	tests.AssertEqual(t, uint64(1), hs.settings.Other[0xc671706a])
+	tests.AssertEqual(t, uint64(1), hs.settings.Other[uint64(http3.SettingEnableWebTransport)])
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	str, err := s.CreateStream(ctx)
+	tests.AssertNoError(t, err)
+	_, err = str.Write([]byte("hello"))
+	tests.AssertNoError(t, err)
+	str.Close()
+	b, err := io.ReadAll(str)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "hello", string(b))
+
+	ustr, err := s.ReceiveUniStream(ctx)
+	tests.AssertNoError(t, err)
+	b, err = io.ReadAll(ustr)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "uni", string(b))
+
+	tests.AssertNoError(t, s.SendDatagram([]byte("datagram")))
+	b, err = s.ReceiveDatagram(ctx)
+	tests.AssertNoError(t, err)
+	tests.AssertEqual(t, "datagram", string(b))
+
+	tests.AssertNoError(t, s.SendDatagram([]byte("close")))
+	_, err = s.ReceiveDatagram(ctx)
+	var closeErr *WebTransportCloseError
+	tests.AssertEqual(t, true, errors.As(err, &closeErr))
+	tests.AssertEqual(t, uint32(7), closeErr.Code)
+	tests.AssertEqual(t, "bye", closeErr.Message)
+}
+
+func TestDialWebTransportWithoutDatagrams(t *testing.T) {
+	addr, _ := startWebTransportServer(t, false)
+	_, err := tc().DialWebTransport("https://" + addr)
+	tests.AssertEqual(t, true, errors.Is(err, http3.ErrDatagramNotSupported))
+
+	_, err = tc().DialWebTransport("http://" + addr)
+	tests.AssertErrorContains(t, err, "unsupported scheme")
+}